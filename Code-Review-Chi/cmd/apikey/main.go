@@ -0,0 +1,92 @@
+package main
+
+import (
+	"app/internal/auth"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// apikey is a command that mints, revokes and lists the API keys of the server (see api_keys_path)
+// - usage: apikey -file keys.json mint -name ci -scopes read,write (admin also grants the admin routes)
+// - usage: apikey -file keys.json revoke -id 3f2a9c1b5e7d0a46
+// - usage: apikey -file keys.json list
+func main() {
+	// flags
+	file := flag.String("file", "keys.json", "path to the API keys file, created if it does not exist")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: apikey [-file keys.json] mint|revoke|list [flags]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(*file, flag.Args(), os.Stdout); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run is a function that runs the subcommand of args on the keys stored at file
+func run(file string, args []string, out io.Writer) (err error) {
+	if len(args) == 0 {
+		flag.Usage()
+		return flag.ErrHelp
+	}
+	keys, err := auth.OpenAPIKeyFile(file)
+	if err != nil {
+		return
+	}
+
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	switch args[0] {
+	case "mint":
+		name := fs.String("name", "", "name of the holder of the key, e.g. ci")
+		scopes := fs.String("scopes", string(auth.ScopeRead), "comma-separated scopes of the key: read, write")
+		if err = fs.Parse(args[1:]); err != nil {
+			return
+		}
+		if *name == "" {
+			return errors.New("mint: -name is required")
+		}
+		var s []auth.Scope
+		if s, err = auth.ParseScopes(*scopes); err != nil {
+			return
+		}
+		var key string
+		var k auth.APIKey
+		if key, k, err = keys.Mint(*name, s); err != nil {
+			return
+		}
+		fmt.Fprintf(out, "minted key %s for %s with scopes %v, it is not shown again:\n%s\n", k.ID, k.Name, k.Scopes, key)
+	case "revoke":
+		id := fs.String("id", "", "id of the key, see list")
+		if err = fs.Parse(args[1:]); err != nil {
+			return
+		}
+		if err = keys.Revoke(*id); err != nil {
+			return
+		}
+		fmt.Fprintf(out, "revoked key %s\n", *id)
+	case "list":
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tSCOPES\tCREATED\tREVOKED")
+		for _, k := range keys.Keys() {
+			revoked := "-"
+			if k.RevokedAt != nil {
+				revoked = k.RevokedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%v\t%s\t%s\n", k.ID, k.Name, k.Scopes, k.CreatedAt.Format(time.RFC3339), revoked)
+		}
+		err = tw.Flush()
+	default:
+		err = fmt.Errorf("unknown subcommand %q: mint, revoke or list", args[0])
+	}
+	return
+}
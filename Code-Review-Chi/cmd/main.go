@@ -2,23 +2,32 @@ package main
 
 import (
 	"app/internal/application"
+	"errors"
+	"flag"
 	"fmt"
+	"os"
 )
 
+// main is the entry point of the vehicles server
+// - the configuration is layered: defaults, config file, environment variables and flags (see application.LoadConfigServerChi)
+// - usage: main -config vehicles.yaml
+// - usage: VEHICLES_DATA_SOURCE=../docs/db/vehicles_100.json main -address :9090 -auth-disabled true
+// - the server refuses to start without API keys nor token keys unless auth_disabled is set (development only)
 func main() {
-	// env
-	// ...
-
 	// app
 	// - config
-	cfg := &application.ConfigServerChi{
-		ServerAddress:  ":8080",
-		LoaderFilePath: "../docs/db/vehicles_100.json",
+	cfg, err := application.LoadConfigServerChi(os.Args[0], os.Args[1:], os.LookupEnv)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
 	app := application.NewServerChi(cfg)
 	// - run
 	if err := app.Run(); err != nil {
-		fmt.Println(err)
-		return
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-}
+}
\ No newline at end of file
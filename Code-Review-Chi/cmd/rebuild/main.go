@@ -0,0 +1,54 @@
+package main
+
+import (
+	"app/internal/repository"
+	"app/internal/service"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// rebuild is a command that rebuilds the read model of the event-sourced mode from the event log
+// - the read model is emptied and every event is projected again, the server must not be running
+// - usage: rebuild -events vehicles.events.jsonl -dsn sqlite:///vehicles.db
+func main() {
+	// flags
+	events := flag.String("events", "vehicles.events.jsonl", "path to the event log")
+	dsn := flag.String("dsn", "", "DSN of the read model, e.g. jsonfile:///vehicles.json or sqlite:///vehicles.db")
+	flag.Parse()
+
+	if err := run(*events, *dsn); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run is a function that projects the events at path into the repository of dsn
+func run(path, dsn string) (err error) {
+	ctx := context.Background()
+	es, err := repository.OpenVehicleEventLog(path)
+	if err != nil {
+		return
+	}
+	defer es.Close()
+
+	rp, err := repository.Open(dsn, nil)
+	if err != nil {
+		return
+	}
+	if closer, ok := rp.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	if err = service.NewVehicleEventSourced(es, rp).Rebuild(ctx); err != nil {
+		return
+	}
+	v, err := rp.FindAll(ctx)
+	if err != nil {
+		return
+	}
+	fmt.Printf("rebuilt %d vehicles from %s into %s\n", len(v), path, dsn)
+	return
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"app/internal"
+	"app/internal/loader"
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// snapshot is a command that converts the vehicles dataset between the JSON and the binary snapshot formats
+// - the format of the input is detected by its content, the format of the output by its extension (.snap is binary)
+// - usage: snapshot -in ../docs/db/vehicles_100.json -out vehicles.snap
+// - usage: snapshot -in vehicles.snap -out vehicles.json.gz
+func main() {
+	// flags
+	in := flag.String("in", "../docs/db/vehicles_100.json", "path to the input dataset (JSON, plain, gzip or zstd compressed, or binary snapshot)")
+	out := flag.String("out", "vehicles.snap", "path to the output dataset, binary snapshot if it ends in .snap, JSON otherwise")
+	flag.Parse()
+
+	if err := run(*in, *out); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run is a function that converts the dataset at in into the dataset at out
+func run(in, out string) (err error) {
+	// - input
+	data, err := os.ReadFile(in)
+	if err != nil {
+		return
+	}
+	var v map[int]internal.Vehicle
+	src := loader.SnapshotSource{}
+	switch {
+	case loader.IsSnapshot(data):
+		v, _, err = loader.DecodeVehiclesSnapshot(data)
+	default:
+		if v, err = loader.DecodeVehicles(bytes.NewReader(data)); err != nil {
+			return
+		}
+		// the snapshot of a JSON input is fresh for that input
+		src, err = loader.StatSnapshotSource(in)
+	}
+	if err != nil {
+		return
+	}
+
+	// - output
+	switch filepath.Ext(out) {
+	case ".snap":
+		err = loader.NewVehicleSnapshotFile(out, in).Dump(v, src)
+	default:
+		err = loader.NewVehicleJSONFile(out).Dump(v)
+	}
+	if err != nil {
+		return
+	}
+	fmt.Printf("converted %d vehicles from %s to %s\n", len(v), in, out)
+	return
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"app/internal"
+	"app/internal/loader"
+	"app/internal/repository"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// sqlite-import is a one-shot command that imports the vehicles of a dataset into a SQLite database
+// - usage: sqlite-import -src ../docs/db/vehicles_100.json -db vehicles.db
+func main() {
+	// flags
+	src := flag.String("src", "../docs/db/vehicles_100.json", "path (or http(s) URL) to the vehicles dataset in JSON format")
+	dst := flag.String("db", "vehicles.db", "path to the SQLite database, it is created if it does not exist")
+	flag.Parse()
+
+	if err := run(*src, *dst); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run is a function that imports the dataset at src into the database at dst
+func run(src, dst string) (err error) {
+	// - loader
+	var ld internal.VehicleLoader = loader.NewVehicleJSONFile(src)
+	if loader.IsURL(src) {
+		ld = loader.NewVehicleHTTP(src, nil)
+	}
+	v, err := ld.Load()
+	if err != nil {
+		return
+	}
+
+	// - repository
+	rp, err := repository.OpenVehicleSQLite(dst)
+	if err != nil {
+		return
+	}
+	defer rp.Close()
+
+	// - import
+	if err = rp.Import(context.Background(), v); err != nil {
+		return
+	}
+	fmt.Printf("imported %d vehicles into %s\n", len(v), dst)
+	return
+}
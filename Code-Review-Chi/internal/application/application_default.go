@@ -1,42 +1,221 @@
 package application
 
 import (
+	"app/internal"
+	"app/internal/auth"
 	"app/internal/handler"
 	"app/internal/loader"
 	"app/internal/repository"
 	"app/internal/service"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
+// Version is the version of the release, set at build time with -ldflags "-X app/internal/application.Version=1.2.3"
+var Version = "dev"
+
+// buildInfo is a function that returns the build of the running binary
+func buildInfo() (b handler.BuildInfo) {
+	b.Version = Version
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	b.GoVersion = info.GoVersion
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			b.Revision = setting.Value
+		}
+	}
+	return
+}
+
 // ConfigServerChi is a struct that represents the configuration for ServerChi
 type ConfigServerChi struct {
 	// ServerAddress is the address where the server will be listening
 	ServerAddress string
-	// LoaderFilePath is the path to the file that contains the vehicles
+	// RequestTimeout is the maximum duration of a request, its context is canceled afterwards and it responds 504
+	RequestTimeout time.Duration
+	// ReadHeaderTimeout is the maximum duration to read the headers of a request
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout is the maximum duration to read a whole request, body included
+	ReadTimeout time.Duration
+	// WriteTimeout is the maximum duration from the end of the headers of a request to the end of its response
+	// - it should be longer than RequestTimeout, otherwise the 504 of a timed out request is never written
+	WriteTimeout time.Duration
+	// IdleTimeout is the maximum duration a keep-alive connection waits for the next request
+	IdleTimeout time.Duration
+	// MaxHeaderBytes is the maximum size of the headers of a request
+	MaxHeaderBytes int
+	// ShutdownTimeout is the maximum duration to drain the in-flight requests on SIGTERM/SIGINT
+	// - the remaining connections are closed afterwards
+	ShutdownTimeout time.Duration
+	// LoaderFilePath is the path to the file that contains the vehicles (plain, gzip or zstd compressed)
+	// - it may also be an http(s) URL to a published dataset
 	LoaderFilePath string
+	// LoaderCachePath is the path to the local cache of a dataset loaded from an http(s) URL
+	LoaderCachePath string
+	// LoaderTimeout is the maximum duration of a request to a dataset loaded from an http(s) URL
+	LoaderTimeout time.Duration
+	// LoaderSnapshotPath is the path to a binary snapshot of the dataset, read instead of the JSON file on start
+	// - it is rewritten from the JSON file when missing, stale or corrupt, it is ignored for http(s) URLs
+	LoaderSnapshotPath string
+	// RepositoryDSN selects the repository driver and its options, e.g. memory://, jsonfile:///path, sqlite:///path
+	// - the loader seeds the repository (see the driver of each backend)
+	RepositoryDSN string
+	// EventStorePath is the path to the event log of the vehicles, it enables the event-sourced mode
+	// - the repository is the read model, rebuilt from the events on start
+	// - an empty event log is seeded with the vehicles of the repository
+	EventStorePath string
+	// LogLevel is the minimum level of the logs, one of LogLevels
+	// - the requests are logged at the info level
+	LogLevel string
+	// LogOutput is where the logs are written in JSON format: stderr, stdout or the path to a file, appended to
+	LogOutput string
+	// APIKeysPath is the path to the API keys (see cmd/apikey), it enables the authentication of /vehicles
+	// - queries require the scope read and writes the scope write
+	APIKeysPath string
+	// JWTHS256SecretPath is the path to the shared secret of the HS256 bearer tokens, it enables their authentication
+	// - the roles of the tokens grant the scopes (see auth.RoleScopes), admin also grants the admin routes and GET /metrics
+	JWTHS256SecretPath string
+	// JWTRS256PublicKeyPath is the path to the PEM public key of the RS256 bearer tokens, it enables their authentication
+	JWTRS256PublicKeyPath string
+	// JWTIssuer is the issuer (iss) required of the bearer tokens, empty to accept any
+	JWTIssuer string
+	// JWTAudience is the audience (aud) required of the bearer tokens, empty to accept any
+	JWTAudience string
+	// AuthDisabled serves /vehicles and /metrics without authentication, for development only
+	// - without it the server refuses to start unless API keys or token keys are configured
+	AuthDisabled bool
+}
+
+// DefaultConfigServerChi is a function that returns the default configuration of ServerChi
+func DefaultConfigServerChi() *ConfigServerChi {
+	return &ConfigServerChi{
+		ServerAddress:     ":8080",
+		RequestTimeout:    30 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      45 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		MaxHeaderBytes:    1 << 20,
+		ShutdownTimeout:   20 * time.Second,
+		RepositoryDSN:     "memory://",
+		LogLevel:          "info",
+		LogOutput:         "stderr",
+	}
 }
 
 // NewServerChi is a function that returns a new instance of ServerChi
 func NewServerChi(cfg *ConfigServerChi) *ServerChi {
 	// default values
-	defaultConfig := &ConfigServerChi{
-		ServerAddress: ":8080",
-	}
+	defaultConfig := DefaultConfigServerChi()
 	if cfg != nil {
 		if cfg.ServerAddress != "" {
 			defaultConfig.ServerAddress = cfg.ServerAddress
 		}
+		if cfg.RequestTimeout != 0 {
+			defaultConfig.RequestTimeout = cfg.RequestTimeout
+		}
+		if cfg.ReadHeaderTimeout != 0 {
+			defaultConfig.ReadHeaderTimeout = cfg.ReadHeaderTimeout
+		}
+		if cfg.ReadTimeout != 0 {
+			defaultConfig.ReadTimeout = cfg.ReadTimeout
+		}
+		if cfg.WriteTimeout != 0 {
+			defaultConfig.WriteTimeout = cfg.WriteTimeout
+		}
+		if cfg.IdleTimeout != 0 {
+			defaultConfig.IdleTimeout = cfg.IdleTimeout
+		}
+		if cfg.MaxHeaderBytes != 0 {
+			defaultConfig.MaxHeaderBytes = cfg.MaxHeaderBytes
+		}
+		if cfg.ShutdownTimeout != 0 {
+			defaultConfig.ShutdownTimeout = cfg.ShutdownTimeout
+		}
 		if cfg.LoaderFilePath != "" {
 			defaultConfig.LoaderFilePath = cfg.LoaderFilePath
 		}
+		if cfg.LoaderCachePath != "" {
+			defaultConfig.LoaderCachePath = cfg.LoaderCachePath
+		}
+		if cfg.LoaderTimeout != 0 {
+			defaultConfig.LoaderTimeout = cfg.LoaderTimeout
+		}
+		if cfg.LoaderSnapshotPath != "" {
+			defaultConfig.LoaderSnapshotPath = cfg.LoaderSnapshotPath
+		}
+		if cfg.RepositoryDSN != "" {
+			defaultConfig.RepositoryDSN = cfg.RepositoryDSN
+		}
+		if cfg.EventStorePath != "" {
+			defaultConfig.EventStorePath = cfg.EventStorePath
+		}
+		if cfg.LogLevel != "" {
+			defaultConfig.LogLevel = cfg.LogLevel
+		}
+		if cfg.LogOutput != "" {
+			defaultConfig.LogOutput = cfg.LogOutput
+		}
+		if cfg.APIKeysPath != "" {
+			defaultConfig.APIKeysPath = cfg.APIKeysPath
+		}
+		if cfg.JWTHS256SecretPath != "" {
+			defaultConfig.JWTHS256SecretPath = cfg.JWTHS256SecretPath
+		}
+		if cfg.JWTRS256PublicKeyPath != "" {
+			defaultConfig.JWTRS256PublicKeyPath = cfg.JWTRS256PublicKeyPath
+		}
+		if cfg.JWTIssuer != "" {
+			defaultConfig.JWTIssuer = cfg.JWTIssuer
+		}
+		if cfg.JWTAudience != "" {
+			defaultConfig.JWTAudience = cfg.JWTAudience
+		}
+		if cfg.AuthDisabled {
+			defaultConfig.AuthDisabled = cfg.AuthDisabled
+		}
 	}
 
 	return &ServerChi{
-		serverAddress:  defaultConfig.ServerAddress,
-		loaderFilePath: defaultConfig.LoaderFilePath,
+		serverAddress:         defaultConfig.ServerAddress,
+		requestTimeout:        defaultConfig.RequestTimeout,
+		readHeaderTimeout:     defaultConfig.ReadHeaderTimeout,
+		readTimeout:           defaultConfig.ReadTimeout,
+		writeTimeout:          defaultConfig.WriteTimeout,
+		idleTimeout:           defaultConfig.IdleTimeout,
+		maxHeaderBytes:        defaultConfig.MaxHeaderBytes,
+		shutdownTimeout:       defaultConfig.ShutdownTimeout,
+		loaderFilePath:        defaultConfig.LoaderFilePath,
+		loaderCachePath:       defaultConfig.LoaderCachePath,
+		loaderTimeout:         defaultConfig.LoaderTimeout,
+		loaderSnapshotPath:    defaultConfig.LoaderSnapshotPath,
+		repositoryDSN:         defaultConfig.RepositoryDSN,
+		eventStorePath:        defaultConfig.EventStorePath,
+		logLevel:              defaultConfig.LogLevel,
+		logOutput:             defaultConfig.LogOutput,
+		apiKeysPath:           defaultConfig.APIKeysPath,
+		jwtHS256SecretPath:    defaultConfig.JWTHS256SecretPath,
+		jwtRS256PublicKeyPath: defaultConfig.JWTRS256PublicKeyPath,
+		jwtIssuer:             defaultConfig.JWTIssuer,
+		jwtAudience:           defaultConfig.JWTAudience,
+		authDisabled:          defaultConfig.AuthDisabled,
 	}
 }
 
@@ -44,47 +223,364 @@ func NewServerChi(cfg *ConfigServerChi) *ServerChi {
 type ServerChi struct {
 	// serverAddress is the address where the server will be listening
 	serverAddress string
-	// loaderFilePath is the path to the file that contains the vehicles
+	// requestTimeout is the maximum duration of a request
+	requestTimeout time.Duration
+	// readHeaderTimeout is the maximum duration to read the headers of a request
+	readHeaderTimeout time.Duration
+	// readTimeout is the maximum duration to read a whole request
+	readTimeout time.Duration
+	// writeTimeout is the maximum duration to write a response
+	writeTimeout time.Duration
+	// idleTimeout is the maximum duration a keep-alive connection waits for the next request
+	idleTimeout time.Duration
+	// maxHeaderBytes is the maximum size of the headers of a request
+	maxHeaderBytes int
+	// shutdownTimeout is the maximum duration to drain the in-flight requests on shutdown
+	shutdownTimeout time.Duration
+	// loaderFilePath is the path to the file (or URL) that contains the vehicles
 	loaderFilePath string
+	// loaderCachePath is the path to the local cache of a dataset loaded from an http(s) URL
+	loaderCachePath string
+	// loaderTimeout is the maximum duration of a request to a dataset loaded from an http(s) URL
+	loaderTimeout time.Duration
+	// loaderSnapshotPath is the path to a binary snapshot of the dataset
+	loaderSnapshotPath string
+	// repositoryDSN selects the repository driver and its options
+	repositoryDSN string
+	// eventStorePath is the path to the event log of the vehicles, empty if the mode is not event-sourced
+	eventStorePath string
+	// logLevel is the minimum level of the logs
+	logLevel string
+	// logOutput is where the logs are written
+	logOutput string
+	// apiKeysPath is the path to the API keys, empty if /vehicles is not authenticated
+	apiKeysPath string
+	// jwtHS256SecretPath is the path to the secret of the HS256 bearer tokens, empty to reject them
+	jwtHS256SecretPath string
+	// jwtRS256PublicKeyPath is the path to the public key of the RS256 bearer tokens, empty to reject them
+	jwtRS256PublicKeyPath string
+	// jwtIssuer is the issuer required of the bearer tokens
+	jwtIssuer string
+	// jwtAudience is the audience required of the bearer tokens
+	jwtAudience string
+	// authDisabled is true if the server may run without authentication
+	authDisabled bool
+}
+
+// jwtVerifier is a method that returns the verifier of the bearer tokens, nil if no key is configured
+func (a *ServerChi) jwtVerifier() (v *auth.JWTVerifier, err error) {
+	if a.jwtHS256SecretPath == "" && a.jwtRS256PublicKeyPath == "" {
+		return
+	}
+	cfg := auth.ConfigJWTVerifier{
+		Issuer:   a.jwtIssuer,
+		Audience: a.jwtAudience,
+		Leeway:   jwtLeeway,
+	}
+	if a.jwtHS256SecretPath != "" {
+		var secret []byte
+		if secret, err = os.ReadFile(a.jwtHS256SecretPath); err != nil {
+			return
+		}
+		cfg.HS256Secret = bytes.TrimSpace(secret)
+	}
+	if a.jwtRS256PublicKeyPath != "" {
+		var data []byte
+		if data, err = os.ReadFile(a.jwtRS256PublicKeyPath); err != nil {
+			return
+		}
+		if cfg.RS256PublicKey, err = auth.ParseRSAPublicKey(data); err != nil {
+			err = fmt.Errorf("jwt_rs256_public_key_path: %w", err)
+			return
+		}
+	}
+	v, err = auth.NewJWTVerifier(cfg)
+	return
+}
+
+// jwtLeeway is the clock skew tolerated between the issuer of the bearer tokens and the server
+const jwtLeeway = 30 * time.Second
+
+// logger is a method that returns the JSON logger of the application, with the closer of its output
+func (a *ServerChi) logger() (logger *slog.Logger, closer io.Closer, err error) {
+	var level slog.Level
+	if err = level.UnmarshalText([]byte(a.logLevel)); err != nil {
+		return
+	}
+
+	var out io.Writer
+	switch a.logOutput {
+	case "stderr":
+		out = os.Stderr
+	case "stdout":
+		out = os.Stdout
+	default:
+		var f *os.File
+		if f, err = os.OpenFile(a.logOutput, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644); err != nil {
+			return
+		}
+		out, closer = f, f
+	}
+	logger = slog.New(slog.NewJSONHandler(out, &slog.HandlerOptions{Level: level}))
+	return
 }
 
 // Run is a method that runs the application
+// - on SIGTERM/SIGINT it stops accepting connections, drains the in-flight requests and closes the repository
 func (a *ServerChi) Run() (err error) {
+	// signals
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// logger, also the default one of the code without a request context
+	logger, logCloser, err := a.logger()
+	if err != nil {
+		return
+	}
+	if logCloser != nil {
+		defer logCloser.Close()
+	}
+	slog.SetDefault(logger)
+	ctx = internal.ContextWithLogger(ctx, logger)
+	// health and metrics
+	hh := handler.NewHealth(buildInfo())
+	mt := newServerMetrics()
+
 	// dependencies
 	// - loader
-	ld := loader.NewVehicleJSONFile(a.loaderFilePath)
-	db, err := ld.Load()
+	var ld internal.VehicleLoader
+	switch {
+	case loader.IsURL(a.loaderFilePath):
+		ld = loader.NewVehicleHTTP(a.loaderFilePath, &loader.ConfigVehicleHTTP{
+			CachePath: a.loaderCachePath,
+			Timeout:   a.loaderTimeout,
+		})
+	case a.loaderSnapshotPath != "":
+		ld = loader.NewVehicleSnapshotFile(a.loaderSnapshotPath, a.loaderFilePath)
+	default:
+		ld = loader.NewVehicleJSONFile(a.loaderFilePath)
+	}
+	ld = loader.NewVehicleObserved(ld, mt.observeLoad)
+	// - repository
+	loadStart := time.Now()
+	rp, err := repository.Open(a.repositoryDSN, ld)
 	if err != nil {
 		return
 	}
-	// - repository
-	rp := repository.NewVehicleMap(db)
-	// - service
-	sv := service.NewVehicleDefault(rp)
+	// - persistent repositories are flushed on close, after the server is drained (see serve)
+	var closers []io.Closer
+	defer func() {
+		err = errors.Join(err, closeAll(closers))
+	}()
+	if closer, ok := rp.(io.Closer); ok {
+		closers = append(closers, closer)
+	}
+	mt.datasetSize(rp)
+	// - service, its operations on the repository are timed
+	orp := repository.NewVehicleObserved(rp, mt.observeRepository)
+	var sv internal.VehicleService = service.NewVehicleDefault(orp)
+	if a.eventStorePath != "" {
+		var es *repository.VehicleEventLog
+		es, err = repository.OpenVehicleEventLog(a.eventStorePath)
+		if err != nil {
+			return
+		}
+		closers = append(closers, es)
+		esv := service.NewVehicleEventSourced(es, orp)
+		if err = esv.Rebuild(ctx); err != nil {
+			return
+		}
+		sv = esv
+	}
+	// - ready once the dataset is loaded
+	v, err := sv.FindAll(ctx)
+	if err != nil {
+		return
+	}
+	dataset := handler.DatasetInfo{
+		Source:       a.loaderFilePath,
+		Vehicles:     len(v),
+		LoadedAt:     time.Now(),
+		LoadDuration: time.Since(loadStart),
+	}
+	hh.SetReady(rp, dataset)
+	logger.Info("dataset loaded",
+		slog.String("source", dataset.Source),
+		slog.String("repository", a.repositoryDSN),
+		slog.Int("vehicles", dataset.Vehicles),
+		slog.Duration("duration", dataset.LoadDuration),
+	)
+	// - authentication, every route is open only if it is disabled explicitly
+	scope := func(s auth.Scope) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	var keys *auth.APIKeyFile
+	if a.apiKeysPath != "" {
+		if keys, err = auth.OpenAPIKeyFile(a.apiKeysPath); err != nil {
+			return
+		}
+	}
+	tokens, err := a.jwtVerifier()
+	if err != nil {
+		return
+	}
+	authenticated := keys != nil || tokens != nil
+	switch {
+	case authenticated:
+		scope = handler.RequireScope
+	case !a.authDisabled:
+		err = ErrAuthRequired
+		return
+	default:
+		logger.Warn("authentication disabled, /vehicles and /metrics are not authenticated and /admin is disabled")
+	}
 	// - handler
 	hd := handler.NewVehicleDefault(sv)
 	// router
 	rt := chi.NewRouter()
 	// - middlewares
-	rt.Use(middleware.Logger)
-	rt.Use(middleware.Recoverer)
+	rt.Use(handler.RequestID)
+	rt.Use(handler.Logger(logger))
+	rt.Use(handler.Instrument(mt.requests, mt.requestDurations))
+	rt.Use(handler.Recoverer)
+	rt.Use(middleware.Timeout(a.requestTimeout))
 	// - endpoints
+	rt.Get("/healthz", hh.Healthz())
+	rt.Get("/readyz", hh.Readyz())
+	rt.Get("/info", hh.Info())
+	// - GET /metrics, scope admin when authenticated
+	if authenticated {
+		rt.Method(http.MethodGet, "/metrics", adminOnly(mt.registry, keys, tokens))
+	} else {
+		rt.Method(http.MethodGet, "/metrics", mt.registry)
+	}
 	rt.Route("/vehicles", func(rt chi.Router) {
-		// - GET /vehicles
-		rt.Get("/", hd.GetAll())
-		rt.Get("/color/{color}/year/{year}", hd.GetByColorYear())
-		rt.Get("/brand/{brand}/between/{startYear}/{endYear}", hd.GetByBrandYearRange())
-		rt.Get("/average_speed/brand/{brand}", hd.GetByBrandAverageSpeed())
-		rt.Get("/fuel_type/{type}", hd.GetByFuelType())
-		rt.Get("/transmission/{type}", hd.GetByTransmissionType())
-		rt.Get("/average_capacity/brand/{brand}", hd.GetByBrandAverageCapacity())
-		rt.Get("/weight", hd.GetByWeightRange())
-		rt.Get("/dimensions", hd.GetByDimensionRange())
-		// - POST /vehicles
-		rt.Post("/add", hd.Save())
+		// - content negotiation
+		rt.Use(handler.Negotiate)
+		// - points in time (as_of) are read-only
+		rt.Use(handler.ReadOnlyAsOf)
+		// - authentication
+		if authenticated {
+			rt.Use(handler.Authenticate(keys, tokens))
+		}
+		// - actor of the writes
+		rt.Use(handler.Actor)
+		// - queries, scope read
+		rt.Group(func(rt chi.Router) {
+			rt.Use(scope(auth.ScopeRead))
+			// - GET /vehicles
+			rt.Get("/", hd.GetAll())
+			rt.Get("/color/{color}/year/{year}", hd.GetByColorYear())
+			rt.Get("/brand/{brand}/between/{startYear}/{endYear}", hd.GetByBrandYearRange())
+			rt.Get("/average_speed/brand/{brand}", hd.GetByBrandAverageSpeed())
+			rt.Get("/fuel_type/{type}", hd.GetByFuelType())
+			rt.Get("/transmission/{type}", hd.GetByTransmissionType())
+			rt.Get("/average_capacity/brand/{brand}", hd.GetByBrandAverageCapacity())
+			rt.Get("/weight", hd.GetByWeightRange())
+			rt.Get("/dimensions", hd.GetByDimensionRange())
+			rt.Get("/{id}", hd.GetById())
+			rt.Get("/{id}/history", hd.GetHistory())
+		})
+		// - writes, scope write
+		rt.Group(func(rt chi.Router) {
+			rt.Use(scope(auth.ScopeWrite))
+			// - POST /vehicles
+			rt.Post("/add", hd.Save())
+			rt.Post("/import", hd.Import())
+			// - /vehicles/{id}, writes require If-Match with the ETag of the current version
+			rt.Put("/{id}", hd.Update())
+			rt.Patch("/{id}", hd.Patch())
+			rt.Delete("/{id}", hd.Delete())
+		})
 	})
+	// - admin routes, scope admin, only served when authenticated
+	if authenticated {
+		rt.Route("/admin", func(rt chi.Router) {
+			rt.Use(handler.Authenticate(keys, tokens))
+			rt.Use(handler.RequireScope(auth.ScopeAdmin))
+			rt.Use(handler.Actor)
+			// - POST /admin/rebuild, event-sourced mode only
+			if rb, ok := sv.(handler.Rebuilder); ok {
+				rt.Post("/rebuild", handler.Rebuild(rb))
+			}
+		})
+	}
+
+	// server
+	srv := &http.Server{
+		Addr:              a.serverAddress,
+		Handler:           rt,
+		ReadHeaderTimeout: a.readHeaderTimeout,
+		ReadTimeout:       a.readTimeout,
+		WriteTimeout:      a.writeTimeout,
+		IdleTimeout:       a.idleTimeout,
+		MaxHeaderBytes:    a.maxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
 
 	// run server
-	err = http.ListenAndServe(a.serverAddress, rt)
+	ln, err := net.Listen("tcp", a.serverAddress)
+	if err != nil {
+		return
+	}
+	// - a second signal is not caught anymore, it kills the process
+	// - GET /readyz fails while draining
+	draining := func() {
+		stop()
+		hh.SetDraining()
+	}
+	// - from now on the closers are closed by serve
+	err, closers = a.serve(ctx, srv, ln, draining, closers...), nil
+	return
+}
+
+// serve is a method that serves srv on ln until ctx is done, then shuts it down gracefully
+// - draining is called once ctx is done, before the in-flight requests are drained
+// - the closers are closed once the server is stopped, in reverse order, even if it failed
+func (a *ServerChi) serve(ctx context.Context, srv *http.Server, ln net.Listener, draining func(), closers ...io.Closer) (err error) {
+	defer func() {
+		err = errors.Join(err, closeAll(closers))
+	}()
+	logger := internal.LoggerFromContext(ctx)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(ln)
+	}()
+	logger.Info("server listening", slog.String("address", ln.Addr().String()))
+	select {
+	case err = <-errc:
+		return
+	case <-ctx.Done():
+	}
+
+	// graceful shutdown
+	draining()
+	logger.Info("shutting down, draining the in-flight requests", slog.Duration("timeout", a.shutdownTimeout))
+	err = a.shutdown(srv)
+	return
+}
+
+// shutdown is a method that drains the in-flight requests of srv within the shutdown timeout
+// - the connections still open once the timeout expires are closed
+func (a *ServerChi) shutdown(srv *http.Server) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), a.shutdownTimeout)
+	defer cancel()
+
+	if err = srv.Shutdown(ctx); err != nil {
+		err = errors.Join(err, srv.Close())
+	}
+	return
+}
+
+// adminOnly is a function that returns next behind the authentication of keys and tokens and the scope admin
+func adminOnly(next http.Handler, keys *auth.APIKeyFile, tokens *auth.JWTVerifier) http.Handler {
+	return handler.Authenticate(keys, tokens)(handler.RequireScope(auth.ScopeAdmin)(next))
+}
+
+// closeAll is a function that closes the closers in reverse order, like deferred calls, joining their errors
+func closeAll(closers []io.Closer) (err error) {
+	for i := len(closers) - 1; i >= 0; i-- {
+		err = errors.Join(err, closers[i].Close())
+	}
 	return
 }
@@ -0,0 +1,186 @@
+package application
+
+import (
+	"app/internal/auth"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// closerFunc is a function that implements the io.Closer interface
+type closerFunc func() error
+
+// Close is a method that calls the function
+func (f closerFunc) Close() error { return f() }
+
+// inFlightServer is a function that returns a server whose requests block until release is closed
+// - started receives a value once a request is being served, done is set once it was answered
+func inFlightServer() (srv *http.Server, started chan struct{}, release chan struct{}, done *atomic.Bool) {
+	started, release, done = make(chan struct{}, 1), make(chan struct{}), &atomic.Bool{}
+	srv = &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		w.Write([]byte("done"))
+		done.Store(true)
+	})}
+	return
+}
+
+// get is a function that requests url in the background, the result is sent to the returned channel
+func get(url string) <-chan error {
+	errc := make(chan error, 1)
+	go func() {
+		res, err := http.Get(url)
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err == nil && string(body) != "done" {
+			err = errors.New("unexpected body " + string(body))
+		}
+		errc <- err
+	}()
+	return errc
+}
+
+// Tests for adminOnly
+func TestAdminOnly(t *testing.T) {
+	t.Run("case 1: should only let the principals granted the scope admin read the metrics", func(t *testing.T) {
+		// arrange
+		keys, err := auth.OpenAPIKeyFile(filepath.Join(t.TempDir(), "apikeys.json"))
+		require.NoError(t, err)
+		adminKey, _, err := keys.Mint("ops", []auth.Scope{auth.ScopeAdmin})
+		require.NoError(t, err)
+		readKey, _, err := keys.Mint("reader", []auth.Scope{auth.ScopeRead})
+		require.NoError(t, err)
+		mt := newServerMetrics()
+		hd := adminOnly(mt.registry, keys, nil)
+		status := func(key string) int {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if key != "" {
+				req.Header.Set("X-API-Key", key)
+			}
+			res := httptest.NewRecorder()
+			hd.ServeHTTP(res, req)
+			return res.Code
+		}
+
+		// act
+		anonymous, reader, admin := status(""), status(readKey), status(adminKey)
+
+		// assert
+		require.Equal(t, http.StatusUnauthorized, anonymous)
+		require.Equal(t, http.StatusForbidden, reader)
+		require.Equal(t, http.StatusOK, admin)
+	})
+}
+
+// Tests for ServerChi.serve
+func TestServerChi_Serve(t *testing.T) {
+	t.Run("case 1: should drain an in-flight request before closing", func(t *testing.T) {
+		// arrange
+		a := &ServerChi{shutdownTimeout: 5 * time.Second}
+		srv, started, release, done := inFlightServer()
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var drained, closedAfterDone atomic.Bool
+		draining := func() {
+			drained.Store(true)
+			close(release)
+		}
+		closer := closerFunc(func() error {
+			closedAfterDone.Store(done.Load())
+			return nil
+		})
+
+		// act
+		servec := make(chan error, 1)
+		go func() {
+			servec <- a.serve(ctx, srv, ln, draining, closer)
+		}()
+		getc := get("http://" + ln.Addr().String())
+		<-started
+		cancel()
+		err = <-servec
+
+		// assert
+		require.NoError(t, err)
+		require.NoError(t, <-getc)
+		require.True(t, drained.Load())
+		require.True(t, closedAfterDone.Load())
+	})
+
+	t.Run("case 2: should close the requests still in flight once the shutdown timeout expires", func(t *testing.T) {
+		// arrange
+		a := &ServerChi{shutdownTimeout: 50 * time.Millisecond}
+		srv, started, _, done := inFlightServer()
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var closed atomic.Bool
+		closer := closerFunc(func() error {
+			closed.Store(true)
+			return nil
+		})
+
+		// act
+		servec := make(chan error, 1)
+		go func() {
+			servec <- a.serve(ctx, srv, ln, func() {}, closer)
+		}()
+		getc := get("http://" + ln.Addr().String())
+		<-started
+		cancel()
+		err = <-servec
+
+		// assert
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Error(t, <-getc)
+		require.False(t, done.Load())
+		require.True(t, closed.Load())
+	})
+
+	t.Run("case 3: should close in reverse order and return the error if the server fails", func(t *testing.T) {
+		// arrange
+		a := &ServerChi{shutdownTimeout: time.Second}
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		require.NoError(t, ln.Close())
+		errClose := errors.New("close failed")
+		var order []int
+		first := closerFunc(func() error {
+			order = append(order, 1)
+			return nil
+		})
+		second := closerFunc(func() error {
+			order = append(order, 2)
+			return errClose
+		})
+
+		// act
+		err = a.serve(context.Background(), &http.Server{}, ln, func() {}, first, second)
+
+		// assert
+		require.ErrorIs(t, err, net.ErrClosed)
+		require.ErrorIs(t, err, errClose)
+		require.Equal(t, []int{2, 1}, order)
+	})
+}
@@ -0,0 +1,380 @@
+package application
+
+import (
+	"app/internal/loader"
+	"app/internal/repository"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrInvalidConfig is returned when a setting of the configuration can not be parsed or is not valid
+	ErrInvalidConfig = errors.New("application: invalid config")
+	// ErrAuthRequired is returned when neither API keys nor token keys are configured and the authentication is not disabled
+	ErrAuthRequired = errors.New("application: authentication required, configure api_keys_path or a jwt key, or set auth_disabled for development")
+)
+
+const (
+	// ConfigEnvPrefix is the prefix of the environment variables of the settings, e.g. VEHICLES_ADDRESS
+	ConfigEnvPrefix = "VEHICLES_"
+	// ConfigFileEnv is the environment variable with the path to the config file, overridden by the flag -config
+	ConfigFileEnv = ConfigEnvPrefix + "CONFIG"
+)
+
+// LogLevels are the valid log levels, from the most to the least verbose
+var LogLevels = []string{"debug", "info", "warn", "error"}
+
+// setting is a struct that represents a setting of ConfigServerChi
+// - key is its name in the config file, its flag is key with dashes (-data-source) and its environment variable
+// is ConfigEnvPrefix plus key in upper case (VEHICLES_DATA_SOURCE)
+type setting struct {
+	// key is the name of the setting in the config file
+	key string
+	// usage is the description of the setting
+	usage string
+	// path is true for file paths, relative paths of the config file are resolved against its directory
+	path bool
+	// dsn is true for repository DSNs, the relative paths of the file drivers in the config file are resolved against its directory
+	dsn bool
+	// set is the function that parses value into the setting of cfg
+	set func(cfg *ConfigServerChi, value string) (err error)
+}
+
+// flag is a method that returns the name of the flag of the setting
+func (s setting) flag() string {
+	return strings.ReplaceAll(s.key, "_", "-")
+}
+
+// env is a method that returns the name of the environment variable of the setting
+func (s setting) env() string {
+	return ConfigEnvPrefix + strings.ToUpper(s.key)
+}
+
+// stringSetting is a function that returns the parser of a string setting
+func stringSetting(field func(cfg *ConfigServerChi) *string) func(cfg *ConfigServerChi, value string) error {
+	return func(cfg *ConfigServerChi, value string) (err error) {
+		*field(cfg) = value
+		return
+	}
+}
+
+// durationSetting is a function that returns the parser of a duration setting, e.g. 30s or 1m30s
+func durationSetting(field func(cfg *ConfigServerChi) *time.Duration) func(cfg *ConfigServerChi, value string) error {
+	return func(cfg *ConfigServerChi, value string) (err error) {
+		*field(cfg), err = time.ParseDuration(value)
+		return
+	}
+}
+
+// intSetting is a function that returns the parser of an integer setting
+func intSetting(field func(cfg *ConfigServerChi) *int) func(cfg *ConfigServerChi, value string) error {
+	return func(cfg *ConfigServerChi, value string) (err error) {
+		*field(cfg), err = strconv.Atoi(value)
+		return
+	}
+}
+
+// boolSetting is a function that returns the parser of a boolean setting, e.g. true or false
+func boolSetting(field func(cfg *ConfigServerChi) *bool) func(cfg *ConfigServerChi, value string) error {
+	return func(cfg *ConfigServerChi, value string) (err error) {
+		*field(cfg), err = strconv.ParseBool(value)
+		return
+	}
+}
+
+// settings are the settings of ConfigServerChi that can be configured
+var settings = []setting{
+	{key: "address", usage: "address where the server listens, e.g. :8080",
+		set: stringSetting(func(cfg *ConfigServerChi) *string { return &cfg.ServerAddress })},
+	{key: "data_source", usage: "path (plain, gzip or zstd compressed) or http(s) URL of the vehicles dataset", path: true,
+		set: stringSetting(func(cfg *ConfigServerChi) *string { return &cfg.LoaderFilePath })},
+	{key: "data_cache_path", usage: "path to the local cache of a dataset loaded from an http(s) URL", path: true,
+		set: stringSetting(func(cfg *ConfigServerChi) *string { return &cfg.LoaderCachePath })},
+	{key: "data_timeout", usage: "maximum duration of a request to a dataset loaded from an http(s) URL",
+		set: durationSetting(func(cfg *ConfigServerChi) *time.Duration { return &cfg.LoaderTimeout })},
+	{key: "data_snapshot_path", usage: "path to a binary snapshot of the dataset, read instead of the JSON file on start", path: true,
+		set: stringSetting(func(cfg *ConfigServerChi) *string { return &cfg.LoaderSnapshotPath })},
+	{key: "repository", usage: "DSN of the repository, its scheme is the driver, e.g. memory://, sqlite:///path/to/vehicles.db", dsn: true,
+		set: stringSetting(func(cfg *ConfigServerChi) *string { return &cfg.RepositoryDSN })},
+	{key: "event_store_path", usage: "path to the event log of the vehicles, it enables the event-sourced mode", path: true,
+		set: stringSetting(func(cfg *ConfigServerChi) *string { return &cfg.EventStorePath })},
+	{key: "log_level", usage: "log level: " + strings.Join(LogLevels, ", "),
+		set: stringSetting(func(cfg *ConfigServerChi) *string { return &cfg.LogLevel })},
+	{key: "log_output", usage: "where the JSON logs are written: stderr, stdout or the path to a file", path: true,
+		set: stringSetting(func(cfg *ConfigServerChi) *string { return &cfg.LogOutput })},
+	{key: "api_keys_path", usage: "path to the API keys minted with cmd/apikey, it enables the authentication of /vehicles", path: true,
+		set: stringSetting(func(cfg *ConfigServerChi) *string { return &cfg.APIKeysPath })},
+	{key: "jwt_hs256_secret_path", usage: "path to the shared secret (at least 32 bytes) of the HS256 bearer tokens, it enables their authentication", path: true,
+		set: stringSetting(func(cfg *ConfigServerChi) *string { return &cfg.JWTHS256SecretPath })},
+	{key: "jwt_rs256_public_key_path", usage: "path to the PEM public key of the RS256 bearer tokens, it enables their authentication", path: true,
+		set: stringSetting(func(cfg *ConfigServerChi) *string { return &cfg.JWTRS256PublicKeyPath })},
+	{key: "jwt_issuer", usage: "issuer (iss) required of the bearer tokens",
+		set: stringSetting(func(cfg *ConfigServerChi) *string { return &cfg.JWTIssuer })},
+	{key: "jwt_audience", usage: "audience (aud) required of the bearer tokens",
+		set: stringSetting(func(cfg *ConfigServerChi) *string { return &cfg.JWTAudience })},
+	{key: "auth_disabled", usage: "true to serve /vehicles and /metrics without authentication, for development only",
+		set: boolSetting(func(cfg *ConfigServerChi) *bool { return &cfg.AuthDisabled })},
+	{key: "request_timeout", usage: "maximum duration of a request, it responds 504 afterwards",
+		set: durationSetting(func(cfg *ConfigServerChi) *time.Duration { return &cfg.RequestTimeout })},
+	{key: "read_header_timeout", usage: "maximum duration to read the headers of a request",
+		set: durationSetting(func(cfg *ConfigServerChi) *time.Duration { return &cfg.ReadHeaderTimeout })},
+	{key: "read_timeout", usage: "maximum duration to read a whole request",
+		set: durationSetting(func(cfg *ConfigServerChi) *time.Duration { return &cfg.ReadTimeout })},
+	{key: "write_timeout", usage: "maximum duration to write a response, longer than the request timeout",
+		set: durationSetting(func(cfg *ConfigServerChi) *time.Duration { return &cfg.WriteTimeout })},
+	{key: "idle_timeout", usage: "maximum duration a keep-alive connection waits for the next request",
+		set: durationSetting(func(cfg *ConfigServerChi) *time.Duration { return &cfg.IdleTimeout })},
+	{key: "max_header_bytes", usage: "maximum size of the headers of a request",
+		set: intSetting(func(cfg *ConfigServerChi) *int { return &cfg.MaxHeaderBytes })},
+	{key: "shutdown_timeout", usage: "maximum duration to drain the in-flight requests on SIGTERM/SIGINT",
+		set: durationSetting(func(cfg *ConfigServerChi) *time.Duration { return &cfg.ShutdownTimeout })},
+}
+
+// LoadConfigServerChi is a function that returns the configuration of ServerChi from its layers, each one overriding the previous:
+// - the defaults (see DefaultConfigServerChi)
+// - the config file given by the flag -config or the environment variable ConfigFileEnv, YAML or JSON
+// - the environment variables, e.g. VEHICLES_ADDRESS
+// - the flags of args, e.g. -address
+// - the result is validated, see ConfigServerChi.Validate
+// - name is the name of the command in the usage, lookupEnv is usually os.LookupEnv
+// - it returns flag.ErrHelp if args ask for help (-h), the usage is already printed
+func LoadConfigServerChi(name string, args []string, lookupEnv func(key string) (string, bool)) (cfg *ConfigServerChi, err error) {
+	// flags
+	// - they are collected first to find the config file, they are applied last
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configPath, _ := lookupEnv(ConfigFileEnv)
+	fs.StringVar(&configPath, "config", configPath, "path to the config file, YAML or JSON (env "+ConfigFileEnv+")")
+	type flagValue struct {
+		s     setting
+		value string
+	}
+	var flags []flagValue
+	for _, s := range settings {
+		s := s
+		fs.Func(s.flag(), s.usage+" (env "+s.env()+")", func(value string) error {
+			flags = append(flags, flagValue{s: s, value: value})
+			return nil
+		})
+	}
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+	if fs.NArg() > 0 {
+		err = fmt.Errorf("%w: unexpected arguments %q", ErrInvalidConfig, fs.Args())
+		return
+	}
+
+	// defaults
+	cfg = DefaultConfigServerChi()
+
+	// config file
+	if configPath != "" {
+		if err = loadConfigFile(cfg, configPath); err != nil {
+			cfg = nil
+			return
+		}
+	}
+
+	// environment variables
+	for _, s := range settings {
+		value, ok := lookupEnv(s.env())
+		if !ok {
+			continue
+		}
+		if err = s.set(cfg, value); err != nil {
+			err = fmt.Errorf("%w: environment variable %s: %v", ErrInvalidConfig, s.env(), err)
+			cfg = nil
+			return
+		}
+	}
+
+	// flags
+	for _, f := range flags {
+		if err = f.s.set(cfg, f.value); err != nil {
+			err = fmt.Errorf("%w: flag -%s: %v", ErrInvalidConfig, f.s.flag(), err)
+			cfg = nil
+			return
+		}
+	}
+
+	// validation
+	if err = cfg.Validate(); err != nil {
+		cfg = nil
+	}
+	return
+}
+
+// loadConfigFile is a function that applies the settings of the config file at path to cfg
+// - JSON is read as YAML, of which it is a subset
+// - unknown keys are rejected, relative paths are resolved against the directory of the file
+func loadConfigFile(cfg *ConfigServerChi, path string) (err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		err = fmt.Errorf("%w: config file: %v", ErrInvalidConfig, err)
+		return
+	}
+	var values map[string]string
+	if err = yaml.Unmarshal(data, &values); err != nil {
+		err = fmt.Errorf("%w: config file %s: %v", ErrInvalidConfig, path, err)
+		return
+	}
+
+	for key, value := range values {
+		i := slices.IndexFunc(settings, func(s setting) bool { return s.key == key })
+		if i < 0 {
+			err = fmt.Errorf("%w: config file %s: unknown setting %q", ErrInvalidConfig, path, key)
+			return
+		}
+		s := settings[i]
+		if s.path && relativePath(value) {
+			value = filepath.Join(filepath.Dir(path), value)
+		}
+		if s.dsn {
+			value = resolveDSN(value, filepath.Dir(path))
+		}
+		if err = s.set(cfg, value); err != nil {
+			err = fmt.Errorf("%w: config file %s: %s: %v", ErrInvalidConfig, path, key, err)
+			return
+		}
+	}
+	return
+}
+
+// relativePath is a function that reports whether the value of a path setting is a relative file path
+// - URLs and the stderr and stdout log outputs are not file paths
+func relativePath(value string) bool {
+	switch {
+	case value == "", value == "stderr", value == "stdout", loader.IsURL(value):
+		return false
+	}
+	return !filepath.IsAbs(value)
+}
+
+// fileDrivers are the repository drivers whose DSN carries the path to a file or a directory
+var fileDrivers = []string{"sqlite", "bolt", "wal", "jsonfile"}
+
+// resolveDSN is a function that resolves the relative path of the DSN of a file driver against dir
+// - sqlite://data/vehicles.db and sqlite:data/vehicles.db are relative, sqlite:///data/vehicles.db is absolute
+// - the query of the DSN is kept, other drivers and values that are not DSNs are returned as they are
+func resolveDSN(value, dir string) string {
+	u, err := url.Parse(value)
+	if err != nil || !slices.Contains(fileDrivers, u.Scheme) {
+		return value
+	}
+	path := u.Opaque
+	if path == "" {
+		path = u.Host + u.Path
+	}
+	if path == "" || filepath.IsAbs(path) {
+		return value
+	}
+	resolved := url.URL{Scheme: u.Scheme, Path: filepath.ToSlash(filepath.Join(dir, path)), RawQuery: u.RawQuery}
+	return resolved.String()
+}
+
+// Validate is a method that returns the problems of the configuration, nil if it is valid
+// - every problem is reported at once, each one wrapping ErrInvalidConfig
+func (c *ConfigServerChi) Validate() (err error) {
+	var errs []error
+	invalid := func(format string, a ...any) {
+		errs = append(errs, fmt.Errorf("%w: "+format, append([]any{ErrInvalidConfig}, a...)...))
+	}
+
+	// server
+	if _, _, e := net.SplitHostPort(c.ServerAddress); e != nil {
+		invalid("address %q: %v", c.ServerAddress, e)
+	}
+	timeouts := []struct {
+		key string
+		d   time.Duration
+	}{
+		{"request_timeout", c.RequestTimeout},
+		{"read_header_timeout", c.ReadHeaderTimeout},
+		{"read_timeout", c.ReadTimeout},
+		{"write_timeout", c.WriteTimeout},
+		{"idle_timeout", c.IdleTimeout},
+		{"shutdown_timeout", c.ShutdownTimeout},
+	}
+	for _, t := range timeouts {
+		if t.d <= 0 {
+			invalid("%s must be positive, got %s", t.key, t.d)
+		}
+	}
+	if c.WriteTimeout > 0 && c.WriteTimeout <= c.RequestTimeout {
+		invalid("write_timeout (%s) must be longer than request_timeout (%s)", c.WriteTimeout, c.RequestTimeout)
+	}
+	if c.MaxHeaderBytes <= 0 {
+		invalid("max_header_bytes must be positive, got %d", c.MaxHeaderBytes)
+	}
+	if !slices.Contains(LogLevels, c.LogLevel) {
+		invalid("log_level %q must be one of %v", c.LogLevel, LogLevels)
+	}
+	switch c.LogOutput {
+	case "":
+		invalid("log_output is required: stderr, stdout or the path to a file")
+	case "stderr", "stdout":
+	default:
+		if info, e := os.Stat(filepath.Dir(c.LogOutput)); e != nil || !info.IsDir() {
+			invalid("log_output %q: its directory does not exist", c.LogOutput)
+		}
+	}
+
+	// data source
+	switch {
+	case c.LoaderFilePath == "":
+		invalid("data_source is required (flag -data-source, env %sDATA_SOURCE or data_source in the config file)", ConfigEnvPrefix)
+	case loader.IsURL(c.LoaderFilePath):
+		if c.LoaderTimeout < 0 {
+			invalid("data_timeout must not be negative, got %s", c.LoaderTimeout)
+		}
+	default:
+		if _, e := os.Stat(c.LoaderFilePath); e != nil {
+			invalid("data_source: %v", e)
+		}
+	}
+
+	// authentication
+	if c.APIKeysPath != "" {
+		if _, e := os.Stat(c.APIKeysPath); e != nil {
+			invalid("api_keys_path: %v (mint a key with cmd/apikey first)", e)
+		}
+	}
+	if c.JWTHS256SecretPath != "" {
+		if _, e := os.Stat(c.JWTHS256SecretPath); e != nil {
+			invalid("jwt_hs256_secret_path: %v", e)
+		}
+	}
+	if c.JWTRS256PublicKeyPath != "" {
+		if _, e := os.Stat(c.JWTRS256PublicKeyPath); e != nil {
+			invalid("jwt_rs256_public_key_path: %v", e)
+		}
+	}
+	credentials := c.APIKeysPath != "" || c.JWTHS256SecretPath != "" || c.JWTRS256PublicKeyPath != ""
+	switch {
+	case !credentials && !c.AuthDisabled:
+		invalid("authentication requires api_keys_path, jwt_hs256_secret_path or jwt_rs256_public_key_path, or auth_disabled for development")
+	case credentials && c.AuthDisabled:
+		invalid("auth_disabled conflicts with the configured api keys or token keys")
+	}
+
+	// repository
+	if u, e := url.Parse(c.RepositoryDSN); e != nil || u.Scheme == "" {
+		invalid("repository %q is not a DSN, e.g. memory:// or sqlite:///path/to/vehicles.db", c.RepositoryDSN)
+	} else if !slices.Contains(repository.Drivers(), u.Scheme) {
+		invalid("repository driver %q is not registered (registered: %v)", u.Scheme, repository.Drivers())
+	}
+
+	err = errors.Join(errs...)
+	return
+}
@@ -0,0 +1,144 @@
+package application_test
+
+import (
+	"app/internal/application"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// env is a function that returns a lookup of the environment variables of vars
+func env(vars map[string]string) func(key string) (string, bool) {
+	return func(key string) (value string, ok bool) {
+		value, ok = vars[key]
+		return
+	}
+}
+
+// writeConfig is a function that writes a config file with the dataset next to it, returning the path of the config file
+func writeConfig(t *testing.T, name, content string) string {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "vehicles.json"), []byte("[]"), 0o644))
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+// Tests for LoadConfigServerChi
+func TestLoadConfigServerChi(t *testing.T) {
+	t.Run("case 1: should layer the defaults, the config file, the environment variables and the flags", func(t *testing.T) {
+		// arrange
+		path := writeConfig(t, "vehicles.yaml", "address: :7070\ndata_source: vehicles.json\nauth_disabled: true\nread_timeout: 10s\nlog_level: warn\nlog_output: stdout\n")
+		vars := map[string]string{
+			application.ConfigFileEnv: path,
+			"VEHICLES_READ_TIMEOUT":   "20s",
+			"VEHICLES_LOG_LEVEL":      "error",
+		}
+
+		// act
+		cfg, err := application.LoadConfigServerChi("test", []string{"-log-level", "debug"}, env(vars))
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, ":7070", cfg.ServerAddress)
+		require.Equal(t, filepath.Join(filepath.Dir(path), "vehicles.json"), cfg.LoaderFilePath)
+		require.Equal(t, 20*time.Second, cfg.ReadTimeout)
+		require.Equal(t, "debug", cfg.LogLevel)
+		require.Equal(t, "stdout", cfg.LogOutput)
+		require.Equal(t, application.DefaultConfigServerChi().WriteTimeout, cfg.WriteTimeout)
+	})
+
+	t.Run("case 2: should read JSON config files given by flag", func(t *testing.T) {
+		// arrange
+		path := writeConfig(t, "vehicles.json.conf", `{"data_source": "vehicles.json", "auth_disabled": true, "repository": "memory://?columnar=true", "max_header_bytes": 4096}`)
+
+		// act
+		cfg, err := application.LoadConfigServerChi("test", []string{"-config", path}, env(nil))
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, "memory://?columnar=true", cfg.RepositoryDSN)
+		require.Equal(t, 4096, cfg.MaxHeaderBytes)
+	})
+
+	t.Run("case 3: should reject unknown settings and invalid values", func(t *testing.T) {
+		// arrange
+		path := writeConfig(t, "vehicles.yaml", "data_source: vehicles.json\nport: 8080\n")
+
+		// act
+		_, errFile := application.LoadConfigServerChi("test", []string{"-config", path}, env(nil))
+		_, errEnv := application.LoadConfigServerChi("test", nil, env(map[string]string{"VEHICLES_IDLE_TIMEOUT": "soon"}))
+
+		// assert
+		require.ErrorIs(t, errFile, application.ErrInvalidConfig)
+		require.ErrorContains(t, errFile, `unknown setting "port"`)
+		require.ErrorIs(t, errEnv, application.ErrInvalidConfig)
+		require.ErrorContains(t, errEnv, "VEHICLES_IDLE_TIMEOUT")
+	})
+
+	t.Run("case 4: should report every problem of the result at once", func(t *testing.T) {
+		// act
+		_, err := application.LoadConfigServerChi("test", []string{"-repository", "nosql://", "-write-timeout", "1s", "-log-level", "loud"}, env(nil))
+
+		// assert
+		require.ErrorIs(t, err, application.ErrInvalidConfig)
+		require.ErrorContains(t, err, "write_timeout")
+		require.ErrorContains(t, err, "log_level")
+		require.ErrorContains(t, err, "data_source is required")
+		require.ErrorContains(t, err, `driver "nosql"`)
+	})
+
+	t.Run("case 5: should resolve the relative paths of the repository DSN in the config file against its directory", func(t *testing.T) {
+		// arrange
+		cases := []struct{ dsn, expected string }{
+			{dsn: "sqlite://data/vehicles.db?journal=wal", expected: "sqlite://%s/data/vehicles.db?journal=wal"},
+			{dsn: "bolt:vehicles.bolt", expected: "bolt://%s/vehicles.bolt"},
+			{dsn: "wal://vehicles", expected: "wal://%s/vehicles"},
+			{dsn: "jsonfile:///var/lib/vehicles.json", expected: "jsonfile:///var/lib/vehicles.json"},
+			{dsn: "memory://?columnar=true", expected: "memory://?columnar=true"},
+		}
+
+		for _, c := range cases {
+			path := writeConfig(t, "vehicles.yaml", "data_source: vehicles.json\nauth_disabled: true\nrepository: "+c.dsn+"\n")
+			expected := c.expected
+			if strings.Contains(expected, "%s") {
+				expected = fmt.Sprintf(expected, filepath.ToSlash(filepath.Dir(path)))
+			}
+
+			// act
+			cfg, err := application.LoadConfigServerChi("test", []string{"-config", path}, env(nil))
+			flagCfg, flagErr := application.LoadConfigServerChi("test", []string{"-config", path, "-repository", c.dsn}, env(nil))
+
+			// assert
+			require.NoError(t, err)
+			require.Equal(t, expected, cfg.RepositoryDSN)
+			require.NoError(t, flagErr)
+			require.Equal(t, c.dsn, flagCfg.RepositoryDSN)
+		}
+	})
+
+	t.Run("case 6: should require the authentication unless it is disabled explicitly", func(t *testing.T) {
+		// arrange
+		path := writeConfig(t, "vehicles.yaml", "data_source: vehicles.json\n")
+		keysPath := filepath.Join(filepath.Dir(path), "apikeys.json")
+		require.NoError(t, os.WriteFile(keysPath, []byte(`{"keys":[]}`), 0o644))
+
+		// act
+		_, errOpen := application.LoadConfigServerChi("test", []string{"-config", path}, env(nil))
+		cfg, errDisabled := application.LoadConfigServerChi("test", []string{"-config", path}, env(map[string]string{"VEHICLES_AUTH_DISABLED": "true"}))
+		_, errConflict := application.LoadConfigServerChi("test", []string{"-config", path, "-api-keys-path", keysPath, "-auth-disabled", "true"}, env(nil))
+
+		// assert
+		require.ErrorIs(t, errOpen, application.ErrInvalidConfig)
+		require.ErrorContains(t, errOpen, "authentication requires api_keys_path")
+		require.NoError(t, errDisabled)
+		require.True(t, cfg.AuthDisabled)
+		require.ErrorIs(t, errConflict, application.ErrInvalidConfig)
+		require.ErrorContains(t, errConflict, "auth_disabled conflicts")
+	})
+}
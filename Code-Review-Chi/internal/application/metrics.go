@@ -0,0 +1,92 @@
+package application
+
+import (
+	"app/internal"
+	"app/internal/metrics"
+	"context"
+	"errors"
+	"math"
+	"time"
+)
+
+// scrapeTimeout is the maximum duration of the queries made to compute the gauges of a scrape
+const scrapeTimeout = 5 * time.Second
+
+// serverMetrics is a struct that represents the metrics exposed by ServerChi on GET /metrics
+type serverMetrics struct {
+	// registry holds every family
+	registry *metrics.Registry
+	// requests counts the requests by route pattern, method and status class
+	requests *metrics.CounterVec
+	// requestDurations records the latency of the requests by route pattern and method
+	requestDurations *metrics.HistogramVec
+	// repositoryDurations records the latency of the operations of the repository by operation and result
+	repositoryDurations *metrics.HistogramVec
+	// loads counts the loads of the dataset by result
+	loads *metrics.CounterVec
+	// loadedVehicles is the number of vehicles of the last successful load of the dataset
+	loadedVehicles *metrics.GaugeVec
+	// loadDuration is the duration of the last load of the dataset
+	loadDuration *metrics.GaugeVec
+	// loadTimestamp is the time of the last successful load of the dataset
+	loadTimestamp *metrics.GaugeVec
+}
+
+// newServerMetrics is a function that returns the metrics of ServerChi, registered in a new registry
+func newServerMetrics() *serverMetrics {
+	reg := metrics.NewRegistry()
+	return &serverMetrics{
+		registry:            reg,
+		requests:            reg.Counter("http_requests_total", "Number of HTTP requests by route pattern, method and status class.", "route", "method", "status"),
+		requestDurations:    reg.Histogram("http_request_duration_seconds", "Latency of the HTTP requests by route pattern and method.", metrics.DefaultBuckets, "route", "method"),
+		repositoryDurations: reg.Histogram("vehicles_repository_operation_duration_seconds", "Latency of the operations of the vehicle repository by operation and result.", metrics.DefaultBuckets, "operation", "result"),
+		loads:               reg.Counter("vehicles_loader_loads_total", "Number of loads of the vehicles dataset by result.", "result"),
+		loadedVehicles:      reg.Gauge("vehicles_loader_loaded_vehicles", "Number of vehicles of the last successful load of the dataset."),
+		loadDuration:        reg.Gauge("vehicles_loader_last_load_duration_seconds", "Duration of the last load of the dataset."),
+		loadTimestamp:       reg.Gauge("vehicles_loader_last_success_timestamp_seconds", "Unix time of the last successful load of the dataset."),
+	}
+}
+
+// observeRepository is a method that records an operation of the repository
+func (m *serverMetrics) observeRepository(op string, d time.Duration, err error) {
+	m.repositoryDurations.Observe(d.Seconds(), op, result(err))
+}
+
+// observeLoad is a method that records a load of the dataset
+func (m *serverMetrics) observeLoad(d time.Duration, v map[int]internal.Vehicle, err error) {
+	m.loads.Inc(result(err))
+	m.loadDuration.Set(d.Seconds())
+	if err == nil {
+		m.loadedVehicles.Set(float64(len(v)))
+		m.loadTimestamp.Set(float64(time.Now().Unix()))
+	}
+}
+
+// datasetSize is a method that registers the gauge of the number of vehicles of rp, counted on every scrape
+// - the gauge is NaN if rp can not be queried
+func (m *serverMetrics) datasetSize(rp internal.VehicleRepository) {
+	m.registry.GaugeFunc("vehicles_dataset_vehicles", "Number of vehicles currently in the repository.", func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), scrapeTimeout)
+		defer cancel()
+		v, err := rp.FindAll(ctx)
+		if err != nil {
+			return math.NaN()
+		}
+		return float64(len(v))
+	})
+}
+
+// result is a function that returns the result label of an error
+func result(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, internal.ErrVehicleNotFound):
+		return "not_found"
+	case errors.Is(err, internal.ErrVehicleVersionMismatch):
+		return "conflict"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "canceled"
+	}
+	return "error"
+}
@@ -0,0 +1,313 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrAPIKeyInvalid is returned when an API key is malformed, unknown or revoked
+	ErrAPIKeyInvalid = errors.New("auth: invalid api key")
+	// ErrAPIKeyNotFound is returned when no API key has the given id
+	ErrAPIKeyNotFound = errors.New("auth: api key not found")
+	// ErrScopeInvalid is returned when a scope is not one of Scopes
+	ErrScopeInvalid = errors.New("auth: invalid scope")
+)
+
+// Scope is a permission granted to an API key
+type Scope string
+
+const (
+	// ScopeRead grants the queries of the vehicles
+	ScopeRead Scope = "read"
+	// ScopeWrite grants the writes of the vehicles
+	ScopeWrite Scope = "write"
+	// ScopeAdmin grants the admin routes
+	ScopeAdmin Scope = "admin"
+)
+
+// Scopes are the valid scopes
+var Scopes = []Scope{ScopeRead, ScopeWrite, ScopeAdmin}
+
+// ParseScopes is a function that parses a comma-separated list of scopes, e.g. read,write
+func ParseScopes(s string) (scopes []Scope, err error) {
+	for _, name := range strings.Split(s, ",") {
+		scope := Scope(strings.TrimSpace(name))
+		if !slices.Contains(Scopes, scope) {
+			err = fmt.Errorf("%w: %q (valid: %v)", ErrScopeInvalid, scope, Scopes)
+			return nil, err
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return
+}
+
+// apiKeyPrefix is the prefix of every API key, it makes leaked keys easy to find
+const apiKeyPrefix = "vk_"
+
+// APIKey is a struct that represents a minted API key
+// - only the hash of the key is stored, the key itself is shown once when it is minted
+type APIKey struct {
+	// ID identifies the key, it is also part of the key
+	ID string `json:"id"`
+	// Name describes the holder of the key, e.g. ci or reporting
+	Name string `json:"name"`
+	// Hash is the SHA-256 of the key, hex encoded
+	Hash string `json:"hash"`
+	// Scopes are the scopes granted to the key
+	Scopes []Scope `json:"scopes"`
+	// CreatedAt is the time the key was minted
+	CreatedAt time.Time `json:"created_at"`
+	// RevokedAt is the time the key was revoked, nil while it is valid
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// hashAPIKey is a function that returns the hash of a key
+// - keys are long random strings, a plain SHA-256 is enough to make a leaked file useless
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyID is a function that returns the id part of a key, false if the key is malformed
+// - keys look like vk_<id>_<secret>
+func apiKeyID(key string) (id string, ok bool) {
+	rest, ok := strings.CutPrefix(key, apiKeyPrefix)
+	if !ok {
+		return
+	}
+	id, _, ok = strings.Cut(rest, "_")
+	return
+}
+
+// apiKeyCheckInterval is the minimum duration between two checks for changes of the key file
+const apiKeyCheckInterval = time.Second
+
+// OpenAPIKeyFile is a function that opens the API keys stored at path, an empty set if the file does not exist yet
+func OpenAPIKeyFile(path string) (f *APIKeyFile, err error) {
+	f = &APIKeyFile{path: path, now: time.Now}
+	if err = f.reload(); err != nil {
+		f = nil
+	}
+	return
+}
+
+// APIKeyFile is a struct that represents the API keys stored in a JSON file
+// - the file is read again when it changes, so keys minted or revoked by another process apply without a restart
+type APIKeyFile struct {
+	// path is the path to the file
+	path string
+	// now is the clock of the keys
+	now func() time.Time
+	// mu guards the state below
+	mu sync.Mutex
+	// keys are the keys by id
+	keys map[string]APIKey
+	// info is the file info of the file when it was read or written, nil if it did not exist
+	// - every write replaces the file, a file that is not the same (see os.SameFile) changed
+	info os.FileInfo
+	// checkedAt is the time of the last check for changes of the file
+	checkedAt time.Time
+}
+
+// apiKeyFileJSON is a struct that represents the content of the key file
+type apiKeyFileJSON struct {
+	Keys []APIKey `json:"keys"`
+}
+
+// Authenticate is a method that returns the valid key matching key, ErrAPIKeyInvalid if there is none
+func (f *APIKeyFile) Authenticate(key string) (k APIKey, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if now := f.now(); now.Sub(f.checkedAt) >= apiKeyCheckInterval {
+		f.checkedAt = now
+		// - a file being rewritten keeps the keys already read
+		_ = f.reloadIfChanged()
+	}
+
+	id, ok := apiKeyID(key)
+	if !ok {
+		err = ErrAPIKeyInvalid
+		return
+	}
+	k, ok = f.keys[id]
+	if !ok || k.RevokedAt != nil || subtle.ConstantTimeCompare([]byte(k.Hash), []byte(hashAPIKey(key))) != 1 {
+		k, err = APIKey{}, ErrAPIKeyInvalid
+	}
+	return
+}
+
+// Mint is a method that creates a key for name with the scopes and stores it
+// - key is the only copy of the key, the file keeps its hash
+func (f *APIKeyFile) Mint(name string, scopes []Scope) (key string, k APIKey, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err = f.reloadIfChanged(); err != nil {
+		return
+	}
+
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err = rand.Read(id); err != nil {
+		return
+	}
+	if _, err = rand.Read(secret); err != nil {
+		return
+	}
+	k = APIKey{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Scopes:    scopes,
+		CreatedAt: f.now().UTC(),
+	}
+	key = apiKeyPrefix + k.ID + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	k.Hash = hashAPIKey(key)
+
+	f.keys[k.ID] = k
+	if err = f.save(); err != nil {
+		delete(f.keys, k.ID)
+	}
+	return
+}
+
+// Revoke is a method that revokes the key with the id, ErrAPIKeyNotFound if there is none
+// - revoked keys stay in the file, so the history of the keys is kept
+func (f *APIKeyFile) Revoke(id string) (err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err = f.reloadIfChanged(); err != nil {
+		return
+	}
+
+	k, ok := f.keys[id]
+	if !ok {
+		err = fmt.Errorf("%w: %q", ErrAPIKeyNotFound, id)
+		return
+	}
+	if k.RevokedAt != nil {
+		return
+	}
+	revokedAt := f.now().UTC()
+	k.RevokedAt = &revokedAt
+	f.keys[id] = k
+	if err = f.save(); err != nil {
+		k.RevokedAt = nil
+		f.keys[id] = k
+	}
+	return
+}
+
+// Keys is a method that returns every key, revoked ones included, sorted by creation time
+func (f *APIKeyFile) Keys() (keys []APIKey) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys = make([]APIKey, 0, len(f.keys))
+	for _, k := range f.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return
+}
+
+// reloadIfChanged is a method that reads the file again if it changed, with mu held
+func (f *APIKeyFile) reloadIfChanged() (err error) {
+	info, err := os.Stat(f.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		err = nil
+		return
+	case err != nil:
+		return
+	case f.info != nil && os.SameFile(info, f.info) && info.ModTime().Equal(f.info.ModTime()) && info.Size() == f.info.Size():
+		return
+	}
+	err = f.reload()
+	return
+}
+
+// reload is a method that reads the file, with mu held
+func (f *APIKeyFile) reload() (err error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		f.keys = make(map[string]APIKey)
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return
+	}
+
+	var content apiKeyFileJSON
+	if err = json.Unmarshal(data, &content); err != nil {
+		err = fmt.Errorf("auth: api key file %s: %w", f.path, err)
+		return
+	}
+	keys := make(map[string]APIKey, len(content.Keys))
+	for _, k := range content.Keys {
+		keys[k.ID] = k
+	}
+	f.keys, f.info = keys, info
+	return
+}
+
+// save is a method that writes the keys to the file through a temporary file and a rename, with mu held
+// - the file is only readable by its owner
+func (f *APIKeyFile) save() (err error) {
+	content := apiKeyFileJSON{Keys: make([]APIKey, 0, len(f.keys))}
+	for _, k := range f.keys {
+		content.Keys = append(content.Keys, k)
+	}
+	sort.Slice(content.Keys, func(i, j int) bool { return content.Keys[i].CreatedAt.Before(content.Keys[j].CreatedAt) })
+	data, err := json.MarshalIndent(content, "", "  ")
+	if err != nil {
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".tmp*")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.Write(append(data, '\n')); err != nil {
+		return
+	}
+	if err = tmp.Chmod(0o600); err != nil {
+		return
+	}
+	if err = tmp.Sync(); err != nil {
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+	if err = os.Rename(tmp.Name(), f.path); err != nil {
+		return
+	}
+
+	f.info, err = os.Stat(f.path)
+	return
+}
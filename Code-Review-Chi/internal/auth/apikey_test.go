@@ -0,0 +1,78 @@
+package auth_test
+
+import (
+	"app/internal/auth"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Tests for APIKeyFile
+func TestAPIKeyFile(t *testing.T) {
+	t.Run("case 1: should authenticate minted keys and store only their hash", func(t *testing.T) {
+		// arrange
+		path := filepath.Join(t.TempDir(), "keys.json")
+		keys, err := auth.OpenAPIKeyFile(path)
+		require.NoError(t, err)
+
+		// act
+		key, minted, err := keys.Mint("ci", []auth.Scope{auth.ScopeRead, auth.ScopeWrite})
+		require.NoError(t, err)
+		k, errAuth := keys.Authenticate(key)
+		_, errTampered := keys.Authenticate(key + "x")
+		_, errMalformed := keys.Authenticate("not-a-key")
+		data, errRead := os.ReadFile(path)
+
+		// assert
+		require.NoError(t, errAuth)
+		require.Equal(t, minted, k)
+		require.Equal(t, "ci", k.Name)
+		require.ErrorIs(t, errTampered, auth.ErrAPIKeyInvalid)
+		require.ErrorIs(t, errMalformed, auth.ErrAPIKeyInvalid)
+		require.NoError(t, errRead)
+		require.NotContains(t, string(data), key)
+		require.True(t, strings.Contains(string(data), k.Hash))
+	})
+
+	t.Run("case 2: should reject revoked keys, also when revoked by another process", func(t *testing.T) {
+		// arrange
+		path := filepath.Join(t.TempDir(), "keys.json")
+		server, err := auth.OpenAPIKeyFile(path)
+		require.NoError(t, err)
+		cli, err := auth.OpenAPIKeyFile(path)
+		require.NoError(t, err)
+		key, k, err := cli.Mint("reporting", []auth.Scope{auth.ScopeRead})
+		require.NoError(t, err)
+
+		// act
+		_, errBefore := server.Authenticate(key)
+		require.NoError(t, cli.Revoke(k.ID))
+		time.Sleep(1100 * time.Millisecond)
+		_, errAfter := server.Authenticate(key)
+		errUnknown := cli.Revoke("unknown")
+
+		// assert
+		require.NoError(t, errBefore)
+		require.ErrorIs(t, errAfter, auth.ErrAPIKeyInvalid)
+		require.ErrorIs(t, errUnknown, auth.ErrAPIKeyNotFound)
+		require.NotNil(t, cli.Keys()[0].RevokedAt)
+	})
+}
+
+// Tests for ParseScopes
+func TestParseScopes(t *testing.T) {
+	t.Run("case 1: should parse known scopes once and reject unknown ones", func(t *testing.T) {
+		// act
+		scopes, err := auth.ParseScopes("read, write,read")
+		_, errUnknown := auth.ParseScopes("read,delete")
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, []auth.Scope{auth.ScopeRead, auth.ScopeWrite}, scopes)
+		require.ErrorIs(t, errUnknown, auth.ErrScopeInvalid)
+	})
+}
@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrTokenInvalid is returned when a token is malformed, badly signed, expired or not meant for the service
+	ErrTokenInvalid = errors.New("auth: invalid token")
+)
+
+// Role is a role of the subject of a token, it grants scopes (see RoleScopes)
+type Role string
+
+const (
+	// RoleViewer can query the vehicles
+	RoleViewer Role = "viewer"
+	// RoleEditor can query and write the vehicles
+	RoleEditor Role = "editor"
+	// RoleAdmin can also use the admin routes
+	RoleAdmin Role = "admin"
+)
+
+// RoleScopes are the scopes granted by each role
+var RoleScopes = map[Role][]Scope{
+	RoleViewer: {ScopeRead},
+	RoleEditor: {ScopeRead, ScopeWrite},
+	RoleAdmin:  {ScopeRead, ScopeWrite, ScopeAdmin},
+}
+
+// minHS256SecretLength is the minimum length of an HS256 secret, the size of the hash
+const minHS256SecretLength = 32
+
+// ConfigJWTVerifier is a struct that represents the configuration for JWTVerifier
+// - at least one key is required, a token is only accepted with the algorithm of a configured key
+type ConfigJWTVerifier struct {
+	// HS256Secret is the shared secret of the HS256 tokens, nil to reject them
+	HS256Secret []byte
+	// RS256PublicKey is the public key of the RS256 tokens, nil to reject them
+	RS256PublicKey *rsa.PublicKey
+	// Issuer is the required iss claim, empty to accept any
+	Issuer string
+	// Audience is the required aud claim, empty to accept any
+	Audience string
+	// Leeway is the clock skew tolerated on exp and nbf
+	Leeway time.Duration
+}
+
+// NewJWTVerifier is a function that returns a new instance of JWTVerifier
+func NewJWTVerifier(cfg ConfigJWTVerifier) (v *JWTVerifier, err error) {
+	switch {
+	case cfg.HS256Secret == nil && cfg.RS256PublicKey == nil:
+		err = errors.New("auth: jwt verifier requires an HS256 secret or an RS256 public key")
+		return
+	case cfg.HS256Secret != nil && len(cfg.HS256Secret) < minHS256SecretLength:
+		err = fmt.Errorf("auth: HS256 secret must have at least %d bytes", minHS256SecretLength)
+		return
+	}
+	v = &JWTVerifier{cfg: cfg, now: time.Now}
+	return
+}
+
+// ParseRSAPublicKey is a function that parses a PEM encoded RSA public key (PKIX or PKCS #1)
+func ParseRSAPublicKey(data []byte) (key *rsa.PublicKey, err error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		err = errors.New("auth: no PEM block found")
+		return
+	}
+	if key, err = x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return
+	}
+	key, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		err = errors.New("auth: public key is not an RSA key")
+	}
+	return
+}
+
+// JWTVerifier is a struct that verifies bearer tokens in the JWT format signed with HS256 or RS256
+// - the subject is the sub claim and the scopes are granted by the roles of the roles claim
+type JWTVerifier struct {
+	// cfg is the configuration of the verifier
+	cfg ConfigJWTVerifier
+	// now is the clock of the expiration
+	now func() time.Time
+}
+
+// jwtHeader is a struct that represents the header of a token
+type jwtHeader struct {
+	Alg string `json:"alg"`
+}
+
+// jwtClaims is a struct that represents the claims of a token read by the verifier
+type jwtClaims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *float64        `json:"exp"`
+	NotBefore *float64        `json:"nbf"`
+	Roles     json.RawMessage `json:"roles"`
+}
+
+// Verify is a method that returns the principal of a token, ErrTokenInvalid if it is not valid
+// - exp and sub are required, tokens without any known role are valid but get no scope
+func (v *JWTVerifier) Verify(token string) (p Principal, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		err = fmt.Errorf("%w: malformed", ErrTokenInvalid)
+		return
+	}
+
+	// - signature, with the algorithm of a configured key only
+	var header jwtHeader
+	if err = decodeJWTPart(parts[0], &header); err != nil {
+		return
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		err = fmt.Errorf("%w: malformed signature", ErrTokenInvalid)
+		return
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	switch {
+	case header.Alg == "HS256" && v.cfg.HS256Secret != nil:
+		mac := hmac.New(sha256.New, v.cfg.HS256Secret)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			err = fmt.Errorf("%w: bad signature", ErrTokenInvalid)
+			return
+		}
+	case header.Alg == "RS256" && v.cfg.RS256PublicKey != nil:
+		digest := sha256.Sum256(signed)
+		if rsa.VerifyPKCS1v15(v.cfg.RS256PublicKey, crypto.SHA256, digest[:], signature) != nil {
+			err = fmt.Errorf("%w: bad signature", ErrTokenInvalid)
+			return
+		}
+	default:
+		err = fmt.Errorf("%w: algorithm %q not accepted", ErrTokenInvalid, header.Alg)
+		return
+	}
+
+	// - claims
+	var claims jwtClaims
+	if err = decodeJWTPart(parts[1], &claims); err != nil {
+		return
+	}
+	now := v.now()
+	switch {
+	case claims.Subject == "":
+		err = fmt.Errorf("%w: missing sub", ErrTokenInvalid)
+	case claims.ExpiresAt == nil:
+		err = fmt.Errorf("%w: missing exp", ErrTokenInvalid)
+	case now.After(unixTime(*claims.ExpiresAt).Add(v.cfg.Leeway)):
+		err = fmt.Errorf("%w: expired", ErrTokenInvalid)
+	case claims.NotBefore != nil && now.Add(v.cfg.Leeway).Before(unixTime(*claims.NotBefore)):
+		err = fmt.Errorf("%w: not valid yet", ErrTokenInvalid)
+	case v.cfg.Issuer != "" && claims.Issuer != v.cfg.Issuer:
+		err = fmt.Errorf("%w: unexpected iss", ErrTokenInvalid)
+	case v.cfg.Audience != "" && !slices.Contains(stringOrList(claims.Audience), v.cfg.Audience):
+		err = fmt.Errorf("%w: unexpected aud", ErrTokenInvalid)
+	}
+	if err != nil {
+		return
+	}
+
+	p.Subject = claims.Subject
+	for _, role := range stringOrList(claims.Roles) {
+		for _, scope := range RoleScopes[Role(role)] {
+			if !p.HasScope(scope) {
+				p.Scopes = append(p.Scopes, scope)
+			}
+		}
+	}
+	return
+}
+
+// decodeJWTPart is a function that decodes a base64url encoded JSON part of a token into v
+func decodeJWTPart(part string, v any) (err error) {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err == nil {
+		err = json.Unmarshal(data, v)
+	}
+	if err != nil {
+		err = fmt.Errorf("%w: malformed", ErrTokenInvalid)
+	}
+	return
+}
+
+// unixTime is a function that returns the time of a NumericDate claim, seconds since the epoch
+func unixTime(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+// stringOrList is a function that returns the values of a claim that is either a string or a list of strings
+// - other values have no strings
+func stringOrList(raw json.RawMessage) (values []string) {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return []string{s}
+	}
+	_ = json.Unmarshal(raw, &values)
+	return
+}
@@ -0,0 +1,136 @@
+package auth_test
+
+import (
+	"app/internal/auth"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// signJWT is a function that returns a token with the claims, signed with HS256 (secret) or RS256 (private key)
+func signJWT(t *testing.T, alg string, key any, claims map[string]any) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// Tests for JWTVerifier
+func TestJWTVerifier(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	exp := time.Now().Add(time.Hour).Unix()
+
+	t.Run("case 1: should verify HS256 tokens and grant the scopes of their roles", func(t *testing.T) {
+		// arrange
+		v, err := auth.NewJWTVerifier(auth.ConfigJWTVerifier{HS256Secret: secret, Issuer: "portal", Audience: "vehicles"})
+		require.NoError(t, err)
+		token := signJWT(t, "HS256", secret, map[string]any{
+			"sub": "jdoe", "iss": "portal", "aud": []string{"vehicles", "other"}, "exp": exp,
+			"roles": []string{"viewer", "editor", "unknown"},
+		})
+
+		// act
+		p, err := v.Verify(token)
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, auth.Principal{Subject: "jdoe", Scopes: []auth.Scope{auth.ScopeRead, auth.ScopeWrite}}, p)
+	})
+
+	t.Run("case 2: should verify RS256 tokens with a PEM public key", func(t *testing.T) {
+		// arrange
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		require.NoError(t, err)
+		pub, err := auth.ParseRSAPublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+		require.NoError(t, err)
+		v, err := auth.NewJWTVerifier(auth.ConfigJWTVerifier{RS256PublicKey: pub})
+		require.NoError(t, err)
+
+		// act
+		p, err := v.Verify(signJWT(t, "RS256", key, map[string]any{"sub": "ops", "exp": exp, "roles": "admin"}))
+		_, errHS256 := v.Verify(signJWT(t, "HS256", der, map[string]any{"sub": "ops", "exp": exp, "roles": "admin"}))
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, "ops", p.Subject)
+		require.True(t, p.HasScope(auth.ScopeAdmin))
+		require.ErrorIs(t, errHS256, auth.ErrTokenInvalid)
+	})
+
+	t.Run("case 3: should reject invalid tokens", func(t *testing.T) {
+		// arrange
+		v, err := auth.NewJWTVerifier(auth.ConfigJWTVerifier{HS256Secret: secret, Issuer: "portal", Audience: "vehicles", Leeway: time.Minute})
+		require.NoError(t, err)
+		valid := map[string]any{"sub": "jdoe", "iss": "portal", "aud": "vehicles", "exp": exp}
+		with := func(key string, value any) map[string]any {
+			claims := map[string]any{}
+			for k, v := range valid {
+				claims[k] = v
+			}
+			if value == nil {
+				delete(claims, key)
+			} else {
+				claims[key] = value
+			}
+			return claims
+		}
+		tokens := map[string]string{
+			"malformed":      "not.a-token",
+			"bad signature":  signJWT(t, "HS256", []byte("another secret of at least 32 bytes"), valid),
+			"alg none":       signJWT(t, "none", nil, valid),
+			"expired":        signJWT(t, "HS256", secret, with("exp", time.Now().Add(-2*time.Minute).Unix())),
+			"not valid yet":  signJWT(t, "HS256", secret, with("nbf", time.Now().Add(2*time.Minute).Unix())),
+			"missing exp":    signJWT(t, "HS256", secret, with("exp", nil)),
+			"missing sub":    signJWT(t, "HS256", secret, with("sub", nil)),
+			"other issuer":   signJWT(t, "HS256", secret, with("iss", "elsewhere")),
+			"other audience": signJWT(t, "HS256", secret, with("aud", []string{"billing"})),
+		}
+
+		// act
+		_, errLeeway := v.Verify(signJWT(t, "HS256", secret, with("exp", time.Now().Add(-30*time.Second).Unix())))
+		for name, token := range tokens {
+			_, err := v.Verify(token)
+
+			// assert
+			require.ErrorIs(t, err, auth.ErrTokenInvalid, name)
+		}
+		require.NoError(t, errLeeway)
+	})
+
+	t.Run("case 4: should require a key and a long enough HS256 secret", func(t *testing.T) {
+		// act
+		_, errNoKey := auth.NewJWTVerifier(auth.ConfigJWTVerifier{})
+		_, errShort := auth.NewJWTVerifier(auth.ConfigJWTVerifier{HS256Secret: []byte("short")})
+
+		// assert
+		require.Error(t, errNoKey)
+		require.Error(t, errShort)
+	})
+}
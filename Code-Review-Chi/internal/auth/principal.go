@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"context"
+	"slices"
+)
+
+// Principal is a struct that represents who makes a request, once authenticated
+type Principal struct {
+	// Subject identifies the principal, e.g. apikey:ci or jwt:jdoe
+	Subject string
+	// Scopes are the scopes granted to the principal
+	Scopes []Scope
+}
+
+// HasScope is a method that reports whether the scope is granted to the principal
+func (p Principal) HasScope(scope Scope) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// contextKeyPrincipal is the key of the principal of a context
+type contextKeyPrincipal struct{}
+
+// ContextWithPrincipal is a function that returns a copy of ctx with the authenticated principal
+func ContextWithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, contextKeyPrincipal{}, p)
+}
+
+// PrincipalFromContext is a function that returns the principal of ctx, false if the context is not authenticated
+func PrincipalFromContext(ctx context.Context) (p Principal, ok bool) {
+	p, ok = ctx.Value(contextKeyPrincipal{}).(Principal)
+	return
+}
@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"app/internal"
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+// Rebuilder is an interface that represents a read model rebuilt from its events (see service.VehicleEventSourced)
+type Rebuilder interface {
+	// Rebuild rebuilds the read model from the events
+	Rebuild(ctx context.Context) (err error)
+}
+
+// Rebuild is a function that returns a handler for the admin route POST /admin/rebuild
+// - it responds 204 once the read model is rebuilt, it is rebuilt aside and swapped in
+// so reads during the rebuild see the previous state, never a partial one
+func Rebuild(rb Rebuilder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := internal.LoggerFromContext(r.Context())
+		logger.Info("read model rebuild requested", slog.String("actor", internal.ActorFromContext(r.Context())))
+		if err := rb.Rebuild(r.Context()); err != nil {
+			logger.Error("read model rebuild failed", slog.Any("error", err))
+			respond(w, r, http.StatusInternalServerError, "error rebuilding read model", nil)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"app/internal"
+	"net/http"
+	"time"
+)
+
+// QueryAsOf is the query parameter of the point in time of the read routes, in RFC 3339 (e.g. 2026-01-01T00:00:00Z)
+const QueryAsOf = "as_of"
+
+// ReadOnlyAsOf is a middleware that rejects the writes with the query parameter as_of
+// - a point in time is a read-only view of the vehicles, writes respond 405
+func ReadOnlyAsOf(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has(QueryAsOf) && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			respond(w, r, http.StatusMethodNotAllowed, "as_of is read-only", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// reader is a method that returns the service of the read routes, the view of the vehicles at as_of if it is set
+// - it writes the error response and returns ok false if as_of is invalid or the view can not be built
+func (h *VehicleDefault) reader(w http.ResponseWriter, r *http.Request) (sv internal.VehicleService, ok bool) {
+	t, set, err := asOf(r)
+	if err != nil {
+		respond(w, r, http.StatusBadRequest, "invalid as_of", nil)
+		return
+	}
+	if !set {
+		return h.sv, true
+	}
+	sv, err = h.sv.AsOf(r.Context(), t)
+	if err != nil {
+		respond(w, r, http.StatusInternalServerError, "error getting vehicles", nil)
+		return
+	}
+	ok = true
+	return
+}
+
+// asOf is a function that returns the point in time of the query parameter as_of, set is false if it is missing
+func asOf(r *http.Request) (t time.Time, set bool, err error) {
+	if !r.URL.Query().Has(QueryAsOf) {
+		return
+	}
+	set = true
+	t, err = time.Parse(time.RFC3339, r.URL.Query().Get(QueryAsOf))
+	return
+}
@@ -0,0 +1,96 @@
+package handler_test
+
+import (
+	"app/internal"
+	"app/internal/handler"
+	"app/internal/repository"
+	"app/internal/service"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests for the points in time (as_of) of VehicleDefault
+func TestVehicleDefault_AsOf(t *testing.T) {
+	// written is a function that returns a read-only router over the vehicles of the negotiation tests,
+	// and the instant before the vehicle 1 was painted blue
+	written := func(t *testing.T) (rt http.Handler, at string) {
+		sv := service.NewVehicleDefault(repository.NewVehicleMap(negotiationVehicles()))
+		at = time.Now().UTC().Format(time.RFC3339Nano)
+		time.Sleep(time.Millisecond)
+		v := negotiationVehicles()[1]
+		v.Color = "blue"
+		require.NoError(t, sv.Update(internal.ContextWithActor(context.Background(), "alice"), &v, 1))
+
+		hd := handler.NewVehicleDefault(sv)
+		r := chi.NewRouter()
+		r.Use(handler.ReadOnlyAsOf)
+		r.Get("/vehicles/{id}", hd.GetById())
+		r.Put("/vehicles/{id}", hd.Update())
+		r.Delete("/vehicles/{id}", hd.Delete())
+		rt = r
+		return
+	}
+	do := func(rt http.Handler, method, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(etagVehicle("green")))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", `"2"`)
+		rr := httptest.NewRecorder()
+		rt.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("case 1: should return the vehicle as it was at as_of", func(t *testing.T) {
+		// arrange
+		rt, at := written(t)
+
+		// act
+		rrBefore := do(rt, http.MethodGet, "/vehicles/1?as_of="+url.QueryEscape(at))
+		rrNow := do(rt, http.MethodGet, "/vehicles/1")
+
+		// assert
+		require.Equal(t, http.StatusOK, rrBefore.Code)
+		require.Equal(t, `"1"`, rrBefore.Header().Get("ETag"))
+		require.Contains(t, rrBefore.Body.String(), `"color":"red"`)
+		require.Equal(t, http.StatusOK, rrNow.Code)
+		require.Equal(t, `"2"`, rrNow.Header().Get("ETag"))
+		require.Contains(t, rrNow.Body.String(), `"color":"blue"`)
+	})
+
+	t.Run("case 2: should respond 405 to the writes with as_of and write nothing", func(t *testing.T) {
+		// arrange
+		rt, at := written(t)
+
+		// act
+		rrPut := do(rt, http.MethodPut, "/vehicles/1?as_of="+url.QueryEscape(at))
+		rrDelete := do(rt, http.MethodDelete, "/vehicles/1?as_of="+url.QueryEscape(at))
+		rrNow := do(rt, http.MethodGet, "/vehicles/1")
+
+		// assert
+		for _, rr := range []*httptest.ResponseRecorder{rrPut, rrDelete} {
+			require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+			require.Equal(t, "GET, HEAD", rr.Header().Get("Allow"))
+			require.JSONEq(t, `{"message":"as_of is read-only"}`, rr.Body.String())
+		}
+		require.Equal(t, `"2"`, rrNow.Header().Get("ETag"))
+	})
+
+	t.Run("case 3: should respond 400 to an invalid as_of", func(t *testing.T) {
+		// arrange
+		rt, _ := written(t)
+
+		// act
+		rr := do(rt, http.MethodGet, "/vehicles/1?as_of=yesterday")
+
+		// assert
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.JSONEq(t, `{"message":"invalid as_of"}`, rr.Body.String())
+	})
+}
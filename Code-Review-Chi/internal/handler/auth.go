@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"app/internal"
+	"app/internal/auth"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// HeaderAPIKey is the header with the API key of a request
+const HeaderAPIKey = "X-API-Key"
+
+// bearerPrefix is the prefix of the Authorization header with a bearer token
+const bearerPrefix = "Bearer "
+
+// Authenticate is a function that returns a middleware that authenticates the requests
+// with an API key or a bearer token (JWT), nil keys or tokens disable that kind of credentials
+// - a request with valid credentials gets its principal in the context (see auth.ContextWithPrincipal)
+// and the subject in its logger
+// - the subject is apikey:<name> for an API key and jwt:<sub> for a token, a token can not pass for a key in the history
+// - a request with invalid, expired or revoked credentials gets 401, a request without credentials goes on unauthenticated
+func Authenticate(keys *auth.APIKeyFile, tokens *auth.JWTVerifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var p auth.Principal
+			key := r.Header.Get(HeaderAPIKey)
+			authorization := r.Header.Get("Authorization")
+			switch {
+			case key != "" && keys != nil:
+				k, err := keys.Authenticate(key)
+				if err != nil {
+					unauthorized(w, r, "invalid api key")
+					return
+				}
+				p = auth.Principal{Subject: "apikey:" + k.Name, Scopes: k.Scopes}
+			case authorization != "" && tokens != nil:
+				token, ok := strings.CutPrefix(authorization, bearerPrefix)
+				if !ok {
+					unauthorized(w, r, "unsupported authorization scheme")
+					return
+				}
+				var err error
+				if p, err = tokens.Verify(token); err != nil {
+					unauthorized(w, r, "invalid token")
+					return
+				}
+				p.Subject = "jwt:" + p.Subject
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx := auth.ContextWithPrincipal(r.Context(), p)
+			ctx = internal.ContextWithLogger(ctx, internal.LoggerFromContext(ctx).With(slog.String("subject", p.Subject)))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireScope is a function that returns a middleware that only lets through the principals granted the scope
+// - it responds 401 to unauthenticated requests and 403 to principals without the scope
+func RequireScope(scope auth.Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := auth.PrincipalFromContext(r.Context())
+			if !ok {
+				unauthorized(w, r, "authentication required")
+				return
+			}
+			if !p.HasScope(scope) {
+				respond(w, r, http.StatusForbidden, "scope "+string(scope)+" required", nil)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// unauthorized is a function that responds 401 with the challenges of the API key and bearer authentications
+func unauthorized(w http.ResponseWriter, r *http.Request, message string) {
+	w.Header().Add("WWW-Authenticate", `APIKey header="`+HeaderAPIKey+`"`)
+	w.Header().Add("WWW-Authenticate", `Bearer realm="vehicles"`)
+	respond(w, r, http.StatusUnauthorized, message, nil)
+}
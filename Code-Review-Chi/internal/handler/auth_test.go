@@ -0,0 +1,166 @@
+package handler_test
+
+import (
+	"app/internal/auth"
+	"app/internal/handler"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// principalHandler is a function that returns a handler responding with the subject of the principal of the request
+func principalHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := auth.PrincipalFromContext(r.Context())
+		if !ok {
+			w.Write([]byte("anonymous"))
+			return
+		}
+		w.Write([]byte(p.Subject))
+	})
+}
+
+// signHS256 is a function that returns a token with the claims signed with HS256
+func signHS256(t *testing.T, secret []byte, claims map[string]any) string {
+	header, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// requireUnauthorized is a function that asserts rr is the 401 envelope with message and the challenges
+func requireUnauthorized(t *testing.T, rr *httptest.ResponseRecorder, message string) {
+	require.Equal(t, http.StatusUnauthorized, rr.Code)
+	require.Equal(t, []string{`APIKey header="X-API-Key"`, `Bearer realm="vehicles"`}, rr.Header().Values("WWW-Authenticate"))
+	require.JSONEq(t, `{"message":"`+message+`"}`, rr.Body.String())
+}
+
+// Tests for Authenticate
+func TestAuthenticate(t *testing.T) {
+	tokenSecret := []byte(strings.Repeat("s", 32))
+	// authenticated is a function that returns the Authenticate middleware over principalHandler, and a valid API key
+	authenticated := func(t *testing.T) (hd http.Handler, key string) {
+		keys, err := auth.OpenAPIKeyFile(filepath.Join(t.TempDir(), "apikeys.json"))
+		require.NoError(t, err)
+		key, _, err = keys.Mint("ci", []auth.Scope{auth.ScopeRead})
+		require.NoError(t, err)
+		tokens, err := auth.NewJWTVerifier(auth.ConfigJWTVerifier{HS256Secret: tokenSecret})
+		require.NoError(t, err)
+		hd = handler.Authenticate(keys, tokens)(principalHandler())
+		return
+	}
+	do := func(hd http.Handler, header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/vehicles", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		rr := httptest.NewRecorder()
+		hd.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("case 1: should set the principal of a valid API key", func(t *testing.T) {
+		// arrange
+		hd, key := authenticated(t)
+
+		// act
+		rr := do(hd, handler.HeaderAPIKey, key)
+
+		// assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "apikey:ci", rr.Body.String())
+	})
+
+	t.Run("case 2: should respond 401 with the challenges to invalid credentials", func(t *testing.T) {
+		// arrange
+		hd, _ := authenticated(t)
+
+		// act
+		rrKey := do(hd, handler.HeaderAPIKey, "vk_unknown")
+		rrScheme := do(hd, "Authorization", "Basic YWxpY2U6c2VjcmV0")
+		rrToken := do(hd, "Authorization", "Bearer not.a.token")
+
+		// assert
+		requireUnauthorized(t, rrKey, "invalid api key")
+		requireUnauthorized(t, rrScheme, "unsupported authorization scheme")
+		requireUnauthorized(t, rrToken, "invalid token")
+	})
+
+	t.Run("case 3: should let a request without credentials go on without a principal", func(t *testing.T) {
+		// arrange
+		hd, _ := authenticated(t)
+
+		// act
+		rr := do(hd, "", "")
+
+		// assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "anonymous", rr.Body.String())
+	})
+
+	t.Run("case 4: should set the subject of a token apart from the subjects of the API keys", func(t *testing.T) {
+		// arrange
+		hd, _ := authenticated(t)
+		token := signHS256(t, tokenSecret, map[string]any{"sub": "apikey:ci", "exp": time.Now().Add(time.Hour).Unix(), "roles": []string{"viewer"}})
+
+		// act
+		rr := do(hd, "Authorization", "Bearer "+token)
+
+		// assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "jwt:apikey:ci", rr.Body.String())
+	})
+}
+
+// Tests for RequireScope
+func TestRequireScope(t *testing.T) {
+	do := func(p *auth.Principal) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/vehicles/add", nil)
+		if p != nil {
+			req = req.WithContext(auth.ContextWithPrincipal(req.Context(), *p))
+		}
+		rr := httptest.NewRecorder()
+		handler.RequireScope(auth.ScopeWrite)(principalHandler()).ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("case 1: should respond 401 with the challenges to unauthenticated requests", func(t *testing.T) {
+		// act
+		rr := do(nil)
+
+		// assert
+		requireUnauthorized(t, rr, "authentication required")
+	})
+
+	t.Run("case 2: should respond 403 to principals without the scope", func(t *testing.T) {
+		// act
+		rr := do(&auth.Principal{Subject: "apikey:ci", Scopes: []auth.Scope{auth.ScopeRead}})
+
+		// assert
+		require.Equal(t, http.StatusForbidden, rr.Code)
+		require.Empty(t, rr.Header().Values("WWW-Authenticate"))
+		require.JSONEq(t, `{"message":"scope write required"}`, rr.Body.String())
+	})
+
+	t.Run("case 3: should let through the principals granted the scope", func(t *testing.T) {
+		// act
+		rr := do(&auth.Principal{Subject: "apikey:ci", Scopes: []auth.Scope{auth.ScopeRead, auth.ScopeWrite}})
+
+		// assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "apikey:ci", rr.Body.String())
+	})
+}
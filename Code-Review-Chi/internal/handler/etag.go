@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// etag is a function that returns the entity tag of a version of a vehicle
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// matchETag is a function that reports whether a list of entity tags (If-Match, If-None-Match) matches a version
+// - * matches any version
+// - weak is the comparison of If-None-Match, where W/"1" matches "1"; If-Match only matches strong tags
+func matchETag(header string, version int, weak bool) bool {
+	current := etag(version)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = tag[2:]
+		}
+		if tag == current {
+			return true
+		}
+	}
+	return false
+}
+
+// vehicleID is a function that returns the id of the path of a vehicle, ok is false if it is not a positive integer
+func vehicleID(r *http.Request) (id int, ok bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	ok = err == nil && id > 0
+	return
+}
+
+// mergeVehicle is a function that returns v with the fields present in a partial body replaced by the values of body
+// - fields are the names of the fields present in the body (see decodeVehicleBody)
+func mergeVehicle(v VehicleJSON, fields map[string]any, body VehicleJSON) VehicleJSON {
+	dst := reflect.ValueOf(&v).Elem()
+	src := reflect.ValueOf(body)
+	for i, name := range vehicleColumns {
+		if _, ok := fields[name]; ok {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+	return v
+}
@@ -0,0 +1,144 @@
+package handler_test
+
+import (
+	"app/internal/handler"
+	"app/internal/repository"
+	"app/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// newETagRouter is a function that returns a router with the write routes over the vehicles of the negotiation tests
+func newETagRouter() http.Handler {
+	hd := handler.NewVehicleDefault(service.NewVehicleDefault(repository.NewVehicleMap(negotiationVehicles())))
+	rt := chi.NewRouter()
+	rt.Post("/vehicles", hd.Save())
+	rt.Get("/vehicles/{id}", hd.GetById())
+	rt.Put("/vehicles/{id}", hd.Update())
+	rt.Patch("/vehicles/{id}", hd.Patch())
+	rt.Delete("/vehicles/{id}", hd.Delete())
+	return rt
+}
+
+// etagVehicle is the body of the vehicle 1 of the negotiation tests with the given color
+func etagVehicle(color string) string {
+	return `{"id":1,"brand":"Ford","model":"Fiesta","registration":"ABC123","color":"` + color + `","year":2010,"passengers":5,"max_speed":180,"fuel_type":"gas","transmission":"manual","weight":1000,"height":0,"length":0,"width":0}`
+}
+
+// Tests for the conditional requests of VehicleDefault
+func TestVehicleDefault_ETag(t *testing.T) {
+	do := func(rt http.Handler, method, target, body string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		rt.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("case 1: should respond 428 to a write without If-Match", func(t *testing.T) {
+		// arrange
+		rt := newETagRouter()
+
+		// act
+		rrPut := do(rt, http.MethodPut, "/vehicles/1", etagVehicle("blue"), nil)
+		rrPatch := do(rt, http.MethodPatch, "/vehicles/1", `{"color":"blue"}`, nil)
+		rrDelete := do(rt, http.MethodDelete, "/vehicles/1", "", nil)
+
+		// assert
+		for _, rr := range []*httptest.ResponseRecorder{rrPut, rrPatch, rrDelete} {
+			require.Equal(t, http.StatusPreconditionRequired, rr.Code)
+			require.JSONEq(t, `{"message":"If-Match header is required"}`, rr.Body.String())
+		}
+	})
+
+	t.Run("case 2: should write with the current ETag and respond 412 to a stale one with the current ETag", func(t *testing.T) {
+		// arrange
+		rt := newETagRouter()
+
+		// act
+		rrPut := do(rt, http.MethodPut, "/vehicles/1", etagVehicle("blue"), map[string]string{"If-Match": `"1"`})
+		rrStale := do(rt, http.MethodPatch, "/vehicles/1", `{"color":"green"}`, map[string]string{"If-Match": `"1"`})
+		rrWeak := do(rt, http.MethodDelete, "/vehicles/1", "", map[string]string{"If-Match": `W/"2"`})
+
+		// assert
+		require.Equal(t, http.StatusOK, rrPut.Code)
+		require.Equal(t, `"2"`, rrPut.Header().Get("ETag"))
+		require.Equal(t, http.StatusPreconditionFailed, rrStale.Code)
+		require.Equal(t, `"2"`, rrStale.Header().Get("ETag"))
+		require.JSONEq(t, `{"message":"vehicle was modified"}`, rrStale.Body.String())
+		require.Equal(t, http.StatusPreconditionFailed, rrWeak.Code)
+	})
+
+	t.Run("case 3: should respond 304 to a read with a matching If-None-Match", func(t *testing.T) {
+		// arrange
+		rt := newETagRouter()
+
+		// act
+		rrMatch := do(rt, http.MethodGet, "/vehicles/1", "", map[string]string{"If-None-Match": `W/"1"`})
+		rrOther := do(rt, http.MethodGet, "/vehicles/1", "", map[string]string{"If-None-Match": `"2"`})
+
+		// assert
+		require.Equal(t, http.StatusNotModified, rrMatch.Code)
+		require.Equal(t, `"1"`, rrMatch.Header().Get("ETag"))
+		require.Empty(t, rrMatch.Body.String())
+		require.Equal(t, http.StatusOK, rrOther.Code)
+		require.Equal(t, `"1"`, rrOther.Header().Get("ETag"))
+	})
+
+	t.Run("case 4: should respond 412 to the ETag of a deleted vehicle after its id is created again", func(t *testing.T) {
+		// arrange
+		rt := newETagRouter()
+		require.Equal(t, http.StatusNoContent, do(rt, http.MethodDelete, "/vehicles/1", "", map[string]string{"If-Match": `"1"`}).Code)
+
+		// act
+		rrCreate := do(rt, http.MethodPost, "/vehicles", etagVehicle("red"), nil)
+		rrStale := do(rt, http.MethodPut, "/vehicles/1", etagVehicle("blue"), map[string]string{"If-Match": `"1"`})
+
+		// assert
+		require.Equal(t, http.StatusCreated, rrCreate.Code)
+		require.Equal(t, `"2"`, rrCreate.Header().Get("ETag"))
+		require.Equal(t, http.StatusPreconditionFailed, rrStale.Code)
+	})
+
+	t.Run("case 5: should create a vehicle only once and respond 409 to the other creates", func(t *testing.T) {
+		// arrange
+		rt := newETagRouter()
+		body := strings.Replace(etagVehicle("red"), `"id":1`, `"id":7`, 1)
+		const n = 8
+		codes := make([]int, n)
+
+		// act
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				codes[i] = do(rt, http.MethodPost, "/vehicles", body, nil).Code
+			}(i)
+		}
+		wg.Wait()
+		rrExisting := do(rt, http.MethodPost, "/vehicles", etagVehicle("red"), nil)
+
+		// assert
+		created := 0
+		for _, code := range codes {
+			if code == http.StatusCreated {
+				created++
+				continue
+			}
+			require.Equal(t, http.StatusConflict, code)
+		}
+		require.Equal(t, 1, created)
+		require.Equal(t, http.StatusConflict, rrExisting.Code)
+		require.JSONEq(t, `{"message":"vehicle already exists"}`, rrExisting.Body.String())
+	})
+}
@@ -0,0 +1,254 @@
+package handler
+
+import (
+	"app/internal"
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// vehicleColumns is the column set of the exports, it matches the json tags of VehicleJSON
+var vehicleColumns = func() (columns []string) {
+	rt := reflect.TypeOf(VehicleJSON{})
+	for i := 0; i < rt.NumField(); i++ {
+		name, _, _ := strings.Cut(rt.Field(i).Tag.Get("json"), ",")
+		columns = append(columns, name)
+	}
+	return
+}()
+
+// record is a method that returns the values of the vehicle in the order of vehicleColumns
+func (v VehicleJSON) record() (r []any) {
+	rv := reflect.ValueOf(v)
+	r = make([]any, rv.NumField())
+	for i := range r {
+		r[i] = rv.Field(i).Interface()
+	}
+	return
+}
+
+// serializeVehicle is a function that returns the JSON representation of a vehicle
+func serializeVehicle(v internal.Vehicle) VehicleJSON {
+	return VehicleJSON{
+		ID:              v.Id,
+		Brand:           v.Brand,
+		Model:           v.Model,
+		Registration:    v.Registration,
+		Color:           v.Color,
+		FabricationYear: v.FabricationYear,
+		Capacity:        v.Capacity,
+		MaxSpeed:        v.MaxSpeed,
+		FuelType:        v.FuelType,
+		Transmission:    v.Transmission,
+		Weight:          v.Weight,
+		Height:          v.Height,
+		Length:          v.Length,
+		Width:           v.Width,
+	}
+}
+
+// serializeVehicles is a function that returns the JSON representation of the vehicles ordered by id
+func serializeVehicles(v map[int]internal.Vehicle) (data []VehicleJSON) {
+	data = make([]VehicleJSON, 0, len(v))
+	for _, value := range v {
+		data = append(data, serializeVehicle(value))
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].ID < data[j].ID })
+	return
+}
+
+// exporter is a struct that represents an export format
+type exporter struct {
+	// contentType is the media type of the format
+	contentType string
+	// extension is the file extension of the format
+	extension string
+	// write is the function that streams the vehicles in the format
+	write func(w io.Writer, data []VehicleJSON) (err error)
+}
+
+// exporters are the supported export formats by name (query parameter "format")
+var exporters = map[string]exporter{
+	"csv":    {contentType: "text/csv; charset=utf-8", extension: "csv", write: writeCSV},
+	"ndjson": {contentType: "application/x-ndjson", extension: "ndjson", write: writeNDJSON},
+	"xlsx":   {contentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", extension: "xlsx", write: writeXLSX},
+}
+
+// export is a function that streams the vehicles as a file download in the format requested by the query parameter "format"
+// - ok is false if no export was requested, in that case nothing is written
+// - an empty result is still exported with 200, as a file with only the header (CSV and XLSX) or no line (NDJSON)
+func export(w http.ResponseWriter, r *http.Request, name string, v map[int]internal.Vehicle) (ok bool) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		return
+	}
+	ok = true
+
+	ex, found := exporters[format]
+	if !found {
+		respond(w, r, http.StatusBadRequest, "invalid format", nil)
+		return
+	}
+
+	// response
+	w.Header().Set("Content-Type", ex.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, ex.extension))
+	w.WriteHeader(http.StatusOK)
+	// - the status is already sent, an error here can only abort the stream
+	_ = ex.write(w, serializeVehicles(v))
+	return
+}
+
+// formatCell is a function that returns the text representation of a cell value
+// - strings are neutralized so a spreadsheet never evaluates them (see neutralizeCell)
+func formatCell(value any) string {
+	switch value := value.(type) {
+	case string:
+		return neutralizeCell(value)
+	case int:
+		return strconv.Itoa(value)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// neutralizeCell is a function that prefixes with a single quote a text that a spreadsheet would read as a formula
+// - texts starting with =, +, -, @, a tab or a carriage return (formula injection)
+func neutralizeCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// writeCSV is a function that streams the vehicles in CSV format with a header row
+func writeCSV(w io.Writer, data []VehicleJSON) (err error) {
+	cw := csv.NewWriter(w)
+	if err = cw.Write(vehicleColumns); err != nil {
+		return
+	}
+	row := make([]string, len(vehicleColumns))
+	for _, v := range data {
+		for i, value := range v.record() {
+			row[i] = formatCell(value)
+		}
+		if err = cw.Write(row); err != nil {
+			return
+		}
+	}
+	cw.Flush()
+	err = cw.Error()
+	return
+}
+
+// writeNDJSON is a function that streams the vehicles in newline delimited JSON format
+func writeNDJSON(w io.Writer, data []VehicleJSON) (err error) {
+	enc := json.NewEncoder(w)
+	for _, v := range data {
+		if err = enc.Encode(v); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// xlsx static parts of a workbook with a single sheet
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+	xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="vehicles" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+	xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetEnd = `</sheetData></worksheet>`
+)
+
+// writeXLSX is a function that streams the vehicles as a basic XLSX workbook with a header row
+func writeXLSX(w io.Writer, data []VehicleJSON) (err error) {
+	zw := zip.NewWriter(w)
+
+	// static parts
+	for _, part := range []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	} {
+		var fw io.Writer
+		if fw, err = zw.Create(part.name); err != nil {
+			return
+		}
+		if _, err = io.WriteString(fw, part.content); err != nil {
+			return
+		}
+	}
+
+	// sheet
+	sw, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return
+	}
+	if _, err = io.WriteString(sw, xlsxSheetStart); err != nil {
+		return
+	}
+	// - header
+	header := make([]any, len(vehicleColumns))
+	for i, column := range vehicleColumns {
+		header[i] = column
+	}
+	if err = writeXLSXRow(sw, header); err != nil {
+		return
+	}
+	// - rows
+	for _, v := range data {
+		if err = writeXLSXRow(sw, v.record()); err != nil {
+			return
+		}
+	}
+	if _, err = io.WriteString(sw, xlsxSheetEnd); err != nil {
+		return
+	}
+
+	err = zw.Close()
+	return
+}
+
+// writeXLSXRow is a function that writes a row of a sheet, strings are written inline (neutralized) and numbers as values
+func writeXLSXRow(w io.Writer, values []any) (err error) {
+	if _, err = io.WriteString(w, "<row>"); err != nil {
+		return
+	}
+	for _, value := range values {
+		switch value := value.(type) {
+		case string:
+			if _, err = io.WriteString(w, `<c t="inlineStr"><is><t>`); err != nil {
+				return
+			}
+			if err = xml.EscapeText(w, []byte(neutralizeCell(value))); err != nil {
+				return
+			}
+			_, err = io.WriteString(w, "</t></is></c>")
+		default:
+			_, err = fmt.Fprintf(w, "<c><v>%s</v></c>", formatCell(value))
+		}
+		if err != nil {
+			return
+		}
+	}
+	_, err = io.WriteString(w, "</row>")
+	return
+}
@@ -0,0 +1,146 @@
+package handler_test
+
+import (
+	"app/internal"
+	"app/internal/handler"
+	"app/internal/repository"
+	"app/internal/service"
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// newExportRouter is a function that returns a router with the export routes over the given vehicles
+func newExportRouter(db map[int]internal.Vehicle) http.Handler {
+	hd := handler.NewVehicleDefault(service.NewVehicleDefault(repository.NewVehicleMap(db)))
+	rt := chi.NewRouter()
+	rt.Get("/vehicles", hd.GetAll())
+	rt.Get("/vehicles/fuel_type/{type}", hd.GetByFuelType())
+	return rt
+}
+
+// exportVehicles are the vehicles of the export tests, the second one has formulas in its texts
+func exportVehicles() map[int]internal.Vehicle {
+	return map[int]internal.Vehicle{
+		1: {Id: 1, VehicleAttributes: internal.VehicleAttributes{Brand: "Ford", Model: "Fiesta", Registration: "ABC123", Color: "red", FabricationYear: 2010, Capacity: 5, MaxSpeed: 180.5, FuelType: "gas", Transmission: "manual", Weight: 1000}},
+		2: {Id: 2, VehicleAttributes: internal.VehicleAttributes{Brand: `=HYPERLINK("http://evil")`, Model: "+1", Registration: "-2", Color: "@SUM(A1)", FabricationYear: 2020, Capacity: 4, MaxSpeed: 200, FuelType: "gas", Transmission: "automatic", Weight: 1200}},
+	}
+}
+
+// Tests for the exports of VehicleDefault
+func TestVehicleDefault_Export(t *testing.T) {
+	get := func(db map[int]internal.Vehicle, target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		newExportRouter(db).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		return rr
+	}
+	header := "id,brand,model,registration,color,year,passengers,max_speed,fuel_type,transmission,weight,height,length,width"
+	sheet := func(t *testing.T, body []byte) string {
+		zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		require.NoError(t, err)
+		f, err := zr.Open("xl/worksheets/sheet1.xml")
+		require.NoError(t, err)
+		defer f.Close()
+		content, err := io.ReadAll(f)
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	t.Run("case 1: should export the vehicles as CSV with neutralized formulas", func(t *testing.T) {
+		// arrange
+		// ...
+
+		// act
+		rr := get(exportVehicles(), "/vehicles?format=csv")
+
+		// assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "text/csv; charset=utf-8", rr.Header().Get("Content-Type"))
+		require.Equal(t, `attachment; filename="vehicles.csv"`, rr.Header().Get("Content-Disposition"))
+		records, err := csv.NewReader(rr.Body).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 3)
+		require.Equal(t, header, strings.Join(records[0], ","))
+		require.Equal(t, []string{"1", "Ford", "Fiesta", "ABC123", "red", "2010", "5", "180.5", "gas", "manual", "1000", "0", "0", "0"}, records[1])
+		require.Equal(t, []string{"2", `'=HYPERLINK("http://evil")`, "'+1", "'-2", "'@SUM(A1)"}, records[2][:5])
+	})
+
+	t.Run("case 2: should export the vehicles as NDJSON without altering the texts", func(t *testing.T) {
+		// arrange
+		// ...
+
+		// act
+		rr := get(exportVehicles(), "/vehicles?format=ndjson")
+
+		// assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "application/x-ndjson", rr.Header().Get("Content-Type"))
+		require.Equal(t, `attachment; filename="vehicles.ndjson"`, rr.Header().Get("Content-Disposition"))
+		lines := strings.Split(strings.TrimSuffix(rr.Body.String(), "\n"), "\n")
+		require.Len(t, lines, 2)
+		var v handler.VehicleJSON
+		require.NoError(t, json.Unmarshal([]byte(lines[1]), &v))
+		require.Equal(t, 2, v.ID)
+		require.Equal(t, `=HYPERLINK("http://evil")`, v.Brand)
+	})
+
+	t.Run("case 3: should export the vehicles as XLSX with neutralized formulas", func(t *testing.T) {
+		// arrange
+		// ...
+
+		// act
+		rr := get(exportVehicles(), "/vehicles?format=xlsx")
+
+		// assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", rr.Header().Get("Content-Type"))
+		require.Equal(t, `attachment; filename="vehicles.xlsx"`, rr.Header().Get("Content-Disposition"))
+		content := sheet(t, rr.Body.Bytes())
+		require.Equal(t, 3, strings.Count(content, "<row>"))
+		require.Contains(t, content, `<c t="inlineStr"><is><t>Ford</t></is></c>`)
+		require.Contains(t, content, `<c><v>180.5</v></c>`)
+		require.Contains(t, content, `<c t="inlineStr"><is><t>&#39;=HYPERLINK(&#34;http://evil&#34;)</t></is></c>`)
+		require.Contains(t, content, `<c t="inlineStr"><is><t>&#39;+1</t></is></c>`)
+		require.NotContains(t, content, `<t>=`)
+	})
+
+	t.Run("case 4: should export an empty result as files with only the header", func(t *testing.T) {
+		// arrange
+		db := exportVehicles()
+
+		// act
+		rrCSV := get(db, "/vehicles/fuel_type/hydrogen?format=csv")
+		rrNDJSON := get(db, "/vehicles/fuel_type/hydrogen?format=ndjson")
+		rrXLSX := get(db, "/vehicles/fuel_type/hydrogen?format=xlsx")
+
+		// assert
+		require.Equal(t, http.StatusOK, rrCSV.Code)
+		require.Equal(t, `attachment; filename="vehicles_fuel_type.csv"`, rrCSV.Header().Get("Content-Disposition"))
+		require.Equal(t, header+"\n", rrCSV.Body.String())
+		require.Equal(t, http.StatusOK, rrNDJSON.Code)
+		require.Empty(t, rrNDJSON.Body.String())
+		require.Equal(t, http.StatusOK, rrXLSX.Code)
+		require.Equal(t, 1, strings.Count(sheet(t, rrXLSX.Body.Bytes()), "<row>"))
+	})
+
+	t.Run("case 5: should not export an unknown format", func(t *testing.T) {
+		// arrange
+		// ...
+
+		// act
+		rr := get(exportVehicles(), "/vehicles?format=pdf")
+
+		// assert
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.JSONEq(t, `{"message":"invalid format"}`, rr.Body.String())
+	})
+}
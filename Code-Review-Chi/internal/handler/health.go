@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"app/internal"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// pingTimeout is the maximum duration of the check of the repository on GET /readyz
+const pingTimeout = 2 * time.Second
+
+// BuildInfo is a struct that represents the build of the running binary
+type BuildInfo struct {
+	// Version is the version of the release, dev for local builds
+	Version string
+	// Revision is the VCS revision of the build, empty if unknown
+	Revision string
+	// GoVersion is the version of the Go toolchain of the build
+	GoVersion string
+}
+
+// DatasetInfo is a struct that represents the dataset loaded on start
+type DatasetInfo struct {
+	// Source is the path (or URL) of the dataset
+	Source string
+	// Vehicles is the number of vehicles once loaded
+	Vehicles int
+	// LoadedAt is the time at which the load finished
+	LoadedAt time.Time
+	// LoadDuration is the duration of the load
+	LoadDuration time.Duration
+}
+
+// InfoJSON is a struct that represents the info of the service in JSON format
+type InfoJSON struct {
+	Version        string    `json:"version" xml:"version" yaml:"version"`
+	Revision       string    `json:"revision,omitempty" xml:"revision,omitempty" yaml:"revision,omitempty"`
+	GoVersion      string    `json:"go_version" xml:"go_version" yaml:"go_version"`
+	StartedAt      time.Time `json:"started_at" xml:"started_at" yaml:"started_at"`
+	Ready          bool      `json:"ready" xml:"ready" yaml:"ready"`
+	Source         string    `json:"source,omitempty" xml:"source,omitempty" yaml:"source,omitempty"`
+	Vehicles       int       `json:"vehicles" xml:"vehicles" yaml:"vehicles"`
+	LoadedAt       time.Time `json:"loaded_at" xml:"loaded_at" yaml:"loaded_at"`
+	LoadDurationMs int64     `json:"load_duration_ms" xml:"load_duration_ms" yaml:"load_duration_ms"`
+}
+
+// NewHealth is a function that returns a new instance of Health, not ready until SetReady is called
+func NewHealth(build BuildInfo) *Health {
+	return &Health{build: build, startedAt: time.Now()}
+}
+
+// Health is a struct with methods that represent handlers for the health, readiness and info of the service
+type Health struct {
+	// build is the build of the running binary
+	build BuildInfo
+	// startedAt is the time at which the service started
+	startedAt time.Time
+
+	// mu guards the state below, it changes while the handlers run
+	mu sync.RWMutex
+	// ready is true once the dataset is loaded and until the service starts draining
+	ready bool
+	// rp is the repository checked by the readiness
+	rp internal.VehicleRepository
+	// dataset is the dataset loaded on start
+	dataset DatasetInfo
+}
+
+// SetReady is a method that records the dataset loaded into rp and marks the service as ready
+// - rp is checked by GET /readyz if it implements internal.Pinger
+func (h *Health) SetReady(rp internal.VehicleRepository, dataset DatasetInfo) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rp = rp
+	h.dataset = dataset
+	h.ready = true
+}
+
+// SetDraining is a method that marks the service as not ready, so that load balancers stop routing to it before shutdown
+func (h *Health) SetDraining() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ready = false
+}
+
+// Healthz is a method that returns a handler for the route GET /healthz
+// - it responds 200 as long as the process is serving
+func (h *Health) Healthz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		respond(w, r, http.StatusOK, "ok", nil)
+	}
+}
+
+// Readyz is a method that returns a handler for the route GET /readyz
+// - it responds 200 once the dataset is loaded and while the repository is reachable, 503 otherwise
+func (h *Health) Readyz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.mu.RLock()
+		ready, rp := h.ready, h.rp
+		h.mu.RUnlock()
+		if !ready {
+			respond(w, r, http.StatusServiceUnavailable, "not ready", nil)
+			return
+		}
+
+		if pinger, ok := rp.(internal.Pinger); ok {
+			ctx, cancel := context.WithTimeout(r.Context(), pingTimeout)
+			defer cancel()
+			if err := pinger.Ping(ctx); err != nil {
+				respond(w, r, http.StatusServiceUnavailable, "repository unreachable", nil)
+				return
+			}
+		}
+
+		respond(w, r, http.StatusOK, "ready", nil)
+	}
+}
+
+// Info is a method that returns a handler for the route GET /info
+func (h *Health) Info() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.mu.RLock()
+		ready, dataset := h.ready, h.dataset
+		h.mu.RUnlock()
+
+		data := InfoJSON{
+			Version:        h.build.Version,
+			Revision:       h.build.Revision,
+			GoVersion:      h.build.GoVersion,
+			StartedAt:      h.startedAt,
+			Ready:          ready,
+			Source:         dataset.Source,
+			Vehicles:       dataset.Vehicles,
+			LoadedAt:       dataset.LoadedAt,
+			LoadDurationMs: dataset.LoadDuration.Milliseconds(),
+		}
+		respond(w, r, http.StatusOK, "success", data)
+	}
+}
@@ -0,0 +1,85 @@
+package handler_test
+
+import (
+	"app/internal"
+	"app/internal/handler"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// pingerRepository is a struct that implements the VehicleRepository and Pinger interfaces, only Ping is usable
+type pingerRepository struct {
+	internal.VehicleRepository
+	// err is the error of Ping
+	err error
+}
+
+// Ping is a method that returns err
+func (r *pingerRepository) Ping(ctx context.Context) (err error) {
+	return r.err
+}
+
+// Tests for Health.Readyz
+func TestHealth_Readyz(t *testing.T) {
+	readyz := func(h *handler.Health) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.Readyz()(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rr
+	}
+
+	t.Run("case 1: should not be ready until the dataset is loaded", func(t *testing.T) {
+		// arrange
+		h := handler.NewHealth(handler.BuildInfo{})
+
+		// act
+		rr := readyz(h)
+
+		// assert
+		require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		require.JSONEq(t, `{"message":"not ready"}`, rr.Body.String())
+	})
+
+	t.Run("case 2: should be ready once the dataset is loaded and the repository is reachable", func(t *testing.T) {
+		// arrange
+		h := handler.NewHealth(handler.BuildInfo{})
+		h.SetReady(&pingerRepository{}, handler.DatasetInfo{Vehicles: 3})
+
+		// act
+		rr := readyz(h)
+
+		// assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.JSONEq(t, `{"message":"ready"}`, rr.Body.String())
+	})
+
+	t.Run("case 3: should not be ready if the repository is unreachable", func(t *testing.T) {
+		// arrange
+		h := handler.NewHealth(handler.BuildInfo{})
+		h.SetReady(&pingerRepository{err: errors.New("database is locked")}, handler.DatasetInfo{})
+
+		// act
+		rr := readyz(h)
+
+		// assert
+		require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		require.JSONEq(t, `{"message":"repository unreachable"}`, rr.Body.String())
+	})
+
+	t.Run("case 4: should not be ready while draining", func(t *testing.T) {
+		// arrange
+		h := handler.NewHealth(handler.BuildInfo{})
+		h.SetReady(&pingerRepository{}, handler.DatasetInfo{})
+
+		// act
+		h.SetDraining()
+		rr := readyz(h)
+
+		// assert
+		require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	})
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"app/internal"
+	"app/internal/auth"
+	"net/http"
+	"time"
+)
+
+// HeaderActor is the header with who makes a write, it is recorded in the history of the vehicle
+const HeaderActor = "X-Actor"
+
+// defaultActor is the actor of the writes without HeaderActor
+const defaultActor = "anonymous"
+
+// HistoryEntryJSON is a struct that represents an entry of the history of a vehicle in JSON format
+type HistoryEntryJSON struct {
+	Version   int               `json:"version" xml:"version" yaml:"version"`
+	Timestamp time.Time         `json:"timestamp" xml:"timestamp" yaml:"timestamp"`
+	Actor     string            `json:"actor" xml:"actor" yaml:"actor"`
+	Operation string            `json:"operation" xml:"operation" yaml:"operation"`
+	Changes   []FieldChangeJSON `json:"changes" xml:"changes>change" yaml:"changes"`
+}
+
+// Actor is a middleware that sets the actor of the context of the request (see internal.ContextWithActor)
+// - the actor is the subject of the authenticated principal, so the service audits who really made a write
+// - otherwise it is the header X-Actor, anonymous if it is missing
+func Actor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor := r.Header.Get(HeaderActor)
+		if p, ok := auth.PrincipalFromContext(r.Context()); ok {
+			actor = p.Subject
+		}
+		if actor == "" {
+			actor = defaultActor
+		}
+		next.ServeHTTP(w, r.WithContext(internal.ContextWithActor(r.Context(), actor)))
+	})
+}
+
+// GetHistory is a method that returns a handler for the route GET /vehicles/{id}/history
+// - the entries are ordered oldest first, the history of a deleted vehicle is still available
+func (h *VehicleDefault) GetHistory() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// REQUEST
+		// - get id from path
+		id, ok := vehicleID(r)
+		if !ok {
+			respond(w, r, http.StatusBadRequest, "invalid id", nil)
+			return
+		}
+
+		// PROCESS
+		// - calling the service
+		history, err := h.sv.FindHistory(r.Context(), id)
+		if err != nil {
+			respond(w, r, http.StatusInternalServerError, "error getting history", nil)
+			return
+		}
+
+		// - if the vehicle never existed
+		if len(history) == 0 {
+			respond(w, r, http.StatusNotFound, "vehicle not found", nil)
+			return
+		}
+
+		// RESPONSE
+		data := make([]HistoryEntryJSON, 0, len(history))
+		for _, e := range history {
+			data = append(data, serializeHistoryEntry(e))
+		}
+		respond(w, r, http.StatusOK, "success", data)
+	}
+}
+
+// serializeHistoryEntry is a function that returns the JSON representation of a history entry
+func serializeHistoryEntry(e internal.VehicleHistoryEntry) HistoryEntryJSON {
+	changes := make([]FieldChangeJSON, 0, len(e.Changes))
+	for _, c := range e.Changes {
+		changes = append(changes, FieldChangeJSON{Field: c.Field, Old: c.Old, New: c.New})
+	}
+	return HistoryEntryJSON{
+		Version:   e.Version,
+		Timestamp: e.Timestamp,
+		Actor:     e.Actor,
+		Operation: string(e.Operation),
+		Changes:   changes,
+	}
+}
@@ -0,0 +1,304 @@
+package handler
+
+import (
+	"app/internal"
+	"app/tools"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// vehicleRequiredFields are the fields a vehicle must have to be created or imported
+var vehicleRequiredFields = []string{"brand", "model", "registration", "color", "year", "passengers", "max_speed", "fuel_type", "transmission", "weight", "height", "length", "width"}
+
+// maxImportSize is the maximum size of an uploaded import file
+const maxImportSize = 32 << 20
+
+// FieldChangeJSON is a struct that represents the change of a field of a vehicle in JSON format
+type FieldChangeJSON struct {
+	Field string `json:"field" xml:"field" yaml:"field"`
+	Old   any    `json:"old" xml:"old" yaml:"old"`
+	New   any    `json:"new" xml:"new" yaml:"new"`
+}
+
+// ImportUpdateJSON is a struct that represents a vehicle updated by an import in JSON format
+type ImportUpdateJSON struct {
+	ID      int               `json:"id" xml:"id" yaml:"id"`
+	Changes []FieldChangeJSON `json:"changes" xml:"changes>change" yaml:"changes"`
+}
+
+// ImportRejectionJSON is a struct that represents a record rejected by an import in JSON format
+type ImportRejectionJSON struct {
+	Record int    `json:"record" xml:"record" yaml:"record"`
+	ID     int    `json:"id,omitempty" xml:"id,omitempty" yaml:"id,omitempty"`
+	Error  string `json:"error" xml:"error" yaml:"error"`
+}
+
+// ImportReportJSON is a struct that represents the result of an import in JSON format
+type ImportReportJSON struct {
+	DryRun    bool                  `json:"dry_run" xml:"dry_run" yaml:"dry_run"`
+	Created   []VehicleJSON         `json:"created" xml:"created>vehicle" yaml:"created"`
+	Updated   []ImportUpdateJSON    `json:"updated" xml:"updated>vehicle" yaml:"updated"`
+	Unchanged []int                 `json:"unchanged" xml:"unchanged>id" yaml:"unchanged"`
+	Rejected  []ImportRejectionJSON `json:"rejected" xml:"rejected>record" yaml:"rejected"`
+}
+
+// importRecord is a struct that represents a record of an import file
+type importRecord struct {
+	// vehicle is the vehicle of the record
+	vehicle VehicleJSON
+	// err is the error that makes the record invalid
+	err error
+}
+
+// Import is a method that returns a handler for the route POST /vehicles/import
+// - the file is uploaded as the multipart field "file" in CSV (with a header row) or JSON (array of vehicles) format
+// - by default it is a dry run that only reports the vehicles that would be created, updated or rejected
+// - with the query parameter dry_run=false the import is applied through the service as a single batch,
+// every vehicle is written with its history entry or none is
+// - the batch is only applied if no vehicle was written since it was planned, it responds 409 otherwise
+func (h *VehicleDefault) Import() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// REQUEST
+		// - mode
+		dryRun := true
+		if dryRunStr := r.URL.Query().Get("dry_run"); dryRunStr != "" {
+			var err error
+			if dryRun, err = strconv.ParseBool(dryRunStr); err != nil {
+				respond(w, r, http.StatusBadRequest, "invalid dry_run", nil)
+				return
+			}
+		}
+
+		// - file
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			respond(w, r, http.StatusBadRequest, "field file is required", nil)
+			return
+		}
+		defer file.Close()
+
+		// - records
+		var records []importRecord
+		switch importFormat(header.Header.Get("Content-Type"), header.Filename) {
+		case "csv":
+			records, err = readImportCSV(file)
+		case "json":
+			records, err = readImportJSON(file)
+		default:
+			respond(w, r, http.StatusUnsupportedMediaType, "unsupported file format, expected csv or json", nil)
+			return
+		}
+		if err != nil {
+			respond(w, r, http.StatusBadRequest, fmt.Sprintf("error parsing file: %s", err), nil)
+			return
+		}
+
+		// PROCESS
+		// - current vehicles
+		current, err := h.sv.FindAll(r.Context())
+		if err != nil {
+			respond(w, r, http.StatusInternalServerError, "error getting vehicles", nil)
+			return
+		}
+
+		// - plan the import
+		report := ImportReportJSON{
+			DryRun:    dryRun,
+			Created:   []VehicleJSON{},
+			Updated:   []ImportUpdateJSON{},
+			Unchanged: []int{},
+			Rejected:  []ImportRejectionJSON{},
+		}
+		var writes []internal.Vehicle
+		var versions []int
+		seen := make(map[int]bool)
+		for i, record := range records {
+			// - the first record is 1, as seen by the user (the header of a CSV file is not counted)
+			number := i + 1
+			if record.err == nil && seen[record.vehicle.ID] {
+				record.err = fmt.Errorf("duplicated id %d", record.vehicle.ID)
+			}
+			if record.err != nil {
+				report.Rejected = append(report.Rejected, ImportRejectionJSON{Record: number, ID: record.vehicle.ID, Error: record.err.Error()})
+				continue
+			}
+			seen[record.vehicle.ID] = true
+
+			vehicle := record.vehicle.vehicle()
+			before, exists := current[vehicle.Id]
+			switch {
+			case !exists:
+				report.Created = append(report.Created, record.vehicle)
+			default:
+				changes := internal.DiffVehicleAttributes(before.VehicleAttributes, vehicle.VehicleAttributes)
+				if len(changes) == 0 {
+					report.Unchanged = append(report.Unchanged, vehicle.Id)
+					continue
+				}
+				update := ImportUpdateJSON{ID: vehicle.Id}
+				for _, change := range changes {
+					update.Changes = append(update.Changes, FieldChangeJSON{Field: change.Field, Old: change.Old, New: change.New})
+				}
+				report.Updated = append(report.Updated, update)
+			}
+			writes = append(writes, vehicle)
+			versions = append(versions, before.Version)
+		}
+
+		// - apply the import
+		if !dryRun && len(writes) > 0 {
+			if err := h.sv.SaveBatchVersioned(r.Context(), writes, versions); err != nil {
+				if errors.Is(err, internal.ErrVehicleVersionMismatch) {
+					respond(w, r, http.StatusConflict, "vehicles were modified during the import, no vehicle was imported", nil)
+					return
+				}
+				respond(w, r, http.StatusInternalServerError, "error importing vehicles, no vehicle was imported", nil)
+				return
+			}
+		}
+
+		// RESPONSE
+		sort.Ints(report.Unchanged)
+		code := http.StatusOK
+		if !dryRun && len(writes) > 0 {
+			code = http.StatusCreated
+		}
+		respond(w, r, code, "success", report)
+	}
+}
+
+// importFormat is a function that returns the format of an uploaded file from its content type or extension
+func importFormat(contentType, filename string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "text/csv" || filepath.Ext(filename) == ".csv":
+		return "csv"
+	case mediaType == "application/json" || filepath.Ext(filename) == ".json":
+		return "json"
+	}
+	return ""
+}
+
+// readImportCSV is a function that reads the records of an import file in CSV format
+// - the header row must contain every required field and the id
+func readImportCSV(r io.Reader) (records []importRecord, err error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	columns, err := cr.Read()
+	if err != nil {
+		return
+	}
+
+	// validate header
+	fields := make(map[string]any, len(columns))
+	for _, column := range columns {
+		fields[column] = nil
+	}
+	if err = tools.CheckFieldExistance(fields, append([]string{"id"}, vehicleRequiredFields...)...); err != nil {
+		return
+	}
+
+	// read rows
+	for {
+		var row []string
+		row, err = cr.Read()
+		if errors.Is(err, io.EOF) {
+			err = nil
+			return
+		}
+		if err != nil {
+			return
+		}
+		var record importRecord
+		record.vehicle, record.err = vehicleFromRecord(columns, row)
+		if record.err == nil {
+			record.err = validateVehicle(record.vehicle)
+		}
+		records = append(records, record)
+	}
+}
+
+// readImportJSON is a function that reads the records of an import file in JSON format (array of vehicles)
+func readImportJSON(r io.Reader) (records []importRecord, err error) {
+	var raws []json.RawMessage
+	if err = json.NewDecoder(r).Decode(&raws); err != nil {
+		return
+	}
+
+	for _, raw := range raws {
+		var record importRecord
+		record.err = func() (err error) {
+			// - validate required fields
+			fields := make(map[string]any)
+			if err = json.Unmarshal(raw, &fields); err != nil {
+				return
+			}
+			if err = tools.CheckFieldExistance(fields, append([]string{"id"}, vehicleRequiredFields...)...); err != nil {
+				return
+			}
+			// - parse
+			if err = json.Unmarshal(raw, &record.vehicle); err != nil {
+				return
+			}
+			return validateVehicle(record.vehicle)
+		}()
+		records = append(records, record)
+	}
+	return
+}
+
+// validateVehicle is a function that validates the values of an imported vehicle
+func validateVehicle(v VehicleJSON) (err error) {
+	switch {
+	case v.ID <= 0:
+		err = &tools.FieldError{Field: "id", Msg: "must be positive"}
+	case v.Brand == "":
+		err = &tools.FieldError{Field: "brand", Msg: "must not be empty"}
+	case v.Model == "":
+		err = &tools.FieldError{Field: "model", Msg: "must not be empty"}
+	case v.FabricationYear <= 0:
+		err = &tools.FieldError{Field: "year", Msg: "must be positive"}
+	case v.Capacity < 0:
+		err = &tools.FieldError{Field: "passengers", Msg: "must not be negative"}
+	case v.MaxSpeed < 0:
+		err = &tools.FieldError{Field: "max_speed", Msg: "must not be negative"}
+	case v.Weight < 0:
+		err = &tools.FieldError{Field: "weight", Msg: "must not be negative"}
+	case v.Height < 0 || v.Length < 0 || v.Width < 0:
+		err = &tools.FieldError{Field: "dimensions", Msg: "must not be negative"}
+	}
+	return
+}
+
+// vehicle is a method that returns the vehicle represented by the JSON
+func (v VehicleJSON) vehicle() internal.Vehicle {
+	return internal.Vehicle{
+		Id: v.ID,
+		VehicleAttributes: internal.VehicleAttributes{
+			Brand:           v.Brand,
+			Model:           v.Model,
+			Registration:    v.Registration,
+			Color:           v.Color,
+			FabricationYear: v.FabricationYear,
+			Capacity:        v.Capacity,
+			MaxSpeed:        v.MaxSpeed,
+			FuelType:        v.FuelType,
+			Transmission:    v.Transmission,
+			Weight:          v.Weight,
+			Dimensions: internal.Dimensions{
+				Height: v.Height,
+				Length: v.Length,
+				Width:  v.Width,
+			},
+		},
+	}
+}
@@ -0,0 +1,233 @@
+package handler_test
+
+import (
+	"app/internal"
+	"app/internal/handler"
+	"app/internal/repository"
+	"app/internal/service"
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// importCSV is the file of the import tests: vehicle 1 unchanged, 2 changed, 3 new, 4 invalid and 3 again
+const importCSV = `id,brand,model,registration,color,year,passengers,max_speed,fuel_type,transmission,weight,height,length,width
+1,Ford,Fiesta,ABC123,red,2010,5,180,gas,manual,1000,0,0,0
+2,Seat,Ibiza,XYZ789,green,2015,5,190,diesel,manual,1100,1.4,4,1.7
+3,Fiat,Panda,FIA333,white,2019,4,150,gas,manual,900,1.5,3.6,1.6
+4,Fiat,,FIA444,white,2019,4,150,gas,manual,900,1.5,3.6,1.6
+3,Fiat,Panda,FIA333,black,2019,4,150,gas,manual,900,1.5,3.6,1.6
+`
+
+// importVehicles are the vehicles of the import tests
+func importVehicles() map[int]internal.Vehicle {
+	v := negotiationVehicles()
+	v[1] = internal.Vehicle{Id: 1, Version: 1, VehicleAttributes: v[1].VehicleAttributes}
+	v[2] = internal.Vehicle{Id: 2, Version: 1, VehicleAttributes: internal.VehicleAttributes{Brand: "Seat", Model: "Ibiza", Registration: "XYZ789", Color: "blue", FabricationYear: 2015, Capacity: 5, MaxSpeed: 190, FuelType: "diesel", Transmission: "manual", Weight: 1100, Dimensions: internal.Dimensions{Height: 1.4, Length: 4, Width: 1.7}}}
+	return v
+}
+
+// Tests for VehicleDefault.Import
+func TestVehicleDefault_Import(t *testing.T) {
+	upload := func(sv internal.VehicleService, target, filename, content string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("file", filename)
+		fw.Write([]byte(content))
+		mw.Close()
+
+		rt := chi.NewRouter()
+		rt.Post("/vehicles/import", handler.NewVehicleDefault(sv).Import())
+		req := httptest.NewRequest(http.MethodPost, target, &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req = req.WithContext(internal.ContextWithActor(req.Context(), "alice"))
+		rr := httptest.NewRecorder()
+		rt.ServeHTTP(rr, req)
+		return rr
+	}
+	report := func(t *testing.T, rr *httptest.ResponseRecorder) (r handler.ImportReportJSON) {
+		var body struct {
+			Data handler.ImportReportJSON `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+		return body.Data
+	}
+
+	t.Run("case 1: should report the import without writing anything on a dry run", func(t *testing.T) {
+		// arrange
+		rp := repository.NewVehicleMap(importVehicles())
+		sv := service.NewVehicleDefault(rp)
+
+		// act
+		rr := upload(sv, "/vehicles/import", "vehicles.csv", importCSV)
+
+		// assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		r := report(t, rr)
+		require.True(t, r.DryRun)
+		require.Equal(t, []int{1}, r.Unchanged)
+		require.Len(t, r.Updated, 1)
+		require.Equal(t, handler.ImportUpdateJSON{ID: 2, Changes: []handler.FieldChangeJSON{{Field: "color", Old: "blue", New: "green"}}}, r.Updated[0])
+		require.Len(t, r.Created, 1)
+		require.Equal(t, 3, r.Created[0].ID)
+		v, err := rp.FindAll(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, importVehicles(), v)
+	})
+
+	t.Run("case 2: should reject the invalid and duplicated records and the files it can not read", func(t *testing.T) {
+		// arrange
+		sv := service.NewVehicleDefault(repository.NewVehicleMap(importVehicles()))
+
+		// act
+		rr := upload(sv, "/vehicles/import", "vehicles.csv", importCSV)
+		rrJSON := upload(sv, "/vehicles/import", "vehicles.json", `[{"id":5,"brand":"Fiat"},{"id":6,"brand":"Fiat","model":"Uno","registration":"U6","color":"red","year":1990,"passengers":4,"max_speed":140,"fuel_type":"gas","transmission":"manual","weight":-1,"height":1,"length":3,"width":1.5}]`)
+		rrHeader := upload(sv, "/vehicles/import", "vehicles.csv", "id,brand\n1,Ford\n")
+		rrFormat := upload(sv, "/vehicles/import", "vehicles.txt", importCSV)
+		rrMode := upload(sv, "/vehicles/import?dry_run=maybe", "vehicles.csv", importCSV)
+
+		// assert
+		require.Equal(t, []handler.ImportRejectionJSON{
+			{Record: 4, ID: 4, Error: "model: must not be empty"},
+			{Record: 5, ID: 3, Error: "duplicated id 3"},
+		}, report(t, rr).Rejected)
+		rejected := report(t, rrJSON).Rejected
+		require.Len(t, rejected, 2)
+		require.Equal(t, 1, rejected[0].Record)
+		require.Equal(t, 2, rejected[1].Record)
+		require.Contains(t, rejected[1].Error, "weight")
+		require.Equal(t, http.StatusBadRequest, rrHeader.Code)
+		require.Equal(t, http.StatusUnsupportedMediaType, rrFormat.Code)
+		require.Equal(t, http.StatusBadRequest, rrMode.Code)
+		require.JSONEq(t, `{"message":"invalid dry_run"}`, rrMode.Body.String())
+	})
+
+	t.Run("case 3: should write the valid records with their history when committed", func(t *testing.T) {
+		// arrange
+		rp := repository.NewVehicleMap(importVehicles())
+		sv := service.NewVehicleDefault(rp)
+
+		// act
+		rr := upload(sv, "/vehicles/import?dry_run=false", "vehicles.csv", importCSV)
+
+		// assert
+		require.Equal(t, http.StatusCreated, rr.Code)
+		require.False(t, report(t, rr).DryRun)
+		v, err := rp.FindAll(context.Background())
+		require.NoError(t, err)
+		require.Len(t, v, 3)
+		require.Equal(t, "green", v[2].Color)
+		require.Equal(t, 2, v[2].Version)
+		require.Equal(t, "white", v[3].Color)
+		require.Equal(t, 1, v[3].Version)
+		h, err := rp.FindHistory(context.Background(), 2)
+		require.NoError(t, err)
+		require.Len(t, h, 1)
+		require.Equal(t, internal.VehicleOperationUpdate, h[0].Operation)
+		require.Equal(t, "alice", h[0].Actor)
+		h, err = rp.FindHistory(context.Background(), 3)
+		require.NoError(t, err)
+		require.Len(t, h, 1)
+		require.Equal(t, internal.VehicleOperationCreate, h[0].Operation)
+		h, err = rp.FindHistory(context.Background(), 1)
+		require.NoError(t, err)
+		require.Empty(t, h)
+	})
+
+	t.Run("case 4: should commit an import as a single batch of events to an event-sourced service", func(t *testing.T) {
+		// arrange
+		es := repository.NewVehicleEventLog()
+		rp := repository.NewVehicleMap(importVehicles())
+		sv := service.NewVehicleEventSourced(es, rp)
+		require.NoError(t, sv.Rebuild(context.Background()))
+
+		// act
+		rr := upload(sv, "/vehicles/import?dry_run=false", "vehicles.csv", importCSV)
+
+		// assert
+		require.Equal(t, http.StatusCreated, rr.Code)
+		events, err := es.FindAllEvents(context.Background())
+		require.NoError(t, err)
+		require.Len(t, events, 4)
+		require.Equal(t, internal.VehicleAttributesChanged, events[2].Type)
+		require.Equal(t, internal.VehicleRegistered, events[3].Type)
+		require.Equal(t, "alice", events[3].Actor)
+		v, err := rp.FindById(context.Background(), 3)
+		require.NoError(t, err)
+		require.Equal(t, "white", v.Color)
+	})
+
+	t.Run("case 5: should import nothing and respond 409 if a planned vehicle is written before the import is applied", func(t *testing.T) {
+		// arrange
+		// - a write lands right after the import read the vehicles to plan it
+		var sv *service.VehicleDefault
+		var once sync.Once
+		var errWrite error
+		rp := repository.NewVehicleMap(importVehicles())
+		observe := func(op string, d time.Duration, err error) {
+			if op != "find_all" {
+				return
+			}
+			once.Do(func() {
+				patched := importVehicles()[2]
+				patched.Color = "yellow"
+				errWrite = sv.Update(internal.ContextWithActor(context.Background(), "bob"), &patched, 1)
+			})
+		}
+		sv = service.NewVehicleDefault(repository.NewVehicleObserved(rp, observe))
+
+		// act
+		rr := upload(sv, "/vehicles/import?dry_run=false", "vehicles.csv", importCSV)
+
+		// assert
+		require.NoError(t, errWrite)
+		require.Equal(t, http.StatusConflict, rr.Code)
+		require.JSONEq(t, `{"message":"vehicles were modified during the import, no vehicle was imported"}`, rr.Body.String())
+		v, err := rp.FindAll(context.Background())
+		require.NoError(t, err)
+		require.Len(t, v, 2)
+		require.Equal(t, "yellow", v[2].Color)
+	})
+
+	t.Run("case 6: should import nothing into an event-sourced service if a planned vehicle is created before the import is applied", func(t *testing.T) {
+		// arrange
+		es := repository.NewVehicleEventLog()
+		var sv *service.VehicleEventSourced
+		var once sync.Once
+		var armed bool
+		var errWrite error
+		observe := func(op string, d time.Duration, err error) {
+			if op != "find_all" || !armed {
+				return
+			}
+			once.Do(func() {
+				created := importVehicles()[1]
+				created.Id = 3
+				errWrite = sv.Create(internal.ContextWithActor(context.Background(), "bob"), &created)
+			})
+		}
+		sv = service.NewVehicleEventSourced(es, repository.NewVehicleObserved(repository.NewVehicleMap(importVehicles()), observe))
+		require.NoError(t, sv.Rebuild(context.Background()))
+		armed = true
+
+		// act
+		rr := upload(sv, "/vehicles/import?dry_run=false", "vehicles.csv", importCSV)
+
+		// assert
+		require.NoError(t, errWrite)
+		require.Equal(t, http.StatusConflict, rr.Code)
+		events, err := es.FindAllEvents(context.Background())
+		require.NoError(t, err)
+		require.Len(t, events, 3)
+		require.Equal(t, "bob", events[2].Actor)
+	})
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"app/internal"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// HeaderRequestID is the header with the ID of a request, propagated from the client or generated
+const HeaderRequestID = "X-Request-ID"
+
+// maxRequestIDLength is the maximum length of a request ID propagated from the client, longer ones are replaced
+const maxRequestIDLength = 128
+
+// RequestID is a middleware that sets the request ID of the context of the request (see internal.ContextWithRequestID)
+// - the ID is the header X-Request-ID if it is valid, a new random ID otherwise, and it is echoed in the response
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(HeaderRequestID)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(HeaderRequestID, id)
+		next.ServeHTTP(w, r.WithContext(internal.ContextWithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID is a function that reports whether id can be propagated: not empty, not too long and printable ASCII
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID is a function that returns a random request ID of 32 hex digits
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Logger is a function that returns a middleware that logs every request to logger
+// - the context of the request gets a logger with its request ID (see internal.ContextWithLogger)
+// - the request is logged once it is served, at the error level for 5xx and at the info level otherwise
+func Logger(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rl := logger
+			if id := internal.RequestIDFromContext(r.Context()); id != "" {
+				rl = logger.With(slog.String("request_id", id))
+			}
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(internal.ContextWithLogger(r.Context(), rl)))
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			level := slog.LevelInfo
+			if status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+			route := ""
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				route = rctx.RoutePattern()
+			}
+			rl.LogAttrs(r.Context(), level, "request",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("route", route),
+				slog.Int("status", status),
+				slog.Int("bytes", ww.BytesWritten()),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("remote_addr", r.RemoteAddr),
+			)
+		})
+	}
+}
+
+// Recoverer is a middleware that recovers from the panics of the handlers, logging them with their stack
+// - the response is 500 unless the handler already wrote its status
+func Recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		defer func() {
+			rvr := recover()
+			if rvr == nil {
+				return
+			}
+			// - the server aborts the response without logging it
+			if rvr == http.ErrAbortHandler {
+				panic(rvr)
+			}
+			internal.LoggerFromContext(r.Context()).Error("panic serving request",
+				slog.Any("panic", rvr),
+				slog.String("stack", string(debug.Stack())),
+			)
+			// - a status already sent can not be changed, the response is just cut short
+			if ww.Status() == 0 {
+				ww.WriteHeader(http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(ww, r)
+	})
+}
@@ -0,0 +1,185 @@
+package handler_test
+
+import (
+	"app/internal"
+	"app/internal/handler"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Tests for RequestID
+func TestRequestID(t *testing.T) {
+	// serve is a function that serves a request with the header X-Request-ID set to id (if any) and returns the ID in its context
+	serve := func(id string) (rr *httptest.ResponseRecorder, ctxID string) {
+		hd := handler.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctxID = internal.RequestIDFromContext(r.Context())
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/vehicles", nil)
+		if id != "" {
+			req.Header.Set(handler.HeaderRequestID, id)
+		}
+		rr = httptest.NewRecorder()
+		hd.ServeHTTP(rr, req)
+		return
+	}
+	generated := regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+	t.Run("case 1: should propagate a valid request ID", func(t *testing.T) {
+		// act
+		rr, ctxID := serve("client-id-123")
+
+		// assert
+		require.Equal(t, "client-id-123", ctxID)
+		require.Equal(t, "client-id-123", rr.Header().Get(handler.HeaderRequestID))
+	})
+
+	t.Run("case 2: should generate a request ID if there is none", func(t *testing.T) {
+		// act
+		rr, ctxID := serve("")
+
+		// assert
+		require.Regexp(t, generated, ctxID)
+		require.Equal(t, ctxID, rr.Header().Get(handler.HeaderRequestID))
+	})
+
+	t.Run("case 3: should replace a request ID that is not printable ASCII", func(t *testing.T) {
+		// act
+		rr, ctxID := serve("id with spaces")
+
+		// assert
+		require.Regexp(t, generated, ctxID)
+		require.Equal(t, ctxID, rr.Header().Get(handler.HeaderRequestID))
+	})
+
+	t.Run("case 4: should replace a request ID that is too long", func(t *testing.T) {
+		// act
+		_, ctxID := serve(strings.Repeat("a", 129))
+
+		// assert
+		require.Regexp(t, generated, ctxID)
+	})
+}
+
+// Tests for Logger
+func TestLogger(t *testing.T) {
+	// serve is a function that serves a request with status through RequestID and Logger, returning the logged records
+	serve := func(t *testing.T, status int) (records []map[string]any) {
+		var buf bytes.Buffer
+		logger := slog.New(slog.NewJSONHandler(&buf, nil))
+		hd := handler.RequestID(handler.Logger(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			internal.LoggerFromContext(r.Context()).Info("handling")
+			w.WriteHeader(status)
+		})))
+		req := httptest.NewRequest(http.MethodGet, "/vehicles", nil)
+		req.Header.Set(handler.HeaderRequestID, "req-1")
+		hd.ServeHTTP(httptest.NewRecorder(), req)
+
+		dec := json.NewDecoder(&buf)
+		for dec.More() {
+			var rec map[string]any
+			require.NoError(t, dec.Decode(&rec))
+			records = append(records, rec)
+		}
+		return
+	}
+
+	t.Run("case 1: should log the request at the info level with its request ID", func(t *testing.T) {
+		// act
+		records := serve(t, http.StatusOK)
+
+		// assert
+		require.Len(t, records, 2)
+		require.Equal(t, "handling", records[0]["msg"])
+		require.Equal(t, "req-1", records[0]["request_id"])
+		require.Equal(t, "request", records[1]["msg"])
+		require.Equal(t, "INFO", records[1]["level"])
+		require.Equal(t, "req-1", records[1]["request_id"])
+		require.Equal(t, http.MethodGet, records[1]["method"])
+		require.Equal(t, "/vehicles", records[1]["path"])
+		require.EqualValues(t, http.StatusOK, records[1]["status"])
+	})
+
+	t.Run("case 2: should log a 5xx response at the error level", func(t *testing.T) {
+		// act
+		records := serve(t, http.StatusServiceUnavailable)
+
+		// assert
+		require.Len(t, records, 2)
+		require.Equal(t, "ERROR", records[1]["level"])
+		require.EqualValues(t, http.StatusServiceUnavailable, records[1]["status"])
+	})
+
+	t.Run("case 3: should log a 4xx response at the info level", func(t *testing.T) {
+		// act
+		records := serve(t, http.StatusNotFound)
+
+		// assert
+		require.Len(t, records, 2)
+		require.Equal(t, "INFO", records[1]["level"])
+	})
+}
+
+// statusRecorder is a struct that records every status written, httptest.ResponseRecorder only keeps the first one
+type statusRecorder struct {
+	*httptest.ResponseRecorder
+	// statuses are the statuses written, in order
+	statuses []int
+}
+
+// WriteHeader is a method that records the status and writes it
+func (r *statusRecorder) WriteHeader(code int) {
+	r.statuses = append(r.statuses, code)
+	r.ResponseRecorder.WriteHeader(code)
+}
+
+// Tests for Recoverer
+func TestRecoverer(t *testing.T) {
+	t.Run("case 1: should answer 500 if the handler panics before writing", func(t *testing.T) {
+		// arrange
+		hd := handler.Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}))
+		rr := httptest.NewRecorder()
+
+		// act
+		hd.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/vehicles", nil))
+
+		// assert
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+
+	t.Run("case 2: should keep the status if the handler panics after writing it", func(t *testing.T) {
+		// arrange
+		hd := handler.Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			panic("boom")
+		}))
+		rr := &statusRecorder{ResponseRecorder: httptest.NewRecorder()}
+
+		// act
+		hd.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/vehicles", nil))
+
+		// assert
+		require.Equal(t, []int{http.StatusCreated}, rr.statuses)
+	})
+
+	t.Run("case 3: should let the server abort the response", func(t *testing.T) {
+		// arrange
+		hd := handler.Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		}))
+
+		// act & assert
+		require.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			hd.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/vehicles", nil))
+		})
+	})
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"app/internal/metrics"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// unmatchedRoute is the route of the requests that match no route, so that unknown paths do not create new series
+const unmatchedRoute = "unmatched"
+
+// Instrument is a function that returns a middleware that records every request
+// - requests counts them by route pattern (e.g. /vehicles/{id}), method and status class (e.g. 2xx)
+// - durations records their latency in seconds by route pattern and method
+func Instrument(requests *metrics.CounterVec, durations *metrics.HistogramVec) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			// the route pattern is known once the request is routed
+			route := unmatchedRoute
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			requests.Inc(route, r.Method, strconv.Itoa(status/100)+"xx")
+			durations.Observe(time.Since(start).Seconds(), route, r.Method)
+		})
+	}
+}
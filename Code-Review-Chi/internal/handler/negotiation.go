@@ -0,0 +1,418 @@
+package handler
+
+import (
+	"app/internal"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bootcamp-go/web/response"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrUnsupportedMediaType is returned when a request body has a content type that can not be decoded
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+)
+
+// representation is a struct that represents a media type the handlers can respond with
+type representation struct {
+	// mediaTypes are the media types of the representation, the first one is sent as Content-Type
+	mediaTypes []string
+	// write is the function that writes the response body
+	write func(w http.ResponseWriter, code int, message string, data any) (err error)
+}
+
+// representations are the supported representations in order of preference of the server
+var representations = []representation{
+	{mediaTypes: []string{"application/json"}, write: writeJSON},
+	{mediaTypes: []string{"text/plain"}, write: writeTable},
+	{mediaTypes: []string{"text/csv"}, write: writeCSVResponse},
+	{mediaTypes: []string{"application/xml", "text/xml"}, write: writeXML},
+	{mediaTypes: []string{"application/yaml", "application/x-yaml", "text/yaml"}, write: writeYAML},
+}
+
+// acceptRange is a struct that represents a media range of the Accept header
+type acceptRange struct {
+	// mediaType is the media range, it may contain wildcards
+	mediaType string
+	// q is the quality factor of the media range
+	q float64
+}
+
+// negotiate is a function that returns the representation that best matches the Accept header of the request
+// - an empty Accept header matches the first representation (JSON)
+// - a media type takes the quality of the most specific range that includes it, q=0 excludes it
+// - ties on quality are broken by specificity (application/json beats */*) and then by the order of the server
+// - ok is false if no representation is acceptable
+func negotiate(r *http.Request) (rep representation, ok bool) {
+	accept := r.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return representations[0], true
+	}
+
+	// parse media ranges
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qStr, found := params["q"]; found {
+			if q, err = strconv.ParseFloat(qStr, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+	}
+
+	// rank the representations by the quality and specificity of their best match
+	bestQ, bestSpecificity := 0.0, -1
+	for _, candidate := range representations {
+		for _, mediaType := range candidate.mediaTypes {
+			q, specificity := -1.0, -1
+			for _, ar := range ranges {
+				if s := matchMediaRange(ar.mediaType, mediaType); s > specificity {
+					q, specificity = ar.q, s
+				}
+			}
+			if q <= 0 {
+				continue
+			}
+			if q > bestQ || (q == bestQ && specificity > bestSpecificity) {
+				rep, ok = candidate, true
+				bestQ, bestSpecificity = q, specificity
+			}
+		}
+	}
+	return
+}
+
+// matchMediaRange is a function that returns the specificity of the media range for mediaType
+// - 2 for the same media type, 1 for a type/* range, 0 for */* and -1 if mediaType is not included
+func matchMediaRange(mediaRange, mediaType string) (specificity int) {
+	switch {
+	case mediaRange == mediaType:
+		return 2
+	case mediaRange == "*/*":
+		return 0
+	}
+	rangeType, rangeSubtype, _ := strings.Cut(mediaRange, "/")
+	typ, _, _ := strings.Cut(mediaType, "/")
+	if rangeSubtype == "*" && rangeType == typ {
+		return 1
+	}
+	return -1
+}
+
+// contextKeyRepresentation is the context key of the negotiated representation
+type contextKeyRepresentation struct{}
+
+// Negotiate is a middleware that negotiates the representation of the response from the Accept header
+// - it responds 406 Not Acceptable if none of the supported media types is acceptable
+func Negotiate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rep, ok := negotiate(r)
+		if !ok {
+			response.Error(w, http.StatusNotAcceptable, "acceptable media types: application/json, text/plain, text/csv, application/xml, application/yaml")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKeyRepresentation{}, rep)))
+	})
+}
+
+// respond is a function that writes the response in the representation negotiated for the request
+// - requests that did not go through Negotiate are negotiated here, falling back to JSON
+func respond(w http.ResponseWriter, r *http.Request, code int, message string, data any) {
+	rep, ok := r.Context().Value(contextKeyRepresentation{}).(representation)
+	if !ok {
+		if rep, ok = negotiate(r); !ok {
+			rep = representations[0]
+		}
+	}
+	w.Header().Set("Vary", "Accept")
+	// - the status is already sent, an error here can only abort the response
+	_ = rep.write(w, code, message, data)
+}
+
+// writeHeader is a function that sets the content type and writes the status code
+func writeHeader(w http.ResponseWriter, code int, contentType string) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(code)
+}
+
+// writeJSON is a function that writes the response in JSON format
+func writeJSON(w http.ResponseWriter, code int, message string, data any) (err error) {
+	body := map[string]any{"message": message}
+	if data != nil {
+		body["data"] = data
+	}
+	response.JSON(w, code, body)
+	return
+}
+
+// tabular is a function that returns the data as a list of vehicles if it is a vehicle or a collection of vehicles
+func tabular(data any) (rows []VehicleJSON, ok bool) {
+	switch data := data.(type) {
+	case map[int]internal.Vehicle:
+		return serializeVehicles(data), true
+	case internal.Vehicle:
+		return []VehicleJSON{serializeVehicle(data)}, true
+	case map[int]VehicleJSON:
+		rows = make([]VehicleJSON, 0, len(data))
+		for _, v := range data {
+			rows = append(rows, v)
+		}
+		sort.Slice(rows, func(i, j int) bool { return rows[i].ID < rows[j].ID })
+		return rows, true
+	case VehicleJSON:
+		return []VehicleJSON{data}, true
+	case []VehicleJSON:
+		return data, true
+	}
+	return
+}
+
+// envelope is a struct that represents the body of a response in XML and YAML formats
+type envelope struct {
+	XMLName xml.Name `xml:"response" yaml:"-"`
+	// Message is the message of the response
+	Message string `xml:"message" yaml:"message"`
+	// Vehicles is the data of the response if it is tabular
+	Vehicles *envelopeVehicles `xml:"data,omitempty" yaml:"data,omitempty"`
+	// Value is the data of the response if it is a scalar
+	// - a zero (e.g. an average of 0) is still written, only a missing value is omitted
+	Value any `xml:"value" yaml:"value,omitempty"`
+}
+
+// envelopeVehicles is a struct that represents a list of vehicles in XML and YAML formats
+type envelopeVehicles struct {
+	// Vehicle is the list of vehicles
+	Vehicle []VehicleJSON `xml:"vehicle" yaml:"vehicles"`
+}
+
+// newEnvelope is a function that returns the envelope of a response
+func newEnvelope(message string, data any) (e envelope) {
+	e.Message = message
+	if rows, ok := tabular(data); ok {
+		e.Vehicles = &envelopeVehicles{Vehicle: rows}
+		return
+	}
+	e.Value = data
+	return
+}
+
+// writeXML is a function that writes the response in XML format
+func writeXML(w http.ResponseWriter, code int, message string, data any) (err error) {
+	bytes, err := xml.Marshal(newEnvelope(message, data))
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error serializing response")
+		return
+	}
+	writeHeader(w, code, "application/xml; charset=utf-8")
+	if _, err = io.WriteString(w, xml.Header); err != nil {
+		return
+	}
+	_, err = w.Write(bytes)
+	return
+}
+
+// writeYAML is a function that writes the response in YAML format
+func writeYAML(w http.ResponseWriter, code int, message string, data any) (err error) {
+	bytes, err := yaml.Marshal(newEnvelope(message, data))
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error serializing response")
+		return
+	}
+	writeHeader(w, code, "application/yaml; charset=utf-8")
+	_, err = w.Write(bytes)
+	return
+}
+
+// writeCSVResponse is a function that writes the response in CSV format
+// - vehicles are written with the export columns, scalars as a message/data row
+func writeCSVResponse(w http.ResponseWriter, code int, message string, data any) (err error) {
+	writeHeader(w, code, "text/csv; charset=utf-8")
+	if rows, ok := tabular(data); ok {
+		return writeCSV(w, rows)
+	}
+	cw := csv.NewWriter(w)
+	record := []string{message}
+	if data != nil {
+		record = append(record, formatCell(data))
+		err = cw.Write([]string{"message", "data"})
+	} else {
+		err = cw.Write([]string{"message"})
+	}
+	if err != nil {
+		return
+	}
+	if err = cw.Write(record); err != nil {
+		return
+	}
+	cw.Flush()
+	err = cw.Error()
+	return
+}
+
+// writeTable is a function that writes the response as a plain text table
+func writeTable(w http.ResponseWriter, code int, message string, data any) (err error) {
+	writeHeader(w, code, "text/plain; charset=utf-8")
+	rows, ok := tabular(data)
+	if !ok {
+		if data == nil {
+			_, err = fmt.Fprintf(w, "%s\n", message)
+			return
+		}
+		_, err = fmt.Fprintf(w, "%s: %s\n", message, formatCell(data))
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if _, err = fmt.Fprintln(tw, strings.ToUpper(strings.Join(vehicleColumns, "\t"))); err != nil {
+		return
+	}
+	cells := make([]string, len(vehicleColumns))
+	for _, v := range rows {
+		for i, value := range v.record() {
+			cells[i] = formatCell(value)
+		}
+		if _, err = fmt.Fprintln(tw, strings.Join(cells, "\t")); err != nil {
+			return
+		}
+	}
+	err = tw.Flush()
+	return
+}
+
+// decodeVehicleBody is a function that decodes a vehicle from a request body according to its content type
+// - fields are the names of the fields present in the body, used to validate required fields
+// - JSON (default), XML, YAML and CSV (a header row and a single vehicle row) bodies are supported
+func decodeVehicleBody(contentType string, bytes []byte) (fields map[string]any, body VehicleJSON, err error) {
+	mediaType := "application/json"
+	if contentType != "" {
+		if mediaType, _, err = mime.ParseMediaType(contentType); err != nil {
+			err = ErrUnsupportedMediaType
+			return
+		}
+	}
+
+	fields = make(map[string]any)
+	switch mediaType {
+	case "application/json":
+		if err = json.Unmarshal(bytes, &fields); err != nil {
+			return
+		}
+		err = json.Unmarshal(bytes, &body)
+	case "application/yaml", "application/x-yaml", "text/yaml":
+		if err = yaml.Unmarshal(bytes, &fields); err != nil {
+			return
+		}
+		err = yaml.Unmarshal(bytes, &body)
+	case "application/xml", "text/xml":
+		if fields, err = xmlFields(bytes); err != nil {
+			return
+		}
+		err = xml.Unmarshal(bytes, &body)
+	case "text/csv":
+		var records [][]string
+		if records, err = csv.NewReader(strings.NewReader(string(bytes))).ReadAll(); err != nil {
+			return
+		}
+		if len(records) != 2 {
+			err = fmt.Errorf("%w: expected a header and a single row", internal.ErrVehicleInvalidField)
+			return
+		}
+		for _, column := range records[0] {
+			fields[column] = nil
+		}
+		body, err = vehicleFromRecord(records[0], records[1])
+	default:
+		err = ErrUnsupportedMediaType
+	}
+	return
+}
+
+// xmlFields is a function that returns the names of the child elements of the root element of an XML document
+func xmlFields(bytes []byte) (fields map[string]any, err error) {
+	fields = make(map[string]any)
+	dec := xml.NewDecoder(strings.NewReader(string(bytes)))
+	depth := 0
+	for {
+		var token xml.Token
+		token, err = dec.Token()
+		if err == io.EOF {
+			err = nil
+			return
+		}
+		if err != nil {
+			return
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 {
+				fields[token.Name.Local] = nil
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+// vehicleFromRecord is a function that returns the vehicle of a CSV record given the columns of the header
+// - unknown columns are ignored
+func vehicleFromRecord(columns, record []string) (v VehicleJSON, err error) {
+	if len(columns) != len(record) {
+		err = fmt.Errorf("%w: expected %d values, got %d", internal.ErrVehicleInvalidField, len(columns), len(record))
+		return
+	}
+
+	rv := reflect.ValueOf(&v).Elem()
+	for i, column := range columns {
+		index := -1
+		for j, name := range vehicleColumns {
+			if name == column {
+				index = j
+				break
+			}
+		}
+		if index == -1 {
+			continue
+		}
+
+		value := strings.TrimSpace(record[i])
+		field := rv.Field(index)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Int:
+			var n int64
+			if n, err = strconv.ParseInt(value, 10, 64); err != nil {
+				err = fmt.Errorf("%w: %s", internal.ErrVehicleInvalidField, column)
+				return
+			}
+			field.SetInt(n)
+		case reflect.Float64:
+			var f float64
+			if f, err = strconv.ParseFloat(value, 64); err != nil {
+				err = fmt.Errorf("%w: %s", internal.ErrVehicleInvalidField, column)
+				return
+			}
+			field.SetFloat(f)
+		}
+	}
+	return
+}
@@ -0,0 +1,177 @@
+package handler_test
+
+import (
+	"app/internal"
+	"app/internal/handler"
+	"app/internal/repository"
+	"app/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// newNegotiationRouter is a function that returns a negotiated router with read and create routes over the given vehicles
+func newNegotiationRouter(db map[int]internal.Vehicle) http.Handler {
+	hd := handler.NewVehicleDefault(service.NewVehicleDefault(repository.NewVehicleMap(db)))
+	rt := chi.NewRouter()
+	rt.Use(handler.Negotiate)
+	rt.Get("/vehicles/{id}", hd.GetById())
+	rt.Get("/vehicles/average_speed/brand/{brand}", hd.GetByBrandAverageSpeed())
+	rt.Post("/vehicles", hd.Save())
+	return rt
+}
+
+// negotiationVehicles are the vehicles of the negotiation tests
+func negotiationVehicles() map[int]internal.Vehicle {
+	return map[int]internal.Vehicle{
+		1: {Id: 1, VehicleAttributes: internal.VehicleAttributes{Brand: "Ford", Model: "Fiesta", Registration: "ABC123", Color: "red", FabricationYear: 2010, Capacity: 5, MaxSpeed: 180, FuelType: "gas", Transmission: "manual", Weight: 1000}},
+	}
+}
+
+// Tests for Negotiate
+func TestNegotiate(t *testing.T) {
+	get := func(target, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		newNegotiationRouter(negotiationVehicles()).ServeHTTP(rr, req)
+		return rr
+	}
+
+	cases := []struct {
+		name        string
+		accept      string
+		contentType string
+	}{
+		{name: "case 1: should respond JSON without an Accept header", accept: "", contentType: "application/json"},
+		{name: "case 2: should respond JSON to any media type", accept: "*/*", contentType: "application/json"},
+		{name: "case 3: should respond the exact media type", accept: "application/yaml", contentType: "application/yaml; charset=utf-8"},
+		{name: "case 4: should respond the media type with the highest quality", accept: "application/json;q=0.5, text/csv;q=0.9", contentType: "text/csv; charset=utf-8"},
+		{name: "case 5: should break ties on quality by specificity", accept: "*/*, application/xml", contentType: "application/xml; charset=utf-8"},
+		{name: "case 6: should break ties on quality by specificity of a type range", accept: "text/*;q=0.8, application/*;q=0.8, text/csv;q=0.8", contentType: "text/csv; charset=utf-8"},
+		{name: "case 7: should exclude a media type with q=0 even if a range includes it", accept: "application/json;q=0, */*;q=0.5", contentType: "text/plain; charset=utf-8"},
+		{name: "case 8: should ignore malformed media ranges", accept: "not a media type, text/xml", contentType: "application/xml; charset=utf-8"},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			// arrange
+			// ...
+
+			// act
+			rr := get("/vehicles/1", c.accept)
+
+			// assert
+			require.Equal(t, http.StatusOK, rr.Code)
+			require.Equal(t, c.contentType, rr.Header().Get("Content-Type"))
+			require.Equal(t, "Accept", rr.Header().Get("Vary"))
+		})
+	}
+
+	t.Run("case 9: should respond 406 if no media type is acceptable", func(t *testing.T) {
+		// arrange
+		// ...
+
+		// act
+		rr := get("/vehicles/1", "image/png, application/json;q=0")
+
+		// assert
+		require.Equal(t, http.StatusNotAcceptable, rr.Code)
+	})
+
+	t.Run("case 10: should write a scalar as the value of the XML envelope", func(t *testing.T) {
+		// arrange
+		// ...
+
+		// act
+		rr := get("/vehicles/average_speed/brand/Ford", "application/xml")
+
+		// assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Contains(t, rr.Body.String(), "<response><message>success</message><value>180</value></response>")
+	})
+}
+
+// Tests for the decoding of the body of VehicleDefault.Save
+func TestVehicleDefault_Save_Body(t *testing.T) {
+	post := func(contentType, body string) (rr *httptest.ResponseRecorder, get *httptest.ResponseRecorder) {
+		rt := newNegotiationRouter(nil)
+		req := httptest.NewRequest(http.MethodPost, "/vehicles", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		rr = httptest.NewRecorder()
+		rt.ServeHTTP(rr, req)
+		get = httptest.NewRecorder()
+		rt.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/vehicles/7", nil))
+		return
+	}
+	expected := `{"message":"success","data":{"id":7,"brand":"Seat","model":"Ibiza","registration":"XYZ789","color":"blue","year":2015,"passengers":5,"max_speed":190.5,"fuel_type":"diesel","transmission":"manual","weight":1100,"height":1.4,"length":4,"width":1.7}}`
+
+	cases := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{name: "case 1: should decode a JSON body", contentType: "application/json", body: `{"id":7,"brand":"Seat","model":"Ibiza","registration":"XYZ789","color":"blue","year":2015,"passengers":5,"max_speed":190.5,"fuel_type":"diesel","transmission":"manual","weight":1100,"height":1.4,"length":4,"width":1.7}`},
+		{name: "case 2: should decode an XML body", contentType: "application/xml", body: `<vehicle><id>7</id><brand>Seat</brand><model>Ibiza</model><registration>XYZ789</registration><color>blue</color><year>2015</year><passengers>5</passengers><max_speed>190.5</max_speed><fuel_type>diesel</fuel_type><transmission>manual</transmission><weight>1100</weight><height>1.4</height><length>4</length><width>1.7</width></vehicle>`},
+		{name: "case 3: should decode a YAML body", contentType: "application/yaml", body: "id: 7\nbrand: Seat\nmodel: Ibiza\nregistration: XYZ789\ncolor: blue\nyear: 2015\npassengers: 5\nmax_speed: 190.5\nfuel_type: diesel\ntransmission: manual\nweight: 1100\nheight: 1.4\nlength: 4\nwidth: 1.7\n"},
+		{name: "case 4: should decode a CSV body", contentType: "text/csv", body: "id,brand,model,registration,color,year,passengers,max_speed,fuel_type,transmission,weight,height,length,width\n7,Seat,Ibiza,XYZ789,blue,2015,5,190.5,diesel,manual,1100,1.4,4,1.7\n"},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			// arrange
+			// ...
+
+			// act
+			rr, get := post(c.contentType, c.body)
+
+			// assert
+			require.Equal(t, http.StatusCreated, rr.Code)
+			require.JSONEq(t, expected, rr.Body.String())
+			require.Equal(t, http.StatusOK, get.Code)
+			require.JSONEq(t, expected, get.Body.String())
+		})
+	}
+
+	t.Run("case 5: should respond 400 if a required field is missing", func(t *testing.T) {
+		// arrange
+		// ...
+
+		// act
+		rr, _ := post("application/xml", `<vehicle><id>7</id><brand>Seat</brand></vehicle>`)
+
+		// assert
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.JSONEq(t, `{"message":"field model is required"}`, rr.Body.String())
+	})
+
+	t.Run("case 6: should respond 400 if a CSV body has more than one row", func(t *testing.T) {
+		// arrange
+		// ...
+
+		// act
+		rr, _ := post("text/csv", "id,brand\n7,Seat\n8,Seat\n")
+
+		// assert
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.JSONEq(t, `{"message":"error parsing request"}`, rr.Body.String())
+	})
+
+	t.Run("case 7: should respond 415 to an unsupported content type", func(t *testing.T) {
+		// arrange
+		// ...
+
+		// act
+		rr, _ := post("application/octet-stream", "id=7")
+
+		// assert
+		require.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+		require.JSONEq(t, `{"message":"unsupported content type"}`, rr.Body.String())
+	})
+}
@@ -3,36 +3,32 @@ package handler
 import (
 	"app/internal"
 	"app/tools"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 
-	"github.com/bootcamp-go/web/response"
 	"github.com/go-chi/chi/v5"
 )
 
-// VehicleJSON is a struct that represents a vehicle in JSON format
+// VehicleJSON is a struct that represents a vehicle in JSON format (and the other supported representations)
 type VehicleJSON struct {
-	ID              int     `json:"id"`
-	Brand           string  `json:"brand"`
-	Model           string  `json:"model"`
-	Registration    string  `json:"registration"`
-	Color           string  `json:"color"`
-	FabricationYear int     `json:"year"`
-	Capacity        int     `json:"passengers"`
-	MaxSpeed        float64 `json:"max_speed"`
-	FuelType        string  `json:"fuel_type"`
-	Transmission    string  `json:"transmission"`
-	Weight          float64 `json:"weight"`
-	Height          float64 `json:"height"`
-	Length          float64 `json:"length"`
-	Width           float64 `json:"width"`
+	ID              int     `json:"id" xml:"id" yaml:"id"`
+	Brand           string  `json:"brand" xml:"brand" yaml:"brand"`
+	Model           string  `json:"model" xml:"model" yaml:"model"`
+	Registration    string  `json:"registration" xml:"registration" yaml:"registration"`
+	Color           string  `json:"color" xml:"color" yaml:"color"`
+	FabricationYear int     `json:"year" xml:"year" yaml:"year"`
+	Capacity        int     `json:"passengers" xml:"passengers" yaml:"passengers"`
+	MaxSpeed        float64 `json:"max_speed" xml:"max_speed" yaml:"max_speed"`
+	FuelType        string  `json:"fuel_type" xml:"fuel_type" yaml:"fuel_type"`
+	Transmission    string  `json:"transmission" xml:"transmission" yaml:"transmission"`
+	Weight          float64 `json:"weight" xml:"weight" yaml:"weight"`
+	Height          float64 `json:"height" xml:"height" yaml:"height"`
+	Length          float64 `json:"length" xml:"length" yaml:"length"`
+	Width           float64 `json:"width" xml:"width" yaml:"width"`
 }
 
 // Constructor
@@ -49,49 +45,48 @@ type VehicleDefault struct {
 }
 
 // GetAll is a method that returns a handler for the route GET /vehicles
+// - this and every filter route export the vehicles as a file with the query parameter format (csv, ndjson or xlsx)
+// - this, every filter route and GET /vehicles/{id} query the vehicles as they were at the query parameter as_of
 func (h *VehicleDefault) GetAll() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// request
 		// ...
 
 		// process
+		// - point in time, if any
+		sv, ok := h.reader(w, r)
+		if !ok {
+			return
+		}
 		// - get all vehicles
-		v, err := h.sv.FindAll()
+		v, err := sv.FindAll(r.Context())
 		if err != nil {
-			response.JSON(w, http.StatusInternalServerError, nil)
+			respond(w, r, http.StatusInternalServerError, "error getting vehicles", nil)
 			return
 		}
 
 		// response
+		// - export
+		if export(w, r, "vehicles", v) {
+			return
+		}
 		data := make(map[int]VehicleJSON)
 		for key, value := range v {
-			data[key] = VehicleJSON{
-				ID:              value.Id,
-				Brand:           value.Brand,
-				Model:           value.Model,
-				Registration:    value.Registration,
-				Color:           value.Color,
-				FabricationYear: value.FabricationYear,
-				Capacity:        value.Capacity,
-				MaxSpeed:        value.MaxSpeed,
-				FuelType:        value.FuelType,
-				Transmission:    value.Transmission,
-				Weight:          value.Weight,
-				Height:          value.Height,
-				Length:          value.Length,
-				Width:           value.Width,
-			}
+			data[key] = serializeVehicle(value)
 		}
-		response.JSON(w, http.StatusOK, map[string]any{
-			"message": "success",
-			"data":    data,
-		})
+		respond(w, r, http.StatusOK, "success", data)
 	}
 }
 
 // GetByColorYear is a method that returns a handler for the route GET /vehicles/color/:color/year/:year
 func (h *VehicleDefault) GetByColorYear() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// - point in time, if any
+		sv, ok := h.reader(w, r)
+		if !ok {
+			return
+		}
+
 		// REQUEST
 		// - get color from path
 		colorStr := chi.URLParam(r, "color")
@@ -100,31 +95,39 @@ func (h *VehicleDefault) GetByColorYear() http.HandlerFunc {
 		yearStr := chi.URLParam(r, "year")
 		year, err := strconv.Atoi(yearStr)
 		if err != nil {
-			http.Error(w, "invalid year", http.StatusBadRequest)
+			respond(w, r, http.StatusBadRequest, "invalid year", nil)
 			return
 		}
 
-		vehicles, err := h.sv.FindByColorYear(colorStr, year)
+		vehicles, err := sv.FindByColorYear(r.Context(), colorStr, year)
 		if err != nil {
-			http.Error(w, "error getting vehicles", http.StatusInternalServerError)
+			respond(w, r, http.StatusInternalServerError, "error getting vehicles", nil)
+			return
+		}
+
+		// - an export is a file, empty if no vehicles are found
+		if export(w, r, "vehicles_color_year", vehicles) {
 			return
 		}
 
 		if len(vehicles) == 0 {
-			http.Error(w, "No se encontraron vehiculos con esos criterios", http.StatusNotFound)
+			respond(w, r, http.StatusNotFound, "no vehicles found with those criteria", nil)
 			return
 		}
 
-		response.JSON(w, http.StatusOK, map[string]any{
-			"message": "success",
-			"data":    vehicles,
-		})
+		respond(w, r, http.StatusOK, "success", vehicles)
 	}
 }
 
 // GetByBrandYearRange is a method that returns a handler for the route GET /vehicles/brand/:brand/year/:year
 func (h *VehicleDefault) GetByBrandYearRange() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// - point in time, if any
+		sv, ok := h.reader(w, r)
+		if !ok {
+			return
+		}
+
 		// REQUEST
 		// - get brand from path
 		brandStr := chi.URLParam(r, "brand")
@@ -133,7 +136,7 @@ func (h *VehicleDefault) GetByBrandYearRange() http.HandlerFunc {
 		startYearStr := chi.URLParam(r, "startYear")
 		startYear, err := strconv.Atoi(startYearStr)
 		if err != nil {
-			http.Error(w, "invalid start year", http.StatusBadRequest)
+			respond(w, r, http.StatusBadRequest, "invalid start year", nil)
 			return
 		}
 
@@ -141,150 +144,180 @@ func (h *VehicleDefault) GetByBrandYearRange() http.HandlerFunc {
 		endYearStr := chi.URLParam(r, "endYear")
 		endYear, err := strconv.Atoi(endYearStr)
 		if err != nil {
-			http.Error(w, "invalid end year", http.StatusBadRequest)
+			respond(w, r, http.StatusBadRequest, "invalid end year", nil)
 			return
 		}
 
 		// PROCESS
 		// - calling the service
-		vehicles, err := h.sv.FindByBrandYearRange(brandStr, startYear, endYear)
+		vehicles, err := sv.FindByBrandYearRange(r.Context(), brandStr, startYear, endYear)
 		if err != nil {
-			http.Error(w, "error getting vehicles", http.StatusInternalServerError)
+			respond(w, r, http.StatusInternalServerError, "error getting vehicles", nil)
+			return
+		}
+
+		// - an export is a file, empty if no vehicles are found
+		if export(w, r, "vehicles_brand_year_range", vehicles) {
 			return
 		}
 
 		// - if no vehicles found
 		if len(vehicles) == 0 {
-			http.Error(w, "No se encontraron vehiculos con esos criterios", http.StatusNotFound)
+			respond(w, r, http.StatusNotFound, "no vehicles found with those criteria", nil)
 			return
 		}
 
 		// RESPONSE
-		response.JSON(w, http.StatusOK, map[string]any{
-			"message": "success",
-			"data":    vehicles,
-		})
+		respond(w, r, http.StatusOK, "success", vehicles)
 	}
 }
 
 // GetByBrandAverageSpeed is a method that returns a handler for the route GET /vehicles/brand/:brand/average-speed
 func (h *VehicleDefault) GetByBrandAverageSpeed() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// - point in time, if any
+		sv, ok := h.reader(w, r)
+		if !ok {
+			return
+		}
+
 		// REQUEST
 		// - get brand from path
 		brandStr := chi.URLParam(r, "brand")
 
 		// PROCESS
 		// - calling the service
-		averageSpeed, err := h.sv.FindByBrandAverageSpeed(brandStr)
+		averageSpeed, err := sv.FindByBrandAverageSpeed(r.Context(), brandStr)
 		if err != nil {
-			http.Error(w, "error getting vehicles", http.StatusInternalServerError)
+			respond(w, r, http.StatusInternalServerError, "error getting vehicles", nil)
 			return
 		}
 
 		// - if no vehicles found
 		if averageSpeed == 0 {
-			http.Error(w, "No se encontraron vehiculos de esa marca", http.StatusNotFound)
+			respond(w, r, http.StatusNotFound, "no vehicles found of that brand", nil)
 			return
 		}
 
 		// RESPONSE
-		response.JSON(w, http.StatusOK, map[string]any{
-			"message": "success",
-			"data":    averageSpeed,
-		})
+		respond(w, r, http.StatusOK, "success", averageSpeed)
 	}
 }
 
 // GetByFuelType is a method that returns a handler for the route GET /vehicles/fuel-type/:fuelType
 func (h *VehicleDefault) GetByFuelType() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// - point in time, if any
+		sv, ok := h.reader(w, r)
+		if !ok {
+			return
+		}
+
 		// REQUEST
 		// - get fuel type from path
 		fuelTypeStr := chi.URLParam(r, "type")
 
 		// PROCESS
 		// - calling the service
-		vehicles, err := h.sv.FindByFuelType(fuelTypeStr)
+		vehicles, err := sv.FindByFuelType(r.Context(), fuelTypeStr)
 		if err != nil {
-			http.Error(w, "error getting vehicles", http.StatusInternalServerError)
+			respond(w, r, http.StatusInternalServerError, "error getting vehicles", nil)
+			return
+		}
+
+		// - an export is a file, empty if no vehicles are found
+		if export(w, r, "vehicles_fuel_type", vehicles) {
 			return
 		}
 
 		// - if no vehicles found
 		if len(vehicles) == 0 {
-			http.Error(w, "No se encontraron vehiculos con ese tipo de combustible", http.StatusNotFound)
+			respond(w, r, http.StatusNotFound, "no vehicles found with that fuel type", nil)
 			return
 		}
 
 		// RESPONSE
-		response.JSON(w, http.StatusOK, map[string]any{
-			"message": "success",
-			"data":    vehicles,
-		})
+		respond(w, r, http.StatusOK, "success", vehicles)
 	}
 }
 
 // GetByTransmission is a method that returns a handler for the route
 func (h *VehicleDefault) GetByTransmissionType() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// - point in time, if any
+		sv, ok := h.reader(w, r)
+		if !ok {
+			return
+		}
+
 		// REQUEST
 		// - get transmission from path
 		transmissionStr := chi.URLParam(r, "type")
 
 		// PROCESS
 		// - calling the service
-		vehicles, err := h.sv.FindByTransmissionType(transmissionStr)
+		vehicles, err := sv.FindByTransmissionType(r.Context(), transmissionStr)
 		if err != nil {
-			http.Error(w, "error getting vehicles", http.StatusInternalServerError)
+			respond(w, r, http.StatusInternalServerError, "error getting vehicles", nil)
+			return
+		}
+
+		// - an export is a file, empty if no vehicles are found
+		if export(w, r, "vehicles_transmission", vehicles) {
 			return
 		}
 
 		// - if no vehicles found
 		if len(vehicles) == 0 {
-			http.Error(w, "No se encontraron vehiculos con ese tipo de transmision", http.StatusNotFound)
+			respond(w, r, http.StatusNotFound, "no vehicles found with that transmission", nil)
 			return
 		}
 
 		// RESPONSE
-		response.JSON(w, http.StatusOK, map[string]any{
-			"message": "success",
-			"data":    vehicles,
-		})
+		respond(w, r, http.StatusOK, "success", vehicles)
 	}
 }
 
 // GetByPassengers is a method that returns a handler for the route GET /vehicles/passengers/:passengers
 func (h *VehicleDefault) GetByBrandAverageCapacity() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// - point in time, if any
+		sv, ok := h.reader(w, r)
+		if !ok {
+			return
+		}
+
 		// REQUEST
 		// - get passengers from path
 		brandStr := chi.URLParam(r, "brand")
 
 		// PROCESS
 		// - calling the service
-		averageCapacity, err := h.sv.FindByBrandAverageCapacity(brandStr)
+		averageCapacity, err := sv.FindByBrandAverageCapacity(r.Context(), brandStr)
 		if err != nil {
-			http.Error(w, "error getting vehicles", http.StatusInternalServerError)
+			respond(w, r, http.StatusInternalServerError, "error getting vehicles", nil)
 			return
 		}
 
 		// - if no vehicles found
 		if averageCapacity == 0 {
-			http.Error(w, "No se encontraron vehiculos de esa marca", http.StatusNotFound)
+			respond(w, r, http.StatusNotFound, "no vehicles found of that brand", nil)
 			return
 		}
 
 		// RESPONSE
-		response.JSON(w, http.StatusOK, map[string]any{
-			"message": "success",
-			"data":    averageCapacity,
-		})
+		respond(w, r, http.StatusOK, "success", averageCapacity)
 	}
 }
 
 func (h *VehicleDefault) GetByWeightRange() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// - point in time, if any
+		sv, ok := h.reader(w, r)
+		if !ok {
+			return
+		}
+
 		// REQUEST
 		// - get weight from path
 		weightMinStr := r.URL.Query().Get("min")
@@ -292,95 +325,105 @@ func (h *VehicleDefault) GetByWeightRange() http.HandlerFunc {
 
 		weightMin, err := strconv.ParseFloat(weightMinStr, 64)
 		if err != nil {
-			http.Error(w, "invalid min weight", http.StatusBadRequest)
+			respond(w, r, http.StatusBadRequest, "invalid min weight", nil)
 			return
 		}
 		weightMax, err := strconv.ParseFloat(weightMaxStr, 64)
 		if err != nil {
-			http.Error(w, "invalid max weight", http.StatusBadRequest)
+			respond(w, r, http.StatusBadRequest, "invalid max weight", nil)
 			return
 		}
 
 		// PROCESS
 		// - calling the service
-		vehicles, err := h.sv.FindByWeightRange(weightMin, weightMax)
+		vehicles, err := sv.FindByWeightRange(r.Context(), weightMin, weightMax)
 		if err != nil {
-			http.Error(w, "error getting vehicles", http.StatusInternalServerError)
+			respond(w, r, http.StatusInternalServerError, "error getting vehicles", nil)
+			return
+		}
+
+		// - an export is a file, empty if no vehicles are found
+		if export(w, r, "vehicles_weight", vehicles) {
 			return
 		}
 
 		// - if no vehicles found
 		if len(vehicles) == 0 {
-			http.Error(w, "No se encontraron vehiculos en ese rango de peso", http.StatusNotFound)
+			respond(w, r, http.StatusNotFound, "no vehicles found in that weight range", nil)
 			return
 		}
 
 		// RESPONSE
-		response.JSON(w, http.StatusOK, map[string]any{
-			"message": "success",
-			"data":    vehicles,
-		})
+		respond(w, r, http.StatusOK, "success", vehicles)
 	}
 }
 
 // GetByDimensions is a method that returns a handler for the route GET /vehicles/dimensions
 func (h *VehicleDefault) GetByDimensionRange() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// - point in time, if any
+		sv, ok := h.reader(w, r)
+		if !ok {
+			return
+		}
+
 		// REQUEST
 		// - get dimensions from query
 		heightStr := r.URL.Query().Get("height")
 		heightDimension := strings.Split(heightStr, "-")
 		if len(heightDimension) != 2 {
-			http.Error(w, "invalid height", http.StatusBadRequest)
+			respond(w, r, http.StatusBadRequest, "invalid height", nil)
 			return
 		}
 		heightMin, err := strconv.ParseFloat(heightDimension[0], 64)
 		if err != nil {
-			http.Error(w, "invalid height", http.StatusBadRequest)
+			respond(w, r, http.StatusBadRequest, "invalid height", nil)
 			return
 		}
 		heightMax, err := strconv.ParseFloat(heightDimension[1], 64)
 		if err != nil {
-			http.Error(w, "invalid height", http.StatusBadRequest)
+			respond(w, r, http.StatusBadRequest, "invalid height", nil)
 			return
 		}
 
 		widthStr := r.URL.Query().Get("width")
 		widthDimension := strings.Split(widthStr, "-")
 		if len(widthDimension) != 2 {
-			http.Error(w, "invalid width", http.StatusBadRequest)
+			respond(w, r, http.StatusBadRequest, "invalid width", nil)
 			return
 		}
 		widthMin, err := strconv.ParseFloat(widthDimension[0], 64)
 		if err != nil {
-			http.Error(w, "invalid width", http.StatusBadRequest)
+			respond(w, r, http.StatusBadRequest, "invalid width", nil)
 			return
 		}
 		widthMax, err := strconv.ParseFloat(widthDimension[1], 64)
 		if err != nil {
-			http.Error(w, "invalid width", http.StatusBadRequest)
+			respond(w, r, http.StatusBadRequest, "invalid width", nil)
 			return
 		}
 
 		// PROCESS
 		// - calling the service
-		vehicles, err := h.sv.FindByDimensionRange(heightMin, widthMin, heightMax, widthMax)
+		vehicles, err := sv.FindByDimensionRange(r.Context(), heightMin, widthMin, heightMax, widthMax)
 		if err != nil {
-			http.Error(w, "error getting vehicles", http.StatusInternalServerError)
+			respond(w, r, http.StatusInternalServerError, "error getting vehicles", nil)
+			return
+		}
+
+		// - an export is a file, empty if no vehicles are found
+		if export(w, r, "vehicles_dimensions", vehicles) {
 			return
 		}
 
 		// - if no vehicles found
 		if len(vehicles) == 0 {
-			http.Error(w, "No se encontraron vehiculos con esas dimensiones", http.StatusNotFound)
+			respond(w, r, http.StatusNotFound, "no vehicles found with those dimensions", nil)
 			return
 		}
 
 		// RESPONSE
-		response.JSON(w, http.StatusOK, map[string]any{
-			"message": "success",
-			"data":    vehicles,
-		})
+		respond(w, r, http.StatusOK, "success", vehicles)
 	}
 }
 
@@ -388,98 +431,245 @@ func (h *VehicleDefault) GetByDimensionRange() http.HandlerFunc {
 *	SAVE
  */
 
+// Save is a method that returns a handler for the route POST /vehicles/add
+// - the body must contain every field and the id of a vehicle that does not exist yet (409 otherwise)
+// - the vehicle is saved through the service, so it gets a history entry, and is returned with its ETag
 func (h *VehicleDefault) Save() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// REQUEST
-		// -read into bytes
-		bytes, err := io.ReadAll(r.Body)
-		if err != nil {
-			response.JSON(w, http.StatusInternalServerError, map[string]any{"message": "error reading request"})
-			return
-		}
-
-		// - parse to map (dynamic)
-		bodyMap := make(map[string]any)
-		if err := json.Unmarshal(bytes, &bodyMap); err != nil {
-			response.JSON(w, http.StatusInternalServerError, map[string]any{"message": "error parsing request"})
+		// - body
+		fields, body, ok := readVehicleBody(w, r)
+		if !ok {
 			return
 		}
 
 		// validate fields
 		// - validate required fields
-		if err := tools.CheckFieldExistance(bodyMap,
-			"brand", "model", "registration", "color", "year", "passengers", "max_speed", "fuel_type", "transmission", "weight", "height", "length", "width"); err != nil {
+		if err := tools.CheckFieldExistance(fields, append([]string{"id"}, vehicleRequiredFields...)...); err != nil {
 			var fieldError *tools.FieldError
 			if errors.As(err, &fieldError) {
-				response.JSON(w, http.StatusBadRequest, map[string]any{"message": fmt.Sprintf("field %s is required", fieldError.Field)})
+				respond(w, r, http.StatusBadRequest, fmt.Sprintf("field %s is required", fieldError.Field), nil)
+				return
 			}
-			response.JSON(w, http.StatusInternalServerError, map[string]any{"message": "error validating request"})
+			respond(w, r, http.StatusInternalServerError, "error validating request", nil)
+			return
+		}
+		// - validate values
+		if err := validateVehicle(body); err != nil {
+			respond(w, r, http.StatusBadRequest, err.Error(), nil)
 			return
 		}
 
-		// - parse json to struct
-		var body VehicleJSON
-		if err := json.Unmarshal(bytes, &body); err != nil {
-			response.JSON(w, http.StatusInternalServerError, map[string]any{"message": "error parsing request"})
+		// PROCESS
+		// - calling the service, the vehicle must be new: writes over an existing one go through PUT/PATCH with If-Match
+		vehicle := body.vehicle()
+		if err := h.sv.Create(r.Context(), &vehicle); err != nil {
+			respondWriteError(w, r, err)
 			return
 		}
 
-		// Writing to the database
-		file, err := os.OpenFile("../docs/db/vehicles_100.json", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			response.JSON(w, http.StatusInternalServerError, map[string]any{"message": "error opening file"})
+		// RESPONSE
+		w.Header().Set("ETag", etag(vehicle.Version))
+		respond(w, r, http.StatusCreated, "success", serializeVehicle(vehicle))
+	}
+}
+
+// GetById is a method that returns a handler for the route GET /vehicles/{id}
+// - the version of the vehicle is returned as ETag, a request with a matching If-None-Match gets 304
+func (h *VehicleDefault) GetById() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// REQUEST
+		// - get id from path
+		id, valid := vehicleID(r)
+		if !valid {
+			respond(w, r, http.StatusBadRequest, "invalid id", nil)
 			return
 		}
-		defer file.Close()
 
-		// Serialize to json
-		vehicleJSON, err := json.Marshal(body)
-		fmt.Println("Serializing vehicle")
+		// PROCESS
+		// - point in time, if any
+		sv, ok := h.reader(w, r)
+		if !ok {
+			return
+		}
+		// - calling the service
+		v, err := sv.FindById(r.Context(), id)
 		if err != nil {
-			response.JSON(w, http.StatusInternalServerError, map[string]any{"message": "error serializing vehicle"})
+			respondWriteError(w, r, err)
 			return
 		}
-		// Write to file
-		if _, err := file.Write(vehicleJSON); err != nil {
-			response.JSON(w, http.StatusInternalServerError, map[string]any{"message": "error writing to file"})
+
+		// RESPONSE
+		w.Header().Set("ETag", etag(v.Version))
+		if match := r.Header.Get("If-None-Match"); match != "" && matchETag(match, v.Version, true) {
+			w.WriteHeader(http.StatusNotModified)
 			return
-		} else {
-			// Si la escritura en el archivo fue exitosa, registra un mensaje de éxito
-			log.Println("Successfully wrote to file")
 		}
+		respond(w, r, http.StatusOK, "success", serializeVehicle(v))
+	}
+}
 
-		// PROCESS
-		// serialize to vehicle
-		vehicle := internal.Vehicle{
-			VehicleAttributes: internal.VehicleAttributes{
-				Brand:           body.Brand,
-				Model:           body.Model,
-				Registration:    body.Registration,
-				Color:           body.Color,
-				FabricationYear: body.FabricationYear,
-				Capacity:        body.Capacity,
-				MaxSpeed:        body.MaxSpeed,
-				FuelType:        body.FuelType,
-				Transmission:    body.Transmission,
-				Weight:          body.Weight,
-				Dimensions: internal.Dimensions{
-					Height: body.Height,
-					Length: body.Length,
-					Width:  body.Width,
-				},
-			},
+// Update is a method that returns a handler for the route PUT /vehicles/{id}
+// - the body replaces the vehicle and must contain every field
+// - If-Match with the ETag of the current version is required (428), a stale one fails with 412
+func (h *VehicleDefault) Update() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// REQUEST
+		// - current version
+		current, ok := h.precondition(w, r)
+		if !ok {
+			return
 		}
-		/*
-			resp := h.sv.Save(&vehicle)
-			response.JSON(w, http.StatusCreated, map[string]any{
-				"message": "success",
-				"data":    resp,
+		// - body
+		fields, body, ok := readVehicleBody(w, r)
+		if !ok {
+			return
+		}
+		if err := tools.CheckFieldExistance(fields, vehicleRequiredFields...); err != nil {
+			var fieldError *tools.FieldError
+			if errors.As(err, &fieldError) {
+				respond(w, r, http.StatusBadRequest, fmt.Sprintf("field %s is required", fieldError.Field), nil)
+				return
 			}
-		*/
-		response.JSON(w, http.StatusCreated, map[string]any{
-			"message": "success",
-			"data":    vehicle,
-		})
+			respond(w, r, http.StatusInternalServerError, "error validating request", nil)
+			return
+		}
+
+		// PROCESS
+		body.ID = current.Id
+		h.update(w, r, body, current.Version)
+	}
+}
+
+// Patch is a method that returns a handler for the route PATCH /vehicles/{id}
+// - the fields of the body replace the ones of the vehicle, the rest are kept
+// - If-Match with the ETag of the current version is required (428), a stale one fails with 412
+func (h *VehicleDefault) Patch() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// REQUEST
+		// - current version
+		current, ok := h.precondition(w, r)
+		if !ok {
+			return
+		}
+		// - body
+		fields, body, ok := readVehicleBody(w, r)
+		if !ok {
+			return
+		}
+
+		// PROCESS
+		merged := mergeVehicle(serializeVehicle(current), fields, body)
+		merged.ID = current.Id
+		h.update(w, r, merged, current.Version)
+	}
+}
+
+// Delete is a method that returns a handler for the route DELETE /vehicles/{id}
+// - If-Match with the ETag of the current version is required (428), a stale one fails with 412
+func (h *VehicleDefault) Delete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// REQUEST
+		// - current version
+		current, ok := h.precondition(w, r)
+		if !ok {
+			return
+		}
+
+		// PROCESS
+		if err := h.sv.Delete(r.Context(), current.Id, current.Version); err != nil {
+			respondWriteError(w, r, err)
+			return
+		}
+
+		// RESPONSE
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// precondition is a method that returns the current vehicle of the path if the If-Match header matches its version
+// - it writes the error response and returns ok false otherwise
+func (h *VehicleDefault) precondition(w http.ResponseWriter, r *http.Request) (current internal.Vehicle, ok bool) {
+	id, ok := vehicleID(r)
+	if !ok {
+		respond(w, r, http.StatusBadRequest, "invalid id", nil)
+		return
+	}
+	match := r.Header.Get("If-Match")
+	if match == "" {
+		ok = false
+		respond(w, r, http.StatusPreconditionRequired, "If-Match header is required", nil)
+		return
+	}
+
+	current, err := h.sv.FindById(r.Context(), id)
+	if err != nil {
+		ok = false
+		respondWriteError(w, r, err)
+		return
+	}
+	if !matchETag(match, current.Version, false) {
+		ok = false
+		w.Header().Set("ETag", etag(current.Version))
+		respond(w, r, http.StatusPreconditionFailed, "vehicle was modified", nil)
+		return
+	}
+	return
+}
+
+// update is a method that validates and writes a vehicle over the given version and responds with the result
+func (h *VehicleDefault) update(w http.ResponseWriter, r *http.Request, body VehicleJSON, version int) {
+	if err := validateVehicle(body); err != nil {
+		respond(w, r, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	vehicle := body.vehicle()
+	if err := h.sv.Update(r.Context(), &vehicle, version); err != nil {
+		respondWriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(vehicle.Version))
+	respond(w, r, http.StatusOK, "success", serializeVehicle(vehicle))
+}
+
+// readVehicleBody is a function that reads and decodes the body of a vehicle according to its content type
+// - it writes the error response and returns ok false if the body can not be read
+func readVehicleBody(w http.ResponseWriter, r *http.Request) (fields map[string]any, body VehicleJSON, ok bool) {
+	bytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		respond(w, r, http.StatusInternalServerError, "error reading request", nil)
+		return
+	}
+	fields, body, err = decodeVehicleBody(r.Header.Get("Content-Type"), bytes)
+	if err != nil {
+		if errors.Is(err, ErrUnsupportedMediaType) {
+			respond(w, r, http.StatusUnsupportedMediaType, "unsupported content type", nil)
+			return
+		}
+		respond(w, r, http.StatusBadRequest, "error parsing request", nil)
+		return
+	}
+	ok = true
+	return
+}
+
+// respondWriteError is a function that responds with the status of an error of the service
+func respondWriteError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, internal.ErrVehicleNotFound):
+		respond(w, r, http.StatusNotFound, "vehicle not found", nil)
+	case errors.Is(err, internal.ErrVehicleExists):
+		respond(w, r, http.StatusConflict, "vehicle already exists", nil)
+	case errors.Is(err, internal.ErrVehicleVersionMismatch):
+		respond(w, r, http.StatusPreconditionFailed, "vehicle was modified", nil)
+	case errors.Is(err, internal.ErrVehicleInvalidField):
+		respond(w, r, http.StatusBadRequest, "invalid vehicle", nil)
+	case errors.Is(err, internal.ErrVehicleReadOnly):
+		respond(w, r, http.StatusMethodNotAllowed, "vehicles are read-only", nil)
+	default:
+		respond(w, r, http.StatusInternalServerError, "internal server error", nil)
 	}
 }
 
@@ -0,0 +1,110 @@
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	// magicGzip is the magic number at the start of a gzip stream
+	magicGzip = []byte{0x1f, 0x8b}
+	// magicZstd is the magic number at the start of a zstd frame
+	magicZstd = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Compression is the compression of a stream
+type Compression int
+
+const (
+	// CompressionNone is plain data
+	CompressionNone Compression = iota
+	// CompressionGzip is a gzip stream
+	CompressionGzip
+	// CompressionZstd is a zstd stream
+	CompressionZstd
+)
+
+// DetectCompression is a function that returns the compression of a stream starting with head
+// - head shorter than the magic bytes is plain data
+func DetectCompression(head []byte) Compression {
+	switch {
+	case bytes.HasPrefix(head, magicGzip):
+		return CompressionGzip
+	case bytes.HasPrefix(head, magicZstd):
+		return CompressionZstd
+	default:
+		return CompressionNone
+	}
+}
+
+// CompressionOf is a function that returns the compression of a file based on the extension of path
+// - ".gz" is gzip, ".zst" / ".zstd" is zstd, any other extension is plain data
+func CompressionOf(path string) Compression {
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		return CompressionGzip
+	case strings.HasSuffix(path, ".zst"), strings.HasSuffix(path, ".zstd"):
+		return CompressionZstd
+	default:
+		return CompressionNone
+	}
+}
+
+// NewDecompressReader is a function that returns a reader that transparently decompresses r
+// - the compression is detected by the magic bytes of the stream (see DetectCompression), plain data is returned as is
+func NewDecompressReader(r io.Reader) (rc io.ReadCloser, err error) {
+	br := bufio.NewReader(r)
+
+	// peek the magic bytes (a short stream is not an error, it just can not be compressed)
+	head, _ := br.Peek(len(magicZstd))
+
+	switch DetectCompression(head) {
+	case CompressionGzip:
+		rc, err = gzip.NewReader(br)
+	case CompressionZstd:
+		var dec *zstd.Decoder
+		dec, err = zstd.NewReader(br)
+		if err != nil {
+			return
+		}
+		rc = dec.IOReadCloser()
+	default:
+		rc = io.NopCloser(br)
+	}
+	return
+}
+
+// NewCompressWriter is a function that returns a writer that compresses into w based on the extension of path
+// - ".gz" writes gzip, ".zst" / ".zstd" writes zstd, any other extension writes plain data (see CompressionOf)
+// - the returned writer must be closed to flush the compressed stream, closing it does not close w
+func NewCompressWriter(w io.Writer, path string) (wc io.WriteCloser, err error) {
+	wc, err = NewCompressWriterWith(w, CompressionOf(path))
+	return
+}
+
+// NewCompressWriterWith is a function that returns a writer that compresses into w with the compression c
+// - the returned writer must be closed to flush the compressed stream, closing it does not close w
+func NewCompressWriterWith(w io.Writer, c Compression) (wc io.WriteCloser, err error) {
+	switch c {
+	case CompressionGzip:
+		wc = gzip.NewWriter(w)
+	case CompressionZstd:
+		wc, err = zstd.NewWriter(w)
+	default:
+		wc = nopWriteCloser{w}
+	}
+	return
+}
+
+// nopWriteCloser is a struct that wraps a writer with a no-op Close method
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close is a method that does nothing
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,138 @@
+package loader_test
+
+import (
+	"app/internal"
+	"app/internal/loader"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Tests for NewCompressWriter and NewDecompressReader
+func TestCompression_RoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"id":1,"brand":"Ford","model":"Fiesta"},`), 100)
+
+	// compress is a function that compresses data according to the extension of path
+	compress := func(t *testing.T, path string, data []byte) []byte {
+		var buf bytes.Buffer
+		wc, err := loader.NewCompressWriter(&buf, path)
+		require.NoError(t, err)
+		_, err = wc.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, wc.Close())
+		return buf.Bytes()
+	}
+	// decompress is a function that decompresses data detecting its compression
+	decompress := func(t *testing.T, data []byte) []byte {
+		rc, err := loader.NewDecompressReader(bytes.NewReader(data))
+		require.NoError(t, err)
+		defer rc.Close()
+		out, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		return out
+	}
+
+	cases := []struct {
+		name  string
+		path  string
+		magic []byte
+	}{
+		{name: "case 1: should write plain data for any other extension", path: "vehicles.json", magic: []byte(`{"id"`)},
+		{name: "case 2: should write gzip for .gz", path: "vehicles.json.gz", magic: []byte{0x1f, 0x8b}},
+		{name: "case 3: should write zstd for .zst", path: "vehicles.json.zst", magic: []byte{0x28, 0xb5, 0x2f, 0xfd}},
+		{name: "case 4: should write zstd for .zstd", path: "vehicles.json.zstd", magic: []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// act
+			compressed := compress(t, c.path, data)
+			decompressed := decompress(t, compressed)
+
+			// assert
+			require.True(t, bytes.HasPrefix(compressed, c.magic))
+			require.Equal(t, data, decompressed)
+		})
+	}
+
+	t.Run("case 5: should read a stream shorter than the magic bytes as plain data", func(t *testing.T) {
+		// act
+		out := decompress(t, []byte{0x1f})
+
+		// assert
+		require.Equal(t, []byte{0x1f}, out)
+	})
+
+	t.Run("case 6: should read an empty stream as plain data", func(t *testing.T) {
+		// act
+		out := decompress(t, nil)
+
+		// assert
+		require.Empty(t, out)
+	})
+
+	t.Run("case 7: should fail on a gzip stream with a broken header", func(t *testing.T) {
+		// act
+		_, err := loader.NewDecompressReader(bytes.NewReader([]byte{0x1f, 0x8b, 0x00}))
+
+		// assert
+		require.Error(t, err)
+	})
+}
+
+// Tests for VehicleJSONFile with compressed files
+func TestVehicleJSONFile_Compressed(t *testing.T) {
+	vehicles := map[int]internal.Vehicle{
+		1: {Id: 1, VehicleAttributes: internal.VehicleAttributes{Brand: "Ford", Model: "Fiesta", Registration: "1234ABC", FabricationYear: 2010, MaxSpeed: 180.5}},
+		2: {Id: 2, VehicleAttributes: internal.VehicleAttributes{Brand: "Seat", Model: "Ibiza", Registration: "5678DEF", Weight: 1100.25}},
+	}
+	for i, name := range []string{"vehicles.json", "vehicles.json.gz", "vehicles.json.zst"} {
+		t.Run(fmt.Sprintf("case %d: should load the vehicles dumped to %s", i+1, name), func(t *testing.T) {
+			// arrange
+			ld := loader.NewVehicleJSONFile(filepath.Join(t.TempDir(), name))
+			require.NoError(t, ld.Dump(vehicles))
+
+			// act
+			v, err := ld.Load()
+
+			// assert
+			require.NoError(t, err)
+			require.Equal(t, vehicles, v)
+		})
+	}
+
+	t.Run("case 4: should keep the compression detected on load when the file is rewritten, whatever its extension", func(t *testing.T) {
+		// arrange
+		// - a gzip and a zstd file without the extension of their compression
+		dir := t.TempDir()
+		paths := map[string][]byte{
+			filepath.Join(dir, "gzip.json"): {0x1f, 0x8b},
+			filepath.Join(dir, "zstd.json"): {0x28, 0xb5, 0x2f, 0xfd},
+		}
+		for path, magic := range paths {
+			var buf bytes.Buffer
+			require.NoError(t, loader.EncodeVehiclesWith(&buf, loader.DetectCompression(magic), vehicles))
+			require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+		}
+
+		for path, magic := range paths {
+			// act
+			ld := loader.NewVehicleJSONFile(path)
+			_, err := ld.Load()
+			require.NoError(t, err)
+			require.NoError(t, ld.Dump(vehicles))
+
+			// assert
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.True(t, bytes.HasPrefix(data, magic))
+			v, err := loader.NewVehicleJSONFile(path).Load()
+			require.NoError(t, err)
+			require.Equal(t, vehicles, v)
+		}
+	})
+}
@@ -0,0 +1,210 @@
+package loader
+
+import (
+	"app/internal"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnexpectedStatus is returned when the source answers with an unexpected status code
+	ErrUnexpectedStatus = errors.New("loader: unexpected status code")
+)
+
+// IsURL is a function that reports whether path is an http(s) URL instead of a file path
+func IsURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// ConfigVehicleHTTP is a struct that represents the configuration for VehicleHTTP
+type ConfigVehicleHTTP struct {
+	// CachePath is the path to the file where the last fetched dataset is cached
+	CachePath string
+	// Timeout is the maximum duration of a request to the source
+	Timeout time.Duration
+}
+
+// NewVehicleHTTP is a function that returns a new instance of VehicleHTTP
+func NewVehicleHTTP(url string, cfg *ConfigVehicleHTTP) *VehicleHTTP {
+	// default values
+	sum := sha256.Sum256([]byte(url))
+	defaultConfig := &ConfigVehicleHTTP{
+		CachePath: filepath.Join(os.TempDir(), "vehicles-"+hex.EncodeToString(sum[:8])+".cache"),
+		Timeout:   10 * time.Second,
+	}
+	if cfg != nil {
+		if cfg.CachePath != "" {
+			defaultConfig.CachePath = cfg.CachePath
+		}
+		if cfg.Timeout != 0 {
+			defaultConfig.Timeout = cfg.Timeout
+		}
+	}
+
+	return &VehicleHTTP{
+		url:       url,
+		cachePath: defaultConfig.CachePath,
+		client:    &http.Client{Timeout: defaultConfig.Timeout},
+	}
+}
+
+// VehicleHTTP is a struct that implements the LoaderVehicle interface
+// - it fetches the vehicles in JSON format from an http(s) URL (plain, gzip or zstd compressed)
+// - the response is cached locally and revalidated with ETag / If-Modified-Since
+// - if the source is unreachable, fails or serves a broken dataset the cached dataset is used instead
+type VehicleHTTP struct {
+	// url is the URL of the published dataset
+	url string
+	// cachePath is the path to the file where the last fetched dataset is cached
+	cachePath string
+	// client is the http client used to fetch the dataset
+	client *http.Client
+}
+
+// cacheMeta is a struct that represents the validators of the cached dataset
+type cacheMeta struct {
+	// URL is the URL the dataset was fetched from
+	URL string `json:"url"`
+	// ETag is the entity tag returned by the source
+	ETag string `json:"etag,omitempty"`
+	// LastModified is the Last-Modified header returned by the source
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// Load is a method that loads the vehicles
+// - the cached dataset is used if it is still valid (304) or if the source fails in any way:
+// unreachable, an error status or a dataset that can not be read or decoded
+func (l *VehicleHTTP) Load() (v map[int]internal.Vehicle, err error) {
+	// cached validators (only if they belong to the same URL and the cached dataset still exists)
+	meta, cached := l.readCacheMeta()
+
+	v, notModified, err := l.fetch(meta, cached)
+	switch {
+	case notModified:
+		// - the cached dataset is still valid
+		return l.loadCache()
+	case err != nil && cached:
+		// - source failing: fallback to the cache
+		slog.Warn("loading the cached dataset, the source failed",
+			slog.String("url", l.url),
+			slog.String("cache", l.cachePath),
+			slog.Any("error", err),
+		)
+		return l.loadCache()
+	}
+	return
+}
+
+// fetch is a method that requests the dataset, revalidating the cached one if cached is true
+// - notModified is true if the source answers that the cached dataset is still valid
+func (l *VehicleHTTP) fetch(meta cacheMeta, cached bool) (v map[int]internal.Vehicle, notModified bool, err error) {
+	// request
+	req, err := http.NewRequest(http.MethodGet, l.url, nil)
+	if err != nil {
+		return
+	}
+	if cached {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+
+	res, err := l.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusOK:
+		// - fresh dataset: refresh the cache and decode it
+		v, err = l.refreshCache(res)
+	case res.StatusCode == http.StatusNotModified && cached:
+		notModified = true
+	default:
+		err = fmt.Errorf("%w: %s returned %d", ErrUnexpectedStatus, l.url, res.StatusCode)
+	}
+	return
+}
+
+// refreshCache is a method that stores the dataset of res in the cache and decodes it
+func (l *VehicleHTTP) refreshCache(res *http.Response) (v map[int]internal.Vehicle, err error) {
+	// write the body to a temporary file next to the cache
+	if err = os.MkdirAll(filepath.Dir(l.cachePath), 0o755); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(l.cachePath), filepath.Base(l.cachePath)+".tmp*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err = io.Copy(tmp, res.Body); err != nil {
+		return
+	}
+
+	// decode before replacing the cache, a broken dataset must not overwrite a good one
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	v, err = DecodeVehicles(tmp)
+	if err != nil {
+		return
+	}
+
+	// replace the cache
+	if err = tmp.Close(); err != nil {
+		return
+	}
+	if err = os.Rename(tmp.Name(), l.cachePath); err != nil {
+		return
+	}
+	meta := cacheMeta{
+		URL:          l.url,
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+	}
+	bytes, err := json.Marshal(meta)
+	if err != nil {
+		return
+	}
+	err = os.WriteFile(l.cachePath+".meta", bytes, 0o644)
+	return
+}
+
+// loadCache is a method that loads the vehicles from the cache
+func (l *VehicleHTTP) loadCache() (v map[int]internal.Vehicle, err error) {
+	v, err = NewVehicleJSONFile(l.cachePath).Load()
+	return
+}
+
+// readCacheMeta is a method that returns the validators of the cached dataset
+// - ok is false if there is no usable cache for the URL
+func (l *VehicleHTTP) readCacheMeta() (meta cacheMeta, ok bool) {
+	if _, err := os.Stat(l.cachePath); err != nil {
+		return
+	}
+	bytes, err := os.ReadFile(l.cachePath + ".meta")
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(bytes, &meta); err != nil || meta.URL != l.url {
+		return
+	}
+	ok = true
+	return
+}
@@ -0,0 +1,296 @@
+package loader_test
+
+import (
+	"app/internal"
+	"app/internal/loader"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// datasetServer is a struct that serves a dataset over http, recording the validators of the requests
+type datasetServer struct {
+	*httptest.Server
+	mu sync.Mutex
+	// handle serves the next requests
+	handle http.HandlerFunc
+	// headers are the headers of the requests served
+	headers []http.Header
+}
+
+// newDatasetServer is a function that returns a started datasetServer that serves with handle
+func newDatasetServer(t *testing.T, handle http.HandlerFunc) (s *datasetServer) {
+	s = &datasetServer{handle: handle}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.headers = append(s.headers, r.Header.Clone())
+		handle := s.handle
+		s.mu.Unlock()
+		handle(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return
+}
+
+// serve is a method that replaces the handler of the next requests
+func (s *datasetServer) serve(handle http.HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handle = handle
+}
+
+// lastHeader is a method that returns the headers of the last request served
+func (s *datasetServer) lastHeader() http.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.headers[len(s.headers)-1]
+}
+
+// encodedVehicles is a function that returns the vehicles encoded in the loader JSON format
+func encodedVehicles(t *testing.T, v map[int]internal.Vehicle) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, loader.EncodeVehicles(&buf, "vehicles.json", v))
+	return buf.Bytes()
+}
+
+// serveDataset is a function that returns a handler that serves body with the validators etag and lastModified
+func serveDataset(body []byte, etag, lastModified string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		w.Write(body)
+	}
+}
+
+// serveStatus is a function that returns a handler that answers with code
+func serveStatus(code int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+	}
+}
+
+// Tests for VehicleHTTP.Load
+func TestVehicleHTTP_Load(t *testing.T) {
+	vehicles := map[int]internal.Vehicle{
+		1: {Id: 1, VehicleAttributes: internal.VehicleAttributes{Brand: "Ford", Model: "Fiesta", Registration: "1234ABC"}},
+		2: {Id: 2, VehicleAttributes: internal.VehicleAttributes{Brand: "Seat", Model: "Ibiza", Registration: "5678DEF"}},
+	}
+	const lastModified = "Mon, 19 Oct 2026 10:00:00 GMT"
+
+	t.Run("case 1: should fetch the dataset without validators if there is no cache", func(t *testing.T) {
+		// arrange
+		s := newDatasetServer(t, serveDataset(encodedVehicles(t, vehicles), `"v1"`, lastModified))
+		ld := loader.NewVehicleHTTP(s.URL, &loader.ConfigVehicleHTTP{CachePath: filepath.Join(t.TempDir(), "vehicles.cache")})
+
+		// act
+		v, err := ld.Load()
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, vehicles, v)
+		require.Empty(t, s.lastHeader().Get("If-None-Match"))
+		require.Empty(t, s.lastHeader().Get("If-Modified-Since"))
+	})
+
+	t.Run("case 2: should revalidate the cache and load it on 304", func(t *testing.T) {
+		// arrange
+		s := newDatasetServer(t, serveDataset(encodedVehicles(t, vehicles), `"v1"`, lastModified))
+		ld := loader.NewVehicleHTTP(s.URL, &loader.ConfigVehicleHTTP{CachePath: filepath.Join(t.TempDir(), "vehicles.cache")})
+		_, err := ld.Load()
+		require.NoError(t, err)
+		s.serve(serveStatus(http.StatusNotModified))
+
+		// act
+		v, err := ld.Load()
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, vehicles, v)
+		require.Equal(t, `"v1"`, s.lastHeader().Get("If-None-Match"))
+		require.Equal(t, lastModified, s.lastHeader().Get("If-Modified-Since"))
+	})
+
+	t.Run("case 3: should replace the cache with a fresh dataset", func(t *testing.T) {
+		// arrange
+		s := newDatasetServer(t, serveDataset(encodedVehicles(t, vehicles), `"v1"`, lastModified))
+		ld := loader.NewVehicleHTTP(s.URL, &loader.ConfigVehicleHTTP{CachePath: filepath.Join(t.TempDir(), "vehicles.cache")})
+		_, err := ld.Load()
+		require.NoError(t, err)
+		fresh := map[int]internal.Vehicle{3: {Id: 3, VehicleAttributes: internal.VehicleAttributes{Brand: "Fiat"}}}
+		s.serve(serveDataset(encodedVehicles(t, fresh), `"v2"`, ""))
+
+		// act
+		v, err := ld.Load()
+		s.serve(serveStatus(http.StatusNotModified))
+		cached, errCached := ld.Load()
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, fresh, v)
+		require.NoError(t, errCached)
+		require.Equal(t, fresh, cached)
+		require.Equal(t, `"v2"`, s.lastHeader().Get("If-None-Match"))
+		require.Empty(t, s.lastHeader().Get("If-Modified-Since"))
+	})
+
+	t.Run("case 4: should fall back to the cache and keep it if the fresh dataset is broken", func(t *testing.T) {
+		// arrange
+		s := newDatasetServer(t, serveDataset(encodedVehicles(t, vehicles), `"v1"`, lastModified))
+		ld := loader.NewVehicleHTTP(s.URL, &loader.ConfigVehicleHTTP{CachePath: filepath.Join(t.TempDir(), "vehicles.cache")})
+		_, err := ld.Load()
+		require.NoError(t, err)
+		s.serve(serveDataset([]byte(`[{"id":`), `"v2"`, ""))
+
+		// act
+		v, err := ld.Load()
+		s.serve(serveStatus(http.StatusNotModified))
+		cached, errCached := ld.Load()
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, vehicles, v)
+		require.NoError(t, errCached)
+		require.Equal(t, vehicles, cached)
+		require.Equal(t, `"v1"`, s.lastHeader().Get("If-None-Match"))
+	})
+
+	t.Run("case 5: should fall back to the cache if the source is unreachable", func(t *testing.T) {
+		// arrange
+		s := newDatasetServer(t, serveDataset(encodedVehicles(t, vehicles), `"v1"`, lastModified))
+		ld := loader.NewVehicleHTTP(s.URL, &loader.ConfigVehicleHTTP{CachePath: filepath.Join(t.TempDir(), "vehicles.cache")})
+		_, err := ld.Load()
+		require.NoError(t, err)
+		s.Close()
+
+		// act
+		v, err := ld.Load()
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, vehicles, v)
+	})
+
+	t.Run("case 6: should fall back to the cache if the source fails", func(t *testing.T) {
+		// arrange
+		s := newDatasetServer(t, serveDataset(encodedVehicles(t, vehicles), `"v1"`, lastModified))
+		ld := loader.NewVehicleHTTP(s.URL, &loader.ConfigVehicleHTTP{CachePath: filepath.Join(t.TempDir(), "vehicles.cache")})
+		_, err := ld.Load()
+		require.NoError(t, err)
+		s.serve(serveStatus(http.StatusBadGateway))
+
+		// act
+		v, err := ld.Load()
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, vehicles, v)
+	})
+
+	t.Run("case 7: should fall back to the cache if the source times out", func(t *testing.T) {
+		// arrange
+		s := newDatasetServer(t, serveDataset(encodedVehicles(t, vehicles), `"v1"`, lastModified))
+		ld := loader.NewVehicleHTTP(s.URL, &loader.ConfigVehicleHTTP{
+			CachePath: filepath.Join(t.TempDir(), "vehicles.cache"),
+			Timeout:   50 * time.Millisecond,
+		})
+		_, err := ld.Load()
+		require.NoError(t, err)
+		s.serve(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		})
+
+		// act
+		start := time.Now()
+		v, err := ld.Load()
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, vehicles, v)
+		require.Less(t, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("case 8: should fail if the source times out and there is no cache", func(t *testing.T) {
+		// arrange
+		s := newDatasetServer(t, func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		})
+		ld := loader.NewVehicleHTTP(s.URL, &loader.ConfigVehicleHTTP{
+			CachePath: filepath.Join(t.TempDir(), "vehicles.cache"),
+			Timeout:   50 * time.Millisecond,
+		})
+
+		// act
+		_, err := ld.Load()
+
+		// assert
+		require.Error(t, err)
+	})
+
+	t.Run("case 9: should fail on an unexpected status if there is no cache", func(t *testing.T) {
+		// arrange
+		s := newDatasetServer(t, serveStatus(http.StatusBadGateway))
+		ld := loader.NewVehicleHTTP(s.URL, &loader.ConfigVehicleHTTP{CachePath: filepath.Join(t.TempDir(), "vehicles.cache")})
+
+		// act
+		_, err := ld.Load()
+
+		// assert
+		require.ErrorIs(t, err, loader.ErrUnexpectedStatus)
+	})
+
+	t.Run("case 10: should fall back to the cache on a client error", func(t *testing.T) {
+		// arrange
+		s := newDatasetServer(t, serveDataset(encodedVehicles(t, vehicles), `"v1"`, lastModified))
+		ld := loader.NewVehicleHTTP(s.URL, &loader.ConfigVehicleHTTP{CachePath: filepath.Join(t.TempDir(), "vehicles.cache")})
+		_, err := ld.Load()
+		require.NoError(t, err)
+		s.serve(serveStatus(http.StatusNotFound))
+
+		// act
+		v, err := ld.Load()
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, vehicles, v)
+	})
+
+	t.Run("case 11: should fail if the dataset is broken and there is no cache", func(t *testing.T) {
+		// arrange
+		s := newDatasetServer(t, serveDataset([]byte(`[{"id":`), `"v1"`, lastModified))
+		ld := loader.NewVehicleHTTP(s.URL, &loader.ConfigVehicleHTTP{CachePath: filepath.Join(t.TempDir(), "vehicles.cache")})
+
+		// act
+		_, err := ld.Load()
+
+		// assert
+		require.Error(t, err)
+	})
+
+	t.Run("case 12: should not revalidate a cache fetched from another URL", func(t *testing.T) {
+		// arrange
+		cachePath := filepath.Join(t.TempDir(), "vehicles.cache")
+		other := newDatasetServer(t, serveDataset(encodedVehicles(t, vehicles), `"v1"`, lastModified))
+		_, err := loader.NewVehicleHTTP(other.URL, &loader.ConfigVehicleHTTP{CachePath: cachePath}).Load()
+		require.NoError(t, err)
+		s := newDatasetServer(t, serveStatus(http.StatusNotModified))
+
+		// act
+		_, err = loader.NewVehicleHTTP(s.URL, &loader.ConfigVehicleHTTP{CachePath: cachePath}).Load()
+
+		// assert
+		require.ErrorIs(t, err, loader.ErrUnexpectedStatus)
+		require.Empty(t, s.lastHeader().Get("If-None-Match"))
+	})
+}
@@ -2,8 +2,12 @@ package loader
 
 import (
 	"app/internal"
+	"bufio"
 	"encoding/json"
+	"io"
 	"os"
+	"path/filepath"
+	"sort"
 )
 
 // NewVehicleJSONFile is a function that returns a new instance of VehicleJSONFile
@@ -14,14 +18,21 @@ func NewVehicleJSONFile(path string) *VehicleJSONFile {
 }
 
 // VehicleJSONFile is a struct that implements the LoaderVehicle interface
+// - the file may be compressed with gzip or zstd, it is detected by its magic bytes
+// - the compression detected by Load is kept when Dump rewrites the file, whatever its extension
 type VehicleJSONFile struct {
 	// path is the path to the file that contains the vehicles in JSON format
 	path string
+	// compression is the compression of the file detected by the last Load, if loaded is true
+	compression Compression
+	// loaded is true once Load detected the compression of the file
+	loaded bool
 }
 
 // VehicleJSON is a struct that represents a vehicle in JSON format
 type VehicleJSON struct {
 	Id              int     `json:"id"`
+	Version         int     `json:"version,omitempty"`
 	Brand           string  `json:"brand"`
 	Model           string  `json:"model"`
 	Registration    string  `json:"registration"`
@@ -46,9 +57,77 @@ func (l *VehicleJSONFile) Load() (v map[int]internal.Vehicle, err error) {
 	}
 	defer file.Close()
 
+	// detect the compression (a short file is not an error, it just can not be compressed)
+	br := bufio.NewReader(file)
+	head, _ := br.Peek(len(magicZstd))
+	compression := DetectCompression(head)
+
 	// decode file
+	if v, err = DecodeVehicles(br); err != nil {
+		return
+	}
+	l.compression, l.loaded = compression, true
+	return
+}
+
+// Dump is a method that writes the vehicles to the file
+// - the file keeps the compression detected by Load, a file never loaded is compressed according to its extension (see CompressionOf)
+// - the file is replaced atomically, readers never see a partially written file
+func (l *VehicleJSONFile) Dump(v map[int]internal.Vehicle) (err error) {
+	compression := CompressionOf(l.path)
+	if l.loaded {
+		compression = l.compression
+	}
+	err = writeFileAtomic(l.path, func(w io.Writer) error {
+		return EncodeVehiclesWith(w, compression, v)
+	})
+	return
+}
+
+// writeFileAtomic is a function that writes a file through a temporary file next to it and a rename
+// - readers never see a partially written file
+func writeFileAtomic(path string, write func(w io.Writer) error) (err error) {
+	// write to a temporary file next to the destination
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	// write content
+	if err = write(tmp); err != nil {
+		return
+	}
+	if err = tmp.Sync(); err != nil {
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+
+	// replace the file
+	err = os.Rename(tmp.Name(), path)
+	return
+}
+
+// DecodeVehicles is a function that decodes the vehicles from r in the loader JSON format
+// - r may be compressed with gzip or zstd
+func DecodeVehicles(r io.Reader) (v map[int]internal.Vehicle, err error) {
+	// decompress
+	rc, err := NewDecompressReader(r)
+	if err != nil {
+		return
+	}
+	defer rc.Close()
+
+	// decode
 	var vehiclesJSON []VehicleJSON
-	err = json.NewDecoder(file).Decode(&vehiclesJSON)
+	err = json.NewDecoder(rc).Decode(&vehiclesJSON)
 	if err != nil {
 		return
 	}
@@ -56,27 +135,87 @@ func (l *VehicleJSONFile) Load() (v map[int]internal.Vehicle, err error) {
 	// serialize vehicles
 	v = make(map[int]internal.Vehicle)
 	for _, vh := range vehiclesJSON {
-		v[vh.Id] = internal.Vehicle{
-			Id: vh.Id,
-			VehicleAttributes: internal.VehicleAttributes{
-				Brand:           vh.Brand,
-				Model:           vh.Model,
-				Registration:    vh.Registration,
-				Color:           vh.Color,
-				FabricationYear: vh.FabricationYear,
-				Capacity:        vh.Capacity,
-				MaxSpeed:        vh.MaxSpeed,
-				FuelType:        vh.FuelType,
-				Transmission:    vh.Transmission,
-				Weight:          vh.Weight,
-				Dimensions: internal.Dimensions{
-					Height: vh.Height,
-					Length: vh.Length,
-					Width:  vh.Width,
-				},
-			},
-		}
+		v[vh.Id] = vh.Vehicle()
+	}
+
+	return
+}
+
+// EncodeVehicles is a function that encodes the vehicles into w in the loader JSON format
+// - the output is compressed according to the extension of path (see NewCompressWriter)
+// - vehicles are written ordered by id
+func EncodeVehicles(w io.Writer, path string, v map[int]internal.Vehicle) (err error) {
+	err = EncodeVehiclesWith(w, CompressionOf(path), v)
+	return
+}
+
+// EncodeVehiclesWith is a function that encodes the vehicles into w in the loader JSON format compressed with c
+// - vehicles are written ordered by id
+func EncodeVehiclesWith(w io.Writer, c Compression, v map[int]internal.Vehicle) (err error) {
+	// compress
+	wc, err := NewCompressWriterWith(w, c)
+	if err != nil {
+		return
+	}
+
+	// deserialize vehicles
+	vehiclesJSON := make([]VehicleJSON, 0, len(v))
+	for _, vh := range v {
+		vehiclesJSON = append(vehiclesJSON, NewVehicleJSON(vh))
 	}
+	sort.Slice(vehiclesJSON, func(i, j int) bool { return vehiclesJSON[i].Id < vehiclesJSON[j].Id })
 
+	// encode
+	if err = json.NewEncoder(wc).Encode(vehiclesJSON); err != nil {
+		wc.Close()
+		return
+	}
+	err = wc.Close()
 	return
 }
+
+// NewVehicleJSON is a function that returns the JSON representation of a vehicle
+func NewVehicleJSON(v internal.Vehicle) VehicleJSON {
+	return VehicleJSON{
+		Id:              v.Id,
+		Version:         v.Version,
+		Brand:           v.Brand,
+		Model:           v.Model,
+		Registration:    v.Registration,
+		Color:           v.Color,
+		FabricationYear: v.FabricationYear,
+		Capacity:        v.Capacity,
+		MaxSpeed:        v.MaxSpeed,
+		FuelType:        v.FuelType,
+		Transmission:    v.Transmission,
+		Weight:          v.Weight,
+		Height:          v.Height,
+		Length:          v.Length,
+		Width:           v.Width,
+	}
+}
+
+// Vehicle is a method that returns the vehicle represented by the JSON
+func (vh VehicleJSON) Vehicle() internal.Vehicle {
+	return internal.Vehicle{
+		Id:      vh.Id,
+		Version: vh.Version,
+		VehicleAttributes: internal.VehicleAttributes{
+			Brand:           vh.Brand,
+			Model:           vh.Model,
+			Registration:    vh.Registration,
+			Color:           vh.Color,
+			FabricationYear: vh.FabricationYear,
+			Capacity:        vh.Capacity,
+			MaxSpeed:        vh.MaxSpeed,
+			FuelType:        vh.FuelType,
+			Transmission:    vh.Transmission,
+			Weight:          vh.Weight,
+			Dimensions: internal.Dimensions{
+				Height: vh.Height,
+				Length: vh.Length,
+				Width:  vh.Width,
+			},
+		},
+	}
+}
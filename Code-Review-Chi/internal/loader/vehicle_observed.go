@@ -0,0 +1,28 @@
+package loader
+
+import (
+	"app/internal"
+	"time"
+)
+
+// NewVehicleObserved is a function that returns a new instance of VehicleObserved
+func NewVehicleObserved(ld internal.VehicleLoader, observe func(d time.Duration, v map[int]internal.Vehicle, err error)) *VehicleObserved {
+	return &VehicleObserved{ld: ld, observe: observe}
+}
+
+// VehicleObserved is a struct that implements the LoaderVehicle interface
+// - it decorates a loader, reporting the duration, the vehicles and the error of every load to observe
+type VehicleObserved struct {
+	// ld is the loader decorated
+	ld internal.VehicleLoader
+	// observe records the loads
+	observe func(d time.Duration, v map[int]internal.Vehicle, err error)
+}
+
+// Load is a method that loads the vehicles with the decorated loader
+func (l *VehicleObserved) Load() (v map[int]internal.Vehicle, err error) {
+	start := time.Now()
+	v, err = l.ld.Load()
+	l.observe(time.Since(start), v, err)
+	return
+}
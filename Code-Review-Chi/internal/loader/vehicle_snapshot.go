@@ -0,0 +1,295 @@
+package loader
+
+import (
+	"app/internal"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+const (
+	// SnapshotVersion is the version of the binary snapshot format written by this package
+	// - version 2 added the version of the vehicles to the records, snapshots of version 1 are rejected
+	SnapshotVersion uint16 = 2
+	// snapshotHeaderSize is the size of the header: magic, version, source size, source modification time and count
+	snapshotHeaderSize = 4 + 2 + 8 + 8 + 8
+	// snapshotTrailerSize is the size of the trailer: the CRC32 of the header and the records
+	snapshotTrailerSize = 4
+)
+
+// snapshotMagic are the first bytes of a binary snapshot
+var snapshotMagic = [4]byte{'V', 'S', 'N', 'P'}
+
+var (
+	// ErrSnapshotCorrupt is returned when a snapshot is truncated or its checksum does not match
+	ErrSnapshotCorrupt = errors.New("loader: snapshot is corrupt")
+	// ErrSnapshotVersion is returned when a snapshot was written with an unsupported version of the format
+	ErrSnapshotVersion = errors.New("loader: unsupported snapshot version")
+)
+
+// SnapshotSource is a struct that identifies the JSON dataset a snapshot was built from
+// - a snapshot is stale when the size or the modification time of its source changed
+type SnapshotSource struct {
+	// Size is the size of the source in bytes
+	Size int64
+	// ModTime is the modification time of the source in unix nanoseconds
+	ModTime int64
+}
+
+// StatSnapshotSource is a function that returns the identity of the dataset at path
+func StatSnapshotSource(path string) (src SnapshotSource, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	src = SnapshotSource{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+	return
+}
+
+// IsSnapshot is a function that reports whether data starts like a binary snapshot
+func IsSnapshot(data []byte) bool {
+	return bytes.HasPrefix(data, snapshotMagic[:])
+}
+
+// NewVehicleSnapshotFile is a function that returns a new instance of VehicleSnapshotFile
+// - path is the binary snapshot, sourcePath is the JSON dataset it caches
+func NewVehicleSnapshotFile(path, sourcePath string) *VehicleSnapshotFile {
+	return &VehicleSnapshotFile{
+		path:   path,
+		source: NewVehicleJSONFile(sourcePath),
+	}
+}
+
+// VehicleSnapshotFile is a struct that implements the LoaderVehicle interface
+// - the vehicles are read from a binary snapshot, which is much faster to decode than JSON
+// - when the snapshot is missing, stale or corrupt the JSON source is loaded and the snapshot is rewritten
+type VehicleSnapshotFile struct {
+	// path is the path to the binary snapshot
+	path string
+	// source is the JSON dataset of the snapshot
+	source *VehicleJSONFile
+}
+
+// Load is a method that loads the vehicles
+// - a failure to rewrite the snapshot does not fail the load, the next start falls back to JSON again
+func (l *VehicleSnapshotFile) Load() (v map[int]internal.Vehicle, err error) {
+	// identity of the source, unknown if it does not exist (the snapshot is used as is)
+	src, srcErr := StatSnapshotSource(l.source.path)
+	if srcErr != nil && !errors.Is(srcErr, os.ErrNotExist) {
+		err = srcErr
+		return
+	}
+
+	// snapshot
+	if data, readErr := os.ReadFile(l.path); readErr == nil {
+		snapshot, snapshotSrc, decodeErr := DecodeVehiclesSnapshot(data)
+		if decodeErr == nil && (srcErr != nil || snapshotSrc == src) {
+			v = snapshot
+			return
+		}
+	}
+
+	// fallback to the source
+	v, err = l.source.Load()
+	if err != nil {
+		return
+	}
+	_ = l.Dump(v, src)
+	return
+}
+
+// Dump is a method that writes the vehicles to the snapshot, recording the identity of its source
+// - the file is replaced atomically, readers never see a partially written file
+func (l *VehicleSnapshotFile) Dump(v map[int]internal.Vehicle, src SnapshotSource) (err error) {
+	err = writeFileAtomic(l.path, func(w io.Writer) error {
+		return EncodeVehiclesSnapshot(w, src, v)
+	})
+	return
+}
+
+// EncodeVehiclesSnapshot is a function that encodes the vehicles into w in the binary snapshot format
+// - header: magic "VSNP", version (uint16), source size (int64), source modification time (int64), count (uint64)
+// - records: id and version (varint), strings (uvarint length and bytes), integers (varint) and floats (float64 bits), ordered by id
+// - trailer: CRC32 (IEEE) of the header and the records
+// - all fixed-size integers are little endian
+func EncodeVehiclesSnapshot(w io.Writer, src SnapshotSource, v map[int]internal.Vehicle) (err error) {
+	// checksum everything written before the trailer
+	crc := crc32.NewIEEE()
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+
+	// header
+	header := make([]byte, 0, snapshotHeaderSize)
+	header = append(header, snapshotMagic[:]...)
+	header = binary.LittleEndian.AppendUint16(header, SnapshotVersion)
+	header = binary.LittleEndian.AppendUint64(header, uint64(src.Size))
+	header = binary.LittleEndian.AppendUint64(header, uint64(src.ModTime))
+	header = binary.LittleEndian.AppendUint64(header, uint64(len(v)))
+	if _, err = bw.Write(header); err != nil {
+		return
+	}
+
+	// records
+	ids := make([]int, 0, len(v))
+	for id := range v {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	record := make([]byte, 0, 256)
+	for _, id := range ids {
+		record = appendSnapshotVehicle(record[:0], v[id])
+		if _, err = bw.Write(record); err != nil {
+			return
+		}
+	}
+	if err = bw.Flush(); err != nil {
+		return
+	}
+
+	// trailer
+	_, err = w.Write(binary.LittleEndian.AppendUint32(nil, crc.Sum32()))
+	return
+}
+
+// DecodeVehiclesSnapshot is a function that decodes the vehicles of a binary snapshot
+// - the checksum is verified before any record is decoded
+func DecodeVehiclesSnapshot(data []byte) (v map[int]internal.Vehicle, src SnapshotSource, err error) {
+	// header and trailer
+	if len(data) < snapshotHeaderSize+snapshotTrailerSize || !IsSnapshot(data) {
+		err = fmt.Errorf("%w: missing header", ErrSnapshotCorrupt)
+		return
+	}
+	if version := binary.LittleEndian.Uint16(data[4:]); version != SnapshotVersion {
+		err = fmt.Errorf("%w: %d", ErrSnapshotVersion, version)
+		return
+	}
+	body, trailer := data[:len(data)-snapshotTrailerSize], data[len(data)-snapshotTrailerSize:]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(trailer) {
+		err = fmt.Errorf("%w: checksum mismatch", ErrSnapshotCorrupt)
+		return
+	}
+	src.Size = int64(binary.LittleEndian.Uint64(data[6:]))
+	src.ModTime = int64(binary.LittleEndian.Uint64(data[14:]))
+	count := binary.LittleEndian.Uint64(data[22:])
+
+	// records, every record takes at least one byte per field
+	rd := &snapshotReader{data: body[snapshotHeaderSize:]}
+	if count > uint64(len(rd.data)) {
+		err = fmt.Errorf("%w: invalid count %d", ErrSnapshotCorrupt, count)
+		return
+	}
+	v = make(map[int]internal.Vehicle, count)
+	for i := uint64(0); i < count; i++ {
+		vh := rd.vehicle()
+		if rd.err != nil {
+			err = fmt.Errorf("%w: record %d: %w", ErrSnapshotCorrupt, i, rd.err)
+			v = nil
+			return
+		}
+		v[vh.Id] = vh
+	}
+	if len(rd.data) != 0 {
+		err = fmt.Errorf("%w: %d trailing bytes", ErrSnapshotCorrupt, len(rd.data))
+		v = nil
+	}
+	return
+}
+
+// appendSnapshotVehicle is a function that appends the record of a vehicle to b
+func appendSnapshotVehicle(b []byte, v internal.Vehicle) []byte {
+	b = binary.AppendVarint(b, int64(v.Id))
+	b = binary.AppendVarint(b, int64(v.Version))
+	for _, s := range []string{v.Brand, v.Model, v.Registration, v.Color} {
+		b = binary.AppendUvarint(b, uint64(len(s)))
+		b = append(b, s...)
+	}
+	b = binary.AppendVarint(b, int64(v.FabricationYear))
+	b = binary.AppendVarint(b, int64(v.Capacity))
+	b = binary.LittleEndian.AppendUint64(b, math.Float64bits(v.MaxSpeed))
+	for _, s := range []string{v.FuelType, v.Transmission} {
+		b = binary.AppendUvarint(b, uint64(len(s)))
+		b = append(b, s...)
+	}
+	for _, f := range []float64{v.Weight, v.Height, v.Length, v.Width} {
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(f))
+	}
+	return b
+}
+
+// snapshotReader is a struct that decodes the fields of the records of a snapshot
+// - the first error is kept and every later read returns zero values
+type snapshotReader struct {
+	// data are the bytes left to decode
+	data []byte
+	// err is the first error
+	err error
+}
+
+// vehicle is a method that decodes a record
+func (r *snapshotReader) vehicle() (v internal.Vehicle) {
+	v.Id = int(r.varint())
+	v.Version = int(r.varint())
+	v.Brand = r.string()
+	v.Model = r.string()
+	v.Registration = r.string()
+	v.Color = r.string()
+	v.FabricationYear = int(r.varint())
+	v.Capacity = int(r.varint())
+	v.MaxSpeed = r.float()
+	v.FuelType = r.string()
+	v.Transmission = r.string()
+	v.Weight = r.float()
+	v.Height = r.float()
+	v.Length = r.float()
+	v.Width = r.float()
+	return
+}
+
+// varint is a method that decodes a signed varint
+func (r *snapshotReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	x, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.err = errors.New("invalid varint")
+		return 0
+	}
+	r.data = r.data[n:]
+	return x
+}
+
+// string is a method that decodes a length-prefixed string
+func (r *snapshotReader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	size, n := binary.Uvarint(r.data)
+	if n <= 0 || size > uint64(len(r.data)-n) {
+		r.err = errors.New("invalid string")
+		return ""
+	}
+	s := string(r.data[n : n+int(size)])
+	r.data = r.data[n+int(size):]
+	return s
+}
+
+// float is a method that decodes a float64
+func (r *snapshotReader) float() float64 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data) < 8 {
+		r.err = errors.New("invalid float")
+		return 0
+	}
+	f := math.Float64frombits(binary.LittleEndian.Uint64(r.data))
+	r.data = r.data[8:]
+	return f
+}
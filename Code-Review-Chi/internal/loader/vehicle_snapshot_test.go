@@ -0,0 +1,224 @@
+package loader_test
+
+import (
+	"app/internal"
+	"app/internal/loader"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// snapshotVehicles are the vehicles of the snapshot tests
+var snapshotVehicles = map[int]internal.Vehicle{
+	1: {Id: 1, Version: 3, VehicleAttributes: internal.VehicleAttributes{
+		Brand: "Ford", Model: "Fiesta", Registration: "1234ABC", Color: "Red", FabricationYear: 2010, Capacity: 5,
+		MaxSpeed: 180.5, FuelType: "gas", Transmission: "manual", Weight: 1100.25,
+		Dimensions: internal.Dimensions{Height: 1.48, Length: 3.95, Width: 1.72},
+	}},
+	-2: {Id: -2, Version: 1, VehicleAttributes: internal.VehicleAttributes{Brand: "Señor", Model: ""}},
+}
+
+// encodedSnapshot is a function that returns the vehicles encoded in the binary snapshot format
+func encodedSnapshot(t *testing.T, src loader.SnapshotSource, v map[int]internal.Vehicle) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, loader.EncodeVehiclesSnapshot(&buf, src, v))
+	return buf.Bytes()
+}
+
+// Tests for EncodeVehiclesSnapshot and DecodeVehiclesSnapshot
+func TestVehiclesSnapshot_RoundTrip(t *testing.T) {
+	src := loader.SnapshotSource{Size: 4096, ModTime: 1760868000000000000}
+
+	t.Run("case 1: should decode the vehicles and the source that were encoded", func(t *testing.T) {
+		// arrange
+		data := encodedSnapshot(t, src, snapshotVehicles)
+
+		// act
+		v, decodedSrc, err := loader.DecodeVehiclesSnapshot(data)
+
+		// assert
+		require.NoError(t, err)
+		require.True(t, loader.IsSnapshot(data))
+		require.Equal(t, snapshotVehicles, v)
+		require.Equal(t, src, decodedSrc)
+	})
+
+	t.Run("case 2: should decode an empty snapshot", func(t *testing.T) {
+		// arrange
+		data := encodedSnapshot(t, src, map[int]internal.Vehicle{})
+
+		// act
+		v, _, err := loader.DecodeVehiclesSnapshot(data)
+
+		// assert
+		require.NoError(t, err)
+		require.Empty(t, v)
+	})
+
+	t.Run("case 3: should fail if the checksum does not match", func(t *testing.T) {
+		// arrange
+		data := encodedSnapshot(t, src, snapshotVehicles)
+		data[len(data)/2] ^= 0xff
+
+		// act
+		v, _, err := loader.DecodeVehiclesSnapshot(data)
+
+		// assert
+		require.ErrorIs(t, err, loader.ErrSnapshotCorrupt)
+		require.Nil(t, v)
+	})
+
+	t.Run("case 4: should fail if the snapshot is truncated", func(t *testing.T) {
+		// arrange
+		data := encodedSnapshot(t, src, snapshotVehicles)
+
+		// act
+		_, _, err := loader.DecodeVehiclesSnapshot(data[:10])
+
+		// assert
+		require.ErrorIs(t, err, loader.ErrSnapshotCorrupt)
+	})
+
+	t.Run("case 5: should fail if the snapshot has another version", func(t *testing.T) {
+		// arrange
+		data := encodedSnapshot(t, src, snapshotVehicles)
+		data[4]++
+
+		// act
+		_, _, err := loader.DecodeVehiclesSnapshot(data)
+
+		// assert
+		require.ErrorIs(t, err, loader.ErrSnapshotVersion)
+	})
+}
+
+// Tests for VehicleSnapshotFile.Load
+func TestVehicleSnapshotFile_Load(t *testing.T) {
+	// files is a function that returns the paths of a snapshot and its JSON source with vehicles
+	files := func(t *testing.T) (path, sourcePath string, src loader.SnapshotSource) {
+		dir := t.TempDir()
+		path, sourcePath = filepath.Join(dir, "vehicles.snap"), filepath.Join(dir, "vehicles.json")
+		require.NoError(t, loader.NewVehicleJSONFile(sourcePath).Dump(snapshotVehicles))
+		src, err := loader.StatSnapshotSource(sourcePath)
+		require.NoError(t, err)
+		return
+	}
+	// readSnapshot is a function that decodes the snapshot at path
+	readSnapshot := func(t *testing.T, path string) (v map[int]internal.Vehicle, src loader.SnapshotSource) {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		v, src, err = loader.DecodeVehiclesSnapshot(data)
+		require.NoError(t, err)
+		return
+	}
+	other := map[int]internal.Vehicle{7: {Id: 7, VehicleAttributes: internal.VehicleAttributes{Brand: "Fiat"}}}
+
+	t.Run("case 1: should load the source and write the snapshot if it is missing", func(t *testing.T) {
+		// arrange
+		path, sourcePath, src := files(t)
+
+		// act
+		v, err := loader.NewVehicleSnapshotFile(path, sourcePath).Load()
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, snapshotVehicles, v)
+		snapshot, snapshotSrc := readSnapshot(t, path)
+		require.Equal(t, snapshotVehicles, snapshot)
+		require.Equal(t, src, snapshotSrc)
+	})
+
+	t.Run("case 2: should load the snapshot if its source did not change", func(t *testing.T) {
+		// arrange
+		path, sourcePath, src := files(t)
+		require.NoError(t, os.WriteFile(path, encodedSnapshot(t, src, other), 0o644))
+
+		// act
+		v, err := loader.NewVehicleSnapshotFile(path, sourcePath).Load()
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, other, v)
+	})
+
+	t.Run("case 3: should fall back to the source and rewrite the snapshot if the checksum does not match", func(t *testing.T) {
+		// arrange
+		path, sourcePath, src := files(t)
+		data := encodedSnapshot(t, src, other)
+		data[len(data)-1] ^= 0xff
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+
+		// act
+		v, err := loader.NewVehicleSnapshotFile(path, sourcePath).Load()
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, snapshotVehicles, v)
+		snapshot, snapshotSrc := readSnapshot(t, path)
+		require.Equal(t, snapshotVehicles, snapshot)
+		require.Equal(t, src, snapshotSrc)
+	})
+
+	t.Run("case 4: should fall back to the source and rewrite the snapshot if it is stale", func(t *testing.T) {
+		// arrange
+		path, sourcePath, src := files(t)
+		stale := loader.SnapshotSource{Size: src.Size + 1, ModTime: src.ModTime}
+		require.NoError(t, os.WriteFile(path, encodedSnapshot(t, stale, other), 0o644))
+
+		// act
+		v, err := loader.NewVehicleSnapshotFile(path, sourcePath).Load()
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, snapshotVehicles, v)
+		snapshot, snapshotSrc := readSnapshot(t, path)
+		require.Equal(t, snapshotVehicles, snapshot)
+		require.Equal(t, src, snapshotSrc)
+	})
+
+	t.Run("case 5: should load the snapshot as is if the source does not exist", func(t *testing.T) {
+		// arrange
+		path, sourcePath, src := files(t)
+		require.NoError(t, os.WriteFile(path, encodedSnapshot(t, src, other), 0o644))
+		require.NoError(t, os.Remove(sourcePath))
+
+		// act
+		v, err := loader.NewVehicleSnapshotFile(path, sourcePath).Load()
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, other, v)
+	})
+
+	t.Run("case 6: should fall back to the source and rewrite the snapshot if it has a previous version", func(t *testing.T) {
+		// arrange
+		path, sourcePath, src := files(t)
+		// - a snapshot of version 1, whose records do not keep the version
+		data := encodedSnapshot(t, src, other)
+		data[4], data[5] = 1, 0
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+
+		// act
+		v, err := loader.NewVehicleSnapshotFile(path, sourcePath).Load()
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, snapshotVehicles, v)
+		snapshot, _ := readSnapshot(t, path)
+		require.Equal(t, snapshotVehicles, snapshot)
+	})
+
+	t.Run("case 7: should fail if neither the snapshot nor the source exist", func(t *testing.T) {
+		// arrange
+		dir := t.TempDir()
+
+		// act
+		_, err := loader.NewVehicleSnapshotFile(filepath.Join(dir, "vehicles.snap"), filepath.Join(dir, "vehicles.json")).Load()
+
+		// assert
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
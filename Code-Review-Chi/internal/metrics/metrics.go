@@ -0,0 +1,333 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the default upper bounds of the buckets of a histogram, in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// collector is an interface that represents a metric family that can be written in the text exposition format
+type collector interface {
+	// write is a method that writes the samples of the family to w
+	write(w io.Writer) (err error)
+}
+
+// NewRegistry is a function that returns a new instance of Registry
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]collector)}
+}
+
+// Registry is a struct that holds the metric families exposed by a service
+// - it is safe for concurrent use, the families are written sorted by name
+type Registry struct {
+	// mu guards families
+	mu sync.RWMutex
+	// families are the metric families by name
+	families map[string]collector
+}
+
+// register is a method that adds a family to the registry
+// - it panics if the name is already registered, like a duplicate route would
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, dup := r.families[name]; dup {
+		panic("metrics: family registered twice: " + name)
+	}
+	r.families[name] = c
+}
+
+// Counter is a method that registers a counter family with the given label names
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec: newVec[float64](name, help, "counter", labels)}
+	r.register(name, c)
+	return c
+}
+
+// Gauge is a method that registers a gauge family with the given label names
+func (r *Registry) Gauge(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{vec: newVec[float64](name, help, "gauge", labels)}
+	r.register(name, g)
+	return g
+}
+
+// GaugeFunc is a method that registers a gauge without labels whose value is computed by f on every scrape
+func (r *Registry) GaugeFunc(name, help string, f func() float64) {
+	r.register(name, &gaugeFunc{name: name, help: help, f: f})
+}
+
+// Histogram is a method that registers a histogram family with the given bucket upper bounds and label names
+// - buckets are sorted, the +Inf bucket is implicit
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = slices.Clone(buckets)
+	sort.Float64s(buckets)
+	h := &HistogramVec{vec: newVec[*histogram](name, help, "histogram", labels), buckets: buckets}
+	r.register(name, h)
+	return h
+}
+
+// WriteText is a method that writes every family in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) (err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		if err = r.families[name].write(bw); err != nil {
+			return
+		}
+	}
+	err = bw.Flush()
+	return
+}
+
+// ServeHTTP is a method that serves the families in the Prometheus text exposition format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(http.StatusOK)
+	// - the status is already sent, an error here can only abort the response
+	_ = r.WriteText(w)
+}
+
+// vec is a struct that holds the series of a family by their label values
+type vec[T any] struct {
+	// name, help and kind are the name, the description and the type of the family
+	name, help, kind string
+	// labels are the names of the labels
+	labels []string
+	// mu guards series
+	mu sync.Mutex
+	// series are the values of the family by their label values, joined by labelSeparator
+	series map[string]T
+}
+
+// labelSeparator joins the label values of a series, it can not be part of valid UTF-8 text
+const labelSeparator = "\xff"
+
+// newVec is a function that returns a new instance of vec
+func newVec[T any](name, help, kind string, labels []string) vec[T] {
+	return vec[T]{name: name, help: help, kind: kind, labels: labels, series: make(map[string]T)}
+}
+
+// key is a method that returns the key of the series of the label values
+// - it panics if the number of values does not match the number of labels
+func (v *vec[T]) key(values []string) string {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	return strings.Join(values, labelSeparator)
+}
+
+// sorted is a method that returns the keys of the series, sorted, with mu held
+func (v *vec[T]) sorted() (keys []string) {
+	keys = make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// header is a method that writes the HELP and TYPE lines of the family
+func (v *vec[T]) header(w io.Writer) (err error) {
+	_, err = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, escapeHelp(v.help), v.name, v.kind)
+	return
+}
+
+// labelPairs is a method that returns the labels of the series of key, followed by extra pairs, in the text format
+func (v *vec[T]) labelPairs(key string, extra ...string) string {
+	var values []string
+	if len(v.labels) > 0 {
+		values = strings.Split(key, labelSeparator)
+	}
+	pairs := make([]string, 0, len(values)+len(extra)/2)
+	for i, value := range values {
+		pairs = append(pairs, v.labels[i]+`="`+escapeLabel(value)+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escapeLabel(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// writeScalars is a method that writes the series of a counter or a gauge
+func (v *vec[T]) writeScalars(w io.Writer, value func(T) float64) (err error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err = v.header(w); err != nil {
+		return
+	}
+	for _, key := range v.sorted() {
+		if _, err = fmt.Fprintf(w, "%s%s %s\n", v.name, v.labelPairs(key), formatFloat(value(v.series[key]))); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// CounterVec is a struct that represents a family of counters
+type CounterVec struct {
+	vec[float64]
+}
+
+// Inc is a method that adds one to the counter of the label values
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add is a method that adds delta to the counter of the label values
+// - it panics if delta is negative, counters only go up
+func (c *CounterVec) Add(delta float64, values ...string) {
+	if delta < 0 {
+		panic("metrics: counter " + c.name + " can not decrease")
+	}
+	key := c.key(values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.series[key] += delta
+}
+
+// write is a method that writes the counters
+func (c *CounterVec) write(w io.Writer) error {
+	return c.writeScalars(w, func(value float64) float64 { return value })
+}
+
+// GaugeVec is a struct that represents a family of gauges
+type GaugeVec struct {
+	vec[float64]
+}
+
+// Set is a method that sets the gauge of the label values
+func (g *GaugeVec) Set(value float64, values ...string) {
+	key := g.key(values)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.series[key] = value
+}
+
+// write is a method that writes the gauges
+func (g *GaugeVec) write(w io.Writer) error {
+	return g.writeScalars(w, func(value float64) float64 { return value })
+}
+
+// gaugeFunc is a struct that represents a gauge computed on every scrape
+type gaugeFunc struct {
+	// name and help are the name and the description of the gauge
+	name, help string
+	// f computes the value of the gauge
+	f func() float64
+}
+
+// write is a method that writes the gauge
+func (g *gaugeFunc) write(w io.Writer) (err error) {
+	_, err = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.name, escapeHelp(g.help), g.name, g.name, formatFloat(g.f()))
+	return
+}
+
+// histogram is a struct that represents the samples of a series of a histogram
+type histogram struct {
+	// counts are the number of samples of each bucket, not cumulative, the last one is the +Inf bucket
+	counts []uint64
+	// sum is the sum of the samples
+	sum float64
+}
+
+// HistogramVec is a struct that represents a family of histograms
+type HistogramVec struct {
+	vec[*histogram]
+	// buckets are the upper bounds of the buckets, sorted
+	buckets []float64
+}
+
+// Observe is a method that records a sample in the histogram of the label values
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	key := h.key(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets)+1)}
+		h.series[key] = s
+	}
+	i, _ := slices.BinarySearch(h.buckets, value)
+	s.counts[i]++
+	s.sum += value
+}
+
+// write is a method that writes the histograms, with cumulative buckets
+func (h *HistogramVec) write(w io.Writer) (err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err = h.header(w); err != nil {
+		return
+	}
+	for _, key := range h.sorted() {
+		s := h.series[key]
+		var cumulative uint64
+		for i, count := range s.counts {
+			cumulative += count
+			le := math.Inf(1)
+			if i < len(h.buckets) {
+				le = h.buckets[i]
+			}
+			if _, err = fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(key, "le", formatFloat(le)), cumulative); err != nil {
+				return
+			}
+		}
+		labels := h.labelPairs(key)
+		if _, err = fmt.Fprintf(w, "%s_sum%s %s\n%s_count%s %d\n", h.name, labels, formatFloat(s.sum), h.name, labels, cumulative); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// formatFloat is a function that formats a sample value in the text format
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// labelEscaper escapes the label values in the text format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel is a function that escapes a label value
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// helpEscaper escapes the help texts in the text format
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// escapeHelp is a function that escapes a help text
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
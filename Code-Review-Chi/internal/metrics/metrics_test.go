@@ -0,0 +1,84 @@
+package metrics_test
+
+import (
+	"app/internal/metrics"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Tests for Registry
+func TestRegistry_WriteText(t *testing.T) {
+	t.Run("case 1: should write every family sorted by name in the text exposition format", func(t *testing.T) {
+		// arrange
+		reg := metrics.NewRegistry()
+		requests := reg.Counter("requests_total", "Number of requests.", "route", "status")
+		durations := reg.Histogram("request_duration_seconds", "Latency of the requests.", []float64{0.5, 0.1}, "route")
+		size := reg.Gauge("dataset_size", "Size of the dataset.")
+		reg.GaugeFunc("answer", "The answer.", func() float64 { return 42 })
+
+		requests.Inc("/vehicles/{id}", "2xx")
+		requests.Add(2, "/vehicles/{id}", "2xx")
+		requests.Inc(`/a"b\c`, "4xx")
+		durations.Observe(0.05, "/vehicles")
+		durations.Observe(0.1, "/vehicles")
+		durations.Observe(3, "/vehicles")
+		size.Set(100)
+
+		// act
+		var buf bytes.Buffer
+		err := reg.WriteText(&buf)
+
+		// assert
+		require.NoError(t, err)
+		expected := `# HELP answer The answer.
+# TYPE answer gauge
+answer 42
+# HELP dataset_size Size of the dataset.
+# TYPE dataset_size gauge
+dataset_size 100
+# HELP request_duration_seconds Latency of the requests.
+# TYPE request_duration_seconds histogram
+request_duration_seconds_bucket{route="/vehicles",le="0.1"} 2
+request_duration_seconds_bucket{route="/vehicles",le="0.5"} 2
+request_duration_seconds_bucket{route="/vehicles",le="+Inf"} 3
+request_duration_seconds_sum{route="/vehicles"} 3.15
+request_duration_seconds_count{route="/vehicles"} 3
+# HELP requests_total Number of requests.
+# TYPE requests_total counter
+requests_total{route="/a\"b\\c",status="4xx"} 1
+requests_total{route="/vehicles/{id}",status="2xx"} 3
+`
+		require.Equal(t, expected, buf.String())
+	})
+
+	t.Run("case 2: should serve the families with the content type of the text format", func(t *testing.T) {
+		// arrange
+		reg := metrics.NewRegistry()
+		reg.Counter("requests_total", "Number of requests.").Inc()
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		res := httptest.NewRecorder()
+
+		// act
+		reg.ServeHTTP(res, req)
+
+		// assert
+		require.Equal(t, http.StatusOK, res.Code)
+		require.Equal(t, metrics.ContentType, res.Header().Get("Content-Type"))
+		require.Contains(t, res.Body.String(), "requests_total 1\n")
+	})
+
+	t.Run("case 3: should panic on families registered twice and on wrong label values", func(t *testing.T) {
+		// arrange
+		reg := metrics.NewRegistry()
+		requests := reg.Counter("requests_total", "Number of requests.", "route")
+
+		// act & assert
+		require.Panics(t, func() { reg.Gauge("requests_total", "Number of requests.") })
+		require.Panics(t, func() { requests.Inc() })
+		require.Panics(t, func() { requests.Add(-1, "/vehicles") })
+	})
+}
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"app/internal"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+var (
+	// ErrDriverNotFound is returned when a DSN names a driver that is not registered
+	ErrDriverNotFound = errors.New("repository: driver not found")
+	// ErrInvalidDSN is returned when a DSN can not be parsed or has invalid options
+	ErrInvalidDSN = errors.New("repository: invalid dsn")
+)
+
+// Driver is an interface that represents a repository backend
+type Driver interface {
+	// Open is a method that opens a repository from a DSN
+	// - the scheme of the DSN is the name of the driver, the rest (path and query) are the options of the driver
+	// - seed loads the initial vehicles, backends that start empty may use it to populate themselves
+	Open(dsn *url.URL, seed internal.VehicleLoader) (rp internal.VehicleRepository, err error)
+}
+
+// DriverFunc is a function that implements the Driver interface
+type DriverFunc func(dsn *url.URL, seed internal.VehicleLoader) (rp internal.VehicleRepository, err error)
+
+// Open is a method that calls the function
+func (f DriverFunc) Open(dsn *url.URL, seed internal.VehicleLoader) (rp internal.VehicleRepository, err error) {
+	return f(dsn, seed)
+}
+
+var (
+	// driversMu guards drivers
+	driversMu sync.RWMutex
+	// drivers are the registered drivers by name
+	drivers = make(map[string]Driver)
+)
+
+// Register is a function that makes a driver available by name
+// - it panics if the driver is nil or the name is already registered
+func Register(name string, d Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if d == nil {
+		panic("repository: Register driver is nil")
+	}
+	if _, dup := drivers[name]; dup {
+		panic("repository: Register called twice for driver " + name)
+	}
+	drivers[name] = d
+}
+
+// Drivers is a function that returns the names of the registered drivers, sorted
+func Drivers() (names []string) {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// Open is a function that opens a repository with the driver named by the scheme of the DSN
+// - e.g. memory://, jsonfile:///path/to/vehicles.json, sqlite:///path/to/vehicles.db
+func Open(dsn string, seed internal.VehicleLoader) (rp internal.VehicleRepository, err error) {
+	u, err := url.Parse(dsn)
+	if err != nil || u.Scheme == "" {
+		err = fmt.Errorf("%w: %q", ErrInvalidDSN, dsn)
+		return
+	}
+
+	driversMu.RLock()
+	d, ok := drivers[u.Scheme]
+	driversMu.RUnlock()
+	if !ok {
+		err = fmt.Errorf("%w: %q (registered: %v)", ErrDriverNotFound, u.Scheme, Drivers())
+		return
+	}
+
+	rp, err = d.Open(u, seed)
+	return
+}
+
+// dsnPath is a function that returns the path of a DSN
+// - sqlite:///abs/path.db and sqlite://relative/path.db are both supported
+func dsnPath(dsn *url.URL) (path string, err error) {
+	switch {
+	case dsn.Opaque != "":
+		path = dsn.Opaque
+	default:
+		path = dsn.Host + dsn.Path
+	}
+	if path == "" {
+		err = fmt.Errorf("%w: %s requires a path", ErrInvalidDSN, dsn.Scheme)
+	}
+	return
+}
+
+// dsnBoolOption is a function that returns the boolean option name of a DSN, def if it is not set
+func dsnBoolOption(dsn *url.URL, name string, def bool) (value bool, err error) {
+	value = def
+	if raw := dsn.Query().Get(name); raw != "" {
+		if value, err = strconv.ParseBool(raw); err != nil {
+			err = fmt.Errorf("%w: %s must be a boolean", ErrInvalidDSN, name)
+		}
+	}
+	return
+}
+
+// dsnPositiveIntOption is a function that returns the positive integer option name of a DSN, def if it is not set
+func dsnPositiveIntOption(dsn *url.URL, name string, def int) (value int, err error) {
+	value = def
+	if raw := dsn.Query().Get(name); raw != "" {
+		if value, err = strconv.Atoi(raw); err != nil || value <= 0 {
+			err = fmt.Errorf("%w: %s must be a positive integer", ErrInvalidDSN, name)
+		}
+	}
+	return
+}
+
+// loadSeed is a function that loads the vehicles of the seed, nil seeds load no vehicles
+func loadSeed(seed internal.VehicleLoader) (v map[int]internal.Vehicle, err error) {
+	if seed == nil {
+		return
+	}
+	v, err = seed.Load()
+	return
+}
@@ -0,0 +1,45 @@
+package repository_test
+
+import (
+	"app/internal/repository"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Tests for Open
+func TestOpen(t *testing.T) {
+	cases := []struct {
+		name string
+		dsn  func(dir string) string
+		err  error
+	}{
+		{name: "case 1: should fail without a scheme", dsn: func(dir string) string { return dir }, err: repository.ErrInvalidDSN},
+		{name: "case 2: should fail with an unknown driver", dsn: func(dir string) string { return "mongo://" + dir }, err: repository.ErrDriverNotFound},
+		{name: "case 3: should fail without a path", dsn: func(dir string) string { return "sqlite://" }, err: repository.ErrInvalidDSN},
+		{name: "case 4: should fail with a seed option that is not a boolean", dsn: func(dir string) string { return "sqlite://" + dir + "/vehicles.db?seed=no-thanks" }, err: repository.ErrInvalidDSN},
+		{name: "case 5: should fail with a columnar option that is not a boolean", dsn: func(dir string) string { return "memory://?columnar=maybe" }, err: repository.ErrInvalidDSN},
+		{name: "case 6: should fail with an integer option that is not positive", dsn: func(dir string) string { return "wal://" + dir + "/wal?snapshot_every=0" }, err: repository.ErrInvalidDSN},
+		{name: "case 7: should fail with an integer option that is not an integer", dsn: func(dir string) string { return "wal://" + dir + "/wal?snapshot_every=often" }, err: repository.ErrInvalidDSN},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// act
+			rp, err := repository.Open(c.dsn(t.TempDir()), nil)
+
+			// assert
+			require.ErrorIs(t, err, c.err)
+			require.Nil(t, rp)
+		})
+	}
+
+	t.Run("case 8: should open with valid options", func(t *testing.T) {
+		// act
+		rp, err := repository.Open("wal://"+t.TempDir()+"/wal?snapshot_every=10", nil)
+
+		// assert
+		require.NoError(t, err)
+		require.NoError(t, rp.(io.Closer).Close())
+	})
+}
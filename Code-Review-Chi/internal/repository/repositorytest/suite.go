@@ -0,0 +1,1264 @@
+// Package repositorytest is a contract test suite for the implementations of internal.VehicleRepository.
+package repositorytest
+
+import (
+	"app/internal"
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Factory is a function that returns a new repository that contains exactly the vehicles of db
+// - the repository must be independent of the ones returned by previous calls
+type Factory func(t *testing.T, db map[int]internal.Vehicle) internal.VehicleRepository
+
+// NewVehicle is a function that returns a vehicle of the fixture, at its first version
+func NewVehicle(id int, brand, color string, year, capacity int, maxSpeed float64, fuelType, transmission string, weight, height, width float64) internal.Vehicle {
+	return internal.Vehicle{
+		Id:      id,
+		Version: 1,
+		VehicleAttributes: internal.VehicleAttributes{
+			Brand:           brand,
+			Model:           "Model " + brand,
+			Registration:    "REG-" + brand,
+			Color:           color,
+			FabricationYear: year,
+			Capacity:        capacity,
+			MaxSpeed:        maxSpeed,
+			FuelType:        fuelType,
+			Transmission:    transmission,
+			Weight:          weight,
+			Dimensions: internal.Dimensions{
+				Height: height,
+				Length: 400,
+				Width:  width,
+			},
+		},
+	}
+}
+
+// Fixture is a function that returns the vehicles the suite runs against
+func Fixture() map[int]internal.Vehicle {
+	return map[int]internal.Vehicle{
+		1: NewVehicle(1, "Ford", "Red", 2010, 5, 180, "gasoline", "manual", 1200, 150, 180),
+		2: NewVehicle(2, "Ford", "Blue", 2015, 7, 160, "diesel", "automatic", 1800, 170, 190),
+		3: NewVehicle(3, "Ford", "Red", 2020, 4, 200, "gasoline", "automatic", 1400, 140, 175),
+		4: NewVehicle(4, "Toyota", "Red", 2010, 5, 170, "hybrid", "automatic", 1300, 145, 178),
+		5: NewVehicle(5, "Toyota", "White", 2005, 2, 120, "diesel", "manual", 900, 120, 160),
+		6: NewVehicle(6, "Tesla", "Black", 2022, 5, 250, "electric", "automatic", 2000, 144, 196),
+	}
+}
+
+// subset is a function that returns the vehicles of the fixture with the given ids
+func subset(ids ...int) map[int]internal.Vehicle {
+	fixture := Fixture()
+	v := make(map[int]internal.Vehicle, len(ids))
+	for _, id := range ids {
+		v[id] = fixture[id]
+	}
+	return v
+}
+
+// Run is a function that runs the contract test suite against the repositories returned by factory
+func Run(t *testing.T, factory Factory) {
+	t.Run("FindAll", func(t *testing.T) { testFindAll(t, factory) })
+	t.Run("FindById", func(t *testing.T) { testFindById(t, factory) })
+	t.Run("FindByColorYear", func(t *testing.T) { testFindByColorYear(t, factory) })
+	t.Run("FindByBrandYearRange", func(t *testing.T) { testFindByBrandYearRange(t, factory) })
+	t.Run("FindByBrandAverageSpeed", func(t *testing.T) { testFindByBrandAverageSpeed(t, factory) })
+	t.Run("FindByFuelType", func(t *testing.T) { testFindByFuelType(t, factory) })
+	t.Run("FindByTransmissionType", func(t *testing.T) { testFindByTransmissionType(t, factory) })
+	t.Run("FindByBrandAverageCapacity", func(t *testing.T) { testFindByBrandAverageCapacity(t, factory) })
+	t.Run("FindByWeightRange", func(t *testing.T) { testFindByWeightRange(t, factory) })
+	t.Run("FindByDimensionRange", func(t *testing.T) { testFindByDimensionRange(t, factory) })
+	t.Run("Save", func(t *testing.T) { testSave(t, factory) })
+	t.Run("Create", func(t *testing.T) { testCreate(t, factory) })
+	t.Run("SaveBatch", func(t *testing.T) { testSaveBatch(t, factory) })
+	t.Run("Update", func(t *testing.T) { testUpdate(t, factory) })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, factory) })
+	t.Run("Replace", func(t *testing.T) { testReplace(t, factory) })
+	t.Run("History", func(t *testing.T) { testHistory(t, factory) })
+	t.Run("Concurrency", func(t *testing.T) { testConcurrency(t, factory) })
+	t.Run("Audited", func(t *testing.T) { testAudited(t, factory) })
+}
+
+func testFindAll(t *testing.T, factory Factory) {
+	t.Run("case 1: should return all the vehicles", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		v, err := rp.FindAll(context.Background())
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, Fixture(), v)
+	})
+
+	t.Run("case 2: should return an empty map if there are no vehicles", func(t *testing.T) {
+		// arrange
+		rp := factory(t, map[int]internal.Vehicle{})
+
+		// act
+		v, err := rp.FindAll(context.Background())
+
+		// assert
+		require.NoError(t, err)
+		require.NotNil(t, v)
+		require.Empty(t, v)
+	})
+
+	t.Run("case 3: should return a copy that does not alter the repository", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		v, err := rp.FindAll(context.Background())
+		require.NoError(t, err)
+		delete(v, 1)
+		v[2] = internal.Vehicle{Id: 2}
+		v, err = rp.FindAll(context.Background())
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, Fixture(), v)
+	})
+
+	t.Run("case 4: should fail with the error of a canceled context", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// act
+		_, errAll := rp.FindAll(ctx)
+		_, errWeight := rp.FindByWeightRange(ctx, 0, 5000)
+		_, errColorYear := rp.FindByColorYear(ctx, "Red", 2010)
+		_, errBrandYear := rp.FindByBrandYearRange(ctx, "Toyota", 2000, 2020)
+		_, errFuel := rp.FindByFuelType(ctx, "gasoline")
+		_, errTransmission := rp.FindByTransmissionType(ctx, "manual")
+
+		// assert
+		require.ErrorIs(t, errAll, context.Canceled)
+		require.ErrorIs(t, errWeight, context.Canceled)
+		require.ErrorIs(t, errColorYear, context.Canceled)
+		require.ErrorIs(t, errBrandYear, context.Canceled)
+		require.ErrorIs(t, errFuel, context.Canceled)
+		require.ErrorIs(t, errTransmission, context.Canceled)
+	})
+}
+
+func testFindById(t *testing.T, factory Factory) {
+	t.Run("case 1: should return the vehicle with the id", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		v, err := rp.FindById(context.Background(), 3)
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, Fixture()[3], v)
+	})
+
+	t.Run("case 2: should return ErrVehicleNotFound if the vehicle does not exist", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		_, err := rp.FindById(context.Background(), 99)
+
+		// assert
+		require.ErrorIs(t, err, internal.ErrVehicleNotFound)
+	})
+}
+
+func testFindByColorYear(t *testing.T, factory Factory) {
+	t.Run("case 1: should return the vehicles with the color and year", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		v, err := rp.FindByColorYear(context.Background(), "Red", 2010)
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, subset(1, 4), v)
+	})
+
+	t.Run("case 2: should match the color exactly (case sensitive)", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		v, err := rp.FindByColorYear(context.Background(), "red", 2010)
+
+		// assert
+		require.NoError(t, err)
+		require.Empty(t, v)
+	})
+
+	t.Run("case 3: should return an empty map if no vehicle matches", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		v, err := rp.FindByColorYear(context.Background(), "Red", 1999)
+
+		// assert
+		require.NoError(t, err)
+		require.NotNil(t, v)
+		require.Empty(t, v)
+	})
+
+	t.Run("case 4: should not match a year beyond 32 bits that wraps around to a year of the vehicles", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		v, err := rp.FindByColorYear(context.Background(), "Red", 1<<32+2010)
+
+		// assert
+		require.NoError(t, err)
+		require.Empty(t, v)
+	})
+}
+
+func testFindByBrandYearRange(t *testing.T, factory Factory) {
+	t.Run("case 1: should return the vehicles of the brand within the range, bounds included", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		v, err := rp.FindByBrandYearRange(context.Background(), "Ford", 2010, 2015)
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, subset(1, 2), v)
+	})
+
+	t.Run("case 2: should return the vehicles of a single year range", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		v, err := rp.FindByBrandYearRange(context.Background(), "Ford", 2020, 2020)
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, subset(3), v)
+	})
+
+	t.Run("case 3: should return an empty map if the start year is after the end year", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		v, err := rp.FindByBrandYearRange(context.Background(), "Ford", 2020, 2010)
+
+		// assert
+		require.NoError(t, err)
+		require.Empty(t, v)
+	})
+
+	t.Run("case 4: should return an empty map for an unknown brand", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		v, err := rp.FindByBrandYearRange(context.Background(), "Fiat", 1900, 2100)
+
+		// assert
+		require.NoError(t, err)
+		require.Empty(t, v)
+	})
+
+	t.Run("case 5: should support bounds beyond 32 bits up to the extremes of int", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		vWide, errWide := rp.FindByBrandYearRange(context.Background(), "Ford", 2000, 1<<32+1000)
+		vExtreme, errExtreme := rp.FindByBrandYearRange(context.Background(), "Ford", math.MinInt, math.MaxInt)
+		vWrapped, errWrapped := rp.FindByBrandYearRange(context.Background(), "Ford", -1<<32+2010, -1<<32+2015)
+
+		// assert
+		require.NoError(t, errWide)
+		require.Equal(t, subset(1, 2, 3), vWide)
+		require.NoError(t, errExtreme)
+		require.Equal(t, subset(1, 2, 3), vExtreme)
+		require.NoError(t, errWrapped)
+		require.Empty(t, vWrapped)
+	})
+}
+
+func testFindByBrandAverageSpeed(t *testing.T, factory Factory) {
+	t.Run("case 1: should return the average max speed of the brand", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		avg, err := rp.FindByBrandAverageSpeed(context.Background(), "Ford")
+
+		// assert
+		require.NoError(t, err)
+		require.InDelta(t, (180.0+160.0+200.0)/3, avg, 1e-9)
+	})
+
+	t.Run("case 2: should return 0 for an unknown brand", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		avg, err := rp.FindByBrandAverageSpeed(context.Background(), "Fiat")
+
+		// assert
+		require.NoError(t, err)
+		require.Zero(t, avg)
+	})
+
+	t.Run("case 3: should return 0 if there are no vehicles", func(t *testing.T) {
+		// arrange
+		rp := factory(t, map[int]internal.Vehicle{})
+
+		// act
+		avg, err := rp.FindByBrandAverageSpeed(context.Background(), "Ford")
+
+		// assert
+		require.NoError(t, err)
+		require.Zero(t, avg)
+	})
+}
+
+func testFindByFuelType(t *testing.T, factory Factory) {
+	t.Run("case 1: should return the vehicles with the fuel type", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		v, err := rp.FindByFuelType(context.Background(), "diesel")
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, subset(2, 5), v)
+	})
+
+	t.Run("case 2: should return an empty map if no vehicle matches", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		v, err := rp.FindByFuelType(context.Background(), "hydrogen")
+
+		// assert
+		require.NoError(t, err)
+		require.NotNil(t, v)
+		require.Empty(t, v)
+	})
+}
+
+func testFindByTransmissionType(t *testing.T, factory Factory) {
+	t.Run("case 1: should return the vehicles with the transmission", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		v, err := rp.FindByTransmissionType(context.Background(), "manual")
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, subset(1, 5), v)
+	})
+
+	t.Run("case 2: should return an empty map if no vehicle matches", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		v, err := rp.FindByTransmissionType(context.Background(), "cvt")
+
+		// assert
+		require.NoError(t, err)
+		require.NotNil(t, v)
+		require.Empty(t, v)
+	})
+}
+
+func testFindByBrandAverageCapacity(t *testing.T, factory Factory) {
+	t.Run("case 1: should return the average capacity of the brand", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		avg, err := rp.FindByBrandAverageCapacity(context.Background(), "Toyota")
+
+		// assert
+		require.NoError(t, err)
+		require.InDelta(t, 3.5, avg, 1e-9)
+	})
+
+	t.Run("case 2: should return 0 for an unknown brand", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		avg, err := rp.FindByBrandAverageCapacity(context.Background(), "Fiat")
+
+		// assert
+		require.NoError(t, err)
+		require.Zero(t, avg)
+	})
+
+	t.Run("case 3: should return 0 if there are no vehicles", func(t *testing.T) {
+		// arrange
+		rp := factory(t, map[int]internal.Vehicle{})
+
+		// act
+		avg, err := rp.FindByBrandAverageCapacity(context.Background(), "Toyota")
+
+		// assert
+		require.NoError(t, err)
+		require.Zero(t, avg)
+	})
+}
+
+func testFindByWeightRange(t *testing.T, factory Factory) {
+	t.Run("case 1: should return the vehicles within the range, bounds included", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		v, err := rp.FindByWeightRange(context.Background(), 1200, 1400)
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, subset(1, 3, 4), v)
+	})
+
+	t.Run("case 2: should return an empty map if the min weight is greater than the max weight", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		v, err := rp.FindByWeightRange(context.Background(), 1400, 1200)
+
+		// assert
+		require.NoError(t, err)
+		require.Empty(t, v)
+	})
+}
+
+func testFindByDimensionRange(t *testing.T, factory Factory) {
+	t.Run("case 1: should return the vehicles within both ranges, bounds included", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		v, err := rp.FindByDimensionRange(context.Background(), 140, 175, 150, 180)
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, subset(1, 3, 4), v)
+	})
+
+	t.Run("case 2: should require both the height and the width to be within range", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		v, err := rp.FindByDimensionRange(context.Background(), 140, 190, 150, 200)
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, subset(6), v)
+	})
+
+	t.Run("case 3: should return an empty map if no vehicle matches", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		v, err := rp.FindByDimensionRange(context.Background(), 0, 0, 10, 10)
+
+		// assert
+		require.NoError(t, err)
+		require.Empty(t, v)
+	})
+}
+
+func testSave(t *testing.T, factory Factory) {
+	t.Run("case 1: should save a new vehicle", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+		vehicle := NewVehicle(7, "Fiat", "Green", 2018, 4, 150, "gasoline", "manual", 1000, 130, 165)
+
+		// act
+		err := rp.Save(context.Background(), &vehicle)
+
+		// assert
+		require.NoError(t, err)
+		v, err := rp.FindAll(context.Background())
+		require.NoError(t, err)
+		expected := Fixture()
+		expected[7] = vehicle
+		require.Equal(t, expected, v)
+	})
+
+	t.Run("case 2: should overwrite the vehicle with the same id", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+		vehicle := Fixture()[1]
+		vehicle.Color = "Green"
+		vehicle.FabricationYear = 2011
+
+		// act
+		err := rp.Save(context.Background(), &vehicle)
+
+		// assert
+		require.NoError(t, err)
+		v, err := rp.FindAll(context.Background())
+		require.NoError(t, err)
+		require.Len(t, v, len(Fixture()))
+		require.Equal(t, vehicle, v[1])
+	})
+
+	t.Run("case 3: should make the saved vehicle visible to the filters and drop the old values", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+		vehicle := Fixture()[1]
+		vehicle.Brand = "Toyota"
+		vehicle.Color = "White"
+		vehicle.FabricationYear = 2005
+		vehicle.FuelType = "diesel"
+		vehicle.Transmission = "automatic"
+		vehicle.Weight = 950
+		vehicle.Height = 125
+
+		// act
+		err := rp.Save(context.Background(), &vehicle)
+
+		// assert
+		require.NoError(t, err)
+		v, err := rp.FindByColorYear(context.Background(), "White", 2005)
+		require.NoError(t, err)
+		require.Equal(t, map[int]internal.Vehicle{1: vehicle, 5: Fixture()[5]}, v)
+		v, err = rp.FindByColorYear(context.Background(), "Red", 2010)
+		require.NoError(t, err)
+		require.Equal(t, subset(4), v)
+		v, err = rp.FindByBrandYearRange(context.Background(), "Ford", 1900, 2100)
+		require.NoError(t, err)
+		require.Equal(t, subset(2, 3), v)
+		v, err = rp.FindByFuelType(context.Background(), "gasoline")
+		require.NoError(t, err)
+		require.Equal(t, subset(3), v)
+		v, err = rp.FindByTransmissionType(context.Background(), "manual")
+		require.NoError(t, err)
+		require.Equal(t, subset(5), v)
+		v, err = rp.FindByWeightRange(context.Background(), 900, 1000)
+		require.NoError(t, err)
+		require.Equal(t, map[int]internal.Vehicle{1: vehicle, 5: Fixture()[5]}, v)
+		avg, err := rp.FindByBrandAverageCapacity(context.Background(), "Toyota")
+		require.NoError(t, err)
+		require.InDelta(t, (5.0+5.0+2.0)/3, avg, 1e-9)
+	})
+
+	t.Run("case 4: should store a copy of the vehicle", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+		vehicle := NewVehicle(7, "Fiat", "Green", 2018, 4, 150, "gasoline", "manual", 1000, 130, 165)
+
+		// act
+		err := rp.Save(context.Background(), &vehicle)
+		require.NoError(t, err)
+		vehicle.Color = "Yellow"
+
+		// assert
+		v, err := rp.FindAll(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, "Green", v[7].Color)
+	})
+
+	t.Run("case 5: should return ErrVehicleInvalidField if the id is not positive", func(t *testing.T) {
+		for _, id := range []int{0, -1} {
+			// arrange
+			rp := factory(t, Fixture())
+			vehicle := NewVehicle(id, "Fiat", "Green", 2018, 4, 150, "gasoline", "manual", 1000, 130, 165)
+
+			// act
+			err := rp.Save(context.Background(), &vehicle)
+
+			// assert
+			require.ErrorIs(t, err, internal.ErrVehicleInvalidField)
+			v, err := rp.FindAll(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, Fixture(), v)
+		}
+	})
+
+	t.Run("case 6: should save into an empty repository", func(t *testing.T) {
+		// arrange
+		rp := factory(t, map[int]internal.Vehicle{})
+		vehicle := NewVehicle(1, "Fiat", "Green", 2018, 4, 150, "gasoline", "manual", 1000, 130, 165)
+
+		// act
+		err := rp.Save(context.Background(), &vehicle)
+
+		// assert
+		require.NoError(t, err)
+		v, err := rp.FindAll(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, map[int]internal.Vehicle{1: vehicle}, v)
+	})
+
+	t.Run("case 7: should set the version to 1 for a new vehicle and increment it on every save", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+		vehicle := NewVehicle(7, "Fiat", "Green", 2018, 4, 150, "gasoline", "manual", 1000, 130, 165)
+		vehicle.Version = 10
+
+		// act
+		err := rp.Save(context.Background(), &vehicle)
+		require.NoError(t, err)
+		first := vehicle.Version
+		err = rp.Save(context.Background(), &vehicle)
+		require.NoError(t, err)
+
+		// assert
+		require.Equal(t, 1, first)
+		require.Equal(t, 2, vehicle.Version)
+		v, err := rp.FindById(context.Background(), 7)
+		require.NoError(t, err)
+		require.Equal(t, 2, v.Version)
+	})
+}
+
+func testCreate(t *testing.T, factory Factory) {
+	t.Run("case 1: should save a new vehicle at version 1", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+		vehicle := NewVehicle(7, "Fiat", "Green", 2018, 4, 150, "gasoline", "manual", 1000, 130, 165)
+		vehicle.Version = 0
+
+		// act
+		err := rp.Create(context.Background(), &vehicle)
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, 1, vehicle.Version)
+		v, err := rp.FindById(context.Background(), 7)
+		require.NoError(t, err)
+		require.Equal(t, vehicle, v)
+	})
+
+	t.Run("case 2: should return ErrVehicleExists and keep the vehicle with the same id", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+		vehicle := Fixture()[1]
+		vehicle.Color = "Green"
+
+		// act
+		err := rp.Create(context.Background(), &vehicle)
+
+		// assert
+		require.ErrorIs(t, err, internal.ErrVehicleExists)
+		v, err := rp.FindAll(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, Fixture(), v)
+	})
+
+	t.Run("case 3: should return ErrVehicleInvalidField if the id is not positive", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+		vehicle := NewVehicle(0, "Fiat", "Green", 2018, 4, 150, "gasoline", "manual", 1000, 130, 165)
+
+		// act
+		err := rp.Create(context.Background(), &vehicle)
+
+		// assert
+		require.ErrorIs(t, err, internal.ErrVehicleInvalidField)
+	})
+
+	t.Run("case 4: should create a vehicle with the id of a deleted one after its last version", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+		require.NoError(t, rp.Delete(context.Background(), 1, 1))
+		vehicle := Fixture()[1]
+
+		// act
+		err := rp.Create(context.Background(), &vehicle)
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, 2, vehicle.Version)
+	})
+
+	t.Run("case 5: should create a vehicle only once if it is created concurrently", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+		const n = 8
+		errs := make([]error, n)
+
+		// act
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				vehicle := NewVehicle(7, fmt.Sprintf("Fiat %d", i), "Green", 2018, 4, 150, "gasoline", "manual", 1000, 130, 165)
+				errs[i] = rp.Create(context.Background(), &vehicle)
+			}(i)
+		}
+		wg.Wait()
+
+		// assert
+		created := 0
+		for _, err := range errs {
+			if err == nil {
+				created++
+				continue
+			}
+			require.ErrorIs(t, err, internal.ErrVehicleExists)
+		}
+		require.Equal(t, 1, created)
+		v, err := rp.FindById(context.Background(), 7)
+		require.NoError(t, err)
+		require.Equal(t, 1, v.Version)
+	})
+}
+
+func testSaveBatch(t *testing.T, factory Factory) {
+	t.Run("case 1: should save new and existing vehicles in order and set their versions", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+		updated := Fixture()[1]
+		updated.Color = "Green"
+		created := NewVehicle(7, "Fiat", "Green", 2018, 4, 150, "gasoline", "manual", 1000, 130, 165)
+		batch := []internal.Vehicle{updated, created}
+
+		// act
+		err := rp.SaveBatch(context.Background(), batch)
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, 2, batch[0].Version)
+		require.Equal(t, 1, batch[1].Version)
+		v, err := rp.FindAll(context.Background())
+		require.NoError(t, err)
+		expected := Fixture()
+		expected[1], expected[7] = batch[0], batch[1]
+		require.Equal(t, expected, v)
+		v, err = rp.FindByColorYear(context.Background(), "Green", 2010)
+		require.NoError(t, err)
+		require.Equal(t, map[int]internal.Vehicle{1: batch[0]}, v)
+	})
+
+	t.Run("case 2: should save a vehicle repeated in the batch once per occurrence", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+		first, second := Fixture()[1], Fixture()[1]
+		first.Color, second.Color = "Green", "Yellow"
+		batch := []internal.Vehicle{first, second}
+
+		// act
+		err := rp.SaveBatch(context.Background(), batch)
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, 2, batch[0].Version)
+		require.Equal(t, 3, batch[1].Version)
+		v, err := rp.FindById(context.Background(), 1)
+		require.NoError(t, err)
+		require.Equal(t, batch[1], v)
+	})
+
+	t.Run("case 3: should save none of the vehicles if one of them is invalid", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+		created := NewVehicle(7, "Fiat", "Green", 2018, 4, 150, "gasoline", "manual", 1000, 130, 165)
+		created.Version = 0
+		invalid := NewVehicle(0, "Fiat", "Green", 2018, 4, 150, "gasoline", "manual", 1000, 130, 165)
+		batch := []internal.Vehicle{created, invalid}
+
+		// act
+		err := rp.SaveBatch(context.Background(), batch)
+
+		// assert
+		require.ErrorIs(t, err, internal.ErrVehicleInvalidField)
+		require.Equal(t, 0, batch[0].Version)
+		v, err := rp.FindAll(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, Fixture(), v)
+	})
+}
+
+func testUpdate(t *testing.T, factory Factory) {
+	t.Run("case 1: should overwrite the vehicle and increment the version", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+		vehicle := Fixture()[1]
+		vehicle.Color = "Green"
+
+		// act
+		err := rp.Update(context.Background(), &vehicle, 1)
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, 2, vehicle.Version)
+		v, err := rp.FindById(context.Background(), 1)
+		require.NoError(t, err)
+		require.Equal(t, vehicle, v)
+		found, err := rp.FindByColorYear(context.Background(), "Red", 2010)
+		require.NoError(t, err)
+		require.Equal(t, subset(4), found)
+	})
+
+	t.Run("case 2: should return ErrVehicleVersionMismatch if the version is stale", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+		first := Fixture()[1]
+		first.Color = "Green"
+		require.NoError(t, rp.Update(context.Background(), &first, 1))
+		second := Fixture()[1]
+		second.Color = "Yellow"
+
+		// act
+		err := rp.Update(context.Background(), &second, 1)
+
+		// assert
+		require.ErrorIs(t, err, internal.ErrVehicleVersionMismatch)
+		v, err := rp.FindById(context.Background(), 1)
+		require.NoError(t, err)
+		require.Equal(t, first, v)
+	})
+
+	t.Run("case 3: should return ErrVehicleNotFound if the vehicle does not exist", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+		vehicle := NewVehicle(7, "Fiat", "Green", 2018, 4, 150, "gasoline", "manual", 1000, 130, 165)
+
+		// act
+		err := rp.Update(context.Background(), &vehicle, 1)
+
+		// assert
+		require.ErrorIs(t, err, internal.ErrVehicleNotFound)
+		v, err := rp.FindAll(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, Fixture(), v)
+	})
+}
+
+func testDelete(t *testing.T, factory Factory) {
+	t.Run("case 1: should delete the vehicle and drop it from the filters", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		err := rp.Delete(context.Background(), 1, 1)
+
+		// assert
+		require.NoError(t, err)
+		_, err = rp.FindById(context.Background(), 1)
+		require.ErrorIs(t, err, internal.ErrVehicleNotFound)
+		v, err := rp.FindAll(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, subset(2, 3, 4, 5, 6), v)
+		v, err = rp.FindByColorYear(context.Background(), "Red", 2010)
+		require.NoError(t, err)
+		require.Equal(t, subset(4), v)
+		avg, err := rp.FindByBrandAverageSpeed(context.Background(), "Ford")
+		require.NoError(t, err)
+		require.InDelta(t, (160.0+200.0)/2, avg, 1e-9)
+	})
+
+	t.Run("case 2: should return ErrVehicleVersionMismatch if the version is stale", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		err := rp.Delete(context.Background(), 1, 2)
+
+		// assert
+		require.ErrorIs(t, err, internal.ErrVehicleVersionMismatch)
+		v, err := rp.FindAll(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, Fixture(), v)
+	})
+
+	t.Run("case 3: should return ErrVehicleNotFound if the vehicle does not exist", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		err := rp.Delete(context.Background(), 99, 1)
+
+		// assert
+		require.ErrorIs(t, err, internal.ErrVehicleNotFound)
+	})
+
+	t.Run("case 4: should save a new vehicle with the id of a deleted one after its last version", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+		vehicle := Fixture()[1]
+		require.NoError(t, rp.Update(context.Background(), &vehicle, 1))
+		require.NoError(t, rp.Delete(context.Background(), 1, 2))
+
+		// act
+		err := rp.Save(context.Background(), &vehicle)
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, 3, vehicle.Version)
+		stale := vehicle
+		err = rp.Update(context.Background(), &stale, 2)
+		require.ErrorIs(t, err, internal.ErrVehicleVersionMismatch)
+	})
+}
+
+func testReplace(t *testing.T, factory Factory) {
+	t.Run("case 1: should replace every vehicle keeping their versions and reindex them", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+		replaced := subset(2, 5)
+		changed := replaced[2]
+		changed.Color, changed.FabricationYear, changed.Version = "Red", 2010, 4
+		replaced[2] = changed
+		added := NewVehicle(7, "Fiat", "Green", 2018, 4, 150, "gasoline", "manual", 1000, 130, 165)
+		added.Version = 3
+		replaced[7] = added
+
+		// act
+		err := rp.Replace(context.Background(), replaced)
+
+		// assert
+		require.NoError(t, err)
+		v, err := rp.FindAll(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, replaced, v)
+		v, err = rp.FindByColorYear(context.Background(), "Red", 2010)
+		require.NoError(t, err)
+		require.Equal(t, map[int]internal.Vehicle{2: changed}, v)
+		v, err = rp.FindByFuelType(context.Background(), "gasoline")
+		require.NoError(t, err)
+		require.Equal(t, map[int]internal.Vehicle{7: added}, v)
+		avg, err := rp.FindByBrandAverageSpeed(context.Background(), "Toyota")
+		require.NoError(t, err)
+		require.InDelta(t, 120.0, avg, 1e-9)
+	})
+
+	t.Run("case 2: should replace with no vehicles and set vehicles without a version at version 1", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+		unversioned := Fixture()[1]
+		unversioned.Version = 0
+
+		// act
+		errEmpty := rp.Replace(context.Background(), map[int]internal.Vehicle{})
+		empty, errFind := rp.FindAll(context.Background())
+		errReplace := rp.Replace(context.Background(), map[int]internal.Vehicle{1: unversioned})
+
+		// assert
+		require.NoError(t, errEmpty)
+		require.NoError(t, errFind)
+		require.Empty(t, empty)
+		require.NoError(t, errReplace)
+		v, err := rp.FindById(context.Background(), 1)
+		require.NoError(t, err)
+		require.Equal(t, Fixture()[1], v)
+	})
+
+	t.Run("case 3: should save a vehicle with the id of a replaced away one after its last version", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+		vehicle := Fixture()[1]
+		require.NoError(t, rp.Update(context.Background(), &vehicle, 1))
+
+		// act
+		errReplace := rp.Replace(context.Background(), subset(2))
+		errSave := rp.Save(context.Background(), &vehicle)
+
+		// assert
+		require.NoError(t, errReplace)
+		require.NoError(t, errSave)
+		require.Equal(t, 3, vehicle.Version)
+	})
+
+	t.Run("case 4: should not replace anything with a canceled context", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// act
+		err := rp.Replace(ctx, subset(1))
+
+		// assert
+		require.ErrorIs(t, err, context.Canceled)
+		v, err := rp.FindAll(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, Fixture(), v)
+	})
+}
+
+func testHistory(t *testing.T, factory Factory) {
+	t.Run("case 1: should return the entries of the vehicle oldest first with the types of the fields", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+		timestamp := time.Date(2024, 3, 1, 12, 30, 0, 500, time.UTC)
+		entries := []internal.VehicleHistoryEntry{
+			{VehicleId: 1, Version: 1, Timestamp: timestamp, Actor: "alice", Operation: internal.VehicleOperationCreate, Changes: internal.DiffVehicleAttributes(internal.VehicleAttributes{}, Fixture()[1].VehicleAttributes)},
+			{VehicleId: 2, Version: 2, Timestamp: timestamp, Actor: "bob", Operation: internal.VehicleOperationUpdate, Changes: []internal.FieldChange{{Field: "color", Old: "Blue", New: "Red"}}},
+			{VehicleId: 1, Version: 2, Timestamp: timestamp.Add(time.Hour), Actor: "bob", Operation: internal.VehicleOperationUpdate, Changes: []internal.FieldChange{{Field: "year", Old: 2010, New: 2011}, {Field: "max_speed", Old: 180.0, New: 185.5}}},
+			{VehicleId: 1, Version: 2, Timestamp: timestamp.Add(2 * time.Hour), Actor: "carol", Operation: internal.VehicleOperationDelete, Changes: internal.DiffVehicleAttributes(Fixture()[1].VehicleAttributes, internal.VehicleAttributes{})},
+		}
+
+		// act
+		for _, e := range entries {
+			require.NoError(t, rp.AppendHistory(context.Background(), e))
+		}
+		h, err := rp.FindHistory(context.Background(), 1)
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, []internal.VehicleHistoryEntry{entries[0], entries[2], entries[3]}, h)
+	})
+
+	t.Run("case 2: should return an empty history for a vehicle without entries", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+
+		// act
+		h, err := rp.FindHistory(context.Background(), 1)
+
+		// assert
+		require.NoError(t, err)
+		require.NotNil(t, h)
+		require.Empty(t, h)
+	})
+	t.Run("case 3: should return the entries of every vehicle recorded after an instant", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+		timestamp := time.Date(2024, 3, 1, 12, 30, 0, 500, time.UTC)
+		entries := []internal.VehicleHistoryEntry{
+			{VehicleId: 1, Version: 2, Timestamp: timestamp, Actor: "alice", Operation: internal.VehicleOperationUpdate, Changes: []internal.FieldChange{{Field: "color", Old: "Red", New: "Blue"}}},
+			{VehicleId: 1, Version: 3, Timestamp: timestamp.Add(time.Nanosecond), Actor: "bob", Operation: internal.VehicleOperationUpdate, Changes: []internal.FieldChange{{Field: "color", Old: "Blue", New: "Green"}}},
+			{VehicleId: 2, Version: 2, Timestamp: timestamp.Add(time.Second), Actor: "bob", Operation: internal.VehicleOperationUpdate, Changes: []internal.FieldChange{{Field: "weight", Old: 1500.0, New: 1550.0}}},
+			{VehicleId: 1, Version: 3, Timestamp: timestamp.Add(time.Hour), Actor: "carol", Operation: internal.VehicleOperationDelete, Changes: []internal.FieldChange{{Field: "color", Old: "Green", New: ""}}},
+		}
+		for _, e := range entries {
+			require.NoError(t, rp.AppendHistory(context.Background(), e))
+		}
+
+		// act
+		h, err := rp.FindHistorySince(context.Background(), timestamp)
+
+		// assert
+		require.NoError(t, err)
+		byVehicle := make(map[int][]internal.VehicleHistoryEntry)
+		for _, e := range h {
+			byVehicle[e.VehicleId] = append(byVehicle[e.VehicleId], e)
+		}
+		require.Equal(t, map[int][]internal.VehicleHistoryEntry{
+			1: {entries[1], entries[3]},
+			2: {entries[2]},
+		}, byVehicle)
+	})
+}
+
+func testConcurrency(t *testing.T, factory Factory) {
+	t.Run("case 1: should serve parallel writers and readers (run with -race)", func(t *testing.T) {
+		// arrange
+		rp := factory(t, Fixture())
+		const writers = 8
+		const rounds = 10
+
+		// act
+		var wg sync.WaitGroup
+		errs := make(chan error, 2*writers)
+		for w := 0; w < writers; w++ {
+			w := w
+			wg.Add(2)
+			// - each writer creates, updates and deletes its own vehicle
+			go func() {
+				defer wg.Done()
+				id := 100 + w
+				v := NewVehicle(id, "Fiat", "Green", 2000, 4, 150, "gasoline", "manual", 1000, 140, 170)
+				if err := rp.Save(context.Background(), &v); err != nil {
+					errs <- err
+					return
+				}
+				for round := 0; round < rounds; round++ {
+					v.Color = fmt.Sprintf("Green %d", round)
+					if err := rp.Update(context.Background(), &v, v.Version); err != nil {
+						errs <- err
+						return
+					}
+					e := internal.VehicleHistoryEntry{VehicleId: id, Version: v.Version, Timestamp: time.Now(), Actor: "writer", Operation: internal.VehicleOperationUpdate}
+					if err := rp.AppendHistory(context.Background(), e); err != nil {
+						errs <- err
+						return
+					}
+				}
+				if w%2 == 0 {
+					if err := rp.Delete(context.Background(), id, v.Version); err != nil {
+						errs <- err
+					}
+				}
+			}()
+			// - each reader queries the indexes while they change
+			go func() {
+				defer wg.Done()
+				for round := 0; round < rounds; round++ {
+					if _, err := rp.FindByBrandYearRange(context.Background(), "Fiat", 1990, 2010); err != nil {
+						errs <- err
+						return
+					}
+					if _, err := rp.FindAll(context.Background()); err != nil {
+						errs <- err
+						return
+					}
+					if _, err := rp.FindHistory(context.Background(), 100+w); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		// assert
+		for err := range errs {
+			require.NoError(t, err)
+		}
+		v, err := rp.FindByBrandYearRange(context.Background(), "Fiat", 2000, 2000)
+		require.NoError(t, err)
+		require.Len(t, v, writers/2)
+		for id, vehicle := range v {
+			require.Equal(t, 1, id%2)
+			require.Equal(t, rounds+1, vehicle.Version)
+			require.Equal(t, fmt.Sprintf("Green %d", rounds-1), vehicle.Color)
+			h, err := rp.FindHistory(context.Background(), id)
+			require.NoError(t, err)
+			require.Len(t, h, rounds)
+		}
+	})
+}
+
+// audited is a function that returns the repository of factory as an internal.VehicleAuditedRepository, the test is skipped if it is not one
+func audited(t *testing.T, factory Factory) (rp internal.VehicleRepository, a internal.VehicleAuditedRepository) {
+	rp = factory(t, Fixture())
+	a, ok := rp.(internal.VehicleAuditedRepository)
+	if !ok {
+		t.Skip("the repository does not implement internal.VehicleAuditedRepository")
+	}
+	return
+}
+
+func testAudited(t *testing.T, factory Factory) {
+	entry := func(id int, operation internal.VehicleOperation) internal.VehicleHistoryEntry {
+		return internal.VehicleHistoryEntry{VehicleId: id, Timestamp: time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC), Actor: "alice", Operation: operation}
+	}
+
+	t.Run("case 1: should write the vehicles and record their entries with the versions written", func(t *testing.T) {
+		// arrange
+		rp, a := audited(t, factory)
+		created := NewVehicle(7, "Fiat", "Green", 2001, 4, 150, "gasoline", "manual", 1000, 140, 170)
+		updated := Fixture()[1]
+		updated.Color = "Blue"
+
+		// act
+		errSave := a.SaveAudited(context.Background(), &created, entry(7, internal.VehicleOperationCreate))
+		errUpdate := a.UpdateAudited(context.Background(), &updated, 1, entry(1, internal.VehicleOperationUpdate))
+		errDelete := a.DeleteAudited(context.Background(), 2, 1, entry(2, internal.VehicleOperationDelete))
+
+		// assert
+		require.NoError(t, errSave)
+		require.NoError(t, errUpdate)
+		require.NoError(t, errDelete)
+		require.Equal(t, 1, created.Version)
+		require.Equal(t, 2, updated.Version)
+		for id, version := range map[int]int{7: 1, 1: 2, 2: 1} {
+			h, err := rp.FindHistory(context.Background(), id)
+			require.NoError(t, err)
+			require.Len(t, h, 1)
+			require.Equal(t, version, h[0].Version)
+		}
+		_, err := rp.FindById(context.Background(), 2)
+		require.ErrorIs(t, err, internal.ErrVehicleNotFound)
+	})
+
+	t.Run("case 2: should neither write nor record anything if the write fails", func(t *testing.T) {
+		// arrange
+		rp, a := audited(t, factory)
+		stale := Fixture()[1]
+		stale.Color = "Blue"
+
+		// act
+		errUpdate := a.UpdateAudited(context.Background(), &stale, 5, entry(1, internal.VehicleOperationUpdate))
+		errDelete := a.DeleteAudited(context.Background(), 99, 1, entry(99, internal.VehicleOperationDelete))
+
+		// assert
+		require.ErrorIs(t, errUpdate, internal.ErrVehicleVersionMismatch)
+		require.ErrorIs(t, errDelete, internal.ErrVehicleNotFound)
+		require.Equal(t, 1, stale.Version)
+		v, err := rp.FindById(context.Background(), 1)
+		require.NoError(t, err)
+		require.Equal(t, Fixture()[1], v)
+		h, err := rp.FindHistorySince(context.Background(), time.Time{})
+		require.NoError(t, err)
+		require.Empty(t, h)
+	})
+
+	t.Run("case 3: should create a new vehicle and record its entry, and record nothing if it exists", func(t *testing.T) {
+		// arrange
+		rp, a := audited(t, factory)
+		created := NewVehicle(7, "Fiat", "Green", 2001, 4, 150, "gasoline", "manual", 1000, 140, 170)
+		existing := Fixture()[1]
+		existing.Color = "Blue"
+
+		// act
+		errCreate := a.CreateAudited(context.Background(), &created, entry(7, internal.VehicleOperationCreate))
+		errExists := a.CreateAudited(context.Background(), &existing, entry(1, internal.VehicleOperationCreate))
+
+		// assert
+		require.NoError(t, errCreate)
+		require.ErrorIs(t, errExists, internal.ErrVehicleExists)
+		require.Equal(t, 1, created.Version)
+		h, err := rp.FindHistory(context.Background(), 7)
+		require.NoError(t, err)
+		require.Len(t, h, 1)
+		require.Equal(t, 1, h[0].Version)
+		h, err = rp.FindHistory(context.Background(), 1)
+		require.NoError(t, err)
+		require.Empty(t, h)
+		v, err := rp.FindById(context.Background(), 1)
+		require.NoError(t, err)
+		require.Equal(t, Fixture()[1], v)
+	})
+
+	t.Run("case 4: should save a batch and record the entry of each vehicle with the version written", func(t *testing.T) {
+		// arrange
+		rp, a := audited(t, factory)
+		updated := Fixture()[1]
+		updated.Color = "Blue"
+		created := NewVehicle(7, "Fiat", "Green", 2001, 4, 150, "gasoline", "manual", 1000, 140, 170)
+		batch := []internal.Vehicle{updated, created}
+
+		// act
+		err := a.SaveBatchAudited(context.Background(), batch, []internal.VehicleHistoryEntry{entry(1, internal.VehicleOperationUpdate), entry(7, internal.VehicleOperationCreate)})
+
+		// assert
+		require.NoError(t, err)
+		for id, version := range map[int]int{1: 2, 7: 1} {
+			h, err := rp.FindHistory(context.Background(), id)
+			require.NoError(t, err)
+			require.Len(t, h, 1)
+			require.Equal(t, version, h[0].Version)
+		}
+	})
+}
@@ -0,0 +1,858 @@
+package repository
+
+import (
+	"app/internal"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func init() {
+	// bolt:///path/to/vehicles.bolt[?seed=false] stores the vehicles in an embedded key-value file
+	// - an empty file is populated with the seed unless seed=false
+	Register("bolt", DriverFunc(func(dsn *url.URL, seed internal.VehicleLoader) (rp internal.VehicleRepository, err error) {
+		path, err := dsnPath(dsn)
+		if err != nil {
+			return
+		}
+		populate, err := dsnBoolOption(dsn, "seed", true)
+		if err != nil {
+			return
+		}
+
+		r, err := OpenVehicleBolt(path)
+		if err != nil {
+			return
+		}
+		if populate {
+			if err = populateEmpty(context.Background(), r, seed); err != nil {
+				r.Close()
+				return
+			}
+		}
+		rp = r
+		return
+	}))
+}
+
+var (
+	// boltBucketVehicles is the bucket of the vehicles by id
+	boltBucketVehicles = []byte("vehicles")
+	// boltBucketBrand is the index bucket of the vehicles by brand
+	boltBucketBrand = []byte("index_brand")
+	// boltBucketColor is the index bucket of the vehicles by color
+	boltBucketColor = []byte("index_color")
+	// boltBucketFuelType is the index bucket of the vehicles by fuel type
+	boltBucketFuelType = []byte("index_fuel_type")
+	// boltBucketTransmission is the index bucket of the vehicles by transmission
+	boltBucketTransmission = []byte("index_transmission")
+	// boltBucketYear is the index bucket of the vehicles by fabrication year
+	boltBucketYear = []byte("index_year")
+	// boltBucketHistory is the bucket of the history entries, keyed by vehicle id and sequence
+	boltBucketHistory = []byte("history")
+	// boltBucketTombstones is the bucket of the last versions of the deleted vehicles, keyed by id
+	boltBucketTombstones = []byte("tombstones")
+)
+
+// boltIndex is a struct that represents a secondary index bucket
+type boltIndex struct {
+	// bucket is the name of the index bucket
+	bucket []byte
+	// value is the function that returns the indexed value of a vehicle
+	value func(v *internal.Vehicle) []byte
+}
+
+// boltIndexes are the secondary indexes maintained on every write
+// - an index key is the indexed value followed by the 8 bytes big endian id, the value of the key is empty
+var boltIndexes = []boltIndex{
+	{bucket: boltBucketBrand, value: func(v *internal.Vehicle) []byte { return boltStringValue(v.Brand) }},
+	{bucket: boltBucketColor, value: func(v *internal.Vehicle) []byte { return boltStringValue(v.Color) }},
+	{bucket: boltBucketFuelType, value: func(v *internal.Vehicle) []byte { return boltStringValue(v.FuelType) }},
+	{bucket: boltBucketTransmission, value: func(v *internal.Vehicle) []byte { return boltStringValue(v.Transmission) }},
+	{bucket: boltBucketYear, value: func(v *internal.Vehicle) []byte { return boltIntValue(v.FabricationYear) }},
+}
+
+// boltStringValue is a function that returns the index value of a string, terminated so a value is never a prefix of another
+func boltStringValue(s string) []byte {
+	return append([]byte(s), 0)
+}
+
+// boltIntValue is a function that returns the index value of an int, ordered as the ints are
+func boltIntValue(n int) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(n)^(1<<63))
+	return b
+}
+
+// boltID is a function that returns the key of an id
+func boltID(id int) []byte {
+	return boltIntValue(id)
+}
+
+// OpenVehicleBolt is a function that opens (or creates) the key-value file at path
+// - it fails after a second if the file is locked by another process
+func OpenVehicleBolt(path string) (r *VehicleBolt, err error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return
+	}
+
+	// buckets
+	err = db.Update(func(tx *bolt.Tx) (err error) {
+		for _, bucket := range [][]byte{boltBucketVehicles, boltBucketHistory} {
+			if _, err = tx.CreateBucketIfNotExists(bucket); err != nil {
+				return
+			}
+		}
+		for _, index := range boltIndexes {
+			if _, err = tx.CreateBucketIfNotExists(index.bucket); err != nil {
+				return
+			}
+		}
+		// - the tombstones of a file written before them are restored from the history
+		if tx.Bucket(boltBucketTombstones) == nil {
+			if _, err = tx.CreateBucket(boltBucketTombstones); err != nil {
+				return
+			}
+			err = boltRestoreTombstones(tx)
+		}
+		return
+	})
+	if err != nil {
+		db.Close()
+		return
+	}
+
+	r = NewVehicleBolt(db)
+	return
+}
+
+// Constructor
+// NewVehicleBolt is a function that returns a new instance of VehicleBolt
+// - the buckets must exist (see OpenVehicleBolt)
+func NewVehicleBolt(db *bolt.DB) *VehicleBolt {
+	return &VehicleBolt{db: db}
+}
+
+// VehicleBolt is a struct that represents a vehicle repository on an embedded B+tree key-value file
+// - every write is a transaction that updates the vehicle and its secondary indexes atomically
+type VehicleBolt struct {
+	// db is the key-value file
+	db *bolt.DB
+}
+
+// Close is a method that closes the key-value file
+func (r *VehicleBolt) Close() (err error) {
+	err = r.db.Close()
+	return
+}
+
+// Ping is a method that checks the key-value file is open and readable
+func (r *VehicleBolt) Ping(ctx context.Context) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	err = r.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(boltBucketVehicles) == nil {
+			return bolt.ErrBucketNotFound
+		}
+		return nil
+	})
+	return
+}
+
+// Import is a method that saves all the vehicles in a single transaction
+// - existing vehicles with the same id are overwritten
+// - the versions of the vehicles are kept, vehicles without a version are at their first version
+func (r *VehicleBolt) Import(ctx context.Context, v map[int]internal.Vehicle) (err error) {
+	err = r.db.Update(func(tx *bolt.Tx) (err error) {
+		cc := cancelCheck{ctx: ctx}
+		for _, vh := range v {
+			if err = cc.step(); err != nil {
+				return
+			}
+			vh.Version = max(vh.Version, 1)
+			if err = boltPut(tx, &vh); err != nil {
+				return
+			}
+		}
+		return
+	})
+	return
+}
+
+// Replace is a method that replaces every vehicle with the vehicles of v in a single transaction
+// - the buckets of the vehicles and their indexes are recreated, the history is kept
+func (r *VehicleBolt) Replace(ctx context.Context, v map[int]internal.Vehicle) (err error) {
+	err = r.db.Update(func(tx *bolt.Tx) (err error) {
+		// - the vehicles left out are tombstoned at their last version, so their ids are not reused at an earlier one
+		tombstones := tx.Bucket(boltBucketTombstones)
+		err = tx.Bucket(boltBucketVehicles).ForEach(func(key, value []byte) (err error) {
+			var vh internal.Vehicle
+			if err = json.Unmarshal(value, &vh); err != nil {
+				return
+			}
+			if _, ok := v[vh.Id]; ok || vh.Version <= boltTombstone(tx, vh.Id) {
+				return
+			}
+			err = tombstones.Put(boltID(vh.Id), binary.BigEndian.AppendUint64(nil, uint64(vh.Version)))
+			return
+		})
+		if err != nil {
+			return
+		}
+
+		buckets := [][]byte{boltBucketVehicles}
+		for _, index := range boltIndexes {
+			buckets = append(buckets, index.bucket)
+		}
+		for _, bucket := range buckets {
+			if err = tx.DeleteBucket(bucket); err != nil {
+				return
+			}
+			if _, err = tx.CreateBucket(bucket); err != nil {
+				return
+			}
+		}
+
+		cc := cancelCheck{ctx: ctx}
+		for _, vh := range v {
+			if err = cc.step(); err != nil {
+				return
+			}
+			vh.Version = max(vh.Version, 1)
+			if err = boltPut(tx, &vh); err != nil {
+				return
+			}
+		}
+		return
+	})
+	return
+}
+
+// FindAll is a method that returns a map of all vehicles
+func (r *VehicleBolt) FindAll(ctx context.Context) (v map[int]internal.Vehicle, err error) {
+	v, err = r.filter(ctx, func(vh *internal.Vehicle) bool { return true })
+	return
+}
+
+// FindById is a method that returns a vehicle by id
+func (r *VehicleBolt) FindById(ctx context.Context, id int) (v internal.Vehicle, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	err = r.db.View(func(tx *bolt.Tx) (err error) {
+		v, err = boltGet(tx, id)
+		return
+	})
+	return
+}
+
+func (r *VehicleBolt) FindByColorYear(ctx context.Context, color string, year int) (v map[int]internal.Vehicle, err error) {
+	cc := &cancelCheck{ctx: ctx}
+	err = r.db.View(func(tx *bolt.Tx) (err error) {
+		colors, err := boltScan(cc, tx, boltBucketColor, boltStringValue(color), nil)
+		if err != nil {
+			return
+		}
+		years, err := boltScan(cc, tx, boltBucketYear, boltIntValue(year), nil)
+		if err != nil {
+			return
+		}
+		v, err = boltGetAll(cc, tx, boltIntersect(colors, years))
+		return
+	})
+	if err != nil {
+		v = nil
+	}
+	return
+}
+
+func (r *VehicleBolt) FindByBrandYearRange(ctx context.Context, brand string, startYear, endYear int) (v map[int]internal.Vehicle, err error) {
+	cc := &cancelCheck{ctx: ctx}
+	err = r.db.View(func(tx *bolt.Tx) (err error) {
+		brands, err := boltScan(cc, tx, boltBucketBrand, boltStringValue(brand), nil)
+		if err != nil {
+			return
+		}
+		years, err := boltScan(cc, tx, boltBucketYear, boltIntValue(startYear), boltIntValue(endYear))
+		if err != nil {
+			return
+		}
+		v, err = boltGetAll(cc, tx, boltIntersect(brands, years))
+		return
+	})
+	if err != nil {
+		v = nil
+	}
+	return
+}
+
+func (r *VehicleBolt) FindByBrandAverageSpeed(ctx context.Context, brand string) (avg float64, err error) {
+	avg, err = r.brandAverage(ctx, brand, func(v *internal.Vehicle) float64 { return v.MaxSpeed })
+	return
+}
+
+func (r *VehicleBolt) FindByFuelType(ctx context.Context, fuelType string) (v map[int]internal.Vehicle, err error) {
+	v, err = r.lookup(ctx, boltBucketFuelType, boltStringValue(fuelType))
+	return
+}
+
+func (r *VehicleBolt) FindByTransmissionType(ctx context.Context, transmissionType string) (v map[int]internal.Vehicle, err error) {
+	v, err = r.lookup(ctx, boltBucketTransmission, boltStringValue(transmissionType))
+	return
+}
+
+func (r *VehicleBolt) FindByBrandAverageCapacity(ctx context.Context, brand string) (avg float64, err error) {
+	avg, err = r.brandAverage(ctx, brand, func(v *internal.Vehicle) float64 { return float64(v.Capacity) })
+	return
+}
+
+func (r *VehicleBolt) FindByWeightRange(ctx context.Context, minWeight, maxWeight float64) (v map[int]internal.Vehicle, err error) {
+	v, err = r.filter(ctx, func(vh *internal.Vehicle) bool {
+		return vh.Weight >= minWeight && vh.Weight <= maxWeight
+	})
+	return
+}
+
+func (r *VehicleBolt) FindByDimensionRange(ctx context.Context, minHeight, minWidth, maxHeight, maxWidth float64) (v map[int]internal.Vehicle, err error) {
+	v, err = r.filter(ctx, func(vh *internal.Vehicle) bool {
+		return vh.Height >= minHeight && vh.Width >= minWidth && vh.Height <= maxHeight && vh.Width <= maxWidth
+	})
+	return
+}
+
+// Save is a method that saves a vehicle
+// - the id must be positive, a vehicle with the same id is overwritten
+func (r *VehicleBolt) Save(ctx context.Context, v *internal.Vehicle) (err error) {
+	if v.Id <= 0 {
+		err = fmt.Errorf("%w: id must be positive", internal.ErrVehicleInvalidField)
+		return
+	}
+	vh := *v
+	err = r.db.Update(func(tx *bolt.Tx) (err error) {
+		err = boltSave(tx, &vh)
+		return
+	})
+	if err == nil {
+		v.Version = vh.Version
+	}
+	return
+}
+
+// Create is a method that saves a new vehicle, ErrVehicleExists if a vehicle with the same id exists
+func (r *VehicleBolt) Create(ctx context.Context, v *internal.Vehicle) (err error) {
+	if v.Id <= 0 {
+		err = fmt.Errorf("%w: id must be positive", internal.ErrVehicleInvalidField)
+		return
+	}
+	vh := *v
+	err = r.db.Update(func(tx *bolt.Tx) (err error) {
+		err = boltCreate(tx, &vh)
+		return
+	})
+	if err == nil {
+		v.Version = vh.Version
+	}
+	return
+}
+
+// SaveBatch is a method that saves the vehicles in order in a single transaction
+func (r *VehicleBolt) SaveBatch(ctx context.Context, v []internal.Vehicle) (err error) {
+	err = r.saveBatch(ctx, v, nil)
+	return
+}
+
+// Update is a method that overwrites a vehicle if its stored version is version
+func (r *VehicleBolt) Update(ctx context.Context, v *internal.Vehicle, version int) (err error) {
+	vh := *v
+	err = r.db.Update(func(tx *bolt.Tx) (err error) {
+		err = boltUpdate(tx, &vh, version)
+		return
+	})
+	if err == nil {
+		v.Version = vh.Version
+	}
+	return
+}
+
+// Delete is a method that deletes a vehicle and its index entries if its stored version is version
+func (r *VehicleBolt) Delete(ctx context.Context, id int, version int) (err error) {
+	err = r.db.Update(func(tx *bolt.Tx) (err error) {
+		if err = boltCheck(tx, id, version); err != nil {
+			return
+		}
+		err = boltRetire(tx, id, version)
+		return
+	})
+	return
+}
+
+// AppendHistory is a method that records an entry of the history of a vehicle
+// - the key is the id of the vehicle followed by the sequence of the bucket, so the entries of a vehicle are contiguous and ordered
+func (r *VehicleBolt) AppendHistory(ctx context.Context, e internal.VehicleHistoryEntry) (err error) {
+	err = r.db.Update(func(tx *bolt.Tx) (err error) {
+		err = boltAppendHistory(tx, e)
+		return
+	})
+	return
+}
+
+// SaveAudited is a method that saves a vehicle and records the entry of its history in a single transaction
+func (r *VehicleBolt) SaveAudited(ctx context.Context, v *internal.Vehicle, e internal.VehicleHistoryEntry) (err error) {
+	if v.Id <= 0 {
+		err = fmt.Errorf("%w: id must be positive", internal.ErrVehicleInvalidField)
+		return
+	}
+	vh := *v
+	err = r.db.Update(func(tx *bolt.Tx) (err error) {
+		if err = boltSave(tx, &vh); err != nil {
+			return
+		}
+		e.Version = vh.Version
+		err = boltAppendHistory(tx, e)
+		return
+	})
+	if err == nil {
+		v.Version = vh.Version
+	}
+	return
+}
+
+// CreateAudited is a method that saves a new vehicle and records the entry of its history in a single transaction
+func (r *VehicleBolt) CreateAudited(ctx context.Context, v *internal.Vehicle, e internal.VehicleHistoryEntry) (err error) {
+	if v.Id <= 0 {
+		err = fmt.Errorf("%w: id must be positive", internal.ErrVehicleInvalidField)
+		return
+	}
+	vh := *v
+	err = r.db.Update(func(tx *bolt.Tx) (err error) {
+		if err = boltCreate(tx, &vh); err != nil {
+			return
+		}
+		e.Version = vh.Version
+		err = boltAppendHistory(tx, e)
+		return
+	})
+	if err == nil {
+		v.Version = vh.Version
+	}
+	return
+}
+
+// SaveBatchAudited is a method that saves the vehicles in order and records the entries of their history in a single transaction
+func (r *VehicleBolt) SaveBatchAudited(ctx context.Context, v []internal.Vehicle, e []internal.VehicleHistoryEntry) (err error) {
+	if len(e) != len(v) {
+		err = fmt.Errorf("%w: %d vehicles and %d history entries", internal.ErrVehicleInvalidField, len(v), len(e))
+		return
+	}
+	err = r.saveBatch(ctx, v, e)
+	return
+}
+
+// saveBatch is a method that saves the vehicles in order and records e[i], the entry of v[i], in a single transaction
+// - e is nil for a batch without history
+func (r *VehicleBolt) saveBatch(ctx context.Context, v []internal.Vehicle, e []internal.VehicleHistoryEntry) (err error) {
+	for i := range v {
+		if v[i].Id <= 0 {
+			err = fmt.Errorf("%w: id must be positive", internal.ErrVehicleInvalidField)
+			return
+		}
+	}
+	b := append([]internal.Vehicle(nil), v...)
+	err = r.db.Update(func(tx *bolt.Tx) (err error) {
+		cc := cancelCheck{ctx: ctx}
+		for i := range b {
+			if err = cc.step(); err != nil {
+				return
+			}
+			if err = boltSave(tx, &b[i]); err != nil {
+				return
+			}
+			if e == nil {
+				continue
+			}
+			entry := e[i]
+			entry.Version = b[i].Version
+			if err = boltAppendHistory(tx, entry); err != nil {
+				return
+			}
+		}
+		return
+	})
+	if err == nil {
+		copy(v, b)
+	}
+	return
+}
+
+// UpdateAudited is a method that overwrites a vehicle if its stored version is version
+// and records the entry of its history in a single transaction
+func (r *VehicleBolt) UpdateAudited(ctx context.Context, v *internal.Vehicle, version int, e internal.VehicleHistoryEntry) (err error) {
+	vh := *v
+	err = r.db.Update(func(tx *bolt.Tx) (err error) {
+		if err = boltUpdate(tx, &vh, version); err != nil {
+			return
+		}
+		e.Version = vh.Version
+		err = boltAppendHistory(tx, e)
+		return
+	})
+	if err == nil {
+		v.Version = vh.Version
+	}
+	return
+}
+
+// DeleteAudited is a method that deletes a vehicle if its stored version is version
+// and records the entry of its history in a single transaction
+func (r *VehicleBolt) DeleteAudited(ctx context.Context, id int, version int, e internal.VehicleHistoryEntry) (err error) {
+	err = r.db.Update(func(tx *bolt.Tx) (err error) {
+		if err = boltCheck(tx, id, version); err != nil {
+			return
+		}
+		if err = boltRetire(tx, id, version); err != nil {
+			return
+		}
+		e.Version = version
+		err = boltAppendHistory(tx, e)
+		return
+	})
+	return
+}
+
+// FindHistory is a method that returns the history of a vehicle, oldest first
+func (r *VehicleBolt) FindHistory(ctx context.Context, id int) (h []internal.VehicleHistoryEntry, err error) {
+	h = make([]internal.VehicleHistoryEntry, 0)
+	prefix := boltID(id)
+	cc := cancelCheck{ctx: ctx}
+	err = r.db.View(func(tx *bolt.Tx) (err error) {
+		c := tx.Bucket(boltBucketHistory).Cursor()
+		for k, value := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, value = c.Next() {
+			if err = cc.step(); err != nil {
+				return
+			}
+			var e internal.VehicleHistoryEntry
+			if err = json.Unmarshal(value, &e); err != nil {
+				return
+			}
+			h = append(h, e)
+		}
+		return
+	})
+	return
+}
+
+// FindHistorySince is a method that returns the entries of every vehicle recorded after t
+func (r *VehicleBolt) FindHistorySince(ctx context.Context, t time.Time) (h []internal.VehicleHistoryEntry, err error) {
+	h = make([]internal.VehicleHistoryEntry, 0)
+	cc := cancelCheck{ctx: ctx}
+	err = r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucketHistory).ForEach(func(_, value []byte) (err error) {
+			if err = cc.step(); err != nil {
+				return
+			}
+			var e internal.VehicleHistoryEntry
+			if err = json.Unmarshal(value, &e); err != nil {
+				return
+			}
+			if e.Timestamp.After(t) {
+				h = append(h, e)
+			}
+			return
+		})
+	})
+	return
+}
+
+// lookup is a method that returns the vehicles with a value of an index bucket
+func (r *VehicleBolt) lookup(ctx context.Context, bucket, value []byte) (v map[int]internal.Vehicle, err error) {
+	cc := &cancelCheck{ctx: ctx}
+	err = r.db.View(func(tx *bolt.Tx) (err error) {
+		ids, err := boltScan(cc, tx, bucket, value, nil)
+		if err != nil {
+			return
+		}
+		v, err = boltGetAll(cc, tx, ids)
+		return
+	})
+	if err != nil {
+		v = nil
+	}
+	return
+}
+
+// brandAverage is a method that returns the average of a value of the vehicles of a brand, 0 if there are none
+func (r *VehicleBolt) brandAverage(ctx context.Context, brand string, value func(v *internal.Vehicle) float64) (avg float64, err error) {
+	v, err := r.lookup(ctx, boltBucketBrand, boltStringValue(brand))
+	if err != nil || len(v) == 0 {
+		return
+	}
+	var total float64
+	for _, vh := range v {
+		total += value(&vh)
+	}
+	avg = total / float64(len(v))
+	return
+}
+
+// filter is a method that returns the vehicles that match a predicate with a full scan
+func (r *VehicleBolt) filter(ctx context.Context, match func(v *internal.Vehicle) bool) (v map[int]internal.Vehicle, err error) {
+	v = make(map[int]internal.Vehicle)
+	cc := cancelCheck{ctx: ctx}
+	err = r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucketVehicles).ForEach(func(_, value []byte) (err error) {
+			if err = cc.step(); err != nil {
+				return
+			}
+			vh, err := boltDecode(value)
+			if err != nil {
+				return
+			}
+			if match(&vh) {
+				v[vh.Id] = vh
+			}
+			return
+		})
+	})
+	if err != nil {
+		v = nil
+	}
+	return
+}
+
+// boltDecode is a function that decodes a stored vehicle
+// - vehicles stored before versions were introduced are at their first version
+func boltDecode(value []byte) (v internal.Vehicle, err error) {
+	if err = json.Unmarshal(value, &v); err != nil {
+		return
+	}
+	v.Version = max(v.Version, 1)
+	return
+}
+
+// boltGet is a function that returns a vehicle by id, ErrVehicleNotFound if it does not exist
+func boltGet(tx *bolt.Tx, id int) (v internal.Vehicle, err error) {
+	value := tx.Bucket(boltBucketVehicles).Get(boltID(id))
+	if value == nil {
+		err = internal.ErrVehicleNotFound
+		return
+	}
+	v, err = boltDecode(value)
+	return
+}
+
+// boltSave is a function that saves a vehicle in tx, a vehicle with the same id is overwritten
+// - v.Version is set to the new version
+func boltSave(tx *bolt.Tx, v *internal.Vehicle) (err error) {
+	current, err := boltGet(tx, v.Id)
+	switch {
+	case errors.Is(err, internal.ErrVehicleNotFound):
+		v.Version = boltTombstone(tx, v.Id) + 1
+		err = boltPut(tx, v)
+	case err == nil:
+		v.Version = current.Version + 1
+		err = boltPut(tx, v)
+	}
+	return
+}
+
+// boltCreate is a function that saves a new vehicle in tx, ErrVehicleExists if a vehicle with the same id exists
+// - v.Version is set to the new version
+func boltCreate(tx *bolt.Tx, v *internal.Vehicle) (err error) {
+	if tx.Bucket(boltBucketVehicles).Get(boltID(v.Id)) != nil {
+		err = internal.ErrVehicleExists
+		return
+	}
+	v.Version = boltTombstone(tx, v.Id) + 1
+	err = boltPut(tx, v)
+	return
+}
+
+// boltTombstone is a function that returns the last version of a deleted vehicle, 0 if the id has no tombstone
+func boltTombstone(tx *bolt.Tx, id int) int {
+	value := tx.Bucket(boltBucketTombstones).Get(boltID(id))
+	if len(value) != 8 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(value))
+}
+
+// boltRetire is a function that removes a vehicle deleted at the version and keeps the version as its tombstone
+func boltRetire(tx *bolt.Tx, id int, version int) (err error) {
+	if err = boltDelete(tx, id); err != nil {
+		return
+	}
+	err = tx.Bucket(boltBucketTombstones).Put(boltID(id), binary.BigEndian.AppendUint64(nil, uint64(version)))
+	return
+}
+
+// boltRestoreTombstones is a function that keeps as tombstones the last versions in the history of the vehicles that do not exist
+func boltRestoreTombstones(tx *bolt.Tx) (err error) {
+	vehicles, tombstones := tx.Bucket(boltBucketVehicles), tx.Bucket(boltBucketTombstones)
+	err = tx.Bucket(boltBucketHistory).ForEach(func(_, value []byte) (err error) {
+		var e internal.VehicleHistoryEntry
+		if err = json.Unmarshal(value, &e); err != nil {
+			return
+		}
+		key := boltID(e.VehicleId)
+		if vehicles.Get(key) != nil || e.Version <= boltTombstone(tx, e.VehicleId) {
+			return
+		}
+		err = tombstones.Put(key, binary.BigEndian.AppendUint64(nil, uint64(e.Version)))
+		return
+	})
+	return
+}
+
+// boltUpdate is a function that overwrites a vehicle in tx if its stored version is version
+// - v.Version is set to the new version
+func boltUpdate(tx *bolt.Tx, v *internal.Vehicle, version int) (err error) {
+	if err = boltCheck(tx, v.Id, version); err != nil {
+		return
+	}
+	v.Version = version + 1
+	err = boltPut(tx, v)
+	return
+}
+
+// boltAppendHistory is a function that records an entry of the history of a vehicle in tx
+func boltAppendHistory(tx *bolt.Tx, e internal.VehicleHistoryEntry) (err error) {
+	value, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	history := tx.Bucket(boltBucketHistory)
+	seq, err := history.NextSequence()
+	if err != nil {
+		return
+	}
+	key := binary.BigEndian.AppendUint64(boltID(e.VehicleId), seq)
+	err = history.Put(key, value)
+	return
+}
+
+// boltCheck is a function that returns an error unless the vehicle exists at the version
+func boltCheck(tx *bolt.Tx, id int, version int) (err error) {
+	current, err := boltGet(tx, id)
+	if err == nil && current.Version != version {
+		err = fmt.Errorf("%w: expected %d, stored %d", internal.ErrVehicleVersionMismatch, version, current.Version)
+	}
+	return
+}
+
+// boltDelete is a function that removes a vehicle and its index entries
+func boltDelete(tx *bolt.Tx, id int) (err error) {
+	vehicles := tx.Bucket(boltBucketVehicles)
+	key := boltID(id)
+
+	previous := vehicles.Get(key)
+	if previous == nil {
+		return
+	}
+	old, err := boltDecode(previous)
+	if err != nil {
+		return
+	}
+	for _, index := range boltIndexes {
+		if err = tx.Bucket(index.bucket).Delete(append(index.value(&old), key...)); err != nil {
+			return
+		}
+	}
+	err = vehicles.Delete(key)
+	return
+}
+
+// boltPut is a function that writes a vehicle and replaces its index entries
+func boltPut(tx *bolt.Tx, v *internal.Vehicle) (err error) {
+	// remove the previous version with its index entries
+	if err = boltDelete(tx, v.Id); err != nil {
+		return
+	}
+
+	// write the vehicle and its index entries
+	vehicles := tx.Bucket(boltBucketVehicles)
+	key := boltID(v.Id)
+	value, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	if err = vehicles.Put(key, value); err != nil {
+		return
+	}
+	if err = tx.Bucket(boltBucketTombstones).Delete(key); err != nil {
+		return
+	}
+	for _, index := range boltIndexes {
+		if err = tx.Bucket(index.bucket).Put(append(index.value(v), key...), nil); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// boltScan is a function that returns the ids of an index bucket with values between from and to (inclusive)
+// - if to is nil only the ids with value equal to from are returned
+// - the scan stops with the error of the context of cc once it is done
+func boltScan(cc *cancelCheck, tx *bolt.Tx, bucket, from, to []byte) (ids map[string]struct{}, err error) {
+	if to == nil {
+		to = from
+	}
+	ids = make(map[string]struct{})
+	c := tx.Bucket(bucket).Cursor()
+	for k, _ := c.Seek(from); k != nil && len(k) > 8; k, _ = c.Next() {
+		value, id := k[:len(k)-8], k[len(k)-8:]
+		if bytes.Compare(value, to) > 0 {
+			break
+		}
+		if err = cc.step(); err != nil {
+			ids = nil
+			return
+		}
+		ids[string(id)] = struct{}{}
+	}
+	return
+}
+
+// boltIntersect is a function that returns the ids present in both sets
+func boltIntersect(a, b map[string]struct{}) (ids map[string]struct{}) {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	ids = make(map[string]struct{}, len(a))
+	for id := range a {
+		if _, ok := b[id]; ok {
+			ids[id] = struct{}{}
+		}
+	}
+	return
+}
+
+// boltGetAll is a function that returns the vehicles with the given ids
+// - the lookups stop with the error of the context of cc once it is done
+func boltGetAll(cc *cancelCheck, tx *bolt.Tx, ids map[string]struct{}) (v map[int]internal.Vehicle, err error) {
+	v = make(map[int]internal.Vehicle, len(ids))
+	vehicles := tx.Bucket(boltBucketVehicles)
+	for id := range ids {
+		if err = cc.step(); err != nil {
+			return
+		}
+		value := vehicles.Get([]byte(id))
+		if value == nil {
+			continue
+		}
+		var vh internal.Vehicle
+		if vh, err = boltDecode(value); err != nil {
+			return
+		}
+		v[vh.Id] = vh
+	}
+	return
+}
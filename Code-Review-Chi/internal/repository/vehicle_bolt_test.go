@@ -0,0 +1,38 @@
+package repository_test
+
+import (
+	"app/internal"
+	"app/internal/repository"
+	"app/internal/repository/repositorytest"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Tests for the reads of VehicleBolt
+func TestVehicleBolt_Read(t *testing.T) {
+	t.Run("case 1: should fail every lookup and history read with the error of a canceled context", func(t *testing.T) {
+		// arrange
+		rp, err := repository.OpenVehicleBolt(filepath.Join(t.TempDir(), "vehicles.bolt"))
+		require.NoError(t, err)
+		closeOnCleanup(t, rp)
+		require.NoError(t, rp.Import(context.Background(), repositorytest.Fixture()))
+		require.NoError(t, rp.AppendHistory(context.Background(), internal.VehicleHistoryEntry{VehicleId: 1, Version: 1, Operation: internal.VehicleOperationCreate}))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// act
+		_, errId := rp.FindById(ctx, 1)
+		_, errSpeed := rp.FindByBrandAverageSpeed(ctx, "Toyota")
+		_, errCapacity := rp.FindByBrandAverageCapacity(ctx, "Toyota")
+		_, errHistory := rp.FindHistory(ctx, 1)
+
+		// assert
+		require.ErrorIs(t, errId, context.Canceled)
+		require.ErrorIs(t, errSpeed, context.Canceled)
+		require.ErrorIs(t, errCapacity, context.Canceled)
+		require.ErrorIs(t, errHistory, context.Canceled)
+	})
+}
@@ -0,0 +1,109 @@
+package repository_test
+
+import (
+	"app/internal"
+	"app/internal/repository"
+	"app/internal/repository/repositorytest"
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// seed is a struct that implements the VehicleLoader interface with the given vehicles
+type seed map[int]internal.Vehicle
+
+// Load is a method that returns a copy of the vehicles
+func (s seed) Load() (v map[int]internal.Vehicle, err error) {
+	v = make(map[int]internal.Vehicle, len(s))
+	for key, value := range s {
+		v[key] = value
+	}
+	return
+}
+
+// closeOnCleanup is a function that closes the repository when the test finishes if it is closable
+func closeOnCleanup(t *testing.T, rp internal.VehicleRepository) {
+	if closer, ok := rp.(io.Closer); ok {
+		t.Cleanup(func() { closer.Close() })
+	}
+}
+
+// Tests for the VehicleRepository contract
+func TestVehicleMap_Contract(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T, db map[int]internal.Vehicle) internal.VehicleRepository {
+		v, _ := seed(db).Load()
+		return repository.NewVehicleMap(v)
+	})
+}
+
+func TestVehicleMapColumnar_Contract(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T, db map[int]internal.Vehicle) internal.VehicleRepository {
+		v, _ := seed(db).Load()
+		return repository.NewVehicleMapColumnar(v)
+	})
+}
+
+func TestVehicleMapFile_Contract(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T, db map[int]internal.Vehicle) internal.VehicleRepository {
+		rp, err := repository.OpenVehicleMapFile(filepath.Join(t.TempDir(), "vehicles.json"), seed(db))
+		require.NoError(t, err)
+		closeOnCleanup(t, rp)
+		return rp
+	})
+}
+
+func TestVehicleMapWAL_Contract(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T, db map[int]internal.Vehicle) internal.VehicleRepository {
+		v, _ := seed(db).Load()
+		rp, err := repository.OpenVehicleMapWAL(v, &repository.ConfigVehicleMapWAL{Dir: t.TempDir(), SnapshotEvery: 2})
+		require.NoError(t, err)
+		closeOnCleanup(t, rp)
+		return rp
+	})
+}
+
+func TestVehicleSQLite_Contract(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T, db map[int]internal.Vehicle) internal.VehicleRepository {
+		rp, err := repository.OpenVehicleSQLite(filepath.Join(t.TempDir(), "vehicles.db"))
+		require.NoError(t, err)
+		closeOnCleanup(t, rp)
+		require.NoError(t, rp.Import(context.Background(), db))
+		return rp
+	})
+}
+
+func TestVehicleBolt_Contract(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T, db map[int]internal.Vehicle) internal.VehicleRepository {
+		rp, err := repository.OpenVehicleBolt(filepath.Join(t.TempDir(), "vehicles.bolt"))
+		require.NoError(t, err)
+		closeOnCleanup(t, rp)
+		require.NoError(t, rp.Import(context.Background(), db))
+		return rp
+	})
+}
+
+func TestOpen_Contract(t *testing.T) {
+	for _, driver := range []struct {
+		name string
+		dsn  func(dir string) string
+	}{
+		{name: "memory", dsn: func(dir string) string { return "memory://" }},
+		{name: "memory columnar", dsn: func(dir string) string { return "memory://?columnar=true" }},
+		{name: "jsonfile", dsn: func(dir string) string { return "jsonfile://" + dir + "/vehicles.json.gz" }},
+		{name: "wal", dsn: func(dir string) string { return "wal://" + dir + "/wal" }},
+		{name: "sqlite", dsn: func(dir string) string { return "sqlite://" + dir + "/vehicles.db" }},
+		{name: "bolt", dsn: func(dir string) string { return "bolt://" + dir + "/vehicles.bolt" }},
+	} {
+		t.Run(driver.name, func(t *testing.T) {
+			repositorytest.Run(t, func(t *testing.T, db map[int]internal.Vehicle) internal.VehicleRepository {
+				rp, err := repository.Open(driver.dsn(t.TempDir()), seed(db))
+				require.NoError(t, err)
+				closeOnCleanup(t, rp)
+				return rp
+			})
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"app/internal"
+	"context"
+	"fmt"
+	"sync"
+)
+
+// NewVehicleEventLog is a function that returns a new instance of VehicleEventLog kept in memory
+func NewVehicleEventLog() *VehicleEventLog {
+	return &VehicleEventLog{
+		streams: make(map[int][]int),
+	}
+}
+
+// OpenVehicleEventLog is a function that opens (or creates) the event log at path, one JSON event per line
+// - the events are kept in memory as well, a truncated last event (e.g. a torn write) is discarded
+func OpenVehicleEventLog(path string) (s *VehicleEventLog, err error) {
+	file, events, err := openJSONLog[internal.VehicleEvent](path)
+	if err != nil {
+		return
+	}
+	s = NewVehicleEventLog()
+	for _, e := range events {
+		s.add(e)
+	}
+	s.file = file
+	return
+}
+
+// VehicleEventLog is a struct that implements the VehicleEventStore interface
+// - the events are appended to a slice and, when opened from a path, to an append-only file fsynced on every event
+type VehicleEventLog struct {
+	// mu guards the events and the file
+	mu sync.RWMutex
+	// events are the events in the order they were appended
+	events []internal.VehicleEvent
+	// streams are the positions in events of the events of each vehicle
+	streams map[int][]int
+	// file is the file of the events, nil in memory
+	file *jsonLog[internal.VehicleEvent]
+}
+
+// Close is a method that closes the file of the events, if any
+func (s *VehicleEventLog) Close() (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil {
+		err = s.file.Close()
+	}
+	return
+}
+
+// Append is a method that appends an event, setting its sequence
+func (s *VehicleEventLog) Append(ctx context.Context, e *internal.VehicleEvent) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err = internal.CheckVehicleEvent(s.last(e.VehicleId), *e); err != nil {
+		return
+	}
+	e.Sequence = int64(len(s.events)) + 1
+	if s.file != nil {
+		if err = s.file.append(*e); err != nil {
+			return
+		}
+	}
+	s.add(*e)
+	return
+}
+
+// AppendBatch is a method that appends the events in order, setting their sequences, every event or none
+func (s *VehicleEventLog) AppendBatch(ctx context.Context, events []internal.VehicleEvent) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// - check every event before appending any, the last event of a vehicle may be one of the batch
+	b := append([]internal.VehicleEvent(nil), events...)
+	last := make(map[int]internal.VehicleEvent, len(b))
+	for i := range b {
+		previous, ok := last[b[i].VehicleId]
+		if !ok {
+			previous = s.last(b[i].VehicleId)
+		}
+		if err = internal.CheckVehicleEvent(previous, b[i]); err != nil {
+			err = fmt.Errorf("event %d of the batch: %w", i+1, err)
+			return
+		}
+		b[i].Sequence = int64(len(s.events) + i + 1)
+		last[b[i].VehicleId] = b[i]
+	}
+	if s.file != nil {
+		if err = s.file.appendBatch(b); err != nil {
+			return
+		}
+	}
+	for _, e := range b {
+		s.add(e)
+	}
+	copy(events, b)
+	return
+}
+
+// FindEvents is a method that returns the events of a vehicle in the order they were appended
+func (s *VehicleEventLog) FindEvents(ctx context.Context, id int) (events []internal.VehicleEvent, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events = make([]internal.VehicleEvent, 0, len(s.streams[id]))
+	for _, i := range s.streams[id] {
+		events = append(events, s.events[i])
+	}
+	return
+}
+
+// FindAllEvents is a method that returns every event in the order they were appended
+func (s *VehicleEventLog) FindAllEvents(ctx context.Context) (events []internal.VehicleEvent, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events = append(make([]internal.VehicleEvent, 0, len(s.events)), s.events...)
+	return
+}
+
+// last is a method that returns the last event of a vehicle, the zero event if it has none
+func (s *VehicleEventLog) last(id int) (e internal.VehicleEvent) {
+	if stream := s.streams[id]; len(stream) > 0 {
+		e = s.events[stream[len(stream)-1]]
+	}
+	return
+}
+
+// add is a method that indexes an event
+func (s *VehicleEventLog) add(e internal.VehicleEvent) {
+	s.streams[e.VehicleId] = append(s.streams[e.VehicleId], len(s.events))
+	s.events = append(s.events, e)
+}
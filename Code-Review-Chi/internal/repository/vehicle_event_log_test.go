@@ -0,0 +1,202 @@
+package repository_test
+
+import (
+	"app/internal"
+	"app/internal/repository"
+	"app/internal/repository/repositorytest"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fleetEvents is a function that returns the events of a vehicle registered, changed twice and retired,
+// and of a vehicle registered again after being retired, continuing from its retired version
+func fleetEvents() []internal.VehicleEvent {
+	fixture := repositorytest.Fixture()
+	timestamp := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	changed := fixture[1].VehicleAttributes
+	changed.Color, changed.Weight = "Green", 1250.5
+	return []internal.VehicleEvent{
+		{VehicleId: 1, Version: 1, Type: internal.VehicleRegistered, Timestamp: timestamp, Actor: "alice", Changes: internal.DiffVehicleAttributes(internal.VehicleAttributes{}, fixture[1].VehicleAttributes)},
+		{VehicleId: 2, Version: 1, Type: internal.VehicleRegistered, Timestamp: timestamp, Actor: "alice", Changes: internal.DiffVehicleAttributes(internal.VehicleAttributes{}, fixture[2].VehicleAttributes)},
+		{VehicleId: 1, Version: 2, Type: internal.VehicleAttributesChanged, Timestamp: timestamp.Add(time.Hour), Actor: "bob", Changes: internal.DiffVehicleAttributes(fixture[1].VehicleAttributes, changed)},
+		{VehicleId: 2, Version: 1, Type: internal.VehicleRetired, Timestamp: timestamp.Add(2 * time.Hour), Actor: "carol", Changes: internal.DiffVehicleAttributes(fixture[2].VehicleAttributes, internal.VehicleAttributes{})},
+		{VehicleId: 2, Version: 2, Type: internal.VehicleRegistered, Timestamp: timestamp.Add(3 * time.Hour), Actor: "carol", Changes: internal.DiffVehicleAttributes(internal.VehicleAttributes{}, fixture[3].VehicleAttributes)},
+	}
+}
+
+// Tests for VehicleEventLog
+func TestVehicleEventLog_Append(t *testing.T) {
+	t.Run("case 1: should append the events in order, setting their sequence", func(t *testing.T) {
+		// arrange
+		es := repository.NewVehicleEventLog()
+		events := fleetEvents()
+
+		// act
+		for i := range events {
+			require.NoError(t, es.Append(context.Background(), &events[i]))
+		}
+		all, err := es.FindAllEvents(context.Background())
+		require.NoError(t, err)
+		stream, err := es.FindEvents(context.Background(), 2)
+		require.NoError(t, err)
+
+		// assert
+		require.Equal(t, events, all)
+		require.Equal(t, []int64{1, 2, 3, 4, 5}, []int64{all[0].Sequence, all[1].Sequence, all[2].Sequence, all[3].Sequence, all[4].Sequence})
+		require.Equal(t, []internal.VehicleEvent{events[1], events[3], events[4]}, stream)
+	})
+
+	t.Run("case 2: should reject events that do not follow the current version of the vehicle", func(t *testing.T) {
+		// arrange
+		es := repository.NewVehicleEventLog()
+		events := fleetEvents()
+		require.NoError(t, es.Append(context.Background(), &events[0]))
+
+		// act
+		errRegistered := es.Append(context.Background(), &internal.VehicleEvent{VehicleId: 1, Version: 1, Type: internal.VehicleRegistered})
+		errStale := es.Append(context.Background(), &internal.VehicleEvent{VehicleId: 1, Version: 3, Type: internal.VehicleAttributesChanged})
+		errMissing := es.Append(context.Background(), &internal.VehicleEvent{VehicleId: 9, Version: 1, Type: internal.VehicleRetired})
+		errUnknown := es.Append(context.Background(), &internal.VehicleEvent{VehicleId: 1, Version: 2, Type: "VehiclePainted"})
+		all, err := es.FindAllEvents(context.Background())
+		require.NoError(t, err)
+
+		// assert
+		require.ErrorIs(t, errRegistered, internal.ErrVehicleExists)
+		require.ErrorIs(t, errStale, internal.ErrVehicleVersionMismatch)
+		require.ErrorIs(t, errMissing, internal.ErrVehicleNotFound)
+		require.ErrorIs(t, errUnknown, internal.ErrVehicleEventUnknown)
+		require.Len(t, all, 1)
+	})
+
+	t.Run("case 3: should reject registering a retired vehicle again with a version it already had", func(t *testing.T) {
+		// arrange
+		es := repository.NewVehicleEventLog()
+		events := fleetEvents()
+		for _, i := range []int{1, 3} {
+			require.NoError(t, es.Append(context.Background(), &events[i]))
+		}
+
+		// act
+		errReused := es.Append(context.Background(), &internal.VehicleEvent{VehicleId: 2, Version: 1, Type: internal.VehicleRegistered})
+		errNext := es.Append(context.Background(), &internal.VehicleEvent{VehicleId: 2, Version: 2, Type: internal.VehicleRegistered})
+
+		// assert
+		require.ErrorIs(t, errReused, internal.ErrVehicleVersionMismatch)
+		require.NoError(t, errNext)
+	})
+}
+
+func TestVehicleEventLog_AppendBatch(t *testing.T) {
+	t.Run("case 1: should append the events of a batch in order, checking each against the earlier ones", func(t *testing.T) {
+		// arrange
+		es := repository.NewVehicleEventLog()
+		events := fleetEvents()
+
+		// act
+		err := es.AppendBatch(context.Background(), events)
+		all, errFind := es.FindAllEvents(context.Background())
+
+		// assert
+		require.NoError(t, err)
+		require.NoError(t, errFind)
+		require.Equal(t, events, all)
+		require.Equal(t, int64(5), events[4].Sequence)
+	})
+
+	t.Run("case 2: should append none of the events of a batch if one of them is rejected", func(t *testing.T) {
+		// arrange
+		es := repository.NewVehicleEventLog()
+		events := fleetEvents()
+		events[2].Version = 3
+
+		// act
+		err := es.AppendBatch(context.Background(), events)
+		all, errFind := es.FindAllEvents(context.Background())
+
+		// assert
+		require.ErrorIs(t, err, internal.ErrVehicleVersionMismatch)
+		require.NoError(t, errFind)
+		require.Empty(t, all)
+		require.Zero(t, events[0].Sequence)
+	})
+
+	t.Run("case 3: should keep a batch across reopens and discard a torn batch as a whole", func(t *testing.T) {
+		// arrange
+		path := filepath.Join(t.TempDir(), "vehicles.events.jsonl")
+		es, err := repository.OpenVehicleEventLog(path)
+		require.NoError(t, err)
+		events := fleetEvents()
+		require.NoError(t, es.AppendBatch(context.Background(), events[:3]))
+		require.NoError(t, es.Close())
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+		require.NoError(t, err)
+		_, err = file.WriteString(`[{"sequence":4,"vehicle_id":2,"version":1,"type":"VehicleRetired"},{"sequence":5,`)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		// act
+		es, err = repository.OpenVehicleEventLog(path)
+		require.NoError(t, err)
+		defer es.Close()
+		all, err := es.FindAllEvents(context.Background())
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, events[:3], all)
+	})
+}
+
+func TestOpenVehicleEventLog(t *testing.T) {
+	t.Run("case 1: should keep the events across reopens and discard a torn last event", func(t *testing.T) {
+		// arrange
+		path := filepath.Join(t.TempDir(), "vehicles.events.jsonl")
+		es, err := repository.OpenVehicleEventLog(path)
+		require.NoError(t, err)
+		events := fleetEvents()
+		for i := range events {
+			require.NoError(t, es.Append(context.Background(), &events[i]))
+		}
+		require.NoError(t, es.Close())
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+		require.NoError(t, err)
+		_, err = file.WriteString(`{"sequence":6,"vehicle_id":`)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		// act
+		es, err = repository.OpenVehicleEventLog(path)
+		require.NoError(t, err)
+		defer es.Close()
+		all, err := es.FindAllEvents(context.Background())
+		require.NoError(t, err)
+		next := internal.VehicleEvent{VehicleId: 1, Version: 3, Type: internal.VehicleAttributesChanged}
+		errNext := es.Append(context.Background(), &next)
+
+		// assert
+		require.Equal(t, events, all)
+		require.NoError(t, errNext)
+		require.Equal(t, int64(6), next.Sequence)
+	})
+}
+
+func TestReplayVehicleEvents(t *testing.T) {
+	t.Run("case 1: should rebuild the vehicles and their versions exactly", func(t *testing.T) {
+		// arrange
+		fixture := repositorytest.Fixture()
+		expected1 := fixture[1]
+		expected1.Color, expected1.Weight, expected1.Version = "Green", 1250.5, 2
+		expected2 := fixture[3]
+		expected2.Id, expected2.Version = 2, 2
+
+		// act
+		v := internal.ReplayVehicleEvents(fleetEvents())
+
+		// assert
+		require.Equal(t, map[int]internal.Vehicle{1: expected1, 2: expected2}, v)
+	})
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"app/internal"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrLogBroken is returned by the appends to a log that could not be restored after a failed write
+// - the log may end with a torn line, appends are refused until it is reopened (which discards the line)
+var ErrLogBroken = errors.New("repository: log broken")
+
+// jsonLog is a struct that represents an append-only file of records, one JSON object per line
+// - a batch of records is a single line with a JSON array, so a torn batch is discarded as a whole
+type jsonLog[T any] struct {
+	// file is the file of the records
+	file *os.File
+	// offset is the size of the valid lines of the file, where the next line is written
+	offset int64
+	// broken is the error that left a torn line in the file, nil while the file is consistent
+	broken error
+	// last is the offset of the last line read when the file was opened
+	last int64
+	// lastBatch is the number of records of the last line read when the file was opened if it is a batch, 0 otherwise
+	lastBatch int
+}
+
+// openJSONLog is a function that opens (or creates) the log at path and returns its records in the order they were appended
+// - a truncated or corrupted tail (e.g. a torn last write) is discarded
+func openJSONLog[T any](path string) (l *jsonLog[T], records []T, err error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return
+	}
+
+	// read the records up to the first incomplete or corrupted line
+	reader := bufio.NewReader(file)
+	var offset, last int64
+	var lastBatch int
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil {
+			break
+		}
+		var batch []T
+		isBatch := line[0] == '['
+		if isBatch {
+			if json.Unmarshal(line, &batch) != nil {
+				break
+			}
+		} else {
+			var record T
+			if json.Unmarshal(line, &record) != nil {
+				break
+			}
+			batch = append(batch, record)
+		}
+		records = append(records, batch...)
+		last, lastBatch = offset, 0
+		if isBatch {
+			lastBatch = len(batch)
+		}
+		offset += int64(len(line))
+	}
+
+	// discard the tail and append after the last valid record
+	if err = file.Truncate(offset); err != nil {
+		file.Close()
+		return
+	}
+	l = &jsonLog[T]{file: file, offset: offset, last: last, lastBatch: lastBatch}
+	return
+}
+
+// append is a method that writes a record and fsyncs it
+func (l *jsonLog[T]) append(record T) (err error) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	err = l.write(line)
+	return
+}
+
+// appendBatch is a method that writes the records as a single line and fsyncs it
+func (l *jsonLog[T]) appendBatch(records []T) (err error) {
+	line, err := json.Marshal(records)
+	if err != nil {
+		return
+	}
+	err = l.write(line)
+	return
+}
+
+// write is a method that writes a line and fsyncs it
+// - a failed write is truncated back to the previous line, the log is broken if it can not be
+func (l *jsonLog[T]) write(line []byte) (err error) {
+	if l.broken != nil {
+		err = fmt.Errorf("%w: %w", ErrLogBroken, l.broken)
+		return
+	}
+	line = append(line, '\n')
+	if _, err = l.file.WriteAt(line, l.offset); err == nil {
+		err = l.file.Sync()
+	}
+	if err != nil {
+		// - a torn line would hide every later line from the next open
+		if errTruncate := l.file.Truncate(l.offset); errTruncate != nil {
+			l.broken = err
+			err = fmt.Errorf("%w: %w", err, errTruncate)
+		}
+		return
+	}
+	l.offset += int64(len(line))
+	return
+}
+
+// truncate is a method that discards the lines written from offset on and fsyncs the file
+// - the log is broken if they can not be discarded
+func (l *jsonLog[T]) truncate(offset int64) (err error) {
+	if err = l.file.Truncate(offset); err == nil {
+		err = l.file.Sync()
+	}
+	if err != nil {
+		l.broken = err
+		return
+	}
+	l.offset = offset
+	return
+}
+
+// Close is a method that closes the file
+func (l *jsonLog[T]) Close() (err error) {
+	err = l.file.Close()
+	return
+}
+
+// historyLog is an append-only file of history entries
+type historyLog = jsonLog[internal.VehicleHistoryEntry]
+
+// openHistoryLog is a function that opens (or creates) the history log at path and returns its entries by vehicle
+func openHistoryLog(path string) (l *historyLog, h map[int][]internal.VehicleHistoryEntry, err error) {
+	l, entries, err := openJSONLog[internal.VehicleHistoryEntry](path)
+	if err != nil {
+		return
+	}
+	h = make(map[int][]internal.VehicleHistoryEntry)
+	for _, e := range entries {
+		h[e.VehicleId] = append(h[e.VehicleId], e)
+	}
+	return
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"app/internal"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Tests for the appends of jsonLog
+func TestJSONLog_Append(t *testing.T) {
+	entries := []internal.VehicleHistoryEntry{
+		{VehicleId: 1, Version: 1, Actor: "alice", Operation: internal.VehicleOperationCreate},
+		{VehicleId: 1, Version: 2, Actor: "bob", Operation: internal.VehicleOperationUpdate},
+		{VehicleId: 2, Version: 1, Actor: "bob", Operation: internal.VehicleOperationCreate},
+	}
+
+	t.Run("case 1: should refuse appends after a failed write that could not be truncated, until it is reopened", func(t *testing.T) {
+		// arrange
+		path := filepath.Join(t.TempDir(), "vehicles.history.jsonl")
+		l, _, err := openHistoryLog(path)
+		require.NoError(t, err)
+		require.NoError(t, l.append(entries[0]))
+		// - a file that can not be written nor truncated
+		file := l.file
+		l.file, err = os.Open(path)
+		require.NoError(t, err)
+
+		// act
+		errFailed := l.append(entries[1])
+		l.file.Close()
+		l.file = file
+		errBroken := l.appendBatch(entries[1:])
+		require.NoError(t, l.Close())
+		l, h, errOpen := openHistoryLog(path)
+		require.NoError(t, errOpen)
+		defer l.Close()
+		errHealed := l.append(entries[1])
+
+		// assert
+		require.Error(t, errFailed)
+		require.ErrorIs(t, errBroken, ErrLogBroken)
+		require.Equal(t, map[int][]internal.VehicleHistoryEntry{1: entries[:1]}, h)
+		require.NoError(t, errHealed)
+	})
+
+	t.Run("case 2: should write after the last valid line, over a torn tail left by a failed write", func(t *testing.T) {
+		// arrange
+		path := filepath.Join(t.TempDir(), "vehicles.history.jsonl")
+		l, _, err := openHistoryLog(path)
+		require.NoError(t, err)
+		require.NoError(t, l.append(entries[0]))
+		// - the bytes of a torn line after the valid ones
+		_, err = l.file.WriteAt([]byte(`{"vehicle_id":1,"version":2,"actor":"b`), l.offset)
+		require.NoError(t, err)
+
+		// act
+		errBatch := l.appendBatch(entries[1:])
+		require.NoError(t, l.Close())
+		l, h, errOpen := openHistoryLog(path)
+		require.NoError(t, errOpen)
+		defer l.Close()
+
+		// assert
+		require.NoError(t, errBatch)
+		require.Equal(t, map[int][]internal.VehicleHistoryEntry{1: entries[:2], 2: entries[2:]}, h)
+	})
+}
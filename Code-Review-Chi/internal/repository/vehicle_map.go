@@ -1,6 +1,34 @@
 package repository
 
-import "app/internal"
+import (
+	"app/internal"
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+func init() {
+	// memory://[?columnar=true] keeps the vehicles of the seed in memory, writes are lost on restart
+	Register("memory", DriverFunc(func(dsn *url.URL, seed internal.VehicleLoader) (rp internal.VehicleRepository, err error) {
+		columnar, err := dsnBoolOption(dsn, "columnar", false)
+		if err != nil {
+			return
+		}
+
+		db, err := loadSeed(seed)
+		if err != nil {
+			return
+		}
+		if columnar {
+			rp = NewVehicleMapColumnar(db)
+			return
+		}
+		rp = NewVehicleMap(db)
+		return
+	}))
+}
 
 // Constructor
 // NewVehicleMap is a function that returns a new instance of VehicleMap
@@ -10,64 +38,177 @@ func NewVehicleMap(db map[int]internal.Vehicle) *VehicleMap {
 	if db != nil {
 		defaultDb = db
 	}
-	return &VehicleMap{db: defaultDb}
+	// - vehicles loaded without a version are at their first version
+	for id, v := range defaultDb {
+		if v.Version <= 0 {
+			v.Version = 1
+			defaultDb[id] = v
+		}
+	}
+	return &VehicleMap{db: defaultDb, ix: newVehicleMapIndexes(defaultDb), history: make(map[int][]internal.VehicleHistoryEntry), tombstones: make(map[int]int)}
+}
+
+// NewVehicleMapColumnar is a function that returns a new instance of VehicleMap with a columnar store
+// - aggregates and range filters run over the columns with bitmap selection, trading memory for speed on large fleets
+// - narrow ranges are still cheaper on the sorted indexes, the columns pay off on aggregates and wide selections
+func NewVehicleMapColumnar(db map[int]internal.Vehicle) (r *VehicleMap) {
+	r = NewVehicleMap(db)
+	r.col = newVehicleColumns(r.db)
+	return
 }
 
 // Inyection of the db
 // VehicleMap is a struct that represents a vehicle repository
+// - the filters are served by secondary indexes maintained on every write:
+// hash indexes on brand, color, fuel type and transmission, sorted indexes on year, weight, height and width
+// - it is safe for concurrent use, the reads share the lock and the writes hold it alone
 type VehicleMap struct {
+	// mu guards the map, its indexes and the history
+	mu sync.RWMutex
 	// db is a map of vehicles
 	db map[int]internal.Vehicle
+	// ix are the secondary indexes of db
+	ix *vehicleMapIndexes
+	// col is the optional columnar copy of db, nil when disabled
+	col *vehicleColumns
+	// history are the history entries by vehicle, oldest first
+	history map[int][]internal.VehicleHistoryEntry
+	// tombstones are the last versions of the deleted vehicles by id, a new vehicle with the id continues from it
+	tombstones map[int]int
 }
 
 // FindAll is a method that returns a map of all vehicles
-func (r *VehicleMap) FindAll() (v map[int]internal.Vehicle, err error) {
-	v = make(map[int]internal.Vehicle)
+func (r *VehicleMap) FindAll(ctx context.Context) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	v = make(map[int]internal.Vehicle, len(r.db))
 
 	// copy db
+	cc := cancelCheck{ctx: ctx}
 	for key, value := range r.db {
+		if err = cc.step(); err != nil {
+			v = nil
+			return
+		}
 		v[key] = value
 	}
 
 	return
 }
 
-func (r *VehicleMap) FindByColorYear(color string, year int) (v map[int]internal.Vehicle, err error) {
+// FindById is a method that returns a vehicle by id
+func (r *VehicleMap) FindById(ctx context.Context, id int) (v internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	v, ok := r.db[id]
+	if !ok {
+		err = internal.ErrVehicleNotFound
+	}
+	return
+}
+
+func (r *VehicleMap) FindByColorYear(ctx context.Context, color string, year int) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.col != nil {
+		v, err = r.materialize(ctx, r.col.selection(r.col.color.equal(color), between(r.col.year, int64(year), int64(year))))
+		return
+	}
 	v = make(map[int]internal.Vehicle)
 
-	// copy db
-	for key, value := range r.db {
-		if value.Color == color && value.FabricationYear == year {
-			v[key] = value
+	// walk the smaller of both indexes and check the other attribute
+	ids := r.ix.color[color]
+	years := r.ix.year.between(float64(year), float64(year))
+	cc := cancelCheck{ctx: ctx}
+	if years.len() < len(ids) {
+		for _, block := range years {
+			for _, entry := range block {
+				if err = cc.step(); err != nil {
+					v = nil
+					return
+				}
+				if value := r.db[entry.id]; value.Color == color {
+					v[entry.id] = value
+				}
+			}
+		}
+		return
+	}
+	for id := range ids {
+		if err = cc.step(); err != nil {
+			v = nil
+			return
+		}
+		if value := r.db[id]; value.FabricationYear == year {
+			v[id] = value
 		}
 	}
 
 	return
 }
 
-func (r *VehicleMap) FindByBrandYearRange(brand string, startYear, endYear int) (v map[int]internal.Vehicle, err error) {
+func (r *VehicleMap) FindByBrandYearRange(ctx context.Context, brand string, startYear, endYear int) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.col != nil {
+		v, err = r.materialize(ctx, r.col.selection(r.col.brand.equal(brand), between(r.col.year, int64(startYear), int64(endYear))))
+		return
+	}
 	v = make(map[int]internal.Vehicle)
 
-	// copy db
-	for key, value := range r.db {
-		if value.Brand == brand && value.FabricationYear >= startYear && value.FabricationYear <= endYear {
-			v[key] = value
+	// walk the smaller of both indexes and check the other attribute
+	ids := r.ix.brand[brand]
+	years := r.ix.year.between(float64(startYear), float64(endYear))
+	cc := cancelCheck{ctx: ctx}
+	if years.len() < len(ids) {
+		for _, block := range years {
+			for _, entry := range block {
+				if err = cc.step(); err != nil {
+					v = nil
+					return
+				}
+				if value := r.db[entry.id]; value.Brand == brand {
+					v[entry.id] = value
+				}
+			}
+		}
+		return
+	}
+	for id := range ids {
+		if err = cc.step(); err != nil {
+			v = nil
+			return
+		}
+		if value := r.db[id]; value.FabricationYear >= startYear && value.FabricationYear <= endYear {
+			v[id] = value
 		}
 	}
 
 	return
 }
 
-func (r *VehicleMap) FindByBrandAverageSpeed(brand string) (avg float64, err error) {
+func (r *VehicleMap) FindByBrandAverageSpeed(ctx context.Context, brand string) (avg float64, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.col != nil {
+		sel := r.col.selection(r.col.brand.equal(brand))
+		if n := sel.count(); n > 0 {
+			avg = sumFloat(r.col.maxSpeed, sel) / float64(n)
+		}
+		return
+	}
+
 	var totalSpeed float64
 	var totalVehicles float64
 
-	// copy db
-	for _, value := range r.db {
-		if value.Brand == brand {
-			totalSpeed += value.MaxSpeed
-			totalVehicles++
+	// vehicles of the brand
+	cc := cancelCheck{ctx: ctx}
+	for id := range r.ix.brand[brand] {
+		if err = cc.step(); err != nil {
+			return
 		}
+		totalSpeed += r.db[id].MaxSpeed
+		totalVehicles++
 	}
 	if totalVehicles == 0 {
 		avg = 0
@@ -79,40 +220,42 @@ func (r *VehicleMap) FindByBrandAverageSpeed(brand string) (avg float64, err err
 	return
 }
 
-func (r *VehicleMap) FindByFuelType(fuelType string) (v map[int]internal.Vehicle, err error) {
-	v = make(map[int]internal.Vehicle)
-
-	// copy db
-	for key, value := range r.db {
-		if value.FuelType == fuelType {
-			v[key] = value
-		}
-	}
+func (r *VehicleMap) FindByFuelType(ctx context.Context, fuelType string) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	v, err = r.collect(ctx, r.ix.fuelType[fuelType])
 	return
 }
 
-func (r *VehicleMap) FindByTransmissionType(transmissionType string) (v map[int]internal.Vehicle, err error) {
-	v = make(map[int]internal.Vehicle)
+func (r *VehicleMap) FindByTransmissionType(ctx context.Context, transmissionType string) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	v, err = r.collect(ctx, r.ix.transmission[transmissionType])
+	return
+}
 
-	// copy db
-	for key, value := range r.db {
-		if value.Transmission == transmissionType {
-			v[key] = value
+func (r *VehicleMap) FindByBrandAverageCapacity(ctx context.Context, brand string) (avg float64, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.col != nil {
+		sel := r.col.selection(r.col.brand.equal(brand))
+		if n := sel.count(); n > 0 {
+			avg = sumInt(r.col.capacity, sel) / float64(n)
 		}
+		return
 	}
-	return
-}
 
-func (r *VehicleMap) FindByBrandAverageCapacity(brand string) (avg float64, err error) {
 	var totalCapacity float64
 	var totalVehicles float64
 
-	// copy db
-	for _, value := range r.db {
-		if value.Brand == brand {
-			totalCapacity += float64(value.Capacity)
-			totalVehicles++
+	// vehicles of the brand
+	cc := cancelCheck{ctx: ctx}
+	for id := range r.ix.brand[brand] {
+		if err = cc.step(); err != nil {
+			return
 		}
+		totalCapacity += float64(r.db[id].Capacity)
+		totalVehicles++
 	}
 	if totalVehicles == 0 {
 		avg = 0
@@ -124,32 +267,363 @@ func (r *VehicleMap) FindByBrandAverageCapacity(brand string) (avg float64, err
 	return
 }
 
-func (r *VehicleMap) FindByWeightRange(minWeight, maxWeight float64) (v map[int]internal.Vehicle, err error) {
-	v = make(map[int]internal.Vehicle)
+func (r *VehicleMap) FindByWeightRange(ctx context.Context, minWeight, maxWeight float64) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.col != nil {
+		v, err = r.materialize(ctx, r.col.selection(between(r.col.weight, minWeight, maxWeight)))
+		return
+	}
 
-	// copy db
-	for key, value := range r.db {
-		if value.Weight >= minWeight && value.Weight <= maxWeight {
-			v[key] = value
+	entries := r.ix.weight.between(minWeight, maxWeight)
+	v = make(map[int]internal.Vehicle, entries.len())
+
+	cc := cancelCheck{ctx: ctx}
+	for _, block := range entries {
+		for _, entry := range block {
+			if err = cc.step(); err != nil {
+				v = nil
+				return
+			}
+			v[entry.id] = r.db[entry.id]
 		}
 	}
 	return
 }
 
-func (r *VehicleMap) FindByDimensionRange(minHeight, minWidth, maxHeight, maxWidth float64) (v map[int]internal.Vehicle, err error) {
+func (r *VehicleMap) FindByDimensionRange(ctx context.Context, minHeight, minWidth, maxHeight, maxWidth float64) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.col != nil {
+		v, err = r.materialize(ctx, r.col.selection(between(r.col.height, minHeight, maxHeight), between(r.col.width, minWidth, maxWidth)))
+		return
+	}
 	v = make(map[int]internal.Vehicle)
 
-	// copy db
-	for key, value := range r.db {
-		if value.Height >= minHeight && value.Width >= minWidth && value.Height <= maxHeight && value.Width <= maxWidth {
-			v[key] = value
+	// walk the smaller of both ranges and check the other dimension
+	heights := r.ix.height.between(minHeight, maxHeight)
+	widths := r.ix.width.between(minWidth, maxWidth)
+	cc := cancelCheck{ctx: ctx}
+	if heights.len() < widths.len() {
+		for _, block := range heights {
+			for _, entry := range block {
+				if err = cc.step(); err != nil {
+					v = nil
+					return
+				}
+				if value := r.db[entry.id]; value.Width >= minWidth && value.Width <= maxWidth {
+					v[entry.id] = value
+				}
+			}
+		}
+		return
+	}
+	for _, block := range widths {
+		for _, entry := range block {
+			if err = cc.step(); err != nil {
+				v = nil
+				return
+			}
+			if value := r.db[entry.id]; value.Height >= minHeight && value.Height <= maxHeight {
+				v[entry.id] = value
+			}
 		}
 	}
 	return
 }
 
 // Save is a method that saves a vehicle
-func (r *VehicleMap) Save(v *internal.Vehicle) (err error) {
-	r.db[v.Id] = *v
+// - the id must be positive, a vehicle with the same id is overwritten
+func (r *VehicleMap) Save(ctx context.Context, v *internal.Vehicle) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if v.Id <= 0 {
+		err = fmt.Errorf("%w: id must be positive", internal.ErrVehicleInvalidField)
+		return
+	}
+	v.Version = r.next(v.Id)
+	r.put(*v)
+	return
+}
+
+// Create is a method that saves a new vehicle, ErrVehicleExists if a vehicle with the same id exists
+func (r *VehicleMap) Create(ctx context.Context, v *internal.Vehicle) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err = r.absent(v.Id); err != nil {
+		return
+	}
+	v.Version = r.next(v.Id)
+	r.put(*v)
+	return
+}
+
+// SaveBatch is a method that saves the vehicles in order, none if an id is not positive
+func (r *VehicleMap) SaveBatch(ctx context.Context, v []internal.Vehicle) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, err := r.batch(v)
+	if err != nil {
+		return
+	}
+	for i := range b {
+		r.put(b[i])
+		v[i].Version = b[i].Version
+	}
+	return
+}
+
+// Update is a method that overwrites a vehicle if its stored version is version
+func (r *VehicleMap) Update(ctx context.Context, v *internal.Vehicle, version int) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err = r.check(v.Id, version); err != nil {
+		return
+	}
+	v.Version = version + 1
+	r.put(*v)
+	return
+}
+
+// Delete is a method that deletes a vehicle if its stored version is version
+func (r *VehicleMap) Delete(ctx context.Context, id int, version int) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err = r.check(id, version); err != nil {
+		return
+	}
+	r.remove(id)
+	r.tombstones[id] = version
+	return
+}
+
+// Replace is a method that replaces every vehicle with the vehicles of v
+// - the vehicles and their indexes are built aside and swapped in under the lock
+func (r *VehicleMap) Replace(ctx context.Context, v map[int]internal.Vehicle) (err error) {
+	db, err := copyVehicles(ctx, v)
+	if err != nil {
+		return
+	}
+	ix := newVehicleMapIndexes(db)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.replace(db, ix)
+	return
+}
+
+// AppendHistory is a method that records an entry of the history of a vehicle
+func (r *VehicleMap) AppendHistory(ctx context.Context, e internal.VehicleHistoryEntry) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.appendHistory(e)
+	return
+}
+
+// FindHistory is a method that returns the history of a vehicle, oldest first
+func (r *VehicleMap) FindHistory(ctx context.Context, id int) (h []internal.VehicleHistoryEntry, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	h = make([]internal.VehicleHistoryEntry, len(r.history[id]))
+	copy(h, r.history[id])
+	return
+}
+
+// FindHistorySince is a method that returns the entries of every vehicle recorded after t
+func (r *VehicleMap) FindHistorySince(ctx context.Context, t time.Time) (h []internal.VehicleHistoryEntry, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	h = make([]internal.VehicleHistoryEntry, 0)
+	cc := cancelCheck{ctx: ctx}
+	for _, entries := range r.history {
+		if err = cc.step(); err != nil {
+			h = nil
+			return
+		}
+		for _, e := range entries {
+			if e.Timestamp.After(t) {
+				h = append(h, e)
+			}
+		}
+	}
+	return
+}
+
+// appendHistory is a method that records a copy of an entry of the history of a vehicle
+func (r *VehicleMap) appendHistory(e internal.VehicleHistoryEntry) {
+	e.Changes = append([]internal.FieldChange(nil), e.Changes...)
+	r.history[e.VehicleId] = append(r.history[e.VehicleId], e)
+}
+
+// absent is a method that returns an error unless the id is valid for a new vehicle
+func (r *VehicleMap) absent(id int) (err error) {
+	switch _, ok := r.db[id]; {
+	case id <= 0:
+		err = fmt.Errorf("%w: id must be positive", internal.ErrVehicleInvalidField)
+	case ok:
+		err = internal.ErrVehicleExists
+	}
+	return
+}
+
+// next is a method that returns the version of the next write of the vehicle with the id
+// - it follows the stored version or, for a deleted vehicle, its last version
+func (r *VehicleMap) next(id int) int {
+	return max(r.db[id].Version, r.tombstones[id]) + 1
+}
+
+// batch is a method that returns the vehicles of v at the versions a batch of saves would write them
+// - every id must be positive, an id repeated in the batch continues from its previous vehicle of the batch
+func (r *VehicleMap) batch(v []internal.Vehicle) (b []internal.Vehicle, err error) {
+	b = make([]internal.Vehicle, len(v))
+	last := make(map[int]int, len(v))
+	for i, vh := range v {
+		if vh.Id <= 0 {
+			b, err = nil, fmt.Errorf("%w: id must be positive", internal.ErrVehicleInvalidField)
+			return
+		}
+		version, ok := last[vh.Id]
+		if !ok {
+			version = r.next(vh.Id) - 1
+		}
+		vh.Version = version + 1
+		last[vh.Id] = vh.Version
+		b[i] = vh
+	}
+	return
+}
+
+// restoreTombstones is a method that restores the last versions of the deleted vehicles from the history
+// - for repositories that persist the vehicles and the history, but not the tombstones
+func (r *VehicleMap) restoreTombstones() {
+	for id, entries := range r.history {
+		if _, ok := r.db[id]; ok {
+			continue
+		}
+		for _, e := range entries {
+			r.tombstones[id] = max(r.tombstones[id], e.Version)
+		}
+	}
+}
+
+// check is a method that returns an error unless the vehicle exists at the version
+func (r *VehicleMap) check(id int, version int) (err error) {
+	current, ok := r.db[id]
+	switch {
+	case !ok:
+		err = internal.ErrVehicleNotFound
+	case current.Version != version:
+		err = fmt.Errorf("%w: expected %d, stored %d", internal.ErrVehicleVersionMismatch, version, current.Version)
+	}
+	return
+}
+
+// replace is a method that swaps in the vehicles of db with their indexes ix
+// - the vehicles left out are tombstoned at their last version, so their ids are not reused at an earlier one
+func (r *VehicleMap) replace(db map[int]internal.Vehicle, ix *vehicleMapIndexes) {
+	for id, previous := range r.db {
+		if _, ok := db[id]; !ok {
+			r.tombstones[id] = max(r.tombstones[id], previous.Version)
+		}
+	}
+	for id := range db {
+		delete(r.tombstones, id)
+	}
+	r.db, r.ix = db, ix
+	if r.col != nil {
+		r.col = newVehicleColumns(db)
+	}
+}
+
+// copyVehicles is a function that returns a copy of the vehicles, those without a version are at their first version
+func copyVehicles(ctx context.Context, v map[int]internal.Vehicle) (db map[int]internal.Vehicle, err error) {
+	db = make(map[int]internal.Vehicle, len(v))
+	cc := cancelCheck{ctx: ctx}
+	for id, vh := range v {
+		if err = cc.step(); err != nil {
+			db = nil
+			return
+		}
+		vh.Version = max(vh.Version, 1)
+		db[id] = vh
+	}
+	return
+}
+
+// put is a method that stores a vehicle and updates the indexes
+func (r *VehicleMap) put(v internal.Vehicle) {
+	if previous, ok := r.db[v.Id]; ok {
+		r.ix.remove(&previous)
+	}
+	r.db[v.Id] = v
+	delete(r.tombstones, v.Id)
+	r.ix.add(&v)
+	if r.col != nil {
+		r.col.put(&v)
+	}
+}
+
+// remove is a method that removes a vehicle and its index entries
+func (r *VehicleMap) remove(id int) {
+	if previous, ok := r.db[id]; ok {
+		r.ix.remove(&previous)
+		delete(r.db, id)
+		if r.col != nil {
+			r.col.remove(id)
+		}
+	}
+}
+
+// collect is a method that returns the vehicles with the given ids
+func (r *VehicleMap) collect(ctx context.Context, ids map[int]struct{}) (v map[int]internal.Vehicle, err error) {
+	v = make(map[int]internal.Vehicle, len(ids))
+	cc := cancelCheck{ctx: ctx}
+	for id := range ids {
+		if err = cc.step(); err != nil {
+			v = nil
+			return
+		}
+		v[id] = r.db[id]
+	}
+	return
+}
+
+// materialize is a method that returns the vehicles of the selected rows of the columns
+// - the columns are scanned before, the context is checked once the selection is known
+func (r *VehicleMap) materialize(ctx context.Context, sel bitmap) (v map[int]internal.Vehicle, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	v = make(map[int]internal.Vehicle, sel.count())
+	sel.forEach(func(row int) {
+		id := r.col.ids[row]
+		v[id] = r.db[id]
+	})
+	return
+}
+
+// cancelCheckInterval is the number of steps of a scan between checks of the cancellation of its context
+const cancelCheckInterval = 4096
+
+// cancelCheck is a struct that checks the cancellation of the context of a long scan without paying for it on every step
+type cancelCheck struct {
+	// ctx is the context of the scan
+	ctx context.Context
+	// steps is the number of steps counted
+	steps int
+}
+
+// step is a method that counts a step and returns the error of the context on the first step and every cancelCheckInterval steps
+func (c *cancelCheck) step() (err error) {
+	if c.steps%cancelCheckInterval == 0 {
+		err = c.ctx.Err()
+	}
+	c.steps++
 	return
 }
@@ -0,0 +1,226 @@
+package repository
+
+import (
+	"app/internal"
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+var (
+	benchFleetOnce     sync.Once
+	benchFleet         *VehicleMap
+	benchColumnarOnce  sync.Once
+	benchColumnarFleet *VehicleMap
+)
+
+// benchVehicleMap is a function that returns a VehicleMap with 1M generated vehicles, built once
+func benchVehicleMap(b *testing.B) *VehicleMap {
+	b.Helper()
+	benchFleetOnce.Do(func() {
+		brands := []string{"Ford", "Toyota", "Honda", "Chevrolet", "Nissan", "BMW", "Audi", "Kia", "Mazda", "Volvo"}
+		colors := []string{"red", "blue", "green", "black", "white", "silver", "yellow", "gray"}
+		fuels := []string{"gasoline", "diesel", "electric", "hybrid"}
+		transmissions := []string{"manual", "automatic", "semi-automatic"}
+
+		rnd := rand.New(rand.NewSource(1))
+		db := make(map[int]internal.Vehicle, 1_000_000)
+		for id := 1; id <= 1_000_000; id++ {
+			db[id] = internal.Vehicle{
+				Id: id,
+				VehicleAttributes: internal.VehicleAttributes{
+					Brand:           brands[rnd.Intn(len(brands))],
+					Model:           fmt.Sprintf("model-%d", rnd.Intn(100)),
+					Registration:    fmt.Sprintf("REG-%07d", id),
+					Color:           colors[rnd.Intn(len(colors))],
+					FabricationYear: 1980 + rnd.Intn(45),
+					Capacity:        2 + rnd.Intn(7),
+					MaxSpeed:        100 + rnd.Float64()*200,
+					FuelType:        fuels[rnd.Intn(len(fuels))],
+					Transmission:    transmissions[rnd.Intn(len(transmissions))],
+					Weight:          800 + rnd.Float64()*2200,
+					Dimensions: internal.Dimensions{
+						Height: 1 + rnd.Float64()*2,
+						Length: 3 + rnd.Float64()*3,
+						Width:  1.5 + rnd.Float64()*1,
+					},
+				},
+			}
+		}
+		benchFleet = NewVehicleMap(db)
+	})
+	return benchFleet
+}
+
+// benchVehicleMapColumnar is a function that returns the vehicles of benchVehicleMap with a columnar store, built once
+func benchVehicleMapColumnar(b *testing.B) *VehicleMap {
+	b.Helper()
+	rp := benchVehicleMap(b)
+	benchColumnarOnce.Do(func() {
+		benchColumnarFleet = NewVehicleMapColumnar(rp.db)
+	})
+	return benchColumnarFleet
+}
+
+// scan is a function that returns the vehicles of db matching the predicate, the baseline of the indexed queries
+func scan(db map[int]internal.Vehicle, match func(v *internal.Vehicle) bool) (v map[int]internal.Vehicle) {
+	v = make(map[int]internal.Vehicle)
+	for key, value := range db {
+		if match(&value) {
+			v[key] = value
+		}
+	}
+	return
+}
+
+func BenchmarkVehicleMap_FindByColorYear(b *testing.B) {
+	rp := benchVehicleMap(b)
+
+	b.Run("indexed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = rp.FindByColorYear(context.Background(), "red", 2000)
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = scan(rp.db, func(v *internal.Vehicle) bool { return v.Color == "red" && v.FabricationYear == 2000 })
+		}
+	})
+}
+
+func BenchmarkVehicleMap_FindByBrandYearRange(b *testing.B) {
+	rp := benchVehicleMap(b)
+
+	b.Run("indexed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = rp.FindByBrandYearRange(context.Background(), "Ford", 2000, 2002)
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = scan(rp.db, func(v *internal.Vehicle) bool {
+				return v.Brand == "Ford" && v.FabricationYear >= 2000 && v.FabricationYear <= 2002
+			})
+		}
+	})
+}
+
+func BenchmarkVehicleMap_FindByFuelType(b *testing.B) {
+	rp := benchVehicleMap(b)
+
+	b.Run("indexed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = rp.FindByFuelType(context.Background(), "electric")
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = scan(rp.db, func(v *internal.Vehicle) bool { return v.FuelType == "electric" })
+		}
+	})
+}
+
+func BenchmarkVehicleMap_FindByWeightRange(b *testing.B) {
+	rp := benchVehicleMap(b)
+
+	b.Run("indexed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = rp.FindByWeightRange(context.Background(), 1000, 1010)
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = scan(rp.db, func(v *internal.Vehicle) bool { return v.Weight >= 1000 && v.Weight <= 1010 })
+		}
+	})
+}
+
+func BenchmarkVehicleMap_FindByDimensionRange(b *testing.B) {
+	rp := benchVehicleMap(b)
+
+	b.Run("indexed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = rp.FindByDimensionRange(context.Background(), 1.50, 2.00, 1.52, 2.10)
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = scan(rp.db, func(v *internal.Vehicle) bool {
+				return v.Height >= 1.50 && v.Height <= 1.52 && v.Width >= 2.00 && v.Width <= 2.10
+			})
+		}
+	})
+}
+
+func BenchmarkVehicleMap_FindByBrandAverageSpeed(b *testing.B) {
+	rp := benchVehicleMap(b)
+
+	b.Run("indexed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = rp.FindByBrandAverageSpeed(context.Background(), "Ford")
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var total, count float64
+			for _, v := range rp.db {
+				if v.Brand == "Ford" {
+					total += v.MaxSpeed
+					count++
+				}
+			}
+			_ = total / count
+		}
+	})
+}
+
+func BenchmarkVehicleMapColumnar(b *testing.B) {
+	rows := benchVehicleMap(b)
+	columns := benchVehicleMapColumnar(b)
+
+	cases := []struct {
+		name string
+		run  func(rp *VehicleMap)
+	}{
+		{name: "FindByBrandAverageSpeed", run: func(rp *VehicleMap) { _, _ = rp.FindByBrandAverageSpeed(context.Background(), "Ford") }},
+		{name: "FindByBrandAverageCapacity", run: func(rp *VehicleMap) { _, _ = rp.FindByBrandAverageCapacity(context.Background(), "Ford") }},
+		{name: "FindByBrandYearRange", run: func(rp *VehicleMap) { _, _ = rp.FindByBrandYearRange(context.Background(), "Ford", 2000, 2002) }},
+		{name: "FindByWeightRange", run: func(rp *VehicleMap) { _, _ = rp.FindByWeightRange(context.Background(), 1000, 1010) }},
+		{name: "FindByDimensionRange", run: func(rp *VehicleMap) { _, _ = rp.FindByDimensionRange(context.Background(), 1.50, 2.00, 1.52, 2.10) }},
+	}
+	for _, c := range cases {
+		b.Run(c.name+"/rows", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				c.run(rows)
+			}
+		})
+		b.Run(c.name+"/columnar", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				c.run(columns)
+			}
+		})
+	}
+}
+
+func BenchmarkVehicleMap_Save(b *testing.B) {
+	// a fleet of its own, the writes must not change the fleet of the read benchmarks
+	db := make(map[int]internal.Vehicle, len(benchVehicleMap(b).db))
+	for id, v := range benchVehicleMap(b).db {
+		db[id] = v
+	}
+	rp := NewVehicleMap(db)
+	rnd := rand.New(rand.NewSource(2))
+	b.ResetTimer()
+
+	// each save moves the vehicle in the four sorted indexes
+	for i := 0; i < b.N; i++ {
+		v := rp.db[1+rnd.Intn(len(rp.db))]
+		v.FabricationYear = 1980 + rnd.Intn(45)
+		v.Weight = 800 + rnd.Float64()*2200
+		v.Height = 1 + rnd.Float64()*2
+		v.Width = 1.5 + rnd.Float64()*1
+		_ = rp.Save(context.Background(), &v)
+	}
+}
@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"app/internal"
+	"math/bits"
+)
+
+// bitmap is a set of row numbers, one bit per row
+type bitmap []uint64
+
+// newBitmap is a function that returns an empty bitmap for n rows
+func newBitmap(n int) bitmap {
+	return make(bitmap, (n+63)/64)
+}
+
+// set is a method that adds a row to the bitmap
+func (b bitmap) set(row int) {
+	b[row/64] |= 1 << (row % 64)
+}
+
+// clear is a method that removes a row from the bitmap
+func (b bitmap) clear(row int) {
+	b[row/64] &^= 1 << (row % 64)
+}
+
+// and is a method that keeps only the rows that are also in other
+func (b bitmap) and(other bitmap) bitmap {
+	for i := range b {
+		b[i] &= other[i]
+	}
+	return b
+}
+
+// count is a method that returns the number of rows in the bitmap
+func (b bitmap) count() (n int) {
+	for _, word := range b {
+		n += bits.OnesCount64(word)
+	}
+	return
+}
+
+// forEach is a method that calls fn with every row of the bitmap, in order
+func (b bitmap) forEach(fn func(row int)) {
+	for i, word := range b {
+		for word != 0 {
+			fn(i*64 + bits.TrailingZeros64(word))
+			word &= word - 1
+		}
+	}
+}
+
+// between is a function that returns the bitmap of the rows with a value between min and max (inclusive)
+func between[T int64 | float64](values []T, min, max T) (b bitmap) {
+	b = newBitmap(len(values))
+	for i, value := range values {
+		if value >= min && value <= max {
+			b[i/64] |= 1 << (i % 64)
+		}
+	}
+	return
+}
+
+// stringColumn is a struct that represents a dictionary-encoded string attribute
+type stringColumn struct {
+	// dict are the distinct values, the position is the code
+	dict []string
+	// codes are the codes by value
+	codes map[string]uint32
+	// values are the codes by row
+	values []uint32
+}
+
+// encode is a method that returns the code of a value, adding it to the dictionary if missing
+func (c *stringColumn) encode(value string) uint32 {
+	code, ok := c.codes[value]
+	if !ok {
+		code = uint32(len(c.dict))
+		c.dict = append(c.dict, value)
+		c.codes[value] = code
+	}
+	return code
+}
+
+// equal is a method that returns the bitmap of the rows with the value
+func (c *stringColumn) equal(value string) (b bitmap) {
+	b = newBitmap(len(c.values))
+	code, ok := c.codes[value]
+	if !ok {
+		return
+	}
+	for i, v := range c.values {
+		if v == code {
+			b[i/64] |= 1 << (i % 64)
+		}
+	}
+	return
+}
+
+// vehicleColumns is a struct that represents a columnar copy of the vehicles of a VehicleMap
+// - every vehicle is a row, the attributes are stored in one slice per attribute
+// - string attributes are dictionary-encoded, queries combine per-attribute bitmaps
+// - rows of removed vehicles are cleared from live and reused by later writes
+type vehicleColumns struct {
+	// ids are the ids by row
+	ids []int
+	// rows are the rows by id
+	rows map[int]int
+	// free are the rows of removed vehicles
+	free []int
+	// live is the bitmap of the rows in use
+	live bitmap
+
+	brand        stringColumn
+	color        stringColumn
+	fuelType     stringColumn
+	transmission stringColumn
+	year         []int64
+	capacity     []int64
+	maxSpeed     []float64
+	weight       []float64
+	height       []float64
+	width        []float64
+}
+
+// newVehicleColumns is a function that returns the columns of the vehicles of db
+func newVehicleColumns(db map[int]internal.Vehicle) (c *vehicleColumns) {
+	c = &vehicleColumns{
+		ids:          make([]int, 0, len(db)),
+		rows:         make(map[int]int, len(db)),
+		live:         make(bitmap, 0, (len(db)+63)/64),
+		brand:        stringColumn{codes: make(map[string]uint32)},
+		color:        stringColumn{codes: make(map[string]uint32)},
+		fuelType:     stringColumn{codes: make(map[string]uint32)},
+		transmission: stringColumn{codes: make(map[string]uint32)},
+	}
+	for _, v := range db {
+		c.put(&v)
+	}
+	return
+}
+
+// put is a method that writes a vehicle to its row, allocating a row for new vehicles
+func (c *vehicleColumns) put(v *internal.Vehicle) {
+	row, ok := c.rows[v.Id]
+	switch {
+	case ok:
+	case len(c.free) > 0:
+		row = c.free[len(c.free)-1]
+		c.free = c.free[:len(c.free)-1]
+	default:
+		row = len(c.ids)
+		if row%64 == 0 {
+			c.live = append(c.live, 0)
+		}
+		c.ids = append(c.ids, 0)
+		c.brand.values = append(c.brand.values, 0)
+		c.color.values = append(c.color.values, 0)
+		c.fuelType.values = append(c.fuelType.values, 0)
+		c.transmission.values = append(c.transmission.values, 0)
+		c.year = append(c.year, 0)
+		c.capacity = append(c.capacity, 0)
+		c.maxSpeed = append(c.maxSpeed, 0)
+		c.weight = append(c.weight, 0)
+		c.height = append(c.height, 0)
+		c.width = append(c.width, 0)
+	}
+
+	c.rows[v.Id] = row
+	c.live.set(row)
+	c.ids[row] = v.Id
+	c.brand.values[row] = c.brand.encode(v.Brand)
+	c.color.values[row] = c.color.encode(v.Color)
+	c.fuelType.values[row] = c.fuelType.encode(v.FuelType)
+	c.transmission.values[row] = c.transmission.encode(v.Transmission)
+	c.year[row] = int64(v.FabricationYear)
+	c.capacity[row] = int64(v.Capacity)
+	c.maxSpeed[row] = v.MaxSpeed
+	c.weight[row] = v.Weight
+	c.height[row] = v.Height
+	c.width[row] = v.Width
+}
+
+// remove is a method that frees the row of a vehicle
+func (c *vehicleColumns) remove(id int) {
+	row, ok := c.rows[id]
+	if !ok {
+		return
+	}
+	c.live.clear(row)
+	delete(c.rows, id)
+	c.free = append(c.free, row)
+}
+
+// selection is a method that returns the live rows that are in every bitmap
+func (c *vehicleColumns) selection(bitmaps ...bitmap) (sel bitmap) {
+	sel = append(bitmap(nil), c.live...)
+	for _, b := range bitmaps {
+		sel.and(b)
+	}
+	return
+}
+
+// sumFloat is a function that returns the sum of the values of the selected rows
+func sumFloat(values []float64, sel bitmap) (sum float64) {
+	sel.forEach(func(row int) { sum += values[row] })
+	return
+}
+
+// sumInt is a function that returns the sum of the values of the selected rows
+func sumInt(values []int64, sel bitmap) (sum float64) {
+	sel.forEach(func(row int) { sum += float64(values[row]) })
+	return
+}
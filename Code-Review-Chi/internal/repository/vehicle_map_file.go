@@ -0,0 +1,425 @@
+package repository
+
+import (
+	"app/internal"
+	"app/internal/loader"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+func init() {
+	// jsonfile:///path/to/vehicles.json keeps the vehicles in memory and writes them through to a file in the loader JSON format
+	// - a file that does not exist yet is created with the vehicles of the seed
+	Register("jsonfile", DriverFunc(func(dsn *url.URL, seed internal.VehicleLoader) (rp internal.VehicleRepository, err error) {
+		path, err := dsnPath(dsn)
+		if err != nil {
+			return
+		}
+		r, err := OpenVehicleMapFile(path, seed)
+		if err != nil {
+			return
+		}
+		rp = r
+		return
+	}))
+}
+
+// OpenVehicleMapFile is a function that opens the vehicles file at path
+// - if the file does not exist it is created with the vehicles of the seed
+// - the history of the vehicles is appended to a sibling file with the suffix .history.jsonl
+// - the entries of an audited write whose vehicles were not written (a crash in between) are discarded
+func OpenVehicleMapFile(path string, seed internal.VehicleLoader) (r *VehicleMapFile, err error) {
+	file := loader.NewVehicleJSONFile(path)
+	db, err := file.Load()
+	switch {
+	case err == nil:
+	case errors.Is(err, os.ErrNotExist):
+		if db, err = loadSeed(seed); err != nil {
+			return
+		}
+		if db == nil {
+			db = make(map[int]internal.Vehicle)
+		}
+		if err = file.Dump(db); err != nil {
+			return
+		}
+	default:
+		return
+	}
+
+	history, entries, err := openJSONLog[internal.VehicleHistoryEntry](path + ".history.jsonl")
+	if err != nil {
+		return
+	}
+	// - only the last write can be interrupted, its entries are the last line
+	if n := history.lastBatch; n > 0 && !fileCommitted(db, entries[len(entries)-n:]) {
+		if err = history.truncate(history.last); err != nil {
+			history.Close()
+			return
+		}
+		entries = entries[:len(entries)-n]
+		slog.Warn("discarding the history of a write that was not persisted", slog.Int("entries", n))
+	}
+	h := make(map[int][]internal.VehicleHistoryEntry)
+	for _, e := range entries {
+		h[e.VehicleId] = append(h[e.VehicleId], e)
+	}
+
+	r = &VehicleMapFile{rp: NewVehicleMap(db), file: file, history: history}
+	r.rp.history = h
+	r.rp.restoreTombstones()
+	return
+}
+
+// fileCommitted is a function that reports whether the vehicles of db reflect the entries of an audited write
+// - the entries of a write are appended before its vehicles are written
+func fileCommitted(db map[int]internal.Vehicle, entries []internal.VehicleHistoryEntry) bool {
+	for _, e := range entries {
+		v, ok := db[e.VehicleId]
+		switch {
+		case e.Operation == internal.VehicleOperationDelete:
+			if ok && v.Version <= e.Version {
+				return false
+			}
+		case !ok || v.Version < e.Version:
+			return false
+		}
+	}
+	return true
+}
+
+// VehicleMapFile is a struct that represents a vehicle repository persisted in a single file
+// - reads are served by a VehicleMap
+// - every write rewrites the whole file (plain, gzip or zstd by extension), it suits small datasets
+type VehicleMapFile struct {
+	// mu guards the map and the file
+	mu sync.RWMutex
+	// rp is the in-memory repository with the current state
+	rp *VehicleMap
+	// file is the file where the vehicles are persisted
+	file *loader.VehicleJSONFile
+	// history is the file where the history of the vehicles is persisted
+	history *historyLog
+}
+
+// Close is a method that closes the history file
+func (r *VehicleMapFile) Close() (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err = r.history.Close()
+	return
+}
+
+// FindAll is a method that returns a map of all vehicles
+func (r *VehicleMapFile) FindAll(ctx context.Context) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rp.FindAll(ctx)
+}
+
+// FindById is a method that returns a vehicle by id
+func (r *VehicleMapFile) FindById(ctx context.Context, id int) (v internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rp.FindById(ctx, id)
+}
+
+func (r *VehicleMapFile) FindByColorYear(ctx context.Context, color string, year int) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rp.FindByColorYear(ctx, color, year)
+}
+
+func (r *VehicleMapFile) FindByBrandYearRange(ctx context.Context, brand string, startYear, endYear int) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rp.FindByBrandYearRange(ctx, brand, startYear, endYear)
+}
+
+func (r *VehicleMapFile) FindByBrandAverageSpeed(ctx context.Context, brand string) (avg float64, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rp.FindByBrandAverageSpeed(ctx, brand)
+}
+
+func (r *VehicleMapFile) FindByFuelType(ctx context.Context, fuelType string) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rp.FindByFuelType(ctx, fuelType)
+}
+
+func (r *VehicleMapFile) FindByTransmissionType(ctx context.Context, transmissionType string) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rp.FindByTransmissionType(ctx, transmissionType)
+}
+
+func (r *VehicleMapFile) FindByBrandAverageCapacity(ctx context.Context, brand string) (avg float64, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rp.FindByBrandAverageCapacity(ctx, brand)
+}
+
+func (r *VehicleMapFile) FindByWeightRange(ctx context.Context, minWeight, maxWeight float64) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rp.FindByWeightRange(ctx, minWeight, maxWeight)
+}
+
+func (r *VehicleMapFile) FindByDimensionRange(ctx context.Context, minHeight, minWidth, maxHeight, maxWidth float64) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rp.FindByDimensionRange(ctx, minHeight, minWidth, maxHeight, maxWidth)
+}
+
+// Save is a method that saves a vehicle
+// - the vehicle is only kept in memory if the file was written
+func (r *VehicleMapFile) Save(ctx context.Context, v *internal.Vehicle) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err = r.write(ctx, func() error { return r.rp.Save(ctx, v) }, nil, v.Id)
+	return
+}
+
+// SaveAudited is a method that saves a vehicle and records the entry of its history
+// - the entry is appended before the file is written and discarded if it could not be
+func (r *VehicleMapFile) SaveAudited(ctx context.Context, v *internal.Vehicle, e internal.VehicleHistoryEntry) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err = r.write(ctx, func() error { return r.rp.Save(ctx, v) }, func() []internal.VehicleHistoryEntry {
+		e.Version = v.Version
+		return []internal.VehicleHistoryEntry{e}
+	}, v.Id)
+	return
+}
+
+// Create is a method that saves a new vehicle, ErrVehicleExists if a vehicle with the same id exists
+// - the vehicle is only kept in memory if the file was written
+func (r *VehicleMapFile) Create(ctx context.Context, v *internal.Vehicle) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err = r.write(ctx, func() error { return r.rp.Create(ctx, v) }, nil, v.Id)
+	return
+}
+
+// CreateAudited is a method that saves a new vehicle and records the entry of its history
+// - the entry is appended before the file is written and discarded if it could not be
+func (r *VehicleMapFile) CreateAudited(ctx context.Context, v *internal.Vehicle, e internal.VehicleHistoryEntry) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err = r.write(ctx, func() error { return r.rp.Create(ctx, v) }, func() []internal.VehicleHistoryEntry {
+		e.Version = v.Version
+		return []internal.VehicleHistoryEntry{e}
+	}, v.Id)
+	return
+}
+
+// SaveBatch is a method that saves the vehicles in order
+// - the vehicles are only kept in memory if the file was written
+func (r *VehicleMapFile) SaveBatch(ctx context.Context, v []internal.Vehicle) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]int, len(v))
+	for i := range v {
+		ids[i] = v[i].Id
+	}
+	err = r.write(ctx, func() error { return r.rp.SaveBatch(ctx, v) }, nil, ids...)
+	return
+}
+
+// SaveBatchAudited is a method that saves the vehicles in order and records the entries of their history
+// - the entries are appended before the file is written and discarded if it could not be
+func (r *VehicleMapFile) SaveBatchAudited(ctx context.Context, v []internal.Vehicle, e []internal.VehicleHistoryEntry) (err error) {
+	if len(e) != len(v) {
+		err = fmt.Errorf("%w: %d vehicles and %d history entries", internal.ErrVehicleInvalidField, len(v), len(e))
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]int, len(v))
+	for i := range v {
+		ids[i] = v[i].Id
+	}
+	err = r.write(ctx, func() error { return r.rp.SaveBatch(ctx, v) }, func() []internal.VehicleHistoryEntry {
+		entries := append([]internal.VehicleHistoryEntry(nil), e...)
+		for i := range entries {
+			entries[i].Version = v[i].Version
+		}
+		return entries
+	}, ids...)
+	return
+}
+
+// Update is a method that overwrites a vehicle if its stored version is version
+// - the vehicle is only kept in memory if the file was written
+func (r *VehicleMapFile) Update(ctx context.Context, v *internal.Vehicle, version int) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err = r.write(ctx, func() error { return r.rp.Update(ctx, v, version) }, nil, v.Id)
+	return
+}
+
+// UpdateAudited is a method that overwrites a vehicle if its stored version is version and records the entry of its history
+// - the entry is appended before the file is written and discarded if it could not be
+func (r *VehicleMapFile) UpdateAudited(ctx context.Context, v *internal.Vehicle, version int, e internal.VehicleHistoryEntry) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err = r.write(ctx, func() error { return r.rp.Update(ctx, v, version) }, func() []internal.VehicleHistoryEntry {
+		e.Version = v.Version
+		return []internal.VehicleHistoryEntry{e}
+	}, v.Id)
+	return
+}
+
+// Delete is a method that deletes a vehicle if its stored version is version
+// - the vehicle is only removed from memory if the file was written
+func (r *VehicleMapFile) Delete(ctx context.Context, id int, version int) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err = r.write(ctx, func() error { return r.rp.Delete(ctx, id, version) }, nil, id)
+	return
+}
+
+// DeleteAudited is a method that deletes a vehicle if its stored version is version and records the entry of its history
+// - the entry is appended before the file is written and discarded if it could not be
+func (r *VehicleMapFile) DeleteAudited(ctx context.Context, id int, version int, e internal.VehicleHistoryEntry) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err = r.write(ctx, func() error { return r.rp.Delete(ctx, id, version) }, func() []internal.VehicleHistoryEntry {
+		e.Version = version
+		return []internal.VehicleHistoryEntry{e}
+	}, id)
+	return
+}
+
+// Replace is a method that replaces every vehicle with the vehicles of v
+// - the vehicles are only replaced in memory if the file was written
+func (r *VehicleMapFile) Replace(ctx context.Context, v map[int]internal.Vehicle) (err error) {
+	db, err := copyVehicles(ctx, v)
+	if err != nil {
+		return
+	}
+	ix := newVehicleMapIndexes(db)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err = r.file.Dump(db); err != nil {
+		return
+	}
+	r.rp.replace(db, ix)
+	return
+}
+
+// AppendHistory is a method that records an entry of the history of a vehicle
+// - the entry is only kept in memory if the history file was written
+func (r *VehicleMapFile) AppendHistory(ctx context.Context, e internal.VehicleHistoryEntry) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err = r.history.append(e); err != nil {
+		return
+	}
+	err = r.rp.AppendHistory(ctx, e)
+	return
+}
+
+// FindHistory is a method that returns the history of a vehicle, oldest first
+func (r *VehicleMapFile) FindHistory(ctx context.Context, id int) (h []internal.VehicleHistoryEntry, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rp.FindHistory(ctx, id)
+}
+
+// FindHistorySince is a method that returns the entries of every vehicle recorded after t
+func (r *VehicleMapFile) FindHistorySince(ctx context.Context, t time.Time) (h []internal.VehicleHistoryEntry, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rp.FindHistorySince(ctx, t)
+}
+
+// write is a method that applies a write of the vehicles with the ids to the map and the file
+// - audit returns the entries of the history of the write once applied, nil for a write without history
+// - the entries are appended to the history file as a single line before the file is written, so a crash in between
+// leaves them as the last line, which is discarded on open (see OpenVehicleMapFile)
+// - the map is rolled back and the entries discarded if the file could not be written, nothing is written if ctx is done
+func (r *VehicleMapFile) write(ctx context.Context, apply func() error, audit func() []internal.VehicleHistoryEntry, ids ...int) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	// - the state of each id before the write, the first one seen of a repeated id
+	type state struct {
+		previous         internal.Vehicle
+		existed, deleted bool
+		tombstone        int
+	}
+	states := make(map[int]state, len(ids))
+	for _, id := range ids {
+		if _, ok := states[id]; ok {
+			continue
+		}
+		var s state
+		s.previous, s.existed = r.rp.db[id]
+		s.tombstone, s.deleted = r.rp.tombstones[id]
+		states[id] = s
+	}
+	rollback := func() {
+		for id, s := range states {
+			if s.existed {
+				r.rp.put(s.previous)
+			} else {
+				r.rp.remove(id)
+			}
+			if s.deleted {
+				r.rp.tombstones[id] = s.tombstone
+			}
+		}
+	}
+	if err = apply(); err != nil {
+		return
+	}
+
+	// history
+	var entries []internal.VehicleHistoryEntry
+	offset := r.history.offset
+	if audit != nil {
+		entries = audit()
+		if err = r.history.appendBatch(entries); err != nil {
+			rollback()
+			return
+		}
+	}
+
+	// vehicles
+	logger := internal.LoggerFromContext(ctx)
+	if err = r.file.Dump(r.rp.db); err != nil {
+		rollback()
+		logger.Error("persisting the vehicles, write rolled back", slog.Any("vehicle_ids", ids), slog.Any("error", err))
+		if audit != nil {
+			if errTruncate := r.history.truncate(offset); errTruncate != nil {
+				logger.Error("discarding the history of a write rolled back, history appends are refused",
+					slog.Any("vehicle_ids", ids), slog.Any("error", errTruncate))
+			}
+		}
+		return
+	}
+	for _, e := range entries {
+		r.rp.appendHistory(e)
+	}
+	return
+}
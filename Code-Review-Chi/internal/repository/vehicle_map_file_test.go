@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"app/internal"
+	"app/internal/loader"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Tests for the audited writes of VehicleMapFile
+func TestVehicleMapFile_Audited(t *testing.T) {
+	// open is a function that opens the VehicleMapFile at path and closes it when the test finishes
+	open := func(t *testing.T, path string) (r *VehicleMapFile) {
+		t.Helper()
+		r, err := OpenVehicleMapFile(path, nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { r.Close() })
+		return
+	}
+	// seed is a function that returns the path of a vehicles file with a vehicle at its first version
+	seed := func(t *testing.T) (path string) {
+		t.Helper()
+		path = filepath.Join(t.TempDir(), "vehicles.json")
+		require.NoError(t, loader.NewVehicleJSONFile(path).Dump(map[int]internal.Vehicle{1: newWALVehicle(1)}))
+		return
+	}
+
+	t.Run("case 1: should neither write the vehicle nor keep its entry if the file can not be written", func(t *testing.T) {
+		// arrange
+		path := seed(t)
+		r := open(t, path)
+		file := r.file
+		r.file = loader.NewVehicleJSONFile(filepath.Join(t.TempDir(), "missing", "vehicles.json"))
+		v := newWALVehicle(1)
+		v.Color = "Blue"
+
+		// act
+		errFailed := r.UpdateAudited(context.Background(), &v, 1, internal.VehicleHistoryEntry{VehicleId: 1, Operation: internal.VehicleOperationUpdate})
+		r.file = file
+		errUpdate := r.UpdateAudited(context.Background(), &v, 1, internal.VehicleHistoryEntry{VehicleId: 1, Operation: internal.VehicleOperationUpdate})
+		require.NoError(t, r.Close())
+		r = open(t, path)
+		h, errHistory := r.FindHistory(context.Background(), 1)
+
+		// assert
+		require.Error(t, errFailed)
+		require.NoError(t, errUpdate)
+		require.NoError(t, errHistory)
+		require.Len(t, h, 1)
+		require.Equal(t, 2, h[0].Version)
+	})
+
+	t.Run("case 2: should discard the entries of a write whose vehicles were not written before a crash", func(t *testing.T) {
+		// arrange
+		path := seed(t)
+		r := open(t, path)
+		v := newWALVehicle(1)
+		require.NoError(t, r.UpdateAudited(context.Background(), &v, 1, internal.VehicleHistoryEntry{VehicleId: 1, Operation: internal.VehicleOperationUpdate}))
+		// - the entry of a second update appended, the crash before the file was written
+		require.NoError(t, r.history.appendBatch([]internal.VehicleHistoryEntry{{VehicleId: 1, Version: 3, Operation: internal.VehicleOperationUpdate}}))
+		require.NoError(t, r.Close())
+
+		// act
+		r = open(t, path)
+		h, errHistory := r.FindHistory(context.Background(), 1)
+		errUpdate := r.UpdateAudited(context.Background(), &v, 2, internal.VehicleHistoryEntry{VehicleId: 1, Operation: internal.VehicleOperationUpdate})
+		require.NoError(t, r.Close())
+		r = open(t, path)
+		hAfter, errAfter := r.FindHistory(context.Background(), 1)
+
+		// assert
+		require.NoError(t, errHistory)
+		require.Len(t, h, 1)
+		require.NoError(t, errUpdate)
+		require.NoError(t, errAfter)
+		require.Len(t, hAfter, 2)
+		require.Equal(t, []int{2, 3}, []int{hAfter[0].Version, hAfter[1].Version})
+	})
+
+	t.Run("case 3: should keep the entries of a deletion that was written", func(t *testing.T) {
+		// arrange
+		path := seed(t)
+		r := open(t, path)
+		require.NoError(t, r.DeleteAudited(context.Background(), 1, 1, internal.VehicleHistoryEntry{VehicleId: 1, Operation: internal.VehicleOperationDelete}))
+		require.NoError(t, r.Close())
+
+		// act
+		r = open(t, path)
+		h, errHistory := r.FindHistory(context.Background(), 1)
+		v := newWALVehicle(1)
+		errCreate := r.Create(context.Background(), &v)
+
+		// assert
+		require.NoError(t, errHistory)
+		require.Len(t, h, 1)
+		require.NoError(t, errCreate)
+		require.Equal(t, 2, v.Version)
+	})
+}
@@ -0,0 +1,223 @@
+package repository
+
+import (
+	"app/internal"
+	"sort"
+)
+
+// hashIndex is a map from a value to the set of ids of the vehicles with that value
+type hashIndex map[string]map[int]struct{}
+
+// add is a method that adds an id to the set of a value
+func (ix hashIndex) add(value string, id int) {
+	ids, ok := ix[value]
+	if !ok {
+		ids = make(map[int]struct{})
+		ix[value] = ids
+	}
+	ids[id] = struct{}{}
+}
+
+// remove is a method that removes an id from the set of a value
+func (ix hashIndex) remove(value string, id int) {
+	ids := ix[value]
+	delete(ids, id)
+	if len(ids) == 0 {
+		delete(ix, value)
+	}
+}
+
+// sortedEntry is a struct that represents an entry of a sorted index
+type sortedEntry struct {
+	// value is the indexed value
+	value float64
+	// id is the id of the vehicle
+	id int
+}
+
+// less is a method that reports whether the entry sorts before other (by value, then by id)
+func (e sortedEntry) less(other sortedEntry) bool {
+	return e.value < other.value || (e.value == other.value && e.id < other.id)
+}
+
+// sortedBlockSize is the maximum number of entries of a block of a sorted index
+// - a write copies at most a block and the list of blocks, not the whole index
+const sortedBlockSize = 1024
+
+// sortedIndex is a struct that represents the ids of the vehicles sorted by a value, for range queries
+// - the entries are split in consecutive sorted blocks (the leaves of a B+tree), so a write costs O(sqrt n) copies instead of O(n)
+type sortedIndex struct {
+	// blocks are the non-empty blocks of entries, sorted by value and id within and across blocks
+	blocks [][]sortedEntry
+}
+
+// newSortedIndex is a function that returns the sorted index of the entries, sorting them
+// - the blocks are filled to half their size, so the first writes do not split them
+func newSortedIndex(entries []sortedEntry) (ix *sortedIndex) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].less(entries[j]) })
+
+	ix = &sortedIndex{}
+	for len(entries) > 0 {
+		n := min(len(entries), sortedBlockSize/2)
+		block := make([]sortedEntry, n, sortedBlockSize)
+		copy(block, entries[:n])
+		ix.blocks = append(ix.blocks, block)
+		entries = entries[n:]
+	}
+	return
+}
+
+// block is a method that returns the index of the block an entry belongs to, the last block if it sorts after every entry
+func (ix *sortedIndex) block(entry sortedEntry) int {
+	i := sort.Search(len(ix.blocks), func(i int) bool { return !ix.blocks[i][len(ix.blocks[i])-1].less(entry) })
+	return min(i, len(ix.blocks)-1)
+}
+
+// add is a method that inserts an entry keeping the order
+// - a full block is split in two halves
+func (ix *sortedIndex) add(value float64, id int) {
+	entry := sortedEntry{value: value, id: id}
+	if len(ix.blocks) == 0 {
+		ix.blocks = append(ix.blocks, append(make([]sortedEntry, 0, sortedBlockSize), entry))
+		return
+	}
+
+	b := ix.block(entry)
+	block := ix.blocks[b]
+	i := sort.Search(len(block), func(i int) bool { return !block[i].less(entry) })
+	block = append(block, sortedEntry{})
+	copy(block[i+1:], block[i:])
+	block[i] = entry
+	ix.blocks[b] = block
+
+	if len(block) >= sortedBlockSize {
+		half := make([]sortedEntry, len(block)-len(block)/2, sortedBlockSize)
+		copy(half, block[len(block)/2:])
+		ix.blocks[b] = block[:len(block)/2]
+		ix.blocks = append(ix.blocks, nil)
+		copy(ix.blocks[b+2:], ix.blocks[b+1:])
+		ix.blocks[b+1] = half
+	}
+}
+
+// remove is a method that removes an entry keeping the order
+// - an emptied block is dropped
+func (ix *sortedIndex) remove(value float64, id int) {
+	entry := sortedEntry{value: value, id: id}
+	if len(ix.blocks) == 0 {
+		return
+	}
+
+	b := ix.block(entry)
+	block := ix.blocks[b]
+	i := sort.Search(len(block), func(i int) bool { return !block[i].less(entry) })
+	if i == len(block) || block[i] != entry {
+		return
+	}
+	block = append(block[:i], block[i+1:]...)
+	ix.blocks[b] = block
+
+	if len(block) == 0 {
+		ix.blocks = append(ix.blocks[:b], ix.blocks[b+1:]...)
+	}
+}
+
+// sortedRange is the entries of a sorted index in a range, as consecutive sorted blocks
+type sortedRange [][]sortedEntry
+
+// len is a method that returns the number of entries of the range
+func (r sortedRange) len() (n int) {
+	for _, block := range r {
+		n += len(block)
+	}
+	return
+}
+
+// between is a method that returns the entries with a value between min and max (inclusive)
+// - the range shares the blocks of the index, it is only valid until the next write
+func (ix *sortedIndex) between(min, max float64) (r sortedRange) {
+	// first block with a value >= min and first block with a value > max
+	lo := sort.Search(len(ix.blocks), func(i int) bool { return ix.blocks[i][len(ix.blocks[i])-1].value >= min })
+	hi := sort.Search(len(ix.blocks), func(i int) bool { return ix.blocks[i][len(ix.blocks[i])-1].value > max })
+	for b := lo; b <= hi && b < len(ix.blocks); b++ {
+		block := ix.blocks[b]
+		from := sort.Search(len(block), func(i int) bool { return block[i].value >= min })
+		to := sort.Search(len(block), func(i int) bool { return block[i].value > max })
+		if from < to {
+			r = append(r, block[from:to])
+		}
+	}
+	return
+}
+
+// vehicleMapIndexes is a struct that represents the secondary indexes of a VehicleMap
+type vehicleMapIndexes struct {
+	// brand is the hash index of the vehicles by brand
+	brand hashIndex
+	// color is the hash index of the vehicles by color
+	color hashIndex
+	// fuelType is the hash index of the vehicles by fuel type
+	fuelType hashIndex
+	// transmission is the hash index of the vehicles by transmission
+	transmission hashIndex
+	// year is the sorted index of the vehicles by fabrication year
+	year *sortedIndex
+	// weight is the sorted index of the vehicles by weight
+	weight *sortedIndex
+	// height is the sorted index of the vehicles by height
+	height *sortedIndex
+	// width is the sorted index of the vehicles by width
+	width *sortedIndex
+}
+
+// newVehicleMapIndexes is a function that returns the indexes of the vehicles of db
+func newVehicleMapIndexes(db map[int]internal.Vehicle) (ix *vehicleMapIndexes) {
+	ix = &vehicleMapIndexes{
+		brand:        make(hashIndex),
+		color:        make(hashIndex),
+		fuelType:     make(hashIndex),
+		transmission: make(hashIndex),
+	}
+
+	// bulk load: append unsorted and sort once
+	year := make([]sortedEntry, 0, len(db))
+	weight := make([]sortedEntry, 0, len(db))
+	height := make([]sortedEntry, 0, len(db))
+	width := make([]sortedEntry, 0, len(db))
+	for id, v := range db {
+		ix.brand.add(v.Brand, id)
+		ix.color.add(v.Color, id)
+		ix.fuelType.add(v.FuelType, id)
+		ix.transmission.add(v.Transmission, id)
+		year = append(year, sortedEntry{value: float64(v.FabricationYear), id: id})
+		weight = append(weight, sortedEntry{value: v.Weight, id: id})
+		height = append(height, sortedEntry{value: v.Height, id: id})
+		width = append(width, sortedEntry{value: v.Width, id: id})
+	}
+	ix.year, ix.weight, ix.height, ix.width = newSortedIndex(year), newSortedIndex(weight), newSortedIndex(height), newSortedIndex(width)
+	return
+}
+
+// add is a method that indexes a vehicle
+func (ix *vehicleMapIndexes) add(v *internal.Vehicle) {
+	ix.brand.add(v.Brand, v.Id)
+	ix.color.add(v.Color, v.Id)
+	ix.fuelType.add(v.FuelType, v.Id)
+	ix.transmission.add(v.Transmission, v.Id)
+	ix.year.add(float64(v.FabricationYear), v.Id)
+	ix.weight.add(v.Weight, v.Id)
+	ix.height.add(v.Height, v.Id)
+	ix.width.add(v.Width, v.Id)
+}
+
+// remove is a method that removes the index entries of a vehicle
+func (ix *vehicleMapIndexes) remove(v *internal.Vehicle) {
+	ix.brand.remove(v.Brand, v.Id)
+	ix.color.remove(v.Color, v.Id)
+	ix.fuelType.remove(v.FuelType, v.Id)
+	ix.transmission.remove(v.Transmission, v.Id)
+	ix.year.remove(float64(v.FabricationYear), v.Id)
+	ix.weight.remove(v.Weight, v.Id)
+	ix.height.remove(v.Height, v.Id)
+	ix.width.remove(v.Width, v.Id)
+}
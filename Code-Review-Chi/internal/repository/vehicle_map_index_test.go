@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Tests for sortedIndex
+func TestSortedIndex(t *testing.T) {
+	// entries is a function that returns the entries of a range in order
+	entries := func(r sortedRange) (e []sortedEntry) {
+		e = []sortedEntry{}
+		for _, block := range r {
+			e = append(e, block...)
+		}
+		return
+	}
+	// expected is a function that returns the entries of the model with a value between min and max, in order
+	expected := func(model map[int]float64, min, max float64) (e []sortedEntry) {
+		e = []sortedEntry{}
+		for id, value := range model {
+			if value >= min && value <= max {
+				e = append(e, sortedEntry{value: value, id: id})
+			}
+		}
+		sort.Slice(e, func(i, j int) bool { return e[i].less(e[j]) })
+		return
+	}
+
+	t.Run("case 1: should keep the entries sorted across the blocks it splits and drops", func(t *testing.T) {
+		// arrange
+		// - a bulk load and enough writes to split and empty blocks, on few distinct values
+		rnd := rand.New(rand.NewSource(1))
+		model := make(map[int]float64)
+		bulk := make([]sortedEntry, 0, 3*sortedBlockSize)
+		for id := 1; id <= 3*sortedBlockSize; id++ {
+			model[id] = float64(rnd.Intn(50))
+			bulk = append(bulk, sortedEntry{value: model[id], id: id})
+		}
+		ix := newSortedIndex(bulk)
+
+		// act
+		for i := 0; i < 20*sortedBlockSize; i++ {
+			id := 1 + rnd.Intn(4*sortedBlockSize)
+			if value, ok := model[id]; ok {
+				ix.remove(value, id)
+				delete(model, id)
+			}
+			if rnd.Intn(3) > 0 {
+				model[id] = float64(rnd.Intn(50))
+				ix.add(model[id], id)
+			}
+		}
+
+		// assert
+		for _, block := range ix.blocks {
+			require.NotEmpty(t, block)
+			require.Less(t, len(block), sortedBlockSize)
+		}
+		require.Equal(t, expected(model, 0, 49), entries(ix.between(0, 49)))
+		require.Equal(t, expected(model, 10, 20), entries(ix.between(10, 20)))
+		require.Equal(t, expected(model, 7, 7), entries(ix.between(7, 7)))
+		require.Equal(t, len(expected(model, 10, 20)), ix.between(10, 20).len())
+		require.Empty(t, ix.between(60, 70))
+		require.Empty(t, ix.between(20, 10))
+	})
+
+	t.Run("case 2: should index from empty and be empty again once every entry is removed", func(t *testing.T) {
+		// arrange
+		ix := newSortedIndex(nil)
+
+		// act
+		for id := 1; id <= 2*sortedBlockSize; id++ {
+			ix.add(float64(id%7), id)
+		}
+		all := ix.between(0, 6).len()
+		for id := 1; id <= 2*sortedBlockSize; id++ {
+			ix.remove(float64(id%7), id)
+		}
+		ix.remove(1, 1)
+
+		// assert
+		require.Equal(t, 2*sortedBlockSize, all)
+		require.Empty(t, ix.blocks)
+		require.Empty(t, ix.between(0, 6))
+	})
+}
@@ -0,0 +1,711 @@
+package repository
+
+import (
+	"app/internal"
+	"app/internal/loader"
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+func init() {
+	// wal:///path/to/dir[?snapshot_every=1000] keeps the vehicles in memory with a durable log and snapshots in dir
+	// - the seed is only loaded on the first start
+	Register("wal", DriverFunc(func(dsn *url.URL, seed internal.VehicleLoader) (rp internal.VehicleRepository, err error) {
+		cfg := &ConfigVehicleMapWAL{}
+		if cfg.Dir, err = dsnPath(dsn); err != nil {
+			return
+		}
+		if cfg.SnapshotEvery, err = dsnPositiveIntOption(dsn, "snapshot_every", 0); err != nil {
+			return
+		}
+
+		// - the seed is only needed if the directory has no state yet
+		var db map[int]internal.Vehicle
+		if !walExists(cfg.Dir) {
+			if db, err = loadSeed(seed); err != nil {
+				return
+			}
+		}
+		r, err := OpenVehicleMapWAL(db, cfg)
+		if err != nil {
+			return
+		}
+		rp = r
+		return
+	}))
+}
+
+// walExists is a function that reports whether dir contains the state of a VehicleMapWAL
+// - an empty log without a snapshot is a first start that crashed before its first snapshot, it has no state
+func walExists(dir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, walSnapshotName)); err == nil {
+		return true
+	}
+	info, err := os.Stat(filepath.Join(dir, walLogName))
+	return err == nil && info.Size() > 0
+}
+
+// walOp is the operation of a log record
+type walOp string
+
+const (
+	// walOpSave is the operation of a vehicle saved for the first time
+	walOpSave walOp = "save"
+	// walOpUpdate is the operation of a vehicle saved over an existing one
+	walOpUpdate walOp = "update"
+	// walOpDelete is the operation of a vehicle deleted
+	walOpDelete walOp = "delete"
+	// walOpReplace is the operation of every vehicle replaced
+	walOpReplace walOp = "replace"
+	// walOpBatch is the operation of vehicles saved together
+	walOpBatch walOp = "batch"
+	// walOpHistory is the operation of entries of the history recorded on their own
+	walOpHistory walOp = "history"
+)
+
+// walRecord is a struct that represents a record of the operation log
+type walRecord struct {
+	// Op is the operation
+	Op walOp `json:"op"`
+	// Id is the id of the vehicle
+	Id int `json:"id"`
+	// Vehicle is the vehicle after the operation (nil for deletes)
+	Vehicle *internal.Vehicle `json:"vehicle,omitempty"`
+	// Version is the version deleted (deletes only)
+	Version int `json:"version,omitempty"`
+	// Vehicles are the vehicles after a replacement, in a single record so it is applied whole or not at all
+	Vehicles map[int]internal.Vehicle `json:"vehicles,omitempty"`
+	// Batch are the vehicles saved together in order, in a single record so it is applied whole or not at all
+	Batch []internal.Vehicle `json:"batch,omitempty"`
+	// History are the entries of the history recorded with the operation, in the same record so both are durable together
+	History []internal.VehicleHistoryEntry `json:"history,omitempty"`
+}
+
+// walHistoryKey is a struct that identifies an entry of the history, to skip the entries of the log already in the history file
+type walHistoryKey struct {
+	id        int
+	version   int
+	operation internal.VehicleOperation
+}
+
+// walHistory is a function that returns the entry e at the version as the history of a record, nil if e is nil
+func walHistory(e *internal.VehicleHistoryEntry, version int) []internal.VehicleHistoryEntry {
+	if e == nil {
+		return nil
+	}
+	entry := *e
+	entry.Version = version
+	return []internal.VehicleHistoryEntry{entry}
+}
+
+const (
+	// walSnapshotName is the name of the snapshot file in the directory of a VehicleMapWAL
+	walSnapshotName = "vehicles.snapshot.json"
+	// walLogName is the name of the log file in the directory of a VehicleMapWAL
+	walLogName = "vehicles.wal"
+	// walHistoryName is the name of the history file in the directory of a VehicleMapWAL
+	walHistoryName = "vehicles.history.jsonl"
+)
+
+// walHeaderSize is the size of the header of a record: payload length and CRC-32 of the payload (little endian)
+const walHeaderSize = 8
+
+// ErrWALBroken is returned by the writes of a VehicleMapWAL whose log could not be restored after a failed write
+// - the log may end with a torn record, writes are refused until a snapshot truncates it (see Snapshot)
+var ErrWALBroken = errors.New("repository: write-ahead log broken")
+
+// ConfigVehicleMapWAL is a struct that represents the configuration for VehicleMapWAL
+type ConfigVehicleMapWAL struct {
+	// Dir is the directory where the log and the snapshot are stored
+	Dir string
+	// SnapshotEvery is the number of log records after which a compacted snapshot is taken
+	SnapshotEvery int
+}
+
+// OpenVehicleMapWAL is a function that opens (or creates) a durable VehicleMap
+// - the state is recovered by loading the snapshot and the history, and replaying the log
+// - seed is only used when there is neither a snapshot nor a log yet
+// - a truncated or corrupted tail of the log (e.g. a torn last write) is discarded
+func OpenVehicleMapWAL(seed map[int]internal.Vehicle, cfg *ConfigVehicleMapWAL) (r *VehicleMapWAL, err error) {
+	// default values
+	defaultConfig := &ConfigVehicleMapWAL{
+		Dir:           ".",
+		SnapshotEvery: 1000,
+	}
+	if cfg != nil {
+		if cfg.Dir != "" {
+			defaultConfig.Dir = cfg.Dir
+		}
+		if cfg.SnapshotEvery > 0 {
+			defaultConfig.SnapshotEvery = cfg.SnapshotEvery
+		}
+	}
+	if err = os.MkdirAll(defaultConfig.Dir, 0o755); err != nil {
+		return
+	}
+
+	r = &VehicleMapWAL{
+		snapshot:      loader.NewVehicleJSONFile(filepath.Join(defaultConfig.Dir, walSnapshotName)),
+		logPath:       filepath.Join(defaultConfig.Dir, walLogName),
+		snapshotEvery: defaultConfig.SnapshotEvery,
+	}
+
+	// recover
+	// - snapshot
+	db, err := r.snapshot.Load()
+	switch {
+	case err == nil:
+	case errors.Is(err, os.ErrNotExist) && !walExists(defaultConfig.Dir):
+		// - first start: the seed is the initial state
+		db, err = seed, nil
+	case errors.Is(err, os.ErrNotExist):
+		// - the log was written before any snapshot could be taken
+		db, err = nil, nil
+	default:
+		r = nil
+		return
+	}
+	r.rp = NewVehicleMap(db)
+
+	// - history, the entries of the log are replayed after those of the history file
+	history, entries, err := openHistoryLog(filepath.Join(defaultConfig.Dir, walHistoryName))
+	if err != nil {
+		r = nil
+		return
+	}
+	r.history = history
+	r.rp.history = entries
+
+	// - log
+	if r.log, err = os.OpenFile(r.logPath, os.O_RDWR|os.O_CREATE, 0o644); err != nil {
+		r.history.Close()
+		r = nil
+		return
+	}
+	if err = r.replay(); err != nil {
+		r.log.Close()
+		r.history.Close()
+		r = nil
+		return
+	}
+
+	// a first snapshot makes the seed durable and compacts the replayed log
+	if err = r.compact(); err != nil {
+		r.log.Close()
+		r.history.Close()
+		r = nil
+		return
+	}
+
+	// - the snapshot only has the vehicles, the deleted ones are in the history
+	r.rp.restoreTombstones()
+	return
+}
+
+// VehicleMapWAL is a struct that represents a durable vehicle repository
+// - reads are served by a VehicleMap
+// - every write is appended to an operation log and fsynced before it is applied
+// - the log is periodically compacted into a snapshot in the loader JSON format
+type VehicleMapWAL struct {
+	// mu guards the map and the log
+	mu sync.RWMutex
+	// rp is the in-memory repository with the current state
+	rp *VehicleMap
+	// log is the operation log
+	log *os.File
+	// logPath is the path to the operation log
+	logPath string
+	// snapshot is the file with the compacted state
+	snapshot *loader.VehicleJSONFile
+	// records is the number of records in the log
+	records int
+	// offset is the end of the last valid record of the log, where the next one is written
+	offset int64
+	// broken is the error that left a torn record in the log, nil while the log is consistent
+	broken error
+	// snapshotEvery is the number of log records after which a snapshot is taken
+	snapshotEvery int
+	// history is the file where the history of the vehicles is persisted when the log is compacted
+	history *historyLog
+	// pending are the entries of the history in the log that are not in the history file yet
+	pending []internal.VehicleHistoryEntry
+}
+
+// FindAll is a method that returns a map of all vehicles
+func (r *VehicleMapWAL) FindAll(ctx context.Context) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rp.FindAll(ctx)
+}
+
+// FindById is a method that returns a vehicle by id
+func (r *VehicleMapWAL) FindById(ctx context.Context, id int) (v internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rp.FindById(ctx, id)
+}
+
+func (r *VehicleMapWAL) FindByColorYear(ctx context.Context, color string, year int) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rp.FindByColorYear(ctx, color, year)
+}
+
+func (r *VehicleMapWAL) FindByBrandYearRange(ctx context.Context, brand string, startYear, endYear int) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rp.FindByBrandYearRange(ctx, brand, startYear, endYear)
+}
+
+func (r *VehicleMapWAL) FindByBrandAverageSpeed(ctx context.Context, brand string) (avg float64, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rp.FindByBrandAverageSpeed(ctx, brand)
+}
+
+func (r *VehicleMapWAL) FindByFuelType(ctx context.Context, fuelType string) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rp.FindByFuelType(ctx, fuelType)
+}
+
+func (r *VehicleMapWAL) FindByTransmissionType(ctx context.Context, transmissionType string) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rp.FindByTransmissionType(ctx, transmissionType)
+}
+
+func (r *VehicleMapWAL) FindByBrandAverageCapacity(ctx context.Context, brand string) (avg float64, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rp.FindByBrandAverageCapacity(ctx, brand)
+}
+
+func (r *VehicleMapWAL) FindByWeightRange(ctx context.Context, minWeight, maxWeight float64) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rp.FindByWeightRange(ctx, minWeight, maxWeight)
+}
+
+func (r *VehicleMapWAL) FindByDimensionRange(ctx context.Context, minHeight, minWidth, maxHeight, maxWidth float64) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rp.FindByDimensionRange(ctx, minHeight, minWidth, maxHeight, maxWidth)
+}
+
+// Save is a method that saves a vehicle
+// - the id must be positive, a vehicle with the same id is overwritten
+// - the vehicle is durable once Save returns
+func (r *VehicleMapWAL) Save(ctx context.Context, v *internal.Vehicle) (err error) {
+	err = r.save(ctx, v, nil)
+	return
+}
+
+// SaveAudited is a method that saves a vehicle and records the entry of its history in a single log record
+func (r *VehicleMapWAL) SaveAudited(ctx context.Context, v *internal.Vehicle, e internal.VehicleHistoryEntry) (err error) {
+	err = r.save(ctx, v, &e)
+	return
+}
+
+// save is a method that saves a vehicle and records the entry e of its history in a single log record
+// - e is nil for a save without history
+func (r *VehicleMapWAL) save(ctx context.Context, v *internal.Vehicle, e *internal.VehicleHistoryEntry) (err error) {
+	if v.Id <= 0 {
+		err = fmt.Errorf("%w: id must be positive", internal.ErrVehicleInvalidField)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	op := walOpSave
+	if _, ok := r.rp.db[v.Id]; ok {
+		op = walOpUpdate
+	}
+	vh := *v
+	vh.Version = r.rp.next(v.Id)
+	if err = r.write(ctx, walRecord{Op: op, Id: v.Id, Vehicle: &vh, History: walHistory(e, vh.Version)}); err != nil {
+		return
+	}
+	v.Version = vh.Version
+	return
+}
+
+// Create is a method that saves a new vehicle, ErrVehicleExists if a vehicle with the same id exists
+// - the vehicle is durable once Create returns
+func (r *VehicleMapWAL) Create(ctx context.Context, v *internal.Vehicle) (err error) {
+	err = r.create(ctx, v, nil)
+	return
+}
+
+// CreateAudited is a method that saves a new vehicle and records the entry of its history in a single log record
+func (r *VehicleMapWAL) CreateAudited(ctx context.Context, v *internal.Vehicle, e internal.VehicleHistoryEntry) (err error) {
+	err = r.create(ctx, v, &e)
+	return
+}
+
+// create is a method that saves a new vehicle and records the entry e of its history in a single log record
+// - e is nil for a creation without history
+func (r *VehicleMapWAL) create(ctx context.Context, v *internal.Vehicle, e *internal.VehicleHistoryEntry) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err = r.rp.absent(v.Id); err != nil {
+		return
+	}
+	vh := *v
+	vh.Version = r.rp.next(v.Id)
+	if err = r.write(ctx, walRecord{Op: walOpSave, Id: v.Id, Vehicle: &vh, History: walHistory(e, vh.Version)}); err != nil {
+		return
+	}
+	v.Version = vh.Version
+	return
+}
+
+// SaveBatch is a method that saves the vehicles in order
+// - the vehicles are durable once SaveBatch returns
+func (r *VehicleMapWAL) SaveBatch(ctx context.Context, v []internal.Vehicle) (err error) {
+	err = r.saveBatch(ctx, v, nil)
+	return
+}
+
+// SaveBatchAudited is a method that saves the vehicles in order and records the entries of their history in a single log record
+func (r *VehicleMapWAL) SaveBatchAudited(ctx context.Context, v []internal.Vehicle, e []internal.VehicleHistoryEntry) (err error) {
+	if len(e) != len(v) {
+		err = fmt.Errorf("%w: %d vehicles and %d history entries", internal.ErrVehicleInvalidField, len(v), len(e))
+		return
+	}
+	err = r.saveBatch(ctx, v, e)
+	return
+}
+
+// saveBatch is a method that saves the vehicles in order and records e[i], the entry of v[i], in a single log record
+// - e is nil for a batch without history
+func (r *VehicleMapWAL) saveBatch(ctx context.Context, v []internal.Vehicle, e []internal.VehicleHistoryEntry) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, err := r.rp.batch(v)
+	if err != nil {
+		return
+	}
+	var history []internal.VehicleHistoryEntry
+	for i := range e {
+		history = append(history, walHistory(&e[i], b[i].Version)...)
+	}
+	if err = r.write(ctx, walRecord{Op: walOpBatch, Batch: b, History: history}); err != nil {
+		return
+	}
+	for i := range b {
+		v[i].Version = b[i].Version
+	}
+	return
+}
+
+// Update is a method that overwrites a vehicle if its stored version is version
+// - the vehicle is durable once Update returns
+func (r *VehicleMapWAL) Update(ctx context.Context, v *internal.Vehicle, version int) (err error) {
+	err = r.update(ctx, v, version, nil)
+	return
+}
+
+// UpdateAudited is a method that overwrites a vehicle if its stored version is version
+// and records the entry of its history in a single log record
+func (r *VehicleMapWAL) UpdateAudited(ctx context.Context, v *internal.Vehicle, version int, e internal.VehicleHistoryEntry) (err error) {
+	err = r.update(ctx, v, version, &e)
+	return
+}
+
+// update is a method that overwrites a vehicle if its stored version is version
+// and records the entry e of its history in a single log record
+// - e is nil for an update without history
+func (r *VehicleMapWAL) update(ctx context.Context, v *internal.Vehicle, version int, e *internal.VehicleHistoryEntry) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err = r.rp.check(v.Id, version); err != nil {
+		return
+	}
+	vh := *v
+	vh.Version = version + 1
+	if err = r.write(ctx, walRecord{Op: walOpUpdate, Id: v.Id, Vehicle: &vh, History: walHistory(e, vh.Version)}); err != nil {
+		return
+	}
+	v.Version = vh.Version
+	return
+}
+
+// Delete is a method that deletes a vehicle if its stored version is version
+// - the deletion is durable once Delete returns
+func (r *VehicleMapWAL) Delete(ctx context.Context, id int, version int) (err error) {
+	err = r.delete(ctx, id, version, nil)
+	return
+}
+
+// DeleteAudited is a method that deletes a vehicle if its stored version is version
+// and records the entry of its history in a single log record
+func (r *VehicleMapWAL) DeleteAudited(ctx context.Context, id int, version int, e internal.VehicleHistoryEntry) (err error) {
+	err = r.delete(ctx, id, version, &e)
+	return
+}
+
+// delete is a method that deletes a vehicle if its stored version is version
+// and records the entry e of its history in a single log record
+// - e is nil for a deletion without history
+func (r *VehicleMapWAL) delete(ctx context.Context, id int, version int, e *internal.VehicleHistoryEntry) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err = r.rp.check(id, version); err != nil {
+		return
+	}
+	err = r.write(ctx, walRecord{Op: walOpDelete, Id: id, Version: version, History: walHistory(e, version)})
+	return
+}
+
+// Replace is a method that replaces every vehicle with the vehicles of v
+// - the replacement is durable once Replace returns
+func (r *VehicleMapWAL) Replace(ctx context.Context, v map[int]internal.Vehicle) (err error) {
+	db, err := copyVehicles(ctx, v)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err = r.write(ctx, walRecord{Op: walOpReplace, Vehicles: db})
+	return
+}
+
+// AppendHistory is a method that records an entry of the history of a vehicle
+// - the entry is durable once AppendHistory returns, it is logged in order with the writes
+func (r *VehicleMapWAL) AppendHistory(ctx context.Context, e internal.VehicleHistoryEntry) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err = r.write(ctx, walRecord{Op: walOpHistory, History: []internal.VehicleHistoryEntry{e}})
+	return
+}
+
+// FindHistory is a method that returns the history of a vehicle, oldest first
+func (r *VehicleMapWAL) FindHistory(ctx context.Context, id int) (h []internal.VehicleHistoryEntry, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rp.FindHistory(ctx, id)
+}
+
+// FindHistorySince is a method that returns the entries of every vehicle recorded after t
+func (r *VehicleMapWAL) FindHistorySince(ctx context.Context, t time.Time) (h []internal.VehicleHistoryEntry, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rp.FindHistorySince(ctx, t)
+}
+
+// Snapshot is a method that takes a compacted snapshot of the current state and truncates the log
+func (r *VehicleMapWAL) Snapshot() (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err = r.compact()
+	return
+}
+
+// Close is a method that takes a last snapshot and closes the log and the history
+func (r *VehicleMapWAL) Close() (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.history.Close()
+	if err = r.compact(); err != nil {
+		r.log.Close()
+		return
+	}
+	err = r.log.Close()
+	return
+}
+
+// write is a method that appends a record to the log, fsyncs it and applies it to the map
+// - a failed append is truncated back to the previous record, the log is broken if it can not be
+// - a snapshot is taken when the log reaches snapshotEvery records, a failed one does not fail the write
+// - nothing is written if ctx is done
+func (r *VehicleMapWAL) write(ctx context.Context, record walRecord) (err error) {
+	if r.broken != nil {
+		err = fmt.Errorf("%w: %w", ErrWALBroken, r.broken)
+		return
+	}
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	buf := make([]byte, walHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	copy(buf[walHeaderSize:], payload)
+
+	if _, err = r.log.WriteAt(buf, r.offset); err == nil {
+		err = r.log.Sync()
+	}
+	if err != nil {
+		// - a torn record would hide every later record from the replay
+		if errTruncate := r.log.Truncate(r.offset); errTruncate != nil {
+			r.broken = err
+			internal.LoggerFromContext(ctx).Error("restoring the write-ahead log after a failed write, writes are refused",
+				slog.Any("error", err), slog.Any("truncate_error", errTruncate))
+		}
+		return
+	}
+	r.offset += int64(len(buf))
+	r.apply(record)
+	r.records++
+
+	// - the record is durable and applied, a failed compaction is retried on the next write
+	if r.records >= r.snapshotEvery {
+		logger := internal.LoggerFromContext(ctx)
+		if errCompact := r.compact(); errCompact != nil {
+			logger.Error("compacting the write-ahead log", slog.Int("records", r.records), slog.Any("error", errCompact))
+			return
+		}
+		logger.Debug("write-ahead log compacted into a snapshot", slog.Int("vehicles", len(r.rp.db)))
+	}
+	return
+}
+
+// apply is a method that applies a record to the map
+func (r *VehicleMapWAL) apply(record walRecord) {
+	switch record.Op {
+	case walOpSave, walOpUpdate:
+		if record.Vehicle != nil {
+			r.rp.put(*record.Vehicle)
+		}
+	case walOpDelete:
+		r.rp.remove(record.Id)
+		if record.Version > 0 {
+			r.rp.tombstones[record.Id] = record.Version
+		}
+	case walOpReplace:
+		// - no vehicles are omitted from the record
+		db := record.Vehicles
+		if db == nil {
+			db = make(map[int]internal.Vehicle)
+		}
+		r.rp.replace(db, newVehicleMapIndexes(db))
+	case walOpBatch:
+		for _, vh := range record.Batch {
+			r.rp.put(vh)
+		}
+	}
+	for _, e := range record.History {
+		r.rp.appendHistory(e)
+	}
+	r.pending = append(r.pending, record.History...)
+}
+
+// replay is a method that applies the records of the log to the map
+// - the log is truncated at the first incomplete or corrupted record
+// - a length beyond the end of the log is a corrupted record, it is not allocated
+// - the entries of the history already in the history file (a compaction interrupted after writing them) are skipped
+func (r *VehicleMapWAL) replay() (err error) {
+	recorded := make(map[walHistoryKey]struct{})
+	for _, entries := range r.rp.history {
+		for _, e := range entries {
+			recorded[walHistoryKey{id: e.VehicleId, version: e.Version, operation: e.Operation}] = struct{}{}
+		}
+	}
+
+	info, err := r.log.Stat()
+	if err != nil {
+		return
+	}
+	if _, err = r.log.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	reader := bufio.NewReader(r.log)
+
+	var offset int64
+	header := make([]byte, walHeaderSize)
+	for {
+		// - header
+		if _, err = io.ReadFull(reader, header); err != nil {
+			break
+		}
+		size := binary.LittleEndian.Uint32(header[0:4])
+		sum := binary.LittleEndian.Uint32(header[4:8])
+
+		// - payload
+		if int64(size) > info.Size()-offset-walHeaderSize {
+			break
+		}
+		payload := make([]byte, size)
+		if _, err = io.ReadFull(reader, payload); err != nil {
+			break
+		}
+		if crc32.ChecksumIEEE(payload) != sum {
+			break
+		}
+		var record walRecord
+		if err = json.Unmarshal(payload, &record); err != nil {
+			break
+		}
+		history := record.History[:0]
+		for _, e := range record.History {
+			if _, ok := recorded[walHistoryKey{id: e.VehicleId, version: e.Version, operation: e.Operation}]; !ok {
+				history = append(history, e)
+			}
+		}
+		record.History = history
+
+		r.apply(record)
+		r.records++
+		offset += int64(walHeaderSize) + int64(size)
+	}
+
+	// discard the tail after the last valid record
+	if tail := info.Size() - offset; tail > 0 {
+		slog.Warn("discarding the torn tail of the write-ahead log",
+			slog.String("path", r.log.Name()),
+			slog.Int64("offset", offset),
+			slog.Int64("bytes", tail),
+		)
+	}
+	if err = r.log.Truncate(offset); err != nil {
+		return
+	}
+	r.offset = offset
+	return
+}
+
+// compact is a method that appends the pending entries to the history file, writes the snapshot of the current state and truncates the log
+// - the truncation also drops the torn record of a broken log
+// - a crash between the steps is safe: replaying the log over the new snapshot and history yields the same state
+func (r *VehicleMapWAL) compact() (err error) {
+	if len(r.pending) > 0 {
+		if err = r.history.appendBatch(r.pending); err != nil {
+			return
+		}
+		r.pending = nil
+	}
+	if err = r.snapshot.Dump(r.rp.db); err != nil {
+		return
+	}
+	if err = r.log.Truncate(0); err != nil {
+		return
+	}
+	r.offset, r.broken = 0, nil
+	if err = r.log.Sync(); err != nil {
+		return
+	}
+	r.records = 0
+	return
+}
@@ -0,0 +1,304 @@
+package repository
+
+import (
+	"app/internal"
+	"app/internal/loader"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newWALVehicle is a function that returns a vehicle of the WAL tests
+func newWALVehicle(id int) internal.Vehicle {
+	return internal.Vehicle{Id: id, VehicleAttributes: internal.VehicleAttributes{Brand: "Fiat", Color: "Red", FabricationYear: 2000 + id}}
+}
+
+// walWithRecords is a function that returns the directory of a VehicleMapWAL with a record per vehicle saved in its log
+// - the files are closed without the last snapshot, as after a crash
+func walWithRecords(t *testing.T, ids ...int) (dir string) {
+	t.Helper()
+	dir = t.TempDir()
+	r, err := OpenVehicleMapWAL(nil, &ConfigVehicleMapWAL{Dir: dir, SnapshotEvery: 100})
+	require.NoError(t, err)
+	for _, id := range ids {
+		v := newWALVehicle(id)
+		require.NoError(t, r.Save(context.Background(), &v))
+	}
+	require.NoError(t, r.log.Close())
+	require.NoError(t, r.history.Close())
+	return
+}
+
+// reopenWAL is a function that opens the VehicleMapWAL of dir and returns the ids of its vehicles
+func reopenWAL(t *testing.T, dir string) (r *VehicleMapWAL, ids []int) {
+	t.Helper()
+	r, err := OpenVehicleMapWAL(nil, &ConfigVehicleMapWAL{Dir: dir, SnapshotEvery: 100})
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close() })
+	v, err := r.FindAll(context.Background())
+	require.NoError(t, err)
+	for id := range v {
+		ids = append(ids, id)
+	}
+	return
+}
+
+// Tests for OpenVehicleMapWAL
+func TestOpenVehicleMapWAL(t *testing.T) {
+	t.Run("case 1: should seed a directory left with an empty log and no snapshot by a crashed first start", func(t *testing.T) {
+		// arrange
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, walLogName), nil, 0o644))
+		seed := map[int]internal.Vehicle{1: newWALVehicle(1), 2: newWALVehicle(2)}
+
+		// act
+		exists := walExists(dir)
+		r, err := OpenVehicleMapWAL(seed, &ConfigVehicleMapWAL{Dir: dir, SnapshotEvery: 100})
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		_, ids := reopenWAL(t, dir)
+
+		// assert
+		require.False(t, exists)
+		require.ElementsMatch(t, []int{1, 2}, ids)
+		require.True(t, walExists(dir))
+	})
+}
+
+// Tests for the replay of VehicleMapWAL
+func TestVehicleMapWAL_Replay(t *testing.T) {
+	t.Run("case 1: should replay the log and discard a torn tail", func(t *testing.T) {
+		// arrange
+		dir := walWithRecords(t, 1, 2, 3)
+		header := make([]byte, walHeaderSize)
+		binary.LittleEndian.PutUint32(header[0:4], 100)
+		f, err := os.OpenFile(filepath.Join(dir, walLogName), os.O_APPEND|os.O_WRONLY, 0)
+		require.NoError(t, err)
+		_, err = f.Write(append(header, []byte(`{"op":"sa`)...))
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		// act
+		r, ids := reopenWAL(t, dir)
+		v := newWALVehicle(4)
+		errSave := r.Save(context.Background(), &v)
+		require.NoError(t, r.log.Close())
+		require.NoError(t, r.history.Close())
+		_, idsAfter := reopenWAL(t, dir)
+
+		// assert
+		require.ElementsMatch(t, []int{1, 2, 3}, ids)
+		require.NoError(t, errSave)
+		require.ElementsMatch(t, []int{1, 2, 3, 4}, idsAfter)
+	})
+
+	t.Run("case 2: should stop at a record with a bad CRC", func(t *testing.T) {
+		// arrange
+		dir := walWithRecords(t, 1, 2, 3)
+		path := filepath.Join(dir, walLogName)
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		data[len(data)-2] ^= 0xff
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+
+		// act
+		_, ids := reopenWAL(t, dir)
+
+		// assert
+		require.ElementsMatch(t, []int{1, 2}, ids)
+	})
+
+	t.Run("case 3: should not trust a length beyond the end of the log", func(t *testing.T) {
+		// arrange
+		dir := walWithRecords(t, 1)
+		header := make([]byte, walHeaderSize)
+		binary.LittleEndian.PutUint32(header[0:4], 0xffffffff)
+		f, err := os.OpenFile(filepath.Join(dir, walLogName), os.O_APPEND|os.O_WRONLY, 0)
+		require.NoError(t, err)
+		_, err = f.Write(header)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		// act
+		_, ids := reopenWAL(t, dir)
+
+		// assert
+		require.ElementsMatch(t, []int{1}, ids)
+	})
+
+	t.Run("case 4: should replay a replacement of every vehicle as a whole", func(t *testing.T) {
+		// arrange
+		dir := t.TempDir()
+		r, err := OpenVehicleMapWAL(nil, &ConfigVehicleMapWAL{Dir: dir, SnapshotEvery: 100})
+		require.NoError(t, err)
+		for _, id := range []int{1, 2} {
+			v := newWALVehicle(id)
+			require.NoError(t, r.Save(context.Background(), &v))
+		}
+		replaced := newWALVehicle(3)
+		replaced.Version = 5
+		require.NoError(t, r.Replace(context.Background(), map[int]internal.Vehicle{3: replaced}))
+		require.NoError(t, r.log.Close())
+		require.NoError(t, r.history.Close())
+
+		// act
+		r, ids := reopenWAL(t, dir)
+
+		// assert
+		require.ElementsMatch(t, []int{3}, ids)
+		v, err := r.FindById(context.Background(), 3)
+		require.NoError(t, err)
+		require.Equal(t, replaced, v)
+	})
+
+	t.Run("case 5: should not reuse the versions of a deleted vehicle after a replay", func(t *testing.T) {
+		// arrange
+		dir := walWithRecords(t, 1)
+		r, _ := reopenWAL(t, dir)
+		require.NoError(t, r.Delete(context.Background(), 1, 1))
+		require.NoError(t, r.log.Close())
+		require.NoError(t, r.history.Close())
+
+		// act
+		r, _ = reopenWAL(t, dir)
+		v := newWALVehicle(1)
+		err := r.Save(context.Background(), &v)
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, 2, v.Version)
+	})
+
+	t.Run("case 6: should not reuse the versions of a deleted vehicle in its history after a snapshot", func(t *testing.T) {
+		// arrange
+		dir := t.TempDir()
+		r, err := OpenVehicleMapWAL(map[int]internal.Vehicle{1: newWALVehicle(1)}, &ConfigVehicleMapWAL{Dir: dir, SnapshotEvery: 100})
+		require.NoError(t, err)
+		require.NoError(t, r.DeleteAudited(context.Background(), 1, 1, internal.VehicleHistoryEntry{VehicleId: 1, Operation: internal.VehicleOperationDelete}))
+		require.NoError(t, r.Close())
+
+		// act
+		r, _ = reopenWAL(t, dir)
+		v := newWALVehicle(1)
+		err = r.Save(context.Background(), &v)
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, 2, v.Version)
+	})
+
+	t.Run("case 7: should replay the entries of the audited writes with their vehicles", func(t *testing.T) {
+		// arrange
+		dir := t.TempDir()
+		r, err := OpenVehicleMapWAL(nil, &ConfigVehicleMapWAL{Dir: dir, SnapshotEvery: 100})
+		require.NoError(t, err)
+		v := newWALVehicle(1)
+		require.NoError(t, r.SaveAudited(context.Background(), &v, internal.VehicleHistoryEntry{VehicleId: 1, Operation: internal.VehicleOperationCreate}))
+		v.Color = "Blue"
+		require.NoError(t, r.UpdateAudited(context.Background(), &v, 1, internal.VehicleHistoryEntry{VehicleId: 1, Operation: internal.VehicleOperationUpdate}))
+		// - a crash before the entries are compacted into the history file
+		require.NoError(t, r.log.Close())
+		require.NoError(t, r.history.Close())
+
+		// act
+		r, _ = reopenWAL(t, dir)
+		stored, errFind := r.FindById(context.Background(), 1)
+		h, errHistory := r.FindHistory(context.Background(), 1)
+
+		// assert
+		require.NoError(t, errFind)
+		require.Equal(t, v, stored)
+		require.NoError(t, errHistory)
+		require.Len(t, h, 2)
+		require.Equal(t, []int{1, 2}, []int{h[0].Version, h[1].Version})
+	})
+
+	t.Run("case 8: should not duplicate the entries of a compaction interrupted after they were written to the history file", func(t *testing.T) {
+		// arrange
+		dir := t.TempDir()
+		r, err := OpenVehicleMapWAL(nil, &ConfigVehicleMapWAL{Dir: dir, SnapshotEvery: 100})
+		require.NoError(t, err)
+		v := newWALVehicle(1)
+		require.NoError(t, r.CreateAudited(context.Background(), &v, internal.VehicleHistoryEntry{VehicleId: 1, Operation: internal.VehicleOperationCreate}))
+		// - a crash after the history file was written, before the log was truncated
+		require.NoError(t, r.history.appendBatch(r.pending))
+		require.NoError(t, r.log.Close())
+		require.NoError(t, r.history.Close())
+
+		// act
+		r, _ = reopenWAL(t, dir)
+		h, errReplay := r.FindHistory(context.Background(), 1)
+		require.NoError(t, r.Close())
+		r, _ = reopenWAL(t, dir)
+		hCompacted, errCompacted := r.FindHistory(context.Background(), 1)
+
+		// assert
+		require.NoError(t, errReplay)
+		require.Len(t, h, 1)
+		require.NoError(t, errCompacted)
+		require.Equal(t, h, hCompacted)
+	})
+}
+
+// Tests for the writes of VehicleMapWAL
+func TestVehicleMapWAL_Write(t *testing.T) {
+	t.Run("case 1: should refuse writes after a failed append until a snapshot truncates the log", func(t *testing.T) {
+		// arrange
+		dir := t.TempDir()
+		r, err := OpenVehicleMapWAL(nil, &ConfigVehicleMapWAL{Dir: dir, SnapshotEvery: 100})
+		require.NoError(t, err)
+		t.Cleanup(func() { r.Close() })
+		v1, v2, v3 := newWALVehicle(1), newWALVehicle(2), newWALVehicle(3)
+		require.NoError(t, r.Save(context.Background(), &v1))
+		// - a log that can not be written nor truncated
+		log := r.log
+		r.log, err = os.Open(log.Name())
+		require.NoError(t, err)
+
+		// act
+		errFailed := r.Save(context.Background(), &v2)
+		_, errFind := r.FindById(context.Background(), 2)
+		r.log.Close()
+		r.log = log
+		errBroken := r.Save(context.Background(), &v3)
+		errSnapshot := r.Snapshot()
+		errHealed := r.Save(context.Background(), &v3)
+
+		// assert
+		require.Error(t, errFailed)
+		require.ErrorIs(t, errFind, internal.ErrVehicleNotFound)
+		require.ErrorIs(t, errBroken, ErrWALBroken)
+		require.NoError(t, errSnapshot)
+		require.NoError(t, errHealed)
+	})
+
+	t.Run("case 2: should acknowledge a durable write whose compaction failed and retry it", func(t *testing.T) {
+		// arrange
+		dir := t.TempDir()
+		r, err := OpenVehicleMapWAL(nil, &ConfigVehicleMapWAL{Dir: dir, SnapshotEvery: 1})
+		require.NoError(t, err)
+		t.Cleanup(func() { r.Close() })
+		snapshot := r.snapshot
+		r.snapshot = loader.NewVehicleJSONFile(filepath.Join(dir, "missing", walSnapshotName))
+		v1, v2 := newWALVehicle(1), newWALVehicle(2)
+
+		// act
+		errWrite := r.Save(context.Background(), &v1)
+		pending := r.records
+		r.snapshot = snapshot
+		errRetry := r.Save(context.Background(), &v2)
+
+		// assert
+		require.NoError(t, errWrite)
+		require.Equal(t, 1, pending)
+		require.NoError(t, errRetry)
+		require.Zero(t, r.records)
+		v, err := r.FindAll(context.Background())
+		require.NoError(t, err)
+		require.Len(t, v, 2)
+	})
+}
@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"app/internal"
+	"context"
+	"time"
+)
+
+// ObserveFunc is a function that records the duration and the error of an operation of a repository
+// - op is the name of the operation in snake case, e.g. find_all or save
+type ObserveFunc func(op string, d time.Duration, err error)
+
+// NewVehicleObserved is a function that returns a new instance of VehicleObserved
+// - it is a VehicleObservedAudited if rp implements internal.VehicleAuditedRepository
+func NewVehicleObserved(rp internal.VehicleRepository, observe ObserveFunc) internal.VehicleRepository {
+	r := &VehicleObserved{rp: rp, observe: observe}
+	if audited, ok := rp.(internal.VehicleAuditedRepository); ok {
+		return &VehicleObservedAudited{VehicleObserved: r, audited: audited}
+	}
+	return r
+}
+
+// VehicleObserved is a struct that implements the VehicleRepository interface
+// - it decorates a repository, reporting the duration and the error of every operation to observe
+// - the optional interfaces of the repository (io.Closer, internal.Pinger) are not forwarded, use the repository itself
+type VehicleObserved struct {
+	// rp is the repository decorated
+	rp internal.VehicleRepository
+	// observe records the operations
+	observe ObserveFunc
+}
+
+// FindAll is a method that observes FindAll of the repository
+func (r *VehicleObserved) FindAll(ctx context.Context) (v map[int]internal.Vehicle, err error) {
+	defer r.since("find_all", time.Now(), &err)
+	return r.rp.FindAll(ctx)
+}
+
+// FindById is a method that observes FindById of the repository
+func (r *VehicleObserved) FindById(ctx context.Context, id int) (v internal.Vehicle, err error) {
+	defer r.since("find_by_id", time.Now(), &err)
+	return r.rp.FindById(ctx, id)
+}
+
+// FindByColorYear is a method that observes FindByColorYear of the repository
+func (r *VehicleObserved) FindByColorYear(ctx context.Context, color string, year int) (v map[int]internal.Vehicle, err error) {
+	defer r.since("find_by_color_year", time.Now(), &err)
+	return r.rp.FindByColorYear(ctx, color, year)
+}
+
+// FindByBrandYearRange is a method that observes FindByBrandYearRange of the repository
+func (r *VehicleObserved) FindByBrandYearRange(ctx context.Context, brand string, startYear, endYear int) (v map[int]internal.Vehicle, err error) {
+	defer r.since("find_by_brand_year_range", time.Now(), &err)
+	return r.rp.FindByBrandYearRange(ctx, brand, startYear, endYear)
+}
+
+// FindByBrandAverageSpeed is a method that observes FindByBrandAverageSpeed of the repository
+func (r *VehicleObserved) FindByBrandAverageSpeed(ctx context.Context, brand string) (avg float64, err error) {
+	defer r.since("find_by_brand_average_speed", time.Now(), &err)
+	return r.rp.FindByBrandAverageSpeed(ctx, brand)
+}
+
+// FindByFuelType is a method that observes FindByFuelType of the repository
+func (r *VehicleObserved) FindByFuelType(ctx context.Context, fuelType string) (v map[int]internal.Vehicle, err error) {
+	defer r.since("find_by_fuel_type", time.Now(), &err)
+	return r.rp.FindByFuelType(ctx, fuelType)
+}
+
+// FindByTransmissionType is a method that observes FindByTransmissionType of the repository
+func (r *VehicleObserved) FindByTransmissionType(ctx context.Context, transmissionType string) (v map[int]internal.Vehicle, err error) {
+	defer r.since("find_by_transmission_type", time.Now(), &err)
+	return r.rp.FindByTransmissionType(ctx, transmissionType)
+}
+
+// FindByBrandAverageCapacity is a method that observes FindByBrandAverageCapacity of the repository
+func (r *VehicleObserved) FindByBrandAverageCapacity(ctx context.Context, brand string) (avg float64, err error) {
+	defer r.since("find_by_brand_average_capacity", time.Now(), &err)
+	return r.rp.FindByBrandAverageCapacity(ctx, brand)
+}
+
+// FindByWeightRange is a method that observes FindByWeightRange of the repository
+func (r *VehicleObserved) FindByWeightRange(ctx context.Context, minWeight, maxWeight float64) (v map[int]internal.Vehicle, err error) {
+	defer r.since("find_by_weight_range", time.Now(), &err)
+	return r.rp.FindByWeightRange(ctx, minWeight, maxWeight)
+}
+
+// FindByDimensionRange is a method that observes FindByDimensionRange of the repository
+func (r *VehicleObserved) FindByDimensionRange(ctx context.Context, minHeight, minWidth, maxHeight, maxWidth float64) (v map[int]internal.Vehicle, err error) {
+	defer r.since("find_by_dimension_range", time.Now(), &err)
+	return r.rp.FindByDimensionRange(ctx, minHeight, minWidth, maxHeight, maxWidth)
+}
+
+// Save is a method that observes Save of the repository
+func (r *VehicleObserved) Save(ctx context.Context, v *internal.Vehicle) (err error) {
+	defer r.since("save", time.Now(), &err)
+	return r.rp.Save(ctx, v)
+}
+
+// Create is a method that observes Create of the repository
+func (r *VehicleObserved) Create(ctx context.Context, v *internal.Vehicle) (err error) {
+	defer r.since("create", time.Now(), &err)
+	return r.rp.Create(ctx, v)
+}
+
+// SaveBatch is a method that observes SaveBatch of the repository
+func (r *VehicleObserved) SaveBatch(ctx context.Context, v []internal.Vehicle) (err error) {
+	defer r.since("save_batch", time.Now(), &err)
+	return r.rp.SaveBatch(ctx, v)
+}
+
+// Update is a method that observes Update of the repository
+func (r *VehicleObserved) Update(ctx context.Context, v *internal.Vehicle, version int) (err error) {
+	defer r.since("update", time.Now(), &err)
+	return r.rp.Update(ctx, v, version)
+}
+
+// Delete is a method that observes Delete of the repository
+func (r *VehicleObserved) Delete(ctx context.Context, id int, version int) (err error) {
+	defer r.since("delete", time.Now(), &err)
+	return r.rp.Delete(ctx, id, version)
+}
+
+// Replace is a method that observes Replace of the repository
+func (r *VehicleObserved) Replace(ctx context.Context, v map[int]internal.Vehicle) (err error) {
+	defer r.since("replace", time.Now(), &err)
+	return r.rp.Replace(ctx, v)
+}
+
+// AppendHistory is a method that observes AppendHistory of the repository
+func (r *VehicleObserved) AppendHistory(ctx context.Context, e internal.VehicleHistoryEntry) (err error) {
+	defer r.since("append_history", time.Now(), &err)
+	return r.rp.AppendHistory(ctx, e)
+}
+
+// FindHistory is a method that observes FindHistory of the repository
+func (r *VehicleObserved) FindHistory(ctx context.Context, id int) (h []internal.VehicleHistoryEntry, err error) {
+	defer r.since("find_history", time.Now(), &err)
+	return r.rp.FindHistory(ctx, id)
+}
+
+// FindHistorySince is a method that observes FindHistorySince of the repository
+func (r *VehicleObserved) FindHistorySince(ctx context.Context, t time.Time) (h []internal.VehicleHistoryEntry, err error) {
+	defer r.since("find_history_since", time.Now(), &err)
+	return r.rp.FindHistorySince(ctx, t)
+}
+
+// VehicleObservedAudited is a struct that implements the VehicleRepository and VehicleAuditedRepository interfaces
+// - it is the VehicleObserved of a repository that writes a vehicle and its history entry atomically
+type VehicleObservedAudited struct {
+	*VehicleObserved
+	// audited is the repository decorated
+	audited internal.VehicleAuditedRepository
+}
+
+// SaveAudited is a method that observes SaveAudited of the repository
+func (r *VehicleObservedAudited) SaveAudited(ctx context.Context, v *internal.Vehicle, e internal.VehicleHistoryEntry) (err error) {
+	defer r.since("save_audited", time.Now(), &err)
+	return r.audited.SaveAudited(ctx, v, e)
+}
+
+// CreateAudited is a method that observes CreateAudited of the repository
+func (r *VehicleObservedAudited) CreateAudited(ctx context.Context, v *internal.Vehicle, e internal.VehicleHistoryEntry) (err error) {
+	defer r.since("create_audited", time.Now(), &err)
+	return r.audited.CreateAudited(ctx, v, e)
+}
+
+// SaveBatchAudited is a method that observes SaveBatchAudited of the repository
+func (r *VehicleObservedAudited) SaveBatchAudited(ctx context.Context, v []internal.Vehicle, e []internal.VehicleHistoryEntry) (err error) {
+	defer r.since("save_batch_audited", time.Now(), &err)
+	return r.audited.SaveBatchAudited(ctx, v, e)
+}
+
+// UpdateAudited is a method that observes UpdateAudited of the repository
+func (r *VehicleObservedAudited) UpdateAudited(ctx context.Context, v *internal.Vehicle, version int, e internal.VehicleHistoryEntry) (err error) {
+	defer r.since("update_audited", time.Now(), &err)
+	return r.audited.UpdateAudited(ctx, v, version, e)
+}
+
+// DeleteAudited is a method that observes DeleteAudited of the repository
+func (r *VehicleObservedAudited) DeleteAudited(ctx context.Context, id int, version int, e internal.VehicleHistoryEntry) (err error) {
+	defer r.since("delete_audited", time.Now(), &err)
+	return r.audited.DeleteAudited(ctx, id, version, e)
+}
+
+// since is a method that observes the operation op started at start, with the error at err once it returns
+func (r *VehicleObserved) since(op string, start time.Time, err *error) {
+	r.observe(op, time.Since(start), *err)
+}
@@ -0,0 +1,679 @@
+package repository
+
+import (
+	"app/internal"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+func init() {
+	// sqlite:///path/to/vehicles.db[?seed=false] stores the vehicles in a SQLite database
+	// - an empty database is populated with the seed unless seed=false
+	Register("sqlite", DriverFunc(func(dsn *url.URL, seed internal.VehicleLoader) (rp internal.VehicleRepository, err error) {
+		path, err := dsnPath(dsn)
+		if err != nil {
+			return
+		}
+		populate, err := dsnBoolOption(dsn, "seed", true)
+		if err != nil {
+			return
+		}
+
+		r, err := OpenVehicleSQLite(path)
+		if err != nil {
+			return
+		}
+		if populate {
+			if err = populateEmpty(context.Background(), r, seed); err != nil {
+				r.Close()
+				return
+			}
+		}
+		rp = r
+		return
+	}))
+}
+
+// importer is an interface that represents a repository that can save many vehicles at once
+type importer interface {
+	// FindAll is a method that returns a map of all vehicles
+	FindAll(ctx context.Context) (v map[int]internal.Vehicle, err error)
+	// Import is a method that saves all the vehicles
+	Import(ctx context.Context, v map[int]internal.Vehicle) (err error)
+}
+
+// populateEmpty is a function that imports the vehicles of the seed if the repository is empty
+func populateEmpty(ctx context.Context, r importer, seed internal.VehicleLoader) (err error) {
+	current, err := r.FindAll(ctx)
+	if err != nil || len(current) > 0 {
+		return
+	}
+	db, err := loadSeed(seed)
+	if err != nil || len(db) == 0 {
+		return
+	}
+	err = r.Import(ctx, db)
+	return
+}
+
+// sqliteMigrations are the migrations of the vehicles schema, the version of a migration is its index plus one
+// - migrations are append only, an applied migration must never be modified
+var sqliteMigrations = []string{
+	// 1: vehicles table
+	`CREATE TABLE vehicles (
+		id               INTEGER PRIMARY KEY,
+		brand            TEXT    NOT NULL,
+		model            TEXT    NOT NULL,
+		registration     TEXT    NOT NULL,
+		color            TEXT    NOT NULL,
+		fabrication_year INTEGER NOT NULL,
+		capacity         INTEGER NOT NULL,
+		max_speed        REAL    NOT NULL,
+		fuel_type        TEXT    NOT NULL,
+		transmission     TEXT    NOT NULL,
+		weight           REAL    NOT NULL,
+		height           REAL    NOT NULL,
+		length           REAL    NOT NULL,
+		width            REAL    NOT NULL
+	)`,
+	// 2: indexes for the queries of the repository
+	`CREATE INDEX idx_vehicles_color_year ON vehicles (color, fabrication_year);
+	CREATE INDEX idx_vehicles_brand_year ON vehicles (brand, fabrication_year);
+	CREATE INDEX idx_vehicles_fuel_type ON vehicles (fuel_type);
+	CREATE INDEX idx_vehicles_transmission ON vehicles (transmission);
+	CREATE INDEX idx_vehicles_weight ON vehicles (weight);
+	CREATE INDEX idx_vehicles_height_width ON vehicles (height, width)`,
+	// 3: version of the vehicles for optimistic concurrency
+	`ALTER TABLE vehicles ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+	// 4: history of the vehicles, the changes are a JSON array
+	`CREATE TABLE vehicle_history (
+		seq        INTEGER PRIMARY KEY AUTOINCREMENT,
+		vehicle_id INTEGER NOT NULL,
+		version    INTEGER NOT NULL,
+		timestamp  TEXT    NOT NULL,
+		actor      TEXT    NOT NULL,
+		operation  TEXT    NOT NULL,
+		changes    TEXT    NOT NULL
+	);
+	CREATE INDEX idx_vehicle_history_vehicle ON vehicle_history (vehicle_id, seq)`,
+	// 5: last versions of the deleted vehicles, restored from the history of the vehicles deleted before
+	`CREATE TABLE vehicle_tombstones (
+		id      INTEGER PRIMARY KEY,
+		version INTEGER NOT NULL
+	);
+	INSERT INTO vehicle_tombstones (id, version)
+		SELECT vehicle_id, MAX(version) FROM vehicle_history
+		WHERE vehicle_id NOT IN (SELECT id FROM vehicles)
+		GROUP BY vehicle_id`,
+}
+
+// sqliteVehicleColumns are the columns of the vehicles table in the order scanned by query
+const sqliteVehicleColumns = "id, brand, model, registration, color, fabrication_year, capacity, max_speed, fuel_type, transmission, weight, height, length, width, version"
+
+// OpenVehicleSQLite is a function that opens (or creates) the SQLite database at path and migrates it
+func OpenVehicleSQLite(path string) (r *VehicleSQLite, err error) {
+	// - WAL journal so readers do not block the writer, and wait for locks instead of failing
+	// - transactions take the write lock when they begin (BEGIN IMMEDIATE): a read upgraded to a write later
+	// fails with SQLITE_BUSY at once under WAL, busy_timeout does not apply to it
+	dsn := fmt.Sprintf("file:%s?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=synchronous(NORMAL)&_txlock=immediate", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return
+	}
+
+	r = NewVehicleSQLite(db)
+	if err = r.Migrate(); err != nil {
+		db.Close()
+		r = nil
+		return
+	}
+	return
+}
+
+// Constructor
+// NewVehicleSQLite is a function that returns a new instance of VehicleSQLite
+// - the database must be migrated (see Migrate) before it is used
+func NewVehicleSQLite(db *sql.DB) *VehicleSQLite {
+	return &VehicleSQLite{db: db}
+}
+
+// VehicleSQLite is a struct that represents a vehicle repository on a SQLite database
+type VehicleSQLite struct {
+	// db is the database connection pool
+	db *sql.DB
+}
+
+// Migrate is a method that applies the pending migrations of the schema
+func (r *VehicleSQLite) Migrate() (err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	// current version
+	if _, err = tx.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		return
+	}
+	var version int
+	if err = tx.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return
+	}
+
+	// pending migrations
+	for i := version; i < len(sqliteMigrations); i++ {
+		if _, err = tx.Exec(sqliteMigrations[i]); err != nil {
+			err = fmt.Errorf("migration %d: %w", i+1, err)
+			return
+		}
+		if _, err = tx.Exec("INSERT INTO schema_migrations (version) VALUES (?)", i+1); err != nil {
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return
+	}
+	if version < len(sqliteMigrations) {
+		slog.Info("sqlite schema migrated", slog.Int("from", version), slog.Int("to", len(sqliteMigrations)))
+	}
+	return
+}
+
+// Close is a method that closes the database
+func (r *VehicleSQLite) Close() (err error) {
+	err = r.db.Close()
+	return
+}
+
+// Ping is a method that checks the database is reachable
+func (r *VehicleSQLite) Ping(ctx context.Context) (err error) {
+	err = r.db.PingContext(ctx)
+	return
+}
+
+// Import is a method that saves all the vehicles in a single transaction
+// - existing vehicles with the same id are overwritten
+// - the versions of the vehicles are kept, vehicles without a version are at their first version
+func (r *VehicleSQLite) Import(ctx context.Context, v map[int]internal.Vehicle) (err error) {
+	err = r.transaction(ctx, func(tx *sql.Tx) error { return sqliteImport(ctx, tx, v) })
+	return
+}
+
+// Replace is a method that replaces every vehicle with the vehicles of v in a single transaction
+func (r *VehicleSQLite) Replace(ctx context.Context, v map[int]internal.Vehicle) (err error) {
+	err = r.transaction(ctx, func(tx *sql.Tx) (err error) {
+		// - the vehicles left out are tombstoned at their last version, so their ids are not reused at an earlier one
+		if _, err = tx.ExecContext(ctx, `INSERT INTO vehicle_tombstones (id, version) SELECT id, version FROM vehicles WHERE true
+			ON CONFLICT (id) DO UPDATE SET version = MAX(vehicle_tombstones.version, excluded.version)`); err != nil {
+			return
+		}
+		if _, err = tx.ExecContext(ctx, "DELETE FROM vehicles"); err != nil {
+			return
+		}
+		err = sqliteImport(ctx, tx, v)
+		return
+	})
+	return
+}
+
+// sqliteImport is a function that saves all the vehicles in tx keeping their versions
+func sqliteImport(ctx context.Context, tx *sql.Tx, v map[int]internal.Vehicle) (err error) {
+	stmt, err := tx.PrepareContext(ctx, sqliteUpsert+", version = excluded.version")
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+
+	for _, vh := range v {
+		vh.Version = max(vh.Version, 1)
+		if _, err = stmt.ExecContext(ctx, sqliteArgs(&vh)...); err != nil {
+			return
+		}
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM vehicle_tombstones WHERE id IN (SELECT id FROM vehicles)")
+	return
+}
+
+// FindAll is a method that returns a map of all vehicles
+func (r *VehicleSQLite) FindAll(ctx context.Context) (v map[int]internal.Vehicle, err error) {
+	v, err = r.query(ctx, "SELECT "+sqliteVehicleColumns+" FROM vehicles")
+	return
+}
+
+// FindById is a method that returns a vehicle by id
+func (r *VehicleSQLite) FindById(ctx context.Context, id int) (v internal.Vehicle, err error) {
+	found, err := r.query(ctx, "SELECT "+sqliteVehicleColumns+" FROM vehicles WHERE id = ?", id)
+	if err != nil {
+		return
+	}
+	v, ok := found[id]
+	if !ok {
+		err = internal.ErrVehicleNotFound
+	}
+	return
+}
+
+func (r *VehicleSQLite) FindByColorYear(ctx context.Context, color string, year int) (v map[int]internal.Vehicle, err error) {
+	v, err = r.query(ctx, "SELECT "+sqliteVehicleColumns+" FROM vehicles WHERE color = ? AND fabrication_year = ?", color, year)
+	return
+}
+
+func (r *VehicleSQLite) FindByBrandYearRange(ctx context.Context, brand string, startYear, endYear int) (v map[int]internal.Vehicle, err error) {
+	v, err = r.query(ctx, "SELECT "+sqliteVehicleColumns+" FROM vehicles WHERE brand = ? AND fabrication_year BETWEEN ? AND ?", brand, startYear, endYear)
+	return
+}
+
+func (r *VehicleSQLite) FindByBrandAverageSpeed(ctx context.Context, brand string) (avg float64, err error) {
+	err = r.db.QueryRowContext(ctx, "SELECT COALESCE(AVG(max_speed), 0) FROM vehicles WHERE brand = ?", brand).Scan(&avg)
+	return
+}
+
+func (r *VehicleSQLite) FindByFuelType(ctx context.Context, fuelType string) (v map[int]internal.Vehicle, err error) {
+	v, err = r.query(ctx, "SELECT "+sqliteVehicleColumns+" FROM vehicles WHERE fuel_type = ?", fuelType)
+	return
+}
+
+func (r *VehicleSQLite) FindByTransmissionType(ctx context.Context, transmissionType string) (v map[int]internal.Vehicle, err error) {
+	v, err = r.query(ctx, "SELECT "+sqliteVehicleColumns+" FROM vehicles WHERE transmission = ?", transmissionType)
+	return
+}
+
+func (r *VehicleSQLite) FindByBrandAverageCapacity(ctx context.Context, brand string) (avg float64, err error) {
+	err = r.db.QueryRowContext(ctx, "SELECT COALESCE(AVG(capacity), 0) FROM vehicles WHERE brand = ?", brand).Scan(&avg)
+	return
+}
+
+func (r *VehicleSQLite) FindByWeightRange(ctx context.Context, minWeight, maxWeight float64) (v map[int]internal.Vehicle, err error) {
+	v, err = r.query(ctx, "SELECT "+sqliteVehicleColumns+" FROM vehicles WHERE weight BETWEEN ? AND ?", minWeight, maxWeight)
+	return
+}
+
+func (r *VehicleSQLite) FindByDimensionRange(ctx context.Context, minHeight, minWidth, maxHeight, maxWidth float64) (v map[int]internal.Vehicle, err error) {
+	v, err = r.query(ctx, "SELECT "+sqliteVehicleColumns+" FROM vehicles WHERE height BETWEEN ? AND ? AND width BETWEEN ? AND ?", minHeight, maxHeight, minWidth, maxWidth)
+	return
+}
+
+// sqliteUpsert is the statement that inserts a vehicle or overwrites the vehicle with the same id
+// - the version of an overwritten vehicle is set by the statements built on it
+const sqliteUpsert = `INSERT INTO vehicles (` + sqliteVehicleColumns + `)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (id) DO UPDATE SET
+		brand = excluded.brand, model = excluded.model, registration = excluded.registration, color = excluded.color,
+		fabrication_year = excluded.fabrication_year, capacity = excluded.capacity, max_speed = excluded.max_speed,
+		fuel_type = excluded.fuel_type, transmission = excluded.transmission, weight = excluded.weight,
+		height = excluded.height, length = excluded.length, width = excluded.width`
+
+// sqliteExecer is an interface that represents the database or a transaction of it
+type sqliteExecer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Save is a method that saves a vehicle
+// - the id must be positive, a vehicle with the same id is overwritten
+func (r *VehicleSQLite) Save(ctx context.Context, v *internal.Vehicle) (err error) {
+	vh := *v
+	err = r.transaction(ctx, func(tx *sql.Tx) error { return sqliteSave(ctx, tx, &vh) })
+	if err == nil {
+		v.Version = vh.Version
+	}
+	return
+}
+
+// Create is a method that saves a new vehicle, ErrVehicleExists if a vehicle with the same id exists
+func (r *VehicleSQLite) Create(ctx context.Context, v *internal.Vehicle) (err error) {
+	vh := *v
+	err = r.transaction(ctx, func(tx *sql.Tx) error { return sqliteCreate(ctx, tx, &vh) })
+	if err == nil {
+		v.Version = vh.Version
+	}
+	return
+}
+
+// SaveBatch is a method that saves the vehicles in order in a single transaction
+func (r *VehicleSQLite) SaveBatch(ctx context.Context, v []internal.Vehicle) (err error) {
+	b := append([]internal.Vehicle(nil), v...)
+	err = r.transaction(ctx, func(tx *sql.Tx) (err error) {
+		for i := range b {
+			if err = sqliteSave(ctx, tx, &b[i]); err != nil {
+				return
+			}
+		}
+		return
+	})
+	if err == nil {
+		copy(v, b)
+	}
+	return
+}
+
+// Update is a method that overwrites a vehicle if its stored version is version
+func (r *VehicleSQLite) Update(ctx context.Context, v *internal.Vehicle, version int) (err error) {
+	err = sqliteUpdate(ctx, r.db, v, version)
+	return
+}
+
+// Delete is a method that deletes a vehicle if its stored version is version
+func (r *VehicleSQLite) Delete(ctx context.Context, id int, version int) (err error) {
+	err = r.transaction(ctx, func(tx *sql.Tx) error { return sqliteDelete(ctx, tx, id, version) })
+	return
+}
+
+// AppendHistory is a method that records an entry of the history of a vehicle
+func (r *VehicleSQLite) AppendHistory(ctx context.Context, e internal.VehicleHistoryEntry) (err error) {
+	err = sqliteAppendHistory(ctx, r.db, e)
+	return
+}
+
+// SaveAudited is a method that saves a vehicle and records the entry of its history in a single transaction
+func (r *VehicleSQLite) SaveAudited(ctx context.Context, v *internal.Vehicle, e internal.VehicleHistoryEntry) (err error) {
+	vh := *v
+	err = r.transaction(ctx, func(tx *sql.Tx) (err error) {
+		if err = sqliteSave(ctx, tx, &vh); err != nil {
+			return
+		}
+		e.Version = vh.Version
+		err = sqliteAppendHistory(ctx, tx, e)
+		return
+	})
+	if err == nil {
+		v.Version = vh.Version
+	}
+	return
+}
+
+// CreateAudited is a method that saves a new vehicle and records the entry of its history in a single transaction
+func (r *VehicleSQLite) CreateAudited(ctx context.Context, v *internal.Vehicle, e internal.VehicleHistoryEntry) (err error) {
+	vh := *v
+	err = r.transaction(ctx, func(tx *sql.Tx) (err error) {
+		if err = sqliteCreate(ctx, tx, &vh); err != nil {
+			return
+		}
+		e.Version = vh.Version
+		err = sqliteAppendHistory(ctx, tx, e)
+		return
+	})
+	if err == nil {
+		v.Version = vh.Version
+	}
+	return
+}
+
+// SaveBatchAudited is a method that saves the vehicles in order and records the entries of their history in a single transaction
+func (r *VehicleSQLite) SaveBatchAudited(ctx context.Context, v []internal.Vehicle, e []internal.VehicleHistoryEntry) (err error) {
+	if len(e) != len(v) {
+		err = fmt.Errorf("%w: %d vehicles and %d history entries", internal.ErrVehicleInvalidField, len(v), len(e))
+		return
+	}
+	b := append([]internal.Vehicle(nil), v...)
+	err = r.transaction(ctx, func(tx *sql.Tx) (err error) {
+		for i := range b {
+			if err = sqliteSave(ctx, tx, &b[i]); err != nil {
+				return
+			}
+			entry := e[i]
+			entry.Version = b[i].Version
+			if err = sqliteAppendHistory(ctx, tx, entry); err != nil {
+				return
+			}
+		}
+		return
+	})
+	if err == nil {
+		copy(v, b)
+	}
+	return
+}
+
+// UpdateAudited is a method that overwrites a vehicle if its stored version is version
+// and records the entry of its history in a single transaction
+func (r *VehicleSQLite) UpdateAudited(ctx context.Context, v *internal.Vehicle, version int, e internal.VehicleHistoryEntry) (err error) {
+	vh := *v
+	err = r.transaction(ctx, func(tx *sql.Tx) (err error) {
+		if err = sqliteUpdate(ctx, tx, &vh, version); err != nil {
+			return
+		}
+		e.Version = vh.Version
+		err = sqliteAppendHistory(ctx, tx, e)
+		return
+	})
+	if err == nil {
+		v.Version = vh.Version
+	}
+	return
+}
+
+// DeleteAudited is a method that deletes a vehicle if its stored version is version
+// and records the entry of its history in a single transaction
+func (r *VehicleSQLite) DeleteAudited(ctx context.Context, id int, version int, e internal.VehicleHistoryEntry) (err error) {
+	err = r.transaction(ctx, func(tx *sql.Tx) (err error) {
+		if err = sqliteDelete(ctx, tx, id, version); err != nil {
+			return
+		}
+		e.Version = version
+		err = sqliteAppendHistory(ctx, tx, e)
+		return
+	})
+	return
+}
+
+// transaction is a method that runs fn in a transaction, committed only if fn succeeds
+func (r *VehicleSQLite) transaction(ctx context.Context, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	if err = fn(tx); err != nil {
+		return
+	}
+	err = tx.Commit()
+	return
+}
+
+// sqliteSave is a function that saves a vehicle with q, a vehicle with the same id is overwritten
+// - q must be a transaction, the vehicle and its tombstone are written together
+func sqliteSave(ctx context.Context, q sqliteExecer, v *internal.Vehicle) (err error) {
+	if v.Id <= 0 {
+		err = fmt.Errorf("%w: id must be positive", internal.ErrVehicleInvalidField)
+		return
+	}
+	vh := *v
+	if vh.Version, err = sqliteNextVersion(ctx, q, v.Id); err != nil {
+		return
+	}
+	if err = q.QueryRowContext(ctx, sqliteUpsert+", version = vehicles.version + 1 RETURNING version", sqliteArgs(&vh)...).Scan(&vh.Version); err != nil {
+		return
+	}
+	if _, err = q.ExecContext(ctx, "DELETE FROM vehicle_tombstones WHERE id = ?", v.Id); err != nil {
+		return
+	}
+	v.Version = vh.Version
+	return
+}
+
+// sqliteCreate is a function that saves a new vehicle with q, ErrVehicleExists if a vehicle with the same id exists
+// - q must be a transaction, the vehicle and its tombstone are written together
+// - the insert itself is the check, two concurrent creates can not both succeed
+func sqliteCreate(ctx context.Context, q sqliteExecer, v *internal.Vehicle) (err error) {
+	if v.Id <= 0 {
+		err = fmt.Errorf("%w: id must be positive", internal.ErrVehicleInvalidField)
+		return
+	}
+	vh := *v
+	if vh.Version, err = sqliteNextVersion(ctx, q, v.Id); err != nil {
+		return
+	}
+	result, err := q.ExecContext(ctx, `INSERT INTO vehicles (`+sqliteVehicleColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO NOTHING`, sqliteArgs(&vh)...)
+	if err != nil {
+		return
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+	if affected == 0 {
+		err = internal.ErrVehicleExists
+		return
+	}
+	if _, err = q.ExecContext(ctx, "DELETE FROM vehicle_tombstones WHERE id = ?", v.Id); err != nil {
+		return
+	}
+	v.Version = vh.Version
+	return
+}
+
+// sqliteNextVersion is a function that returns the version of a vehicle inserted with the id
+// - 1 for an id never written, the last version plus one for the id of a deleted vehicle
+func sqliteNextVersion(ctx context.Context, q sqliteExecer, id int) (version int, err error) {
+	err = q.QueryRowContext(ctx, "SELECT COALESCE((SELECT version FROM vehicle_tombstones WHERE id = ?), 0) + 1", id).Scan(&version)
+	return
+}
+
+// sqliteUpdate is a function that overwrites a vehicle with q if its stored version is version
+func sqliteUpdate(ctx context.Context, q sqliteExecer, v *internal.Vehicle, version int) (err error) {
+	vh := *v
+	vh.Version = version + 1
+	result, err := q.ExecContext(ctx, `UPDATE vehicles SET
+		brand = ?, model = ?, registration = ?, color = ?, fabrication_year = ?, capacity = ?, max_speed = ?,
+		fuel_type = ?, transmission = ?, weight = ?, height = ?, length = ?, width = ?, version = ?
+		WHERE id = ? AND version = ?`, append(sqliteArgs(&vh)[1:], vh.Id, version)...)
+	if err != nil {
+		return
+	}
+	if err = sqliteCheckAffected(ctx, q, result, v.Id, version); err != nil {
+		return
+	}
+	v.Version = vh.Version
+	return
+}
+
+// sqliteDelete is a function that deletes a vehicle with q if its stored version is version
+// - q must be a transaction, the vehicle and its tombstone are written together
+func sqliteDelete(ctx context.Context, q sqliteExecer, id int, version int) (err error) {
+	result, err := q.ExecContext(ctx, "DELETE FROM vehicles WHERE id = ? AND version = ?", id, version)
+	if err != nil {
+		return
+	}
+	if err = sqliteCheckAffected(ctx, q, result, id, version); err != nil {
+		return
+	}
+	_, err = q.ExecContext(ctx, `INSERT INTO vehicle_tombstones (id, version) VALUES (?, ?)
+		ON CONFLICT (id) DO UPDATE SET version = excluded.version`, id, version)
+	return
+}
+
+// sqliteAppendHistory is a function that records an entry of the history of a vehicle with q
+func sqliteAppendHistory(ctx context.Context, q sqliteExecer, e internal.VehicleHistoryEntry) (err error) {
+	changes, err := json.Marshal(e.Changes)
+	if err != nil {
+		return
+	}
+	_, err = q.ExecContext(ctx, "INSERT INTO vehicle_history (vehicle_id, version, timestamp, actor, operation, changes) VALUES (?, ?, ?, ?, ?, ?)",
+		e.VehicleId, e.Version, e.Timestamp.UTC().Format(sqliteTimeFormat), e.Actor, string(e.Operation), string(changes))
+	return
+}
+
+// FindHistory is a method that returns the history of a vehicle, oldest first
+func (r *VehicleSQLite) FindHistory(ctx context.Context, id int) (h []internal.VehicleHistoryEntry, err error) {
+	h, err = r.queryHistory(ctx, "WHERE vehicle_id = ?", id)
+	return
+}
+
+// FindHistorySince is a method that returns the entries of every vehicle recorded after t
+func (r *VehicleSQLite) FindHistorySince(ctx context.Context, t time.Time) (h []internal.VehicleHistoryEntry, err error) {
+	h, err = r.queryHistory(ctx, "WHERE timestamp > ?", t.UTC().Format(sqliteTimeFormat))
+	return
+}
+
+// sqliteTimeFormat is the format of the timestamps of the history, fixed width so they sort as text
+const sqliteTimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+// queryHistory is a method that returns the history entries selected by a condition, in the order they were recorded
+func (r *VehicleSQLite) queryHistory(ctx context.Context, condition string, args ...any) (h []internal.VehicleHistoryEntry, err error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT vehicle_id, version, timestamp, actor, operation, changes FROM vehicle_history "+condition+" ORDER BY seq", args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	h = make([]internal.VehicleHistoryEntry, 0)
+	for rows.Next() {
+		var e internal.VehicleHistoryEntry
+		var timestamp, changes string
+		if err = rows.Scan(&e.VehicleId, &e.Version, &timestamp, &e.Actor, &e.Operation, &changes); err != nil {
+			return
+		}
+		if e.Timestamp, err = time.Parse(time.RFC3339Nano, timestamp); err != nil {
+			return
+		}
+		if err = json.Unmarshal([]byte(changes), &e.Changes); err != nil {
+			return
+		}
+		h = append(h, e)
+	}
+	err = rows.Err()
+	return
+}
+
+// sqliteCheckAffected is a function that returns why a conditional write of q on a vehicle affected no row
+func sqliteCheckAffected(ctx context.Context, q sqliteExecer, result sql.Result, id int, version int) (err error) {
+	affected, err := result.RowsAffected()
+	if err != nil || affected > 0 {
+		return
+	}
+	var current int
+	switch err = q.QueryRowContext(ctx, "SELECT version FROM vehicles WHERE id = ?", id).Scan(&current); {
+	case errors.Is(err, sql.ErrNoRows):
+		err = internal.ErrVehicleNotFound
+	case err == nil:
+		err = fmt.Errorf("%w: expected %d, stored %d", internal.ErrVehicleVersionMismatch, version, current)
+	}
+	return
+}
+
+// sqliteArgs is a function that returns the values of a vehicle in the order of sqliteVehicleColumns
+func sqliteArgs(v *internal.Vehicle) []any {
+	return []any{
+		v.Id, v.Brand, v.Model, v.Registration, v.Color, v.FabricationYear, v.Capacity, v.MaxSpeed,
+		v.FuelType, v.Transmission, v.Weight, v.Height, v.Length, v.Width, v.Version,
+	}
+}
+
+// query is a method that returns the vehicles selected by a query on sqliteVehicleColumns
+func (r *VehicleSQLite) query(ctx context.Context, query string, args ...any) (v map[int]internal.Vehicle, err error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	v = make(map[int]internal.Vehicle)
+	for rows.Next() {
+		var vh internal.Vehicle
+		if err = rows.Scan(
+			&vh.Id, &vh.Brand, &vh.Model, &vh.Registration, &vh.Color, &vh.FabricationYear, &vh.Capacity, &vh.MaxSpeed,
+			&vh.FuelType, &vh.Transmission, &vh.Weight, &vh.Height, &vh.Length, &vh.Width, &vh.Version,
+		); err != nil {
+			return
+		}
+		v[vh.Id] = vh
+	}
+	err = rows.Err()
+	return
+}
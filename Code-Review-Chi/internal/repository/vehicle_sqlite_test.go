@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"app/internal"
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// openSQLiteAt is a function that opens the VehicleSQLite at path and closes it when the test finishes
+func openSQLiteAt(t *testing.T, path string) (r *VehicleSQLite) {
+	t.Helper()
+	r, err := OpenVehicleSQLite(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close() })
+	return
+}
+
+// sqliteSchemaVersion is a function that returns the last migration applied to the database of r
+func sqliteSchemaVersion(t *testing.T, r *VehicleSQLite) (version int) {
+	t.Helper()
+	require.NoError(t, r.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version))
+	return
+}
+
+// Tests for the migrations of VehicleSQLite
+func TestVehicleSQLite_Migrate(t *testing.T) {
+	t.Run("case 1: should apply every migration to a new database and none to a migrated one", func(t *testing.T) {
+		// arrange
+		r := openSQLiteAt(t, filepath.Join(t.TempDir(), "vehicles.db"))
+
+		// act
+		errAgain := r.Migrate()
+
+		// assert
+		require.NoError(t, errAgain)
+		require.Equal(t, len(sqliteMigrations), sqliteSchemaVersion(t, r))
+		var applied int
+		require.NoError(t, r.db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&applied))
+		require.Equal(t, len(sqliteMigrations), applied)
+	})
+
+	t.Run("case 2: should migrate a database of an older schema keeping its data", func(t *testing.T) {
+		// arrange
+		db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "vehicles.db"))
+		require.NoError(t, err)
+		// - the schema before the tombstones, with a vehicle deleted at version 2
+		_, err = db.Exec(`CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY, applied_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP)`)
+		require.NoError(t, err)
+		for i := 0; i < 4; i++ {
+			_, err = db.Exec(sqliteMigrations[i])
+			require.NoError(t, err)
+			_, err = db.Exec("INSERT INTO schema_migrations (version) VALUES (?)", i+1)
+			require.NoError(t, err)
+		}
+		_, err = db.Exec(`INSERT INTO vehicles (` + sqliteVehicleColumns + `) VALUES (1, 'Fiat', 'Uno', 'U1', 'Red', 1990, 4, 140, 'gasoline', 'manual', 800, 140, 360, 150, 3)`)
+		require.NoError(t, err)
+		_, err = db.Exec(`INSERT INTO vehicle_history (vehicle_id, version, timestamp, actor, operation, changes) VALUES
+			(2, 1, '2024-03-01T12:30:00Z', 'alice', 'create', '[]'),
+			(2, 2, '2024-03-01T13:30:00Z', 'alice', 'update', '[]'),
+			(2, 2, '2024-03-01T14:30:00Z', 'bob', 'delete', '[]')`)
+		require.NoError(t, err)
+		r := NewVehicleSQLite(db)
+		t.Cleanup(func() { r.Close() })
+
+		// act
+		err = r.Migrate()
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, len(sqliteMigrations), sqliteSchemaVersion(t, r))
+		v, err := r.FindById(context.Background(), 1)
+		require.NoError(t, err)
+		require.Equal(t, 3, v.Version)
+		deleted := internal.Vehicle{Id: 2, VehicleAttributes: v.VehicleAttributes}
+		require.NoError(t, r.Save(context.Background(), &deleted))
+		require.Equal(t, 3, deleted.Version)
+	})
+
+	t.Run("case 3: should apply no migration if one of them fails", func(t *testing.T) {
+		// arrange
+		db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "vehicles.db"))
+		require.NoError(t, err)
+		// - a table in the way of the first migration
+		_, err = db.Exec("CREATE TABLE vehicle_tombstones (id INTEGER PRIMARY KEY)")
+		require.NoError(t, err)
+		r := NewVehicleSQLite(db)
+		t.Cleanup(func() { r.Close() })
+
+		// act
+		err = r.Migrate()
+
+		// assert
+		require.ErrorContains(t, err, fmt.Sprintf("migration %d", len(sqliteMigrations)))
+		var tables int
+		require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN ('vehicles', 'schema_migrations')").Scan(&tables))
+		require.Zero(t, tables)
+	})
+}
+
+// Tests for the durability of VehicleSQLite
+func TestVehicleSQLite_Reopen(t *testing.T) {
+	t.Run("case 1: should keep the vehicles, their history and the versions of the deleted ones across reopens", func(t *testing.T) {
+		// arrange
+		path := filepath.Join(t.TempDir(), "vehicles.db")
+		r, err := OpenVehicleSQLite(path)
+		require.NoError(t, err)
+		kept := internal.Vehicle{Id: 1, VehicleAttributes: internal.VehicleAttributes{Brand: "Fiat", Color: "Red", FabricationYear: 1990}}
+		deleted := internal.Vehicle{Id: 2, VehicleAttributes: internal.VehicleAttributes{Brand: "Seat", Color: "Blue", FabricationYear: 2000}}
+		entry := internal.VehicleHistoryEntry{VehicleId: 1, Timestamp: time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC), Actor: "alice", Operation: internal.VehicleOperationCreate}
+		require.NoError(t, r.SaveAudited(context.Background(), &kept, entry))
+		require.NoError(t, r.Save(context.Background(), &deleted))
+		require.NoError(t, r.Delete(context.Background(), 2, 1))
+		require.NoError(t, r.Close())
+
+		// act
+		r = openSQLiteAt(t, path)
+		v, errFind := r.FindAll(context.Background())
+		h, errHistory := r.FindHistory(context.Background(), 1)
+		errSave := r.Save(context.Background(), &deleted)
+
+		// assert
+		require.NoError(t, errFind)
+		require.Equal(t, map[int]internal.Vehicle{1: kept}, v)
+		require.NoError(t, errHistory)
+		entry.Version = 1
+		require.Equal(t, []internal.VehicleHistoryEntry{entry}, h)
+		require.NoError(t, errSave)
+		require.Equal(t, 2, deleted.Version)
+	})
+}
+
+// Tests for the transactions of VehicleSQLite
+func TestVehicleSQLite_Transaction(t *testing.T) {
+	t.Run("case 1: should not write a vehicle whose history entry can not be recorded", func(t *testing.T) {
+		// arrange
+		r := openSQLiteAt(t, filepath.Join(t.TempDir(), "vehicles.db"))
+		_, err := r.db.Exec("DROP TABLE vehicle_history")
+		require.NoError(t, err)
+		vehicle := internal.Vehicle{Id: 1, VehicleAttributes: internal.VehicleAttributes{Brand: "Fiat"}}
+		batch := []internal.Vehicle{vehicle, {Id: 2, VehicleAttributes: internal.VehicleAttributes{Brand: "Seat"}}}
+
+		// act
+		errSave := r.SaveAudited(context.Background(), &vehicle, internal.VehicleHistoryEntry{VehicleId: 1})
+		errBatch := r.SaveBatchAudited(context.Background(), batch, []internal.VehicleHistoryEntry{{VehicleId: 1}, {VehicleId: 2}})
+
+		// assert
+		require.Error(t, errSave)
+		require.Error(t, errBatch)
+		require.Zero(t, vehicle.Version)
+		v, err := r.FindAll(context.Background())
+		require.NoError(t, err)
+		require.Empty(t, v)
+	})
+
+	t.Run("case 2: should create a vehicle once across the connections of two processes", func(t *testing.T) {
+		// arrange
+		path := filepath.Join(t.TempDir(), "vehicles.db")
+		writers := []*VehicleSQLite{openSQLiteAt(t, path), openSQLiteAt(t, path)}
+		const n = 8
+		errs := make([]error, n)
+
+		// act
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				v := internal.Vehicle{Id: 1, VehicleAttributes: internal.VehicleAttributes{Brand: fmt.Sprintf("Fiat %d", i)}}
+				errs[i] = writers[i%2].Create(context.Background(), &v)
+			}(i)
+		}
+		wg.Wait()
+
+		// assert
+		created := 0
+		for _, err := range errs {
+			if err == nil {
+				created++
+				continue
+			}
+			require.ErrorIs(t, err, internal.ErrVehicleExists)
+		}
+		require.Equal(t, 1, created)
+	})
+}
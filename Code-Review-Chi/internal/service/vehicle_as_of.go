@@ -0,0 +1,356 @@
+package service
+
+import (
+	"app/internal"
+	"app/internal/repository"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// AsOf is a method that returns a read-only view of the vehicles as they were at t
+// - only the vehicles written after t are rewound, by undoing their history entries newest first,
+// the view reads the others from the repository
+// - every query of the view rewinds and reads the repository while the writes wait, so a write can not land between both
+// - vehicles without a create entry (e.g. loaded from the dataset) are assumed to exist since before the history began
+func (s *VehicleDefault) AsOf(ctx context.Context, t time.Time) (sv internal.VehicleService, err error) {
+	sv = &VehicleDefault{
+		rp:  &vehicleSnapshot{source: s.rp, writes: &s.mu, at: t},
+		now: s.now,
+	}
+	return
+}
+
+// vehicleSnapshot is a struct that represents a read-only repository of the vehicles as they were at an instant
+// - queries run over the source, with the vehicles written after the instant replaced by their rewound ones
+// - the history is the one of the source up to the instant
+type vehicleSnapshot struct {
+	// source is the repository the vehicles are rewound from
+	source internal.VehicleRepository
+	// writes is the lock of the writes of the source, held by each query, nil if the source is not written anymore
+	writes *sync.RWMutex
+	// at is the instant of the snapshot
+	at time.Time
+}
+
+// vehicleRewind is a struct that represents the vehicles written after the instant of a snapshot
+type vehicleRewind struct {
+	// current are the vehicles as they are now, without the deleted ones
+	current map[int]internal.Vehicle
+	// rewound are the vehicles as they were at the instant, without those that did not exist yet
+	rewound *repository.VehicleMap
+	// touched are the ids of the vehicles
+	touched map[int]struct{}
+}
+
+// rewind is a method that locks the writes of the source and returns the vehicles written after the instant
+// - unlock must be called once the query of the source is done, it is nil on error
+func (r *vehicleSnapshot) rewind(ctx context.Context) (rw vehicleRewind, unlock func(), err error) {
+	unlock = func() {}
+	if r.writes != nil {
+		r.writes.RLock()
+		unlock = r.writes.RUnlock
+	}
+	defer func() {
+		if err != nil {
+			unlock()
+			unlock = nil
+		}
+	}()
+
+	since, err := r.source.FindHistorySince(ctx, r.at)
+	if err != nil {
+		return
+	}
+
+	// - the current vehicles written after the instant
+	rw = vehicleRewind{current: make(map[int]internal.Vehicle), touched: make(map[int]struct{})}
+	for _, e := range since {
+		if _, ok := rw.touched[e.VehicleId]; ok {
+			continue
+		}
+		rw.touched[e.VehicleId] = struct{}{}
+		v, errFind := r.source.FindById(ctx, e.VehicleId)
+		switch {
+		case errFind == nil:
+			rw.current[e.VehicleId] = v
+		case !errors.Is(errFind, internal.ErrVehicleNotFound):
+			err = errFind
+			return
+		}
+	}
+
+	// - undo the writes after the instant
+	db := make(map[int]internal.Vehicle, len(rw.current))
+	for id, v := range rw.current {
+		db[id] = v
+	}
+	for i := len(since) - 1; i >= 0; i-- {
+		e := since[i]
+		switch e.Operation {
+		case internal.VehicleOperationCreate:
+			delete(db, e.VehicleId)
+		case internal.VehicleOperationUpdate:
+			v := db[e.VehicleId]
+			v.Id = e.VehicleId
+			v.Version = e.Version - 1
+			v.VehicleAttributes = internal.RevertVehicleAttributes(v.VehicleAttributes, e.Changes)
+			db[e.VehicleId] = v
+		case internal.VehicleOperationDelete:
+			db[e.VehicleId] = internal.Vehicle{
+				Id:                e.VehicleId,
+				Version:           e.Version,
+				VehicleAttributes: internal.RevertVehicleAttributes(internal.VehicleAttributes{}, e.Changes),
+			}
+		}
+	}
+	rw.rewound = repository.NewVehicleMap(db)
+	return
+}
+
+// FindAll is a method that returns a map of all vehicles
+func (r *vehicleSnapshot) FindAll(ctx context.Context) (v map[int]internal.Vehicle, err error) {
+	rw, unlock, err := r.rewind(ctx)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	if v, err = r.source.FindAll(ctx); err != nil {
+		return
+	}
+	rewound, err := rw.rewound.FindAll(ctx)
+	v = rw.merge(v, rewound, err)
+	return
+}
+
+// FindById is a method that returns a vehicle by id
+func (r *vehicleSnapshot) FindById(ctx context.Context, id int) (v internal.Vehicle, err error) {
+	rw, unlock, err := r.rewind(ctx)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	if _, ok := rw.touched[id]; ok {
+		return rw.rewound.FindById(ctx, id)
+	}
+	return r.source.FindById(ctx, id)
+}
+
+func (r *vehicleSnapshot) FindByColorYear(ctx context.Context, color string, year int) (v map[int]internal.Vehicle, err error) {
+	rw, unlock, err := r.rewind(ctx)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	if v, err = r.source.FindByColorYear(ctx, color, year); err != nil {
+		return
+	}
+	rewound, err := rw.rewound.FindByColorYear(ctx, color, year)
+	v = rw.merge(v, rewound, err)
+	return
+}
+
+func (r *vehicleSnapshot) FindByBrandYearRange(ctx context.Context, brand string, startYear, endYear int) (v map[int]internal.Vehicle, err error) {
+	rw, unlock, err := r.rewind(ctx)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	if v, err = r.source.FindByBrandYearRange(ctx, brand, startYear, endYear); err != nil {
+		return
+	}
+	rewound, err := rw.rewound.FindByBrandYearRange(ctx, brand, startYear, endYear)
+	v = rw.merge(v, rewound, err)
+	return
+}
+
+func (r *vehicleSnapshot) FindByBrandAverageSpeed(ctx context.Context, brand string) (avg float64, err error) {
+	avg, err = r.brandAverage(ctx, brand, r.source.FindByBrandAverageSpeed, func(v *internal.Vehicle) float64 { return v.MaxSpeed })
+	return
+}
+
+func (r *vehicleSnapshot) FindByFuelType(ctx context.Context, fuelType string) (v map[int]internal.Vehicle, err error) {
+	rw, unlock, err := r.rewind(ctx)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	if v, err = r.source.FindByFuelType(ctx, fuelType); err != nil {
+		return
+	}
+	rewound, err := rw.rewound.FindByFuelType(ctx, fuelType)
+	v = rw.merge(v, rewound, err)
+	return
+}
+
+func (r *vehicleSnapshot) FindByTransmissionType(ctx context.Context, transmissionType string) (v map[int]internal.Vehicle, err error) {
+	rw, unlock, err := r.rewind(ctx)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	if v, err = r.source.FindByTransmissionType(ctx, transmissionType); err != nil {
+		return
+	}
+	rewound, err := rw.rewound.FindByTransmissionType(ctx, transmissionType)
+	v = rw.merge(v, rewound, err)
+	return
+}
+
+func (r *vehicleSnapshot) FindByBrandAverageCapacity(ctx context.Context, brand string) (avg float64, err error) {
+	avg, err = r.brandAverage(ctx, brand, r.source.FindByBrandAverageCapacity, func(v *internal.Vehicle) float64 { return float64(v.Capacity) })
+	return
+}
+
+func (r *vehicleSnapshot) FindByWeightRange(ctx context.Context, minWeight, maxWeight float64) (v map[int]internal.Vehicle, err error) {
+	rw, unlock, err := r.rewind(ctx)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	if v, err = r.source.FindByWeightRange(ctx, minWeight, maxWeight); err != nil {
+		return
+	}
+	rewound, err := rw.rewound.FindByWeightRange(ctx, minWeight, maxWeight)
+	v = rw.merge(v, rewound, err)
+	return
+}
+
+func (r *vehicleSnapshot) FindByDimensionRange(ctx context.Context, minHeight, minWidth, maxHeight, maxWidth float64) (v map[int]internal.Vehicle, err error) {
+	rw, unlock, err := r.rewind(ctx)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	if v, err = r.source.FindByDimensionRange(ctx, minHeight, minWidth, maxHeight, maxWidth); err != nil {
+		return
+	}
+	rewound, err := rw.rewound.FindByDimensionRange(ctx, minHeight, minWidth, maxHeight, maxWidth)
+	v = rw.merge(v, rewound, err)
+	return
+}
+
+// merge is a method that replaces the vehicles written after the instant in v, a result of the source,
+// with the rewound ones of the same query
+// - it returns nil if the query of the rewound vehicles failed with err
+func (rw vehicleRewind) merge(v map[int]internal.Vehicle, rewound map[int]internal.Vehicle, err error) map[int]internal.Vehicle {
+	if err != nil {
+		return nil
+	}
+	for id := range rw.touched {
+		delete(v, id)
+	}
+	for id, vh := range rewound {
+		v[id] = vh
+	}
+	return v
+}
+
+// brandAverage is a method that returns the average of a value of the vehicles of a brand at the instant, 0 if there are none
+// - the average of the source is exact unless a vehicle of the brand was written after the instant,
+// otherwise it is computed again over the vehicles of the brand with the rewound ones
+func (r *vehicleSnapshot) brandAverage(ctx context.Context, brand string, sourceAverage func(ctx context.Context, brand string) (float64, error), value func(v *internal.Vehicle) float64) (avg float64, err error) {
+	rw, unlock, err := r.rewind(ctx)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	rewound, err := rw.rewound.FindAll(ctx)
+	if err != nil {
+		return
+	}
+	written := false
+	for _, v := range []map[int]internal.Vehicle{rw.current, rewound} {
+		for _, vh := range v {
+			written = written || vh.Brand == brand
+		}
+	}
+	if !written {
+		avg, err = sourceAverage(ctx, brand)
+		return
+	}
+
+	v, err := r.source.FindAll(ctx)
+	if err != nil {
+		return
+	}
+	var total float64
+	var count int
+	for _, vh := range rw.merge(v, rewound, nil) {
+		if vh.Brand == brand {
+			total += value(&vh)
+			count++
+		}
+	}
+	if count > 0 {
+		avg = total / float64(count)
+	}
+	return
+}
+
+// Save is a method that returns ErrVehicleReadOnly
+func (r *vehicleSnapshot) Save(ctx context.Context, v *internal.Vehicle) (err error) {
+	return internal.ErrVehicleReadOnly
+}
+
+// Create is a method that returns ErrVehicleReadOnly
+func (r *vehicleSnapshot) Create(ctx context.Context, v *internal.Vehicle) (err error) {
+	return internal.ErrVehicleReadOnly
+}
+
+// SaveBatch is a method that returns ErrVehicleReadOnly
+func (r *vehicleSnapshot) SaveBatch(ctx context.Context, v []internal.Vehicle) (err error) {
+	return internal.ErrVehicleReadOnly
+}
+
+// Update is a method that returns ErrVehicleReadOnly
+func (r *vehicleSnapshot) Update(ctx context.Context, v *internal.Vehicle, version int) (err error) {
+	return internal.ErrVehicleReadOnly
+}
+
+// Delete is a method that returns ErrVehicleReadOnly
+func (r *vehicleSnapshot) Delete(ctx context.Context, id, version int) (err error) {
+	return internal.ErrVehicleReadOnly
+}
+
+// Replace is a method that returns ErrVehicleReadOnly
+func (r *vehicleSnapshot) Replace(ctx context.Context, v map[int]internal.Vehicle) (err error) {
+	return internal.ErrVehicleReadOnly
+}
+
+// AppendHistory is a method that returns ErrVehicleReadOnly
+func (r *vehicleSnapshot) AppendHistory(ctx context.Context, e internal.VehicleHistoryEntry) (err error) {
+	return internal.ErrVehicleReadOnly
+}
+
+// FindHistory is a method that returns the history of a vehicle up to the instant, oldest first
+func (r *vehicleSnapshot) FindHistory(ctx context.Context, id int) (h []internal.VehicleHistoryEntry, err error) {
+	h, err = r.source.FindHistory(ctx, id)
+	if err != nil {
+		return
+	}
+	h = r.until(h)
+	return
+}
+
+// FindHistorySince is a method that returns the entries of every vehicle recorded after t and up to the instant
+func (r *vehicleSnapshot) FindHistorySince(ctx context.Context, t time.Time) (h []internal.VehicleHistoryEntry, err error) {
+	h, err = r.source.FindHistorySince(ctx, t)
+	if err != nil {
+		return
+	}
+	h = r.until(h)
+	return
+}
+
+// until is a method that returns the entries recorded up to the instant
+func (r *vehicleSnapshot) until(h []internal.VehicleHistoryEntry) []internal.VehicleHistoryEntry {
+	kept := make([]internal.VehicleHistoryEntry, 0, len(h))
+	for _, e := range h {
+		if !e.Timestamp.After(r.at) {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,152 @@
+package service_test
+
+import (
+	"app/internal"
+	"app/internal/repository"
+	"app/internal/repository/repositorytest"
+	"app/internal/service"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Tests for VehicleDefault.AsOf
+func TestVehicleDefault_AsOf(t *testing.T) {
+	// written is a function that returns a service over the fixture, the instant before its writes
+	// and the vehicles updated (1), deleted (2) and created (7) after the instant
+	written := func(t *testing.T, rp internal.VehicleRepository) (sv *service.VehicleDefault, at time.Time) {
+		t.Helper()
+		sv = service.NewVehicleDefault(rp)
+		at = time.Now().UTC()
+		time.Sleep(time.Millisecond)
+		updated := repositorytest.Fixture()[1]
+		updated.Color, updated.MaxSpeed = "Green", 100
+		require.NoError(t, sv.Update(actor(), &updated, 1))
+		require.NoError(t, sv.Delete(actor(), 2, 1))
+		created := repositorytest.NewVehicle(7, "Ford", "Blue", 2020, 4, 200, "gasoline", "manual", 1000, 130, 165)
+		require.NoError(t, sv.Create(actor(), &created))
+		return
+	}
+
+	t.Run("case 1: should rewind the vehicles written after the instant and read the others as they are", func(t *testing.T) {
+		// arrange
+		sv, at := written(t, repository.NewVehicleMap(repositorytest.Fixture()))
+
+		// act
+		view, err := sv.AsOf(context.Background(), at)
+
+		// assert
+		require.NoError(t, err)
+		v, err := view.FindAll(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, repositorytest.Fixture(), v)
+		ford, err := view.FindByBrandYearRange(context.Background(), "Ford", 2000, 2030)
+		require.NoError(t, err)
+		require.Equal(t, map[int]internal.Vehicle{1: repositorytest.Fixture()[1], 2: repositorytest.Fixture()[2], 3: repositorytest.Fixture()[3]}, ford)
+		avg, err := view.FindByBrandAverageSpeed(context.Background(), "Ford")
+		require.NoError(t, err)
+		require.Equal(t, 180.0, avg)
+		_, err = view.FindById(context.Background(), 7)
+		require.ErrorIs(t, err, internal.ErrVehicleNotFound)
+		h, err := view.FindHistory(context.Background(), 1)
+		require.NoError(t, err)
+		require.Empty(t, h)
+	})
+
+	t.Run("case 2: should read only the vehicles written after the instant to build the view", func(t *testing.T) {
+		// arrange
+		ops := &operations{}
+		sv, at := written(t, repository.NewVehicleObserved(repository.NewVehicleMap(repositorytest.Fixture()), ops.observe))
+		ops.ops = nil
+
+		// act
+		view, err := sv.AsOf(context.Background(), at)
+		require.NoError(t, err)
+		v, errFind := view.FindById(context.Background(), 3)
+
+		// assert
+		require.NoError(t, errFind)
+		require.Equal(t, repositorytest.Fixture()[3], v)
+		require.Equal(t, []string{"find_history_since", "find_by_id", "find_by_id", "find_by_id", "find_by_id"}, ops.ops)
+	})
+
+	t.Run("case 3: should refuse every write", func(t *testing.T) {
+		// arrange
+		sv, at := written(t, repository.NewVehicleMap(repositorytest.Fixture()))
+		view, err := sv.AsOf(context.Background(), at)
+		require.NoError(t, err)
+		vehicle := repositorytest.Fixture()[3]
+
+		// act
+		errSave := view.Save(actor(), &vehicle)
+		errUpdate := view.Update(actor(), &vehicle, 1)
+		errDelete := view.Delete(actor(), 3, 1)
+		errBatch := view.SaveBatch(actor(), []internal.Vehicle{vehicle})
+
+		// assert
+		require.ErrorIs(t, errSave, internal.ErrVehicleReadOnly)
+		require.ErrorIs(t, errUpdate, internal.ErrVehicleReadOnly)
+		require.ErrorIs(t, errDelete, internal.ErrVehicleReadOnly)
+		require.ErrorIs(t, errBatch, internal.ErrVehicleReadOnly)
+		v, err := sv.FindById(context.Background(), 3)
+		require.NoError(t, err)
+		require.Equal(t, repositorytest.Fixture()[3], v)
+	})
+
+	t.Run("case 4: should average the vehicles of the brand at the instant over a columnar source", func(t *testing.T) {
+		// arrange
+		sv, at := written(t, repository.NewVehicleMapColumnar(repositorytest.Fixture()))
+		view, err := sv.AsOf(context.Background(), at)
+		require.NoError(t, err)
+
+		// act
+		speed, errSpeed := view.FindByBrandAverageSpeed(context.Background(), "Ford")
+		capacity, errCapacity := view.FindByBrandAverageCapacity(context.Background(), "Ford")
+		tesla, errTesla := view.FindByBrandAverageSpeed(context.Background(), "Tesla")
+
+		// assert
+		require.NoError(t, errSpeed)
+		require.Equal(t, 180.0, speed)
+		require.NoError(t, errCapacity)
+		require.Equal(t, 16.0/3, capacity)
+		require.NoError(t, errTesla)
+		require.Equal(t, 250.0, tesla)
+	})
+
+	t.Run("case 5: should not see a write that lands while a query of the view reads the repository", func(t *testing.T) {
+		// arrange
+		var sv *service.VehicleDefault
+		var once sync.Once
+		wrote := make(chan error, 1)
+		observe := func(op string, d time.Duration, err error) {
+			if op != "find_history_since" {
+				return
+			}
+			once.Do(func() {
+				go func() {
+					painted := repositorytest.Fixture()[3]
+					painted.Color = "Green"
+					wrote <- sv.Update(actor(), &painted, 1)
+				}()
+				time.Sleep(10 * time.Millisecond)
+			})
+		}
+		sv = service.NewVehicleDefault(repository.NewVehicleObserved(repository.NewVehicleMap(repositorytest.Fixture()), observe))
+		view, err := sv.AsOf(context.Background(), time.Now().UTC())
+		require.NoError(t, err)
+
+		// act
+		v, err := view.FindAll(context.Background())
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, repositorytest.Fixture(), v)
+		require.NoError(t, <-wrote)
+		now, err := sv.FindById(context.Background(), 3)
+		require.NoError(t, err)
+		require.Equal(t, "Green", now.Color)
+	})
+}
@@ -2,69 +2,325 @@ package service
 
 import (
 	"app/internal"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
 )
 
 // Constructor
 // NewVehicleDefault is a function that returns a new instance of VehicleDefault
 func NewVehicleDefault(rp internal.VehicleRepository) *VehicleDefault {
-	return &VehicleDefault{rp: rp}
+	return &VehicleDefault{rp: rp, now: time.Now}
 }
 
 // Inyection of the repository
 // VehicleDefault is a struct that represents the default service for vehicles
+// - every write records an entry in the history of the vehicle, in the same transaction
+// if the repository implements internal.VehicleAuditedRepository
+// - the writes are serialized, so each entry is the diff against the state its write replaces
 type VehicleDefault struct {
 	// rp is the repository that will be used by the service
 	rp internal.VehicleRepository
+	// now is the clock of the history entries
+	now func() time.Time
+	// mu serializes the writes, the points in time (see AsOf) read under it
+	mu sync.RWMutex
 }
 
 // FindAll is a method that returns a map of all vehicles
-func (s *VehicleDefault) FindAll() (v map[int]internal.Vehicle, err error) {
-	v, err = s.rp.FindAll()
+func (s *VehicleDefault) FindAll(ctx context.Context) (v map[int]internal.Vehicle, err error) {
+	v, err = s.rp.FindAll(ctx)
 	return
 }
 
-func (s *VehicleDefault) FindByColorYear(color string, year int) (v map[int]internal.Vehicle, err error) {
-	v, err = s.rp.FindByColorYear(color, year)
+// FindById is a method that returns a vehicle by id
+func (s *VehicleDefault) FindById(ctx context.Context, id int) (v internal.Vehicle, err error) {
+	v, err = s.rp.FindById(ctx, id)
 	return
 }
 
-func (s *VehicleDefault) FindByBrandYearRange(brand string, startYear, endYear int) (v map[int]internal.Vehicle, err error) {
-	v, err = s.rp.FindByBrandYearRange(brand, startYear, endYear)
+func (s *VehicleDefault) FindByColorYear(ctx context.Context, color string, year int) (v map[int]internal.Vehicle, err error) {
+	v, err = s.rp.FindByColorYear(ctx, color, year)
 	return
 }
 
-func (s *VehicleDefault) FindByBrandAverageSpeed(brand string) (avg float64, err error) {
-	avg, err = s.rp.FindByBrandAverageSpeed(brand)
+func (s *VehicleDefault) FindByBrandYearRange(ctx context.Context, brand string, startYear, endYear int) (v map[int]internal.Vehicle, err error) {
+	v, err = s.rp.FindByBrandYearRange(ctx, brand, startYear, endYear)
 	return
 }
 
-func (s *VehicleDefault) FindByFuelType(fuelType string) (v map[int]internal.Vehicle, err error) {
-	v, err = s.rp.FindByFuelType(fuelType)
+func (s *VehicleDefault) FindByBrandAverageSpeed(ctx context.Context, brand string) (avg float64, err error) {
+	avg, err = s.rp.FindByBrandAverageSpeed(ctx, brand)
 	return
 }
 
-func (s *VehicleDefault) FindByTransmissionType(transmissionType string) (v map[int]internal.Vehicle, err error) {
-	v, err = s.rp.FindByTransmissionType(transmissionType)
+func (s *VehicleDefault) FindByFuelType(ctx context.Context, fuelType string) (v map[int]internal.Vehicle, err error) {
+	v, err = s.rp.FindByFuelType(ctx, fuelType)
 	return
 }
 
-func (s *VehicleDefault) FindByBrandAverageCapacity(brand string) (avg float64, err error) {
-	avg, err = s.rp.FindByBrandAverageCapacity(brand)
+func (s *VehicleDefault) FindByTransmissionType(ctx context.Context, transmissionType string) (v map[int]internal.Vehicle, err error) {
+	v, err = s.rp.FindByTransmissionType(ctx, transmissionType)
 	return
 }
 
-func (s *VehicleDefault) FindByWeightRange(minWeight, maxWeight float64) (v map[int]internal.Vehicle, err error) {
-	v, err = s.rp.FindByWeightRange(minWeight, maxWeight)
+func (s *VehicleDefault) FindByBrandAverageCapacity(ctx context.Context, brand string) (avg float64, err error) {
+	avg, err = s.rp.FindByBrandAverageCapacity(ctx, brand)
 	return
 }
 
-func (s *VehicleDefault) FindByDimensionRange(minHeight, minWidth, maxHeight, maxWidth float64) (v map[int]internal.Vehicle, err error) {
-	v, err = s.rp.FindByDimensionRange(minHeight, minWidth, maxHeight, maxWidth)
+func (s *VehicleDefault) FindByWeightRange(ctx context.Context, minWeight, maxWeight float64) (v map[int]internal.Vehicle, err error) {
+	v, err = s.rp.FindByWeightRange(ctx, minWeight, maxWeight)
 	return
 }
 
-// Save is a method that saves a vehicle
-func (s *VehicleDefault) Save(v *internal.Vehicle) (err error) {
-	err = s.rp.Save(v)
+func (s *VehicleDefault) FindByDimensionRange(ctx context.Context, minHeight, minWidth, maxHeight, maxWidth float64) (v map[int]internal.Vehicle, err error) {
+	v, err = s.rp.FindByDimensionRange(ctx, minHeight, minWidth, maxHeight, maxWidth)
 	return
 }
+
+// Save is a method that saves a vehicle, a vehicle with the same id is overwritten whatever its version
+// - it is recorded as a create if there was no vehicle with the id, as an update otherwise
+func (s *VehicleDefault) Save(ctx context.Context, v *internal.Vehicle) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// - previous state, if any
+	before, operation, err := s.previous(ctx, v.Id)
+	if err != nil {
+		return
+	}
+
+	e := s.entry(ctx, v.Id, operation, before.VehicleAttributes, v.VehicleAttributes)
+	if rp, ok := s.rp.(internal.VehicleAuditedRepository); ok {
+		if err = rp.SaveAudited(ctx, v, e); err != nil {
+			return
+		}
+		e.Version = v.Version
+		s.written(ctx, e)
+		return
+	}
+	if err = s.rp.Save(ctx, v); err != nil {
+		return
+	}
+	e.Version = v.Version
+	err = s.record(ctx, e)
+	return
+}
+
+// Create is a method that creates a new vehicle, ErrVehicleExists if a vehicle with the same id exists
+// - the repository checks the id and writes the vehicle atomically, so it also holds against other writers of the repository
+func (s *VehicleDefault) Create(ctx context.Context, v *internal.Vehicle) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.entry(ctx, v.Id, internal.VehicleOperationCreate, internal.VehicleAttributes{}, v.VehicleAttributes)
+	if rp, ok := s.rp.(internal.VehicleAuditedRepository); ok {
+		if err = rp.CreateAudited(ctx, v, e); err != nil {
+			return
+		}
+		e.Version = v.Version
+		s.written(ctx, e)
+		return
+	}
+	if err = s.rp.Create(ctx, v); err != nil {
+		return
+	}
+	e.Version = v.Version
+	err = s.record(ctx, e)
+	return
+}
+
+// SaveBatch is a method that saves the vehicles in order, every vehicle or none
+// - each vehicle is recorded as Save records it, against the state it replaces, which may be an earlier vehicle of the batch
+func (s *VehicleDefault) SaveBatch(ctx context.Context, v []internal.Vehicle) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = s.saveBatch(ctx, v)
+	return
+}
+
+// SaveBatchVersioned is a method that saves the vehicles in order like SaveBatch if each one is still at its version
+func (s *VehicleDefault) SaveBatchVersioned(ctx context.Context, v []internal.Vehicle, versions []int) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(versions) != len(v) {
+		err = fmt.Errorf("%w: %d vehicles and %d versions", internal.ErrVehicleInvalidField, len(v), len(versions))
+		return
+	}
+	for i := range v {
+		before, _, errPrevious := s.previous(ctx, v[i].Id)
+		if errPrevious != nil {
+			err = errPrevious
+			return
+		}
+		if before.Version != versions[i] {
+			err = fmt.Errorf("%w: vehicle %d: expected %d, stored %d", internal.ErrVehicleVersionMismatch, v[i].Id, versions[i], before.Version)
+			return
+		}
+	}
+	err = s.saveBatch(ctx, v)
+	return
+}
+
+// saveBatch is a method that saves the vehicles in order, the caller holds the lock of the writes
+func (s *VehicleDefault) saveBatch(ctx context.Context, v []internal.Vehicle) (err error) {
+	// - previous states, if any
+	e := make([]internal.VehicleHistoryEntry, len(v))
+	saved := make(map[int]internal.Vehicle, len(v))
+	for i := range v {
+		before, operation := saved[v[i].Id], internal.VehicleOperationUpdate
+		if _, ok := saved[v[i].Id]; !ok {
+			if before, operation, err = s.previous(ctx, v[i].Id); err != nil {
+				return
+			}
+		}
+		e[i] = s.entry(ctx, v[i].Id, operation, before.VehicleAttributes, v[i].VehicleAttributes)
+		saved[v[i].Id] = v[i]
+	}
+
+	if rp, ok := s.rp.(internal.VehicleAuditedRepository); ok {
+		if err = rp.SaveBatchAudited(ctx, v, e); err != nil {
+			return
+		}
+		for i := range e {
+			e[i].Version = v[i].Version
+			s.written(ctx, e[i])
+		}
+		return
+	}
+	if err = s.rp.SaveBatch(ctx, v); err != nil {
+		return
+	}
+	for i := range e {
+		e[i].Version = v[i].Version
+		if err = s.record(ctx, e[i]); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Update is a method that overwrites a vehicle if its stored version is version
+func (s *VehicleDefault) Update(ctx context.Context, v *internal.Vehicle, version int) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before, err := s.current(ctx, v.Id, version)
+	if err != nil {
+		return
+	}
+
+	e := s.entry(ctx, v.Id, internal.VehicleOperationUpdate, before.VehicleAttributes, v.VehicleAttributes)
+	if rp, ok := s.rp.(internal.VehicleAuditedRepository); ok {
+		if err = rp.UpdateAudited(ctx, v, version, e); err != nil {
+			return
+		}
+		e.Version = v.Version
+		s.written(ctx, e)
+		return
+	}
+	if err = s.rp.Update(ctx, v, version); err != nil {
+		return
+	}
+	e.Version = v.Version
+	err = s.record(ctx, e)
+	return
+}
+
+// Delete is a method that deletes a vehicle if its stored version is version
+func (s *VehicleDefault) Delete(ctx context.Context, id int, version int) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before, err := s.current(ctx, id, version)
+	if err != nil {
+		return
+	}
+
+	e := s.entry(ctx, id, internal.VehicleOperationDelete, before.VehicleAttributes, internal.VehicleAttributes{})
+	e.Version = version
+	if rp, ok := s.rp.(internal.VehicleAuditedRepository); ok {
+		if err = rp.DeleteAudited(ctx, id, version, e); err != nil {
+			return
+		}
+		s.written(ctx, e)
+		return
+	}
+	if err = s.rp.Delete(ctx, id, version); err != nil {
+		return
+	}
+	err = s.record(ctx, e)
+	return
+}
+
+// FindHistory is a method that returns the history of a vehicle, oldest first
+func (s *VehicleDefault) FindHistory(ctx context.Context, id int) (h []internal.VehicleHistoryEntry, err error) {
+	h, err = s.rp.FindHistory(ctx, id)
+	return
+}
+
+// previous is a method that returns the stored vehicle a save of the id replaces and the operation of the save
+// - the operation is a create if there is no vehicle with the id, with the zero vehicle as previous state
+func (s *VehicleDefault) previous(ctx context.Context, id int) (v internal.Vehicle, operation internal.VehicleOperation, err error) {
+	v, err = s.rp.FindById(ctx, id)
+	operation = internal.VehicleOperationUpdate
+	if errors.Is(err, internal.ErrVehicleNotFound) {
+		v, operation, err = internal.Vehicle{}, internal.VehicleOperationCreate, nil
+	}
+	return
+}
+
+// current is a method that returns the stored vehicle if it is at the version
+// - versions only grow, so the vehicle read is the one a successful conditional write replaces
+func (s *VehicleDefault) current(ctx context.Context, id int, version int) (v internal.Vehicle, err error) {
+	if v, err = s.rp.FindById(ctx, id); err != nil {
+		return
+	}
+	if v.Version != version {
+		err = fmt.Errorf("%w: expected %d, stored %d", internal.ErrVehicleVersionMismatch, version, v.Version)
+	}
+	return
+}
+
+// entry is a method that returns the entry of the history of a write made by the actor of ctx, without its version
+func (s *VehicleDefault) entry(ctx context.Context, id int, operation internal.VehicleOperation, before, after internal.VehicleAttributes) internal.VehicleHistoryEntry {
+	return internal.VehicleHistoryEntry{
+		VehicleId: id,
+		Timestamp: s.now().UTC(),
+		Actor:     internal.ActorFromContext(ctx),
+		Operation: operation,
+		Changes:   internal.DiffVehicleAttributes(before, after),
+	}
+}
+
+// record is a method that appends the entry of a write already applied to the history of the vehicle
+func (s *VehicleDefault) record(ctx context.Context, e internal.VehicleHistoryEntry) (err error) {
+	// - the write is already applied, a missing history entry must not go unnoticed
+	if err = s.rp.AppendHistory(ctx, e); err != nil {
+		s.logger(ctx, e).Error("recording the history of a vehicle", slog.Any("error", err))
+		return
+	}
+	s.written(ctx, e)
+	return
+}
+
+// written is a method that logs a write recorded in the history
+func (s *VehicleDefault) written(ctx context.Context, e internal.VehicleHistoryEntry) {
+	s.logger(ctx, e).Info("vehicle written", slog.Int("changes", len(e.Changes)))
+}
+
+// logger is a method that returns the logger of ctx with the attributes of the entry
+func (s *VehicleDefault) logger(ctx context.Context, e internal.VehicleHistoryEntry) *slog.Logger {
+	return internal.LoggerFromContext(ctx).With(
+		slog.Int("vehicle_id", e.VehicleId),
+		slog.Int("version", e.Version),
+		slog.String("operation", string(e.Operation)),
+		slog.String("actor", e.Actor),
+	)
+}
@@ -0,0 +1,127 @@
+package service_test
+
+import (
+	"app/internal"
+	"app/internal/repository"
+	"app/internal/repository/repositorytest"
+	"app/internal/service"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// actor is the context of the writes of the service tests, made by alice
+func actor() context.Context {
+	return internal.ContextWithActor(context.Background(), "alice")
+}
+
+// Tests for the writes of VehicleDefault
+func TestVehicleDefault_Write(t *testing.T) {
+	t.Run("case 1: should save a vehicle and record its creation by the actor", func(t *testing.T) {
+		// arrange
+		rp := repository.NewVehicleMap(repositorytest.Fixture())
+		sv := service.NewVehicleDefault(rp)
+		vehicle := repositorytest.NewVehicle(7, "Fiat", "Green", 2018, 4, 150, "gasoline", "manual", 1000, 130, 165)
+
+		// act
+		err := sv.Save(actor(), &vehicle)
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, 1, vehicle.Version)
+		h, err := sv.FindHistory(context.Background(), 7)
+		require.NoError(t, err)
+		require.Len(t, h, 1)
+		require.Equal(t, internal.VehicleOperationCreate, h[0].Operation)
+		require.Equal(t, "alice", h[0].Actor)
+		require.Equal(t, 1, h[0].Version)
+		require.Equal(t, internal.DiffVehicleAttributes(internal.VehicleAttributes{}, vehicle.VehicleAttributes), h[0].Changes)
+	})
+
+	t.Run("case 2: should update a vehicle at its version and record the fields changed", func(t *testing.T) {
+		// arrange
+		rp := repository.NewVehicleMap(repositorytest.Fixture())
+		sv := service.NewVehicleDefault(rp)
+		vehicle := repositorytest.Fixture()[1]
+		vehicle.Color = "Green"
+
+		// act
+		err := sv.Update(actor(), &vehicle, 1)
+
+		// assert
+		require.NoError(t, err)
+		require.Equal(t, 2, vehicle.Version)
+		h, err := sv.FindHistory(context.Background(), 1)
+		require.NoError(t, err)
+		require.Len(t, h, 1)
+		require.Equal(t, internal.VehicleOperationUpdate, h[0].Operation)
+		require.Equal(t, 2, h[0].Version)
+		require.Equal(t, []internal.FieldChange{{Field: "color", Old: "Red", New: "Green"}}, h[0].Changes)
+	})
+
+	t.Run("case 3: should delete a vehicle at its version and record the version deleted", func(t *testing.T) {
+		// arrange
+		rp := repository.NewVehicleMap(repositorytest.Fixture())
+		sv := service.NewVehicleDefault(rp)
+
+		// act
+		err := sv.Delete(actor(), 1, 1)
+
+		// assert
+		require.NoError(t, err)
+		_, err = sv.FindById(context.Background(), 1)
+		require.ErrorIs(t, err, internal.ErrVehicleNotFound)
+		h, err := sv.FindHistory(context.Background(), 1)
+		require.NoError(t, err)
+		require.Len(t, h, 1)
+		require.Equal(t, internal.VehicleOperationDelete, h[0].Operation)
+		require.Equal(t, 1, h[0].Version)
+	})
+
+	t.Run("case 4: should neither write nor record a write at a stale version", func(t *testing.T) {
+		// arrange
+		rp := repository.NewVehicleMap(repositorytest.Fixture())
+		sv := service.NewVehicleDefault(rp)
+		vehicle := repositorytest.Fixture()[1]
+		vehicle.Color = "Green"
+
+		// act
+		errUpdate := sv.Update(actor(), &vehicle, 2)
+		errDelete := sv.Delete(actor(), 1, 2)
+		errMissing := sv.Delete(actor(), 99, 1)
+
+		// assert
+		require.ErrorIs(t, errUpdate, internal.ErrVehicleVersionMismatch)
+		require.ErrorIs(t, errDelete, internal.ErrVehicleVersionMismatch)
+		require.ErrorIs(t, errMissing, internal.ErrVehicleNotFound)
+		v, err := sv.FindById(context.Background(), 1)
+		require.NoError(t, err)
+		require.Equal(t, repositorytest.Fixture()[1], v)
+		h, err := sv.FindHistory(context.Background(), 1)
+		require.NoError(t, err)
+		require.Empty(t, h)
+	})
+
+	t.Run("case 5: should create a vehicle only if it does not exist and record its creation", func(t *testing.T) {
+		// arrange
+		rp := repository.NewVehicleMap(repositorytest.Fixture())
+		sv := service.NewVehicleDefault(rp)
+		vehicle := repositorytest.Fixture()[1]
+
+		// act
+		errExists := sv.Create(actor(), &vehicle)
+		require.NoError(t, sv.Delete(actor(), 1, 1))
+		errCreate := sv.Create(actor(), &vehicle)
+
+		// assert
+		require.ErrorIs(t, errExists, internal.ErrVehicleExists)
+		require.NoError(t, errCreate)
+		require.Equal(t, 2, vehicle.Version)
+		h, err := sv.FindHistory(context.Background(), 1)
+		require.NoError(t, err)
+		require.Len(t, h, 2)
+		require.Equal(t, internal.VehicleOperationCreate, h[1].Operation)
+		require.Equal(t, 2, h[1].Version)
+	})
+}
@@ -0,0 +1,402 @@
+package service
+
+import (
+	"app/internal"
+	"app/internal/repository"
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// seedActor is the actor of the events that register the vehicles of an existing read model
+const seedActor = "seed"
+
+// NewVehicleEventSourced is a function that returns a new instance of VehicleEventSourced
+// - rp is the read model, call Rebuild to project the events of es into it
+func NewVehicleEventSourced(es internal.VehicleEventStore, rp internal.VehicleRepository) *VehicleEventSourced {
+	return &VehicleEventSourced{
+		VehicleDefault: NewVehicleDefault(rp),
+		es:             es,
+	}
+}
+
+// VehicleEventSourced is a struct that represents a service for vehicles whose state is a sequence of events
+// - writes append an event to the store and project it into the read model, the repository
+// - reads are served by the read model (see VehicleDefault), the history and points in time by the events
+type VehicleEventSourced struct {
+	// VehicleDefault serves the reads from the read model
+	*VehicleDefault
+	// mu serializes the writes, so the read model applies the events in the order they were appended
+	mu sync.Mutex
+	// es is the store of the events, the source of truth
+	es internal.VehicleEventStore
+}
+
+// Save is a method that registers a vehicle or changes its attributes
+// - a vehicle registered again after it is retired continues from its last version
+func (s *VehicleEventSourced) Save(ctx context.Context, v *internal.Vehicle) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// - current state, if any
+	before, last, err := s.state(ctx, v.Id)
+	if err != nil {
+		return
+	}
+
+	e := internal.VehicleEvent{
+		VehicleId: v.Id,
+		Version:   last + 1,
+		Type:      internal.VehicleRegistered,
+		Changes:   internal.DiffVehicleAttributes(internal.VehicleAttributes{}, v.VehicleAttributes),
+	}
+	if before.Version != 0 {
+		e.Type = internal.VehicleAttributesChanged
+		e.Changes = internal.DiffVehicleAttributes(before.VehicleAttributes, v.VehicleAttributes)
+	}
+	if err = s.apply(ctx, &e); err != nil {
+		return
+	}
+	v.Version = e.Version
+	return
+}
+
+// Create is a method that registers a new vehicle, ErrVehicleExists if a vehicle with the same id exists
+// - the store refuses to register a vehicle that exists (see CheckVehicleEvent), so the check and the write are atomic
+func (s *VehicleEventSourced) Create(ctx context.Context, v *internal.Vehicle) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, last, err := s.state(ctx, v.Id)
+	if err != nil {
+		return
+	}
+
+	e := internal.VehicleEvent{
+		VehicleId: v.Id,
+		Version:   last + 1,
+		Type:      internal.VehicleRegistered,
+		Changes:   internal.DiffVehicleAttributes(internal.VehicleAttributes{}, v.VehicleAttributes),
+	}
+	if err = s.apply(ctx, &e); err != nil {
+		return
+	}
+	v.Version = e.Version
+	return
+}
+
+// SaveBatch is a method that registers the vehicles or changes their attributes in order, every event is appended or none
+// - each event follows the state it replaces, which may be an earlier vehicle of the batch
+func (s *VehicleEventSourced) SaveBatch(ctx context.Context, v []internal.Vehicle) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = s.saveBatch(ctx, v)
+	return
+}
+
+// SaveBatchVersioned is a method that saves the vehicles in order like SaveBatch if each one is still at its version
+func (s *VehicleEventSourced) SaveBatchVersioned(ctx context.Context, v []internal.Vehicle, versions []int) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(versions) != len(v) {
+		err = fmt.Errorf("%w: %d vehicles and %d versions", internal.ErrVehicleInvalidField, len(v), len(versions))
+		return
+	}
+	for i := range v {
+		before, _, errState := s.state(ctx, v[i].Id)
+		if errState != nil {
+			err = errState
+			return
+		}
+		if before.Version != versions[i] {
+			err = fmt.Errorf("%w: vehicle %d: expected %d, stored %d", internal.ErrVehicleVersionMismatch, v[i].Id, versions[i], before.Version)
+			return
+		}
+	}
+	err = s.saveBatch(ctx, v)
+	return
+}
+
+// saveBatch is a method that appends and projects the events of the vehicles in order, the caller holds the lock of the writes
+func (s *VehicleEventSourced) saveBatch(ctx context.Context, v []internal.Vehicle) (err error) {
+	events := make([]internal.VehicleEvent, len(v))
+	saved := make(map[int]internal.Vehicle, len(v))
+	for i := range v {
+		// - the events are appended before they are projected, an invalid vehicle must not get any
+		if v[i].Id <= 0 {
+			err = fmt.Errorf("%w: id must be positive", internal.ErrVehicleInvalidField)
+			return
+		}
+		// - current state, if any
+		before, ok := saved[v[i].Id]
+		last := before.Version
+		if !ok {
+			if before, last, err = s.state(ctx, v[i].Id); err != nil {
+				return
+			}
+		}
+
+		e := internal.VehicleEvent{
+			VehicleId: v[i].Id,
+			Version:   last + 1,
+			Type:      internal.VehicleRegistered,
+			Changes:   internal.DiffVehicleAttributes(internal.VehicleAttributes{}, v[i].VehicleAttributes),
+		}
+		if before.Version != 0 {
+			e.Type = internal.VehicleAttributesChanged
+			e.Changes = internal.DiffVehicleAttributes(before.VehicleAttributes, v[i].VehicleAttributes)
+		}
+		s.stamp(ctx, &e)
+		events[i] = e
+		after := v[i]
+		after.Version = e.Version
+		saved[v[i].Id] = after
+	}
+	if err = s.es.AppendBatch(ctx, events); err != nil {
+		return
+	}
+	for i := range events {
+		v[i].Version = events[i].Version
+	}
+	for _, e := range events {
+		if err = s.project(ctx, e); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Update is a method that changes the attributes of a vehicle if its current version is version
+func (s *VehicleEventSourced) Update(ctx context.Context, v *internal.Vehicle, version int) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before, err := s.current(ctx, v.Id, version)
+	if err != nil {
+		return
+	}
+
+	e := internal.VehicleEvent{
+		VehicleId: v.Id,
+		Version:   version + 1,
+		Type:      internal.VehicleAttributesChanged,
+		Changes:   internal.DiffVehicleAttributes(before.VehicleAttributes, v.VehicleAttributes),
+	}
+	if err = s.apply(ctx, &e); err != nil {
+		return
+	}
+	v.Version = e.Version
+	return
+}
+
+// Delete is a method that retires a vehicle if its current version is version
+func (s *VehicleEventSourced) Delete(ctx context.Context, id int, version int) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before, err := s.current(ctx, id, version)
+	if err != nil {
+		return
+	}
+
+	e := internal.VehicleEvent{
+		VehicleId: id,
+		Version:   version,
+		Type:      internal.VehicleRetired,
+		Changes:   internal.DiffVehicleAttributes(before.VehicleAttributes, internal.VehicleAttributes{}),
+	}
+	err = s.apply(ctx, &e)
+	return
+}
+
+// FindHistory is a method that returns the history of a vehicle, oldest first, one entry per event
+func (s *VehicleEventSourced) FindHistory(ctx context.Context, id int) (h []internal.VehicleHistoryEntry, err error) {
+	events, err := s.es.FindEvents(ctx, id)
+	if err != nil {
+		return
+	}
+	h = make([]internal.VehicleHistoryEntry, 0, len(events))
+	for _, e := range events {
+		h = append(h, e.HistoryEntry())
+	}
+	return
+}
+
+// AsOf is a method that returns a read-only view of the vehicles as they were at t
+// - the view is the replay of the events up to t, it is exact for every vehicle
+func (s *VehicleEventSourced) AsOf(ctx context.Context, t time.Time) (sv internal.VehicleService, err error) {
+	events, err := s.es.FindAllEvents(ctx)
+	if err != nil {
+		return
+	}
+	rp := repository.NewVehicleMap(nil)
+	for _, e := range events {
+		if e.Timestamp.After(t) {
+			continue
+		}
+		if err = projectVehicleEvent(ctx, rp, e); err != nil {
+			return
+		}
+		if err = rp.AppendHistory(ctx, e.HistoryEntry()); err != nil {
+			return
+		}
+	}
+
+	sv = &VehicleDefault{
+		rp:  &vehicleSnapshot{source: rp, at: t},
+		now: s.now,
+	}
+	return
+}
+
+// Rebuild is a method that rebuilds the read model from the events
+// - the events are replayed aside and the result replaces the read model at once (see VehicleRepository.Replace),
+// reads during the rebuild see the read model as it was before
+// - a failed or canceled rebuild leaves the read model as it was
+// - an empty store is first seeded with a VehicleRegistered event per vehicle of the read model,
+// so an existing dataset becomes the first events
+func (s *VehicleEventSourced) Rebuild(ctx context.Context) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events, err := s.es.FindAllEvents(ctx)
+	if err != nil {
+		return
+	}
+	logger := internal.LoggerFromContext(ctx)
+	if len(events) == 0 {
+		if events, err = s.seed(ctx); err != nil {
+			return
+		}
+		logger.Info("event store seeded from the read model", slog.Int("events", len(events)))
+	}
+
+	// - replay the events aside and swap the result in
+	v := internal.ReplayVehicleEvents(events)
+	if err = s.rp.Replace(ctx, v); err != nil {
+		return
+	}
+	logger.Info("read model rebuilt", slog.Int("events", len(events)), slog.Int("vehicles", len(v)))
+	return
+}
+
+// seed is a method that registers the vehicles of the read model at their versions, in order of id
+// - the events are appended as a single batch, a crash while seeding leaves the event store empty and not partial
+func (s *VehicleEventSourced) seed(ctx context.Context) (events []internal.VehicleEvent, err error) {
+	v, err := s.rp.FindAll(ctx)
+	if err != nil {
+		return
+	}
+	ids := make([]int, 0, len(v))
+	for id := range v {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	timestamp := s.now().UTC()
+	events = make([]internal.VehicleEvent, 0, len(ids))
+	for _, id := range ids {
+		events = append(events, internal.VehicleEvent{
+			VehicleId: id,
+			Version:   max(v[id].Version, 1),
+			Type:      internal.VehicleRegistered,
+			Timestamp: timestamp,
+			Actor:     seedActor,
+			Changes:   internal.DiffVehicleAttributes(internal.VehicleAttributes{}, v[id].VehicleAttributes),
+		})
+	}
+	if err = s.es.AppendBatch(ctx, events); err != nil {
+		events = nil
+	}
+	return
+}
+
+// state is a method that returns the current state of a vehicle replaying its events, the zero vehicle if it does not exist
+// - last is the version of its last event, also for a retired vehicle, 0 if it has none
+func (s *VehicleEventSourced) state(ctx context.Context, id int) (v internal.Vehicle, last int, err error) {
+	events, err := s.es.FindEvents(ctx, id)
+	if err != nil {
+		return
+	}
+	v = internal.ReplayVehicleEvents(events)[id]
+	if len(events) > 0 {
+		last = events[len(events)-1].Version
+	}
+	return
+}
+
+// current is a method that returns the current state of a vehicle if it is at the version
+func (s *VehicleEventSourced) current(ctx context.Context, id int, version int) (v internal.Vehicle, err error) {
+	if v, _, err = s.state(ctx, id); err != nil {
+		return
+	}
+	switch {
+	case v.Version == 0:
+		err = internal.ErrVehicleNotFound
+	case v.Version != version:
+		err = fmt.Errorf("%w: expected %d, stored %d", internal.ErrVehicleVersionMismatch, version, v.Version)
+	}
+	return
+}
+
+// apply is a method that appends an event of the actor of ctx to the store and projects it into the read model
+func (s *VehicleEventSourced) apply(ctx context.Context, e *internal.VehicleEvent) (err error) {
+	s.stamp(ctx, e)
+	if err = s.es.Append(ctx, e); err != nil {
+		return
+	}
+	err = s.project(ctx, *e)
+	return
+}
+
+// stamp is a method that sets the timestamp of an event and the actor of ctx as its actor
+func (s *VehicleEventSourced) stamp(ctx context.Context, e *internal.VehicleEvent) {
+	e.Timestamp = s.now().UTC()
+	e.Actor = internal.ActorFromContext(ctx)
+}
+
+// project is a method that projects an appended event into the read model
+// - a failed projection leaves the read model behind the events until it is rebuilt
+func (s *VehicleEventSourced) project(ctx context.Context, e internal.VehicleEvent) (err error) {
+	logger := internal.LoggerFromContext(ctx).With(
+		slog.Int64("sequence", e.Sequence),
+		slog.Int("vehicle_id", e.VehicleId),
+		slog.Int("version", e.Version),
+		slog.String("type", string(e.Type)),
+		slog.String("actor", e.Actor),
+	)
+	if err = projectVehicleEvent(ctx, s.rp, e); err != nil {
+		err = fmt.Errorf("projecting event %d: %w", e.Sequence, err)
+		logger.Error("read model behind the events, rebuild it", slog.Any("error", err))
+		return
+	}
+	logger.Info("vehicle event appended")
+	return
+}
+
+// projectVehicleEvent is a function that applies an event to a read model
+// - replaying every event into an empty read model reproduces the vehicles and their versions
+func projectVehicleEvent(ctx context.Context, rp internal.VehicleRepository, e internal.VehicleEvent) (err error) {
+	switch e.Type {
+	case internal.VehicleRegistered:
+		v := internal.Vehicle{Id: e.VehicleId, VehicleAttributes: internal.ApplyVehicleAttributes(internal.VehicleAttributes{}, e.Changes)}
+		err = rp.Save(ctx, &v)
+	case internal.VehicleAttributesChanged:
+		var v internal.Vehicle
+		if v, err = rp.FindById(ctx, e.VehicleId); err != nil {
+			return
+		}
+		v.VehicleAttributes = internal.ApplyVehicleAttributes(v.VehicleAttributes, e.Changes)
+		err = rp.Update(ctx, &v, e.Version-1)
+	case internal.VehicleRetired:
+		err = rp.Delete(ctx, e.VehicleId, e.Version)
+	default:
+		err = fmt.Errorf("%w: %q", internal.ErrVehicleEventUnknown, e.Type)
+	}
+	return
+}
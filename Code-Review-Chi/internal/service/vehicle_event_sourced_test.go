@@ -0,0 +1,241 @@
+package service_test
+
+import (
+	"app/internal"
+	"app/internal/repository"
+	"app/internal/repository/repositorytest"
+	"app/internal/service"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// operations is a struct that records the operations of an observed repository
+type operations struct {
+	// mu guards ops
+	mu sync.Mutex
+	// ops are the names of the operations in the order they were made
+	ops []string
+}
+
+// observe is a method that records an operation
+func (o *operations) observe(op string, d time.Duration, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.ops = append(o.ops, op)
+}
+
+// Tests for the writes of VehicleEventSourced
+func TestVehicleEventSourced_Write(t *testing.T) {
+	t.Run("case 1: should append an event per write and project it into the read model", func(t *testing.T) {
+		// arrange
+		es := repository.NewVehicleEventLog()
+		rp := repository.NewVehicleMap(nil)
+		sv := service.NewVehicleEventSourced(es, rp)
+		vehicle := repositorytest.NewVehicle(7, "Fiat", "Green", 2018, 4, 150, "gasoline", "manual", 1000, 130, 165)
+
+		// act
+		errSave := sv.Save(actor(), &vehicle)
+		vehicle.Color = "Blue"
+		errUpdate := sv.Update(actor(), &vehicle, 1)
+
+		// assert
+		require.NoError(t, errSave)
+		require.NoError(t, errUpdate)
+		require.Equal(t, 2, vehicle.Version)
+		v, err := rp.FindById(context.Background(), 7)
+		require.NoError(t, err)
+		require.Equal(t, vehicle, v)
+		events, err := es.FindEvents(context.Background(), 7)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		require.Equal(t, internal.VehicleRegistered, events[0].Type)
+		require.Equal(t, internal.VehicleAttributesChanged, events[1].Type)
+		require.Equal(t, []internal.FieldChange{{Field: "color", Old: "Green", New: "Blue"}}, events[1].Changes)
+		require.Equal(t, "alice", events[1].Actor)
+	})
+
+	t.Run("case 2: should retire a vehicle at its version and refuse stale writes", func(t *testing.T) {
+		// arrange
+		es := repository.NewVehicleEventLog()
+		rp := repository.NewVehicleMap(nil)
+		sv := service.NewVehicleEventSourced(es, rp)
+		vehicle := repositorytest.NewVehicle(7, "Fiat", "Green", 2018, 4, 150, "gasoline", "manual", 1000, 130, 165)
+		require.NoError(t, sv.Save(actor(), &vehicle))
+
+		// act
+		errStale := sv.Delete(actor(), 7, 2)
+		errDelete := sv.Delete(actor(), 7, 1)
+		errMissing := sv.Update(actor(), &vehicle, 1)
+
+		// assert
+		require.ErrorIs(t, errStale, internal.ErrVehicleVersionMismatch)
+		require.NoError(t, errDelete)
+		require.ErrorIs(t, errMissing, internal.ErrVehicleNotFound)
+		_, err := rp.FindById(context.Background(), 7)
+		require.ErrorIs(t, err, internal.ErrVehicleNotFound)
+		h, err := sv.FindHistory(context.Background(), 7)
+		require.NoError(t, err)
+		require.Len(t, h, 2)
+		require.Equal(t, internal.VehicleOperationDelete, h[1].Operation)
+		require.Equal(t, 1, h[1].Version)
+	})
+
+	t.Run("case 3: should create a vehicle only if it does not exist, after the last version of a retired one", func(t *testing.T) {
+		// arrange
+		es := repository.NewVehicleEventLog()
+		rp := repository.NewVehicleMap(nil)
+		sv := service.NewVehicleEventSourced(es, rp)
+		vehicle := repositorytest.NewVehicle(7, "Fiat", "Green", 2018, 4, 150, "gasoline", "manual", 1000, 130, 165)
+		require.NoError(t, sv.Create(actor(), &vehicle))
+
+		// act
+		errExists := sv.Create(actor(), &vehicle)
+		require.NoError(t, sv.Delete(actor(), 7, 1))
+		errCreate := sv.Create(actor(), &vehicle)
+
+		// assert
+		require.ErrorIs(t, errExists, internal.ErrVehicleExists)
+		require.NoError(t, errCreate)
+		require.Equal(t, 2, vehicle.Version)
+		v, err := rp.FindById(context.Background(), 7)
+		require.NoError(t, err)
+		require.Equal(t, vehicle, v)
+	})
+}
+
+// Tests for VehicleEventSourced.AsOf
+func TestVehicleEventSourced_AsOf(t *testing.T) {
+	t.Run("case 1: should return the vehicles as they were replaying the events up to the instant", func(t *testing.T) {
+		// arrange
+		es := repository.NewVehicleEventLog()
+		sv := service.NewVehicleEventSourced(es, repository.NewVehicleMap(nil))
+		vehicle := repositorytest.NewVehicle(7, "Fiat", "Green", 2018, 4, 150, "gasoline", "manual", 1000, 130, 165)
+		require.NoError(t, sv.Save(actor(), &vehicle))
+		before := vehicle
+		at := time.Now().UTC()
+		time.Sleep(time.Millisecond)
+		vehicle.Color = "Blue"
+		require.NoError(t, sv.Update(actor(), &vehicle, 1))
+		other := repositorytest.NewVehicle(8, "Seat", "Red", 2019, 5, 160, "diesel", "manual", 1100, 140, 170)
+		require.NoError(t, sv.Save(actor(), &other))
+
+		// act
+		view, err := sv.AsOf(context.Background(), at)
+
+		// assert
+		require.NoError(t, err)
+		v, err := view.FindAll(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, map[int]internal.Vehicle{7: before}, v)
+		h, err := view.FindHistory(context.Background(), 7)
+		require.NoError(t, err)
+		require.Len(t, h, 1)
+		require.ErrorIs(t, view.Save(actor(), &other), internal.ErrVehicleReadOnly)
+	})
+}
+
+// Tests for VehicleEventSourced.Rebuild
+func TestVehicleEventSourced_Rebuild(t *testing.T) {
+	t.Run("case 1: should seed an empty store with the vehicles of the read model", func(t *testing.T) {
+		// arrange
+		es := repository.NewVehicleEventLog()
+		rp := repository.NewVehicleMap(repositorytest.Fixture())
+		sv := service.NewVehicleEventSourced(es, rp)
+
+		// act
+		err := sv.Rebuild(context.Background())
+
+		// assert
+		require.NoError(t, err)
+		events, err := es.FindAllEvents(context.Background())
+		require.NoError(t, err)
+		require.Len(t, events, len(repositorytest.Fixture()))
+		require.Equal(t, repositorytest.Fixture(), internal.ReplayVehicleEvents(events))
+		v, err := rp.FindAll(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, repositorytest.Fixture(), v)
+	})
+
+	t.Run("case 2: should swap the replayed vehicles into the read model without emptying it first", func(t *testing.T) {
+		// arrange
+		es := repository.NewVehicleEventLog()
+		writer := service.NewVehicleEventSourced(es, repository.NewVehicleMap(nil))
+		vehicle := repositorytest.NewVehicle(7, "Fiat", "Green", 2018, 4, 150, "gasoline", "manual", 1000, 130, 165)
+		require.NoError(t, writer.Save(actor(), &vehicle))
+		vehicle.Color = "Blue"
+		require.NoError(t, writer.Update(actor(), &vehicle, 1))
+		// - a read model that is behind the events and has a vehicle they do not have
+		ops := &operations{}
+		rp := repository.NewVehicleMap(repositorytest.Fixture())
+		sv := service.NewVehicleEventSourced(es, repository.NewVehicleObserved(rp, ops.observe))
+
+		// act
+		err := sv.Rebuild(context.Background())
+
+		// assert
+		require.NoError(t, err)
+		v, err := rp.FindAll(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, map[int]internal.Vehicle{7: vehicle}, v)
+		require.Equal(t, []string{"replace"}, ops.ops)
+	})
+
+	t.Run("case 3: should leave the read model as it was if the rebuild is canceled", func(t *testing.T) {
+		// arrange
+		es := repository.NewVehicleEventLog()
+		writer := service.NewVehicleEventSourced(es, repository.NewVehicleMap(nil))
+		vehicle := repositorytest.NewVehicle(7, "Fiat", "Green", 2018, 4, 150, "gasoline", "manual", 1000, 130, 165)
+		require.NoError(t, writer.Save(actor(), &vehicle))
+		rp := repository.NewVehicleMap(repositorytest.Fixture())
+		sv := service.NewVehicleEventSourced(es, rp)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// act
+		err := sv.Rebuild(ctx)
+
+		// assert
+		require.ErrorIs(t, err, context.Canceled)
+		v, err := rp.FindAll(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, repositorytest.Fixture(), v)
+	})
+
+	t.Run("case 4: should seed the vehicles at their versions in a single batch", func(t *testing.T) {
+		// arrange
+		path := filepath.Join(t.TempDir(), "vehicles.events.jsonl")
+		es, err := repository.OpenVehicleEventLog(path)
+		require.NoError(t, err)
+		defer es.Close()
+		rp := repository.NewVehicleMap(repositorytest.Fixture())
+		vehicle := repositorytest.Fixture()[1]
+		for _, color := range []string{"Blue", "Green"} {
+			vehicle.Color = color
+			require.NoError(t, rp.Save(context.Background(), &vehicle))
+		}
+		sv := service.NewVehicleEventSourced(es, rp)
+
+		// act
+		err = sv.Rebuild(context.Background())
+
+		// assert
+		require.NoError(t, err)
+		events, err := es.FindEvents(context.Background(), 1)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		require.Equal(t, 3, events[0].Version)
+		v, err := sv.FindById(context.Background(), 1)
+		require.NoError(t, err)
+		require.Equal(t, vehicle, v)
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, 1, bytes.Count(data, []byte("\n")))
+	})
+}
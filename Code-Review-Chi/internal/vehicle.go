@@ -42,6 +42,8 @@ type VehicleAttributes struct {
 type Vehicle struct {
 	// Id is the unique identifier of the vehicle
 	Id int
+	// Version is the version of the stored vehicle, it starts at 1 and is incremented on every write
+	Version int
 
 	// VehicleAttribue is the attributes of a vehicle
 	VehicleAttributes
@@ -52,4 +54,8 @@ var (
 	ErrVehicleNotFound     = errors.New("vehicle not found")
 	ErrVehicleExists       = errors.New("vehicle already exists")
 	ErrVehicleInvalidField = errors.New("vehicle invalid field")
+	// ErrVehicleVersionMismatch is returned when a write expects a version that is not the stored one
+	ErrVehicleVersionMismatch = errors.New("vehicle version mismatch")
+	// ErrVehicleReadOnly is returned when writing to a read-only view of the vehicles (e.g. a point in time)
+	ErrVehicleReadOnly = errors.New("vehicle read only")
 )
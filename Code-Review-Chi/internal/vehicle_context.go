@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"context"
+	"log/slog"
+)
+
+// contextKey is the type of the keys of the values of a context set by this package
+type contextKey int
+
+const (
+	// actorKey is the key of the actor of a context
+	actorKey contextKey = iota
+	// requestIDKey is the key of the request ID of a context
+	requestIDKey
+	// loggerKey is the key of the logger of a context
+	loggerKey
+)
+
+// ContextWithActor is a function that returns a copy of ctx with the actor of the writes made with it
+func ContextWithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// ActorFromContext is a function that returns the actor of ctx, empty if it has none
+func ActorFromContext(ctx context.Context) (actor string) {
+	actor, _ = ctx.Value(actorKey).(string)
+	return
+}
+
+// ContextWithRequestID is a function that returns a copy of ctx with the ID of the request it belongs to
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestIDFromContext is a function that returns the request ID of ctx, empty if it has none
+func RequestIDFromContext(ctx context.Context) (id string) {
+	id, _ = ctx.Value(requestIDKey).(string)
+	return
+}
+
+// ContextWithLogger is a function that returns a copy of ctx with the logger of the work made with it
+// - the logger usually carries request-scoped attributes such as the request ID
+func ContextWithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// LoggerFromContext is a function that returns the logger of ctx, slog.Default() if it has none
+func LoggerFromContext(ctx context.Context) (logger *slog.Logger) {
+	logger, ok := ctx.Value(loggerKey).(*slog.Logger)
+	if !ok {
+		logger = slog.Default()
+	}
+	return
+}
\ No newline at end of file
@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// FieldChange is a struct that represents the change of a field of a vehicle
+type FieldChange struct {
+	// Field is the name of the field
+	Field string `json:"field"`
+	// Old is the value before the change
+	Old any `json:"old"`
+	// New is the value after the change
+	New any `json:"new"`
+}
+
+// UnmarshalJSON is a method that decodes a change restoring the type of the values of the field
+// - e.g. the year is decoded as an int and not as a float64
+func (c *FieldChange) UnmarshalJSON(data []byte) (err error) {
+	var raw struct {
+		Field string          `json:"field"`
+		Old   json.RawMessage `json:"old"`
+		New   json.RawMessage `json:"new"`
+	}
+	if err = json.Unmarshal(data, &raw); err != nil {
+		return
+	}
+	c.Field = raw.Field
+
+	// - type of the field, unknown fields keep the generic types
+	var zero VehicleAttributes
+	rt := reflect.TypeOf((*any)(nil)).Elem()
+	for _, field := range vehicleFields {
+		if field.name == raw.Field {
+			rt = reflect.TypeOf(field.get(&zero))
+			break
+		}
+	}
+
+	old, updated := reflect.New(rt), reflect.New(rt)
+	if len(raw.Old) > 0 {
+		if err = json.Unmarshal(raw.Old, old.Interface()); err != nil {
+			return
+		}
+	}
+	if len(raw.New) > 0 {
+		if err = json.Unmarshal(raw.New, updated.Interface()); err != nil {
+			return
+		}
+	}
+	c.Old, c.New = old.Elem().Interface(), updated.Elem().Interface()
+	return
+}
+
+// vehicleField is a struct that represents a field of the vehicle attributes
+type vehicleField struct {
+	// name is the name of the field
+	name string
+	// get is the function that returns the value of the field
+	get func(a *VehicleAttributes) any
+	// set is the function that sets the value of the field, values of another type set the zero value
+	set func(a *VehicleAttributes, value any)
+}
+
+// vehicleFields are the fields of the vehicle attributes, named as in the vehicle datasets
+var vehicleFields = []vehicleField{
+	{name: "brand", get: func(a *VehicleAttributes) any { return a.Brand }, set: func(a *VehicleAttributes, v any) { a.Brand, _ = v.(string) }},
+	{name: "model", get: func(a *VehicleAttributes) any { return a.Model }, set: func(a *VehicleAttributes, v any) { a.Model, _ = v.(string) }},
+	{name: "registration", get: func(a *VehicleAttributes) any { return a.Registration }, set: func(a *VehicleAttributes, v any) { a.Registration, _ = v.(string) }},
+	{name: "color", get: func(a *VehicleAttributes) any { return a.Color }, set: func(a *VehicleAttributes, v any) { a.Color, _ = v.(string) }},
+	{name: "year", get: func(a *VehicleAttributes) any { return a.FabricationYear }, set: func(a *VehicleAttributes, v any) { a.FabricationYear, _ = v.(int) }},
+	{name: "passengers", get: func(a *VehicleAttributes) any { return a.Capacity }, set: func(a *VehicleAttributes, v any) { a.Capacity, _ = v.(int) }},
+	{name: "max_speed", get: func(a *VehicleAttributes) any { return a.MaxSpeed }, set: func(a *VehicleAttributes, v any) { a.MaxSpeed, _ = v.(float64) }},
+	{name: "fuel_type", get: func(a *VehicleAttributes) any { return a.FuelType }, set: func(a *VehicleAttributes, v any) { a.FuelType, _ = v.(string) }},
+	{name: "transmission", get: func(a *VehicleAttributes) any { return a.Transmission }, set: func(a *VehicleAttributes, v any) { a.Transmission, _ = v.(string) }},
+	{name: "weight", get: func(a *VehicleAttributes) any { return a.Weight }, set: func(a *VehicleAttributes, v any) { a.Weight, _ = v.(float64) }},
+	{name: "height", get: func(a *VehicleAttributes) any { return a.Height }, set: func(a *VehicleAttributes, v any) { a.Height, _ = v.(float64) }},
+	{name: "length", get: func(a *VehicleAttributes) any { return a.Length }, set: func(a *VehicleAttributes, v any) { a.Length, _ = v.(float64) }},
+	{name: "width", get: func(a *VehicleAttributes) any { return a.Width }, set: func(a *VehicleAttributes, v any) { a.Width, _ = v.(float64) }},
+}
+
+// DiffVehicleAttributes is a function that returns the fields that differ between two versions of the attributes of a vehicle
+func DiffVehicleAttributes(before, after VehicleAttributes) (changes []FieldChange) {
+	for _, field := range vehicleFields {
+		oldValue, newValue := field.get(&before), field.get(&after)
+		if oldValue != newValue {
+			changes = append(changes, FieldChange{Field: field.name, Old: oldValue, New: newValue})
+		}
+	}
+	return
+}
+
+// ApplyVehicleAttributes is a function that returns the attributes after a list of changes, setting the new values
+func ApplyVehicleAttributes(a VehicleAttributes, changes []FieldChange) VehicleAttributes {
+	return setVehicleAttributes(a, changes, func(c FieldChange) any { return c.New })
+}
+
+// RevertVehicleAttributes is a function that returns the attributes before a list of changes, setting the old values
+func RevertVehicleAttributes(a VehicleAttributes, changes []FieldChange) VehicleAttributes {
+	return setVehicleAttributes(a, changes, func(c FieldChange) any { return c.Old })
+}
+
+// setVehicleAttributes is a function that sets the fields of a list of changes to the value chosen by value
+func setVehicleAttributes(a VehicleAttributes, changes []FieldChange, value func(c FieldChange) any) VehicleAttributes {
+	for _, change := range changes {
+		for _, field := range vehicleFields {
+			if field.name == change.Field {
+				field.set(&a, value(change))
+				break
+			}
+		}
+	}
+	return a
+}
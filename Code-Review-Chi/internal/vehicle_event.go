@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// VehicleEventType is the type of an event of a vehicle
+type VehicleEventType string
+
+const (
+	// VehicleRegistered is the event of a vehicle added to the fleet, its changes are from the zero attributes
+	VehicleRegistered VehicleEventType = "VehicleRegistered"
+	// VehicleAttributesChanged is the event of attributes of a vehicle changed
+	VehicleAttributesChanged VehicleEventType = "VehicleAttributesChanged"
+	// VehicleRetired is the event of a vehicle removed from the fleet, its changes are to the zero attributes
+	VehicleRetired VehicleEventType = "VehicleRetired"
+)
+
+var (
+	// ErrVehicleEventUnknown is returned when an event has an unknown type
+	ErrVehicleEventUnknown = errors.New("vehicle event unknown")
+)
+
+// VehicleEvent is a struct that represents a fact about a vehicle, the state of the vehicles is the replay of its events
+type VehicleEvent struct {
+	// Sequence is the position of the event in the store, set when it is appended
+	Sequence int64 `json:"sequence"`
+	// VehicleId is the id of the vehicle
+	VehicleId int `json:"vehicle_id"`
+	// Version is the version of the vehicle after the event (the retired version for VehicleRetired)
+	Version int `json:"version"`
+	// Type is the type of the event
+	Type VehicleEventType `json:"type"`
+	// Timestamp is the time of the event
+	Timestamp time.Time `json:"timestamp"`
+	// Actor is who caused the event
+	Actor string `json:"actor"`
+	// Changes are the attributes that changed
+	Changes []FieldChange `json:"changes"`
+}
+
+// HistoryEntry is a method that returns the entry of the history of the vehicle of the event
+func (e VehicleEvent) HistoryEntry() VehicleHistoryEntry {
+	operation := map[VehicleEventType]VehicleOperation{
+		VehicleRegistered:        VehicleOperationCreate,
+		VehicleAttributesChanged: VehicleOperationUpdate,
+		VehicleRetired:           VehicleOperationDelete,
+	}[e.Type]
+	return VehicleHistoryEntry{
+		VehicleId: e.VehicleId,
+		Version:   e.Version,
+		Timestamp: e.Timestamp,
+		Actor:     e.Actor,
+		Operation: operation,
+		Changes:   e.Changes,
+	}
+}
+
+// CheckVehicleEvent is a function that returns an error unless e may follow last, the last event of its vehicle
+// - last is the zero event if the vehicle has no events
+// - a vehicle registered again after it is retired continues from the retired version, a version is never reused
+// - the first event of a vehicle may start at any version, e.g. the events seeded from a read model keep its versions
+func CheckVehicleEvent(last VehicleEvent, e VehicleEvent) (err error) {
+	current := last.Version
+	if last.Type == VehicleRetired {
+		current = 0
+	}
+	switch e.Type {
+	case VehicleRegistered:
+		if current != 0 {
+			return ErrVehicleExists
+		}
+		if e.Version != last.Version+1 && (last.Version != 0 || e.Version < 1) {
+			return ErrVehicleVersionMismatch
+		}
+	case VehicleAttributesChanged:
+		if current == 0 {
+			return ErrVehicleNotFound
+		}
+		if e.Version != current+1 {
+			return ErrVehicleVersionMismatch
+		}
+	case VehicleRetired:
+		if current == 0 {
+			return ErrVehicleNotFound
+		}
+		if e.Version != current {
+			return ErrVehicleVersionMismatch
+		}
+	default:
+		return fmt.Errorf("%w: %q", ErrVehicleEventUnknown, e.Type)
+	}
+	return
+}
+
+// ApplyVehicleEvent is a function that applies an event to the vehicles
+// - the event is expected to be valid for the vehicles (see CheckVehicleEvent)
+func ApplyVehicleEvent(v map[int]Vehicle, e VehicleEvent) {
+	switch e.Type {
+	case VehicleRegistered:
+		v[e.VehicleId] = Vehicle{
+			Id:                e.VehicleId,
+			Version:           e.Version,
+			VehicleAttributes: ApplyVehicleAttributes(VehicleAttributes{}, e.Changes),
+		}
+	case VehicleAttributesChanged:
+		vh := v[e.VehicleId]
+		vh.Version = e.Version
+		vh.VehicleAttributes = ApplyVehicleAttributes(vh.VehicleAttributes, e.Changes)
+		v[e.VehicleId] = vh
+	case VehicleRetired:
+		delete(v, e.VehicleId)
+	}
+}
+
+// ReplayVehicleEvents is a function that returns the vehicles resulting from a list of events, in the order they were appended
+func ReplayVehicleEvents(events []VehicleEvent) (v map[int]Vehicle) {
+	v = make(map[int]Vehicle)
+	for _, e := range events {
+		ApplyVehicleEvent(v, e)
+	}
+	return
+}
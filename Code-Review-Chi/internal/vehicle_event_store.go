@@ -0,0 +1,21 @@
+package internal
+
+import "context"
+
+// VehicleEventStore is an interface that represents an append-only store of the events of the vehicles
+type VehicleEventStore interface {
+	// Append is a method that appends an event, setting its sequence
+	// - it returns the error of CheckVehicleEvent against the last event of the vehicle
+	Append(ctx context.Context, e *VehicleEvent) (err error)
+
+	// AppendBatch is a method that appends the events in order atomically, every event is appended or none
+	// - each event is checked against the last event of its vehicle, which may be an earlier event of the batch
+	// - the sequences of the events are set only if the batch is appended
+	AppendBatch(ctx context.Context, events []VehicleEvent) (err error)
+
+	// FindEvents is a method that returns the events of a vehicle in the order they were appended
+	FindEvents(ctx context.Context, id int) (events []VehicleEvent, err error)
+
+	// FindAllEvents is a method that returns every event in the order they were appended
+	FindAllEvents(ctx context.Context) (events []VehicleEvent, err error)
+}
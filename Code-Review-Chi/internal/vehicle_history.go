@@ -0,0 +1,31 @@
+package internal
+
+import "time"
+
+// VehicleOperation is the operation of a write on a vehicle
+type VehicleOperation string
+
+const (
+	// VehicleOperationCreate is the operation of a vehicle saved for the first time
+	VehicleOperationCreate VehicleOperation = "create"
+	// VehicleOperationUpdate is the operation of a vehicle saved over an existing one
+	VehicleOperationUpdate VehicleOperation = "update"
+	// VehicleOperationDelete is the operation of a vehicle deleted
+	VehicleOperationDelete VehicleOperation = "delete"
+)
+
+// VehicleHistoryEntry is a struct that represents a write on a vehicle
+type VehicleHistoryEntry struct {
+	// VehicleId is the id of the vehicle
+	VehicleId int `json:"vehicle_id"`
+	// Version is the version of the vehicle written (the deleted version for deletes)
+	Version int `json:"version"`
+	// Timestamp is the time of the write
+	Timestamp time.Time `json:"timestamp"`
+	// Actor is who made the write
+	Actor string `json:"actor"`
+	// Operation is the operation of the write
+	Operation VehicleOperation `json:"operation"`
+	// Changes are the attributes that changed, from and to the zero attributes for creates and deletes
+	Changes []FieldChange `json:"changes"`
+}
@@ -1,34 +1,105 @@
 package internal
 
+import (
+	"context"
+	"time"
+)
+
 // VehicleRepository is an interface that represents a vehicle repository
+// - every method takes the context of the request, long scans and I/O stop with the error of ctx once it is done
 type VehicleRepository interface {
 	// FindAll is a method that returns a map of all vehicles
-	FindAll() (v map[int]Vehicle, err error)
+	FindAll(ctx context.Context) (v map[int]Vehicle, err error)
+
+	// FindById is a method that returns a vehicle by id, ErrVehicleNotFound if it does not exist
+	FindById(ctx context.Context, id int) (v Vehicle, err error)
 
 	// FindByColorYear is a method that returns a map of vehicles by color and year
-	FindByColorYear(color string, year int) (v map[int]Vehicle, err error)
+	FindByColorYear(ctx context.Context, color string, year int) (v map[int]Vehicle, err error)
 
 	// FindByBrandYearRange is a method that returns a map of vehicles by brand and year range
-	FindByBrandYearRange(brand string, startYear, endYear int) (v map[int]Vehicle, err error)
+	FindByBrandYearRange(ctx context.Context, brand string, startYear, endYear int) (v map[int]Vehicle, err error)
 
 	// FindByBrandAverageSpeed is a method that returns the average speed of vehicles by brand
-	FindByBrandAverageSpeed(brand string) (avg float64, err error)
+	FindByBrandAverageSpeed(ctx context.Context, brand string) (avg float64, err error)
 
 	// FindByFuelType is a method that returns a map of vehicles by fuel type
-	FindByFuelType(fuelType string) (v map[int]Vehicle, err error)
+	FindByFuelType(ctx context.Context, fuelType string) (v map[int]Vehicle, err error)
 
 	// FindByTransmissionType is a method that returns a map of vehicles by transmission type
-	FindByTransmissionType(transmissionType string) (v map[int]Vehicle, err error)
+	FindByTransmissionType(ctx context.Context, transmissionType string) (v map[int]Vehicle, err error)
 
 	// FindByBrandAverageCapacity is a method that returns the average capacity of vehicles by brand
-	FindByBrandAverageCapacity(brand string) (avg float64, err error)
+	FindByBrandAverageCapacity(ctx context.Context, brand string) (avg float64, err error)
 
 	// FindByWeightRange (Query parameter: minWeight, maxWeight) is a method that returns a map of vehicles by weight range
-	FindByWeightRange(minWeight, maxWeight float64) (v map[int]Vehicle, err error)
+	FindByWeightRange(ctx context.Context, minWeight, maxWeight float64) (v map[int]Vehicle, err error)
 
 	// FindByDimensionRange (Query parameter: minHeight, maxHeight, minWidth, maxWidth) is a method that returns a map of vehicles by dimension range
-	FindByDimensionRange(minHeight, minWidth, maxHeight, maxWidth float64) (v map[int]Vehicle, err error)
+	FindByDimensionRange(ctx context.Context, minHeight, minWidth, maxHeight, maxWidth float64) (v map[int]Vehicle, err error)
+
+	// Save is a method that saves a vehicle, a vehicle with the same id is overwritten whatever its version
+	// - v.Version is set to the new version: the last version of the id plus one, 1 for an id never written
+	// - the last version of a deleted vehicle is kept, a vehicle saved again with its id never reuses a version
+	Save(ctx context.Context, v *Vehicle) (err error)
+
+	// Create is a method that saves a new vehicle, it returns ErrVehicleExists if a vehicle with the same id exists
+	// - the check and the write are atomic, of two concurrent creates of an id only one succeeds
+	// - v.Version is set to the new version (see Save)
+	Create(ctx context.Context, v *Vehicle) (err error)
+
+	// SaveBatch is a method that saves the vehicles of v in order (see Save) atomically, every vehicle is saved or none
+	// - v[i].Version is set to the new version of the vehicle, only if the batch is saved
+	SaveBatch(ctx context.Context, v []Vehicle) (err error)
+
+	// Update is a method that overwrites a vehicle if its stored version is version
+	// - it returns ErrVehicleNotFound if it does not exist and ErrVehicleVersionMismatch if the version is stale
+	// - v.Version is set to the new version
+	Update(ctx context.Context, v *Vehicle, version int) (err error)
+
+	// Delete is a method that deletes a vehicle if its stored version is version
+	// - it returns ErrVehicleNotFound if it does not exist and ErrVehicleVersionMismatch if the version is stale
+	Delete(ctx context.Context, id int, version int) (err error)
+
+	// Replace is a method that replaces every vehicle with the vehicles of v atomically, keeping their versions
+	// - the reads see either the vehicles before or after the replacement, never a mix of both
+	// - vehicles without a version are at their first version, the history is not changed
+	Replace(ctx context.Context, v map[int]Vehicle) (err error)
+
+	// AppendHistory is a method that records an entry of the history of a vehicle
+	AppendHistory(ctx context.Context, e VehicleHistoryEntry) (err error)
+
+	// FindHistory is a method that returns the history of a vehicle, oldest first, empty if it has none
+	FindHistory(ctx context.Context, id int) (h []VehicleHistoryEntry, err error)
+
+	// FindHistorySince is a method that returns the entries of every vehicle recorded after t
+	// - the entries of each vehicle are ordered oldest first
+	FindHistorySince(ctx context.Context, t time.Time) (h []VehicleHistoryEntry, err error)
+}
+
+// VehicleAuditedRepository is an interface that represents a repository that writes a vehicle and its history entry atomically
+// - either the write and its entry are both stored or none is, the service prefers it to a write followed by AppendHistory
+// - the version of the entry is set to the version written, or to the version deleted
+type VehicleAuditedRepository interface {
+	// SaveAudited is a method that saves a vehicle (see VehicleRepository.Save) and records the entry of its history
+	SaveAudited(ctx context.Context, v *Vehicle, e VehicleHistoryEntry) (err error)
+
+	// CreateAudited is a method that saves a new vehicle (see VehicleRepository.Create) and records the entry of its history
+	CreateAudited(ctx context.Context, v *Vehicle, e VehicleHistoryEntry) (err error)
+
+	// SaveBatchAudited is a method that saves the vehicles of v (see VehicleRepository.SaveBatch) and records e[i], the entry of v[i]
+	SaveBatchAudited(ctx context.Context, v []Vehicle, e []VehicleHistoryEntry) (err error)
+
+	// UpdateAudited is a method that overwrites a vehicle (see VehicleRepository.Update) and records the entry of its history
+	UpdateAudited(ctx context.Context, v *Vehicle, version int, e VehicleHistoryEntry) (err error)
+
+	// DeleteAudited is a method that deletes a vehicle (see VehicleRepository.Delete) and records the entry of its history
+	DeleteAudited(ctx context.Context, id int, version int, e VehicleHistoryEntry) (err error)
+}
 
-	// Save is a method that saves a vehicle
-	Save(v *Vehicle) (err error)
+// Pinger is an interface that represents a backend that can check it is reachable
+// - repositories that do not implement it live in memory and are always reachable
+type Pinger interface {
+	// Ping is a method that returns an error if the backend is not reachable
+	Ping(ctx context.Context) (err error)
 }
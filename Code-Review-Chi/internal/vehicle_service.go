@@ -1,34 +1,76 @@
 package internal
 
+import (
+	"context"
+	"time"
+)
+
 // VehicleService is an interface that represents a vehicle service
+// - every method takes the context of the request, it carries request-scoped values such as the actor
 type VehicleService interface {
 	// FindAll is a method that returns a map of all vehicles
-	FindAll() (v map[int]Vehicle, err error)
+	FindAll(ctx context.Context) (v map[int]Vehicle, err error)
+
+	// FindById is a method that returns a vehicle by id, ErrVehicleNotFound if it does not exist
+	FindById(ctx context.Context, id int) (v Vehicle, err error)
 
 	// FindByColorYear is a method that returns a map of vehicles by color and year
-	FindByColorYear(color string, year int) (v map[int]Vehicle, err error)
+	FindByColorYear(ctx context.Context, color string, year int) (v map[int]Vehicle, err error)
 
 	// FindByBrandYearRange is a method that returns a map of vehicles by brand and year range
-	FindByBrandYearRange(brand string, startYear, endYear int) (v map[int]Vehicle, err error)
+	FindByBrandYearRange(ctx context.Context, brand string, startYear, endYear int) (v map[int]Vehicle, err error)
 
 	// FindByBrandAverageSpeed is a method that returns the average speed of vehicles by brand
-	FindByBrandAverageSpeed(brand string) (avg float64, err error)
+	FindByBrandAverageSpeed(ctx context.Context, brand string) (avg float64, err error)
 
 	// FindByFuelType is a method that returns a map of vehicles by fuel type
-	FindByFuelType(fuelType string) (v map[int]Vehicle, err error)
+	FindByFuelType(ctx context.Context, fuelType string) (v map[int]Vehicle, err error)
 
 	// FindByTransmissionType is a method that returns a map of vehicles by transmission type
-	FindByTransmissionType(transmissionType string) (v map[int]Vehicle, err error)
+	FindByTransmissionType(ctx context.Context, transmissionType string) (v map[int]Vehicle, err error)
 
 	// FindByBrandAverageCapacity is a method that returns the average capacity of vehicles by brand
-	FindByBrandAverageCapacity(brand string) (avg float64, err error)
+	FindByBrandAverageCapacity(ctx context.Context, brand string) (avg float64, err error)
 
 	// FindByWeightRange is a method that returns a map of vehicles by weight range
-	FindByWeightRange(startWeight, endWeight float64) (v map[int]Vehicle, err error)
+	FindByWeightRange(ctx context.Context, startWeight, endWeight float64) (v map[int]Vehicle, err error)
 
 	// FindByDimensionRange is a method that returns a map of vehicles by dimension range
-	FindByDimensionRange(minHeight, minWidth, maxHeight, maxWidth float64) (v map[int]Vehicle, err error)
+	FindByDimensionRange(ctx context.Context, minHeight, minWidth, maxHeight, maxWidth float64) (v map[int]Vehicle, err error)
+
+	// Save is a method that saves a vehicle, a vehicle with the same id is overwritten whatever its version
+	// - the actor of ctx (see ContextWithActor) is who makes the write, it is recorded in the history of the vehicle
+	// - v.Version is set to the new version
+	Save(ctx context.Context, v *Vehicle) (err error)
+
+	// Create is a method that creates a new vehicle, it returns ErrVehicleExists if a vehicle with the same id exists
+	// - the check and the write are atomic (see VehicleRepository.Create)
+	// - v.Version is set to the new version
+	Create(ctx context.Context, v *Vehicle) (err error)
+
+	// SaveBatch is a method that saves the vehicles of v in order (see Save) atomically, every vehicle is saved or none
+	// - each vehicle saved is recorded in its history as Save does
+	// - v[i].Version is set to the new version of the vehicle
+	SaveBatch(ctx context.Context, v []Vehicle) (err error)
+
+	// SaveBatchVersioned is a method that saves the vehicles of v like SaveBatch if each one is still at its version of versions
+	// - versions[i] is the stored version v[i] replaces, 0 if the vehicle is expected not to exist
+	// - the check and the writes are atomic, it returns ErrVehicleVersionMismatch and saves none if a vehicle changed
+	SaveBatchVersioned(ctx context.Context, v []Vehicle, versions []int) (err error)
+
+	// Update is a method that overwrites a vehicle if its stored version is version
+	// - it returns ErrVehicleNotFound if it does not exist and ErrVehicleVersionMismatch if the version is stale
+	// - v.Version is set to the new version
+	Update(ctx context.Context, v *Vehicle, version int) (err error)
+
+	// Delete is a method that deletes a vehicle if its stored version is version
+	// - it returns ErrVehicleNotFound if it does not exist and ErrVehicleVersionMismatch if the version is stale
+	Delete(ctx context.Context, id int, version int) (err error)
+
+	// FindHistory is a method that returns the history of a vehicle, oldest first
+	FindHistory(ctx context.Context, id int) (h []VehicleHistoryEntry, err error)
 
-	// Save is a method that creates a new vehicle
-	Save(v *Vehicle) (err error)
+	// AsOf is a method that returns a read-only view of the vehicles as they were at t, reconstructed from the history
+	// - the writes of the view return ErrVehicleReadOnly
+	AsOf(ctx context.Context, t time.Time) (sv VehicleService, err error)
 }